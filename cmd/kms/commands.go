@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/audit"
+	"github.com/grafviktor/keep-my-secret/internal/backup"
+	"github.com/grafviktor/keep-my-secret/internal/breach"
+	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+	"github.com/grafviktor/keep-my-secret/internal/storage"
+)
+
+const usage = `Usage:
+  kms                                   start the server
+  kms breach import <source> [<corpus>] import HIBP-formatted breached password hashes.
+                                        If corpus path is not set, BREACH_CORPUS_PATH is used
+  kms backup [<dir>]                    create a database backup. If directory is not set, BACKUP_DIR is used
+  kms restore <backup>                  replace the database with the backup. The server must be stopped
+  kms audit verify                      check integrity of the audit log
+  kms admin promote <login>             make the user an administrator of the server
+  kms admin demote <login>              make the administrator a regular user, the user is signed out`
+
+var errUsage = errors.New(usage)
+
+// runCommand - runs an administrative command given in command line arguments. Returns false
+// if there is no command, which means that the server should be started.
+func runCommand(appConfig config.AppConfig, args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	switch {
+	case len(args) >= 3 && args[0] == "breach" && args[1] == "import":
+		return true, importBreachCorpus(appConfig, args[2:])
+	case len(args) <= 2 && args[0] == "backup":
+		return true, backupDatabase(appConfig, args[1:])
+	case len(args) == 2 && args[0] == "restore":
+		return true, restoreDatabase(appConfig, args[1])
+	case len(args) == 2 && args[0] == "audit" && args[1] == "verify":
+		return true, verifyAuditLog(appConfig)
+	case len(args) == 3 && args[0] == "admin" && args[1] == "promote":
+		return true, setUserRole(appConfig, args[2], model.UserRoleAdmin)
+	case len(args) == 3 && args[0] == "admin" && args[1] == "demote":
+		return true, setUserRole(appConfig, args[2], model.UserRoleUser)
+	default:
+		return true, errUsage
+	}
+}
+
+func importBreachCorpus(appConfig config.AppConfig, args []string) error {
+	source := args[0]
+	corpus := appConfig.BreachCorpusPath
+	if len(args) > 1 {
+		corpus = args[1]
+	}
+
+	if corpus == "" {
+		return errUsage
+	}
+
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	count, err := breach.Import(corpus, file)
+	if err != nil {
+		return fmt.Errorf("cannot import %s: %w", source, err)
+	}
+
+	log.Printf("Imported %d hashes into %s\n", count, corpus)
+
+	return nil
+}
+
+// backupDatabase - creates a backup of the database, the server may keep running
+func backupDatabase(appConfig config.AppConfig, args []string) error {
+	dir := appConfig.BackupDir
+	if len(args) > 0 {
+		dir = args[0]
+	}
+
+	if dir == "" {
+		return errUsage
+	}
+
+	ctx := context.Background()
+	dataStorage, err := storage.GetStorage(ctx, appConfig.StorageType, appConfig.DSN)
+	if err != nil {
+		return err
+	}
+	defer dataStorage.Close()
+
+	path, err := backup.NewManager(dataStorage, dir, appConfig.BackupKeep).Backup(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Database backup is saved to %s\n", path)
+
+	return nil
+}
+
+// restoreDatabase - replaces the database with the backup, the server must be stopped
+func restoreDatabase(appConfig config.AppConfig, backupPath string) error {
+	replacedPath, err := backup.Restore(context.Background(), backupPath, backup.DatabasePath(appConfig.DSN))
+	if err != nil {
+		return fmt.Errorf("cannot restore %s: %w", backupPath, err)
+	}
+
+	if replacedPath != "" {
+		log.Printf("Previous database is saved to %s\n", replacedPath)
+	}
+
+	log.Printf("Database is restored from %s\n", backupPath)
+
+	return nil
+}
+
+// verifyAuditLog - checks that events of the audit log were not modified or removed
+func verifyAuditLog(appConfig config.AppConfig) error {
+	ctx := context.Background()
+	dataStorage, err := storage.GetStorage(ctx, appConfig.StorageType, appConfig.DSN)
+	if err != nil {
+		return err
+	}
+	defer dataStorage.Close()
+
+	count, err := audit.Verify(ctx, dataStorage)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Audit log is intact, %d events are verified\n", count)
+
+	return nil
+}
+
+// setUserRole - changes the role of the user. The role is a claim of access tokens, so a demoted
+// administrator is signed out, otherwise the tokens would keep the role until they expire.
+func setUserRole(appConfig config.AppConfig, login, role string) error {
+	ctx := context.Background()
+	dataStorage, err := storage.GetStorage(ctx, appConfig.StorageType, appConfig.DSN)
+	if err != nil {
+		return err
+	}
+	defer dataStorage.Close()
+
+	if err = dataStorage.SetUserRole(ctx, login, role); err != nil {
+		return fmt.Errorf("cannot change role of %s: %w", login, err)
+	}
+
+	if role != model.UserRoleAdmin {
+		if err = dataStorage.RevokeUserSessions(ctx, login, time.Now()); err != nil {
+			return fmt.Errorf("cannot sign out %s: %w", login, err)
+		}
+	}
+
+	log.Printf("User %s is now %s\n", login, role)
+
+	return nil
+}
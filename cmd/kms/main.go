@@ -2,18 +2,24 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/caarlos0/env/v7"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/grafviktor/keep-my-secret/internal/api/web"
+	"github.com/grafviktor/keep-my-secret/internal/backup"
 	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/emergency"
+	"github.com/grafviktor/keep-my-secret/internal/reminder"
+	"github.com/grafviktor/keep-my-secret/internal/scheduler"
 	"github.com/grafviktor/keep-my-secret/internal/storage"
 	"github.com/grafviktor/keep-my-secret/internal/version"
 )
@@ -45,6 +51,23 @@ func main() {
 
 	appConfig := config.New(ec)
 
+	if isCommand, err := runCommand(appConfig, os.Args[1:]); isCommand {
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	services, err := web.NewServices(appConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if appConfig.Secret == config.DefaultSecret && !appConfig.DevMode {
+		log.Fatal("APP_SECRET must be changed, the default value is allowed only in dev mode")
+	}
+
 	appContext, cancel := context.WithCancel(context.Background())
 	go func() {
 		c := make(chan os.Signal, 1) // we need to reserve to buffer size 1, so the notifier are not blocked
@@ -59,7 +82,7 @@ func main() {
 		log.Fatal(err)
 	}
 
-	router := web.NewHTTPRouter(appConfig, dataStorage)
+	router := web.NewHTTPRouter(appConfig, dataStorage, services)
 	httpServer := http.Server{
 		Addr:    appConfig.ServerAddr,
 		Handler: router,
@@ -73,6 +96,51 @@ func main() {
 		return httpServer.ListenAndServeTLS(appConfig.HTTPSCertPath, appConfig.HTTPSKeyPath)
 	})
 
+	// Metrics are served by a separate server, so they are not exposed together with the API
+	metricsServer := http.Server{
+		Addr:    appConfig.MetricsAddr,
+		Handler: expvar.Handler(),
+	}
+	if appConfig.MetricsAddr != "" {
+		g.Go(func() error {
+			log.Printf("Metrics are available at http://%s\n", appConfig.MetricsAddr)
+
+			return metricsServer.ListenAndServe()
+		})
+	}
+
+	reminderChecker := reminder.NewChecker(dataStorage, reminder.NewNotifier(appConfig), appConfig.ReminderLeadTime)
+	g.Go(func() error {
+		return scheduler.Run(gCtx, "reminders", appConfig.ReminderInterval, reminderChecker.Check)
+	})
+
+	g.Go(func() error {
+		return scheduler.Run(gCtx, "sends", appConfig.SendCleanupInterval, func(ctx context.Context) error {
+			deleted, err := dataStorage.DeleteExpiredSends(ctx, time.Now())
+			if deleted > 0 {
+				log.Printf("Removed %d expired sends\n", deleted)
+			}
+
+			return err
+		})
+	})
+
+	emergencyApprover := emergency.NewApprover(dataStorage)
+	g.Go(func() error {
+		return scheduler.Run(gCtx, "emergency access", appConfig.EmergencyCheckInterval, emergencyApprover.Approve)
+	})
+
+	// Scheduled backups are disabled if the backup directory is not set
+	backupInterval := appConfig.BackupInterval
+	if appConfig.BackupDir == "" {
+		backupInterval = 0
+	}
+
+	backupManager := backup.NewManager(dataStorage, appConfig.BackupDir, appConfig.BackupKeep)
+	g.Go(func() error {
+		return scheduler.Run(gCtx, "backup", backupInterval, backupManager.Run)
+	})
+
 	g.Go(func() error {
 		<-gCtx.Done()
 
@@ -81,6 +149,8 @@ func main() {
 		dataStorage.Close()
 
 		log.Println("Shutting down web-server")
+		_ = metricsServer.Shutdown(appContext)
+
 		return httpServer.Shutdown(appContext)
 	})
 
@@ -4,7 +4,6 @@ package auth
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -25,6 +24,15 @@ const (
 	// siteMode     = http.SameSiteStrictMode
 	// Bypassing set cookie request in CORS connections. However, you also must be sure that cookie is "secure: true"
 	siteMode = http.SameSiteNoneMode
+
+	// DefaultTokenExpiry and DefaultRefreshExpiry - lifetimes of tokens if they are not configured
+	DefaultTokenExpiry   = time.Minute * 10
+	DefaultRefreshExpiry = time.Hour * 24
+)
+
+var (
+	errNoSigningKey       = errors.New("signing key is not loaded")
+	errNoVerificationKeys = errors.New("verification keys are not loaded")
 )
 
 // Auth - struct contains all necessary information for JWT token generation
@@ -33,8 +41,8 @@ type Auth struct {
 	Issuer string
 	// Audience of the token. See JWT.io for more information
 	Audience string
-	// Secret of the token. Self-explanatory.
-	Secret string
+	// Keys sign and verify tokens, nil if keys of the configuration cannot be loaded
+	Keys *KeySet
 	// TokenExpiry is duration of the access token
 	TokenExpiry time.Duration
 	// RefreshExpiry is duration of the refresh token
@@ -47,10 +55,12 @@ type Auth struct {
 	CookieName string
 }
 
-// JWTUser - struct for storing user details. Only ID for the moment
+// JWTUser - struct for storing user details
 type JWTUser struct {
 	// ID contains user login which was used during registration process
 	ID string `json:"id"`
+	// Role of the user on the server, it's put into access tokens only
+	Role string `json:"role"`
 }
 
 // TokenPair - struct is used for marshaling tokens
@@ -61,19 +71,40 @@ type TokenPair struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
-// Claims - is utilizing default jwt claims. A subject for further extension.
+// Claims - is utilizing default jwt claims, extended with the role of the user
 type Claims struct {
 	jwt.RegisteredClaims
+	Role string `json:"role,omitempty"`
 }
 
-// New - creates new Auth struct and with application defined values
-func New(ac config.AppConfig) Auth {
+// IssuedAtTime - returns the time when the token was issued, or zero time if the token doesn't tell it
+func (c *Claims) IssuedAtTime() time.Time {
+	if c.IssuedAt == nil {
+		return time.Time{}
+	}
+
+	return c.IssuedAt.Time
+}
+
+// New - creates new Auth struct and with application defined values. Keys are loaded with LoadKeySet
+// when the application starts.
+func New(ac config.AppConfig, keys *KeySet) Auth {
+	tokenExpiry := ac.AccessTokenTTL
+	if tokenExpiry <= 0 {
+		tokenExpiry = DefaultTokenExpiry
+	}
+
+	refreshExpiry := ac.RefreshTokenTTL
+	if refreshExpiry <= 0 {
+		refreshExpiry = DefaultRefreshExpiry
+	}
+
 	return Auth{
 		Issuer:        ac.JWTIssuer,
 		Audience:      ac.JWTAudience,
-		Secret:        ac.Secret,
-		TokenExpiry:   time.Minute * 10,
-		RefreshExpiry: time.Hour * 24,
+		Keys:          keys,
+		TokenExpiry:   tokenExpiry,
+		RefreshExpiry: refreshExpiry,
 		CookieDomain:  ac.CookieDomain,
 		CookiePath:    "/",
 		CookieName:    CookieName,
@@ -82,33 +113,37 @@ func New(ac config.AppConfig) Auth {
 
 // GenerateTokenPair - create new Refresh and Access tokens
 func (auth Auth) GenerateTokenPair(user *JWTUser) (TokenPair, error) { // pair for token and refresh token
-	// Create a token
-	token := jwt.New(jwt.SigningMethodHS256)
+	if auth.Keys == nil {
+		return TokenPair{}, errNoSigningKey
+	}
 
 	// Create a accessToken and set claims
-	claims := token.Claims.(jwt.MapClaims)
+	claims := jwt.MapClaims{}
 	claims["sub"] = user.ID       // id of the user in a database
 	claims["aud"] = auth.Audience // audience
 	claims["iss"] = auth.Issuer
 	claims["iat"] = time.Now().UTC().Unix()                       // issued at
 	claims["typ"] = "JWT"                                         // type
 	claims["exp"] = time.Now().UTC().Add(auth.TokenExpiry).Unix() // expiry
+	if user.Role != "" {
+		claims["role"] = user.Role
+	}
 
 	// Create a signed token
-	signedAccessToken, err := token.SignedString([]byte(auth.Secret))
+	signedAccessToken, err := auth.Keys.sign(claims)
 	if err != nil {
 		return TokenPair{}, err
 	}
 
 	// Create a refreshToken and set claims
-	refreshToken := jwt.New(jwt.SigningMethodHS256)
-	refreshTokenClaims := refreshToken.Claims.(jwt.MapClaims)
-	refreshTokenClaims["sub"] = user.ID                                         // id of the user in a database
+	refreshTokenClaims := jwt.MapClaims{}
+	refreshTokenClaims["sub"] = user.ID // id of the user in a database
+	refreshTokenClaims["iss"] = auth.Issuer
 	refreshTokenClaims["iat"] = time.Now().UTC().Unix()                         // issued at
 	refreshTokenClaims["exp"] = time.Now().UTC().Add(auth.RefreshExpiry).Unix() // expiry
 
 	// Create signed refresh token
-	signedRefreshToken, err := token.SignedString([]byte(auth.Secret))
+	signedRefreshToken, err := auth.Keys.sign(refreshTokenClaims)
 	if err != nil {
 		return TokenPair{}, err
 	}
@@ -153,7 +188,10 @@ func (auth Auth) GetExpiredRefreshCookie() *http.Cookie {
 }
 
 // JWTVerifier - used for verifying user tokens
-type JWTVerifier struct{}
+type JWTVerifier struct {
+	// Keys which are accepted
+	Keys *KeySet
+}
 
 // VerifyAuthHeader - extract users token from HTTP header and verifies it.
 //
@@ -172,26 +210,33 @@ func (t JWTVerifier) VerifyAuthHeader(config config.AppConfig, w http.ResponseWr
 		return "", nil, errors.New("invalid auth header")
 	}
 
+	if t.Keys == nil {
+		return "", nil, errNoVerificationKeys
+	}
+
 	token := headerParts[1]
 	claims := &Claims{}
-	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
-		}
-
-		return []byte(config.Secret), nil
-	})
+	_, err := jwt.ParseWithClaims(token, claims, t.Keys.Keyfunc)
 	if err != nil {
-		if strings.HasPrefix(err.Error(), "token is expired by") {
+		if errors.Is(err, jwt.ErrTokenExpired) {
 			return "", nil, errors.New("expired token")
 		}
 
 		return "", nil, err
 	}
 
-	if claims.Issuer != config.JWTIssuer {
+	// The parser checks expiration only if the claim is present, tokens without it would never expire
+	if claims.ExpiresAt == nil {
+		return "", nil, errors.New("missing expiration")
+	}
+
+	if !claims.VerifyIssuer(config.JWTIssuer, true) {
 		return "", nil, errors.New("invalid issuer")
 	}
 
+	if !claims.VerifyAudience(config.JWTAudience, true) {
+		return "", nil, errors.New("invalid audience")
+	}
+
 	return token, claims, nil
 }
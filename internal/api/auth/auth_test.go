@@ -113,8 +113,11 @@ func TestVerifyAuthHeader(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	jwtUser := JWTUser{ID: "user@localhost"}
-	newAuth := New(ac)
+	keys, err := LoadKeySet(ac)
+	require.NoError(t, err)
+
+	jwtUser := JWTUser{ID: "user@localhost", Role: "admin"}
+	newAuth := New(ac, keys)
 	tokenPair, err := newAuth.GenerateTokenPair(&jwtUser)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -127,7 +130,7 @@ func TestVerifyAuthHeader(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the VerifyAuthHeader function
-	verifier := JWTVerifier{}
+	verifier := JWTVerifier{Keys: keys}
 	token, claims, err := verifier.VerifyAuthHeader(ac, rr, req)
 	// Check for expected results
 	if err != nil {
@@ -144,6 +147,8 @@ func TestVerifyAuthHeader(t *testing.T) {
 	// 	t.Error("Expected non-nil claims")
 	// }
 
+	require.Equal(t, "admin", claims.Role)
+
 	if claims.Issuer != ac.JWTIssuer {
 		t.Errorf("Expected issuer '%s', got '%s'", ac.JWTIssuer, claims.Issuer)
 	}
@@ -159,6 +164,13 @@ func TestVerifyAuthHeader(t *testing.T) {
 		{"Bearer " + generateJWTToken("WrongSecret", ac.JWTIssuer, time.Now().Add(1*time.Hour)), "signature is invalid"},
 		{"Bearer " + generateJWTToken(ac.Secret, ac.JWTIssuer, time.Now().Add(-1*time.Hour)), "expired token"},
 		{"Bearer " + generateJWTToken(ac.Secret, "WrongIssuer", time.Now().Add(1*time.Hour)), "invalid issuer"},
+		{"Bearer " + generateJWTToken(ac.Secret, ac.JWTIssuer, time.Now().Add(1*time.Hour)), "invalid audience"},
+		{"Bearer " + signClaims(ac.Secret, jwt.MapClaims{"iss": ac.JWTIssuer, "aud": "other"}), "missing expiration"},
+		{"Bearer " + signClaims(ac.Secret, jwt.MapClaims{
+			"iss": ac.JWTIssuer,
+			"aud": "other",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}), "invalid audience"},
 	}
 
 	for _, tc := range testCases {
@@ -181,3 +193,9 @@ func generateJWTToken(secretKey, issuer string, expiration time.Time) string {
 	tokenString, _ := token.SignedString([]byte(secretKey))
 	return tokenString
 }
+
+func signClaims(secretKey string, claims jwt.MapClaims) string {
+	tokenString, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secretKey))
+
+	return tokenString
+}
@@ -0,0 +1,330 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/samber/lo"
+
+	"github.com/grafviktor/keep-my-secret/internal/config"
+)
+
+// Supported signing algorithms
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// minRSAKeySize - shorter RSA keys are not accepted neither for signing nor for verification
+const minRSAKeySize = 2048
+
+var (
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrUnexpectedMethod = errors.New("unexpected signing method")
+)
+
+// Key - a key which verifies tokens. The signing key also has the private part.
+type Key struct {
+	// ID - RFC 7638 thumbprint of the public key, which is sent in "kid" header of tokens.
+	// HMAC keys don't have an ID, because they must never be published.
+	ID        string
+	Algorithm string
+	// Public - []byte for HMAC, *rsa.PublicKey or ed25519.PublicKey
+	Public crypto.PublicKey
+	// Private - []byte for HMAC, *rsa.PrivateKey or ed25519.PrivateKey. Nil for verification keys.
+	Private crypto.PrivateKey
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// KeySet - the key which signs new tokens and keys which are still accepted. When the signing key
+// is replaced, the previous key is kept as a verification key until the tokens it has signed expire.
+type KeySet struct {
+	Signing *Key
+	// Verification - all accepted keys including the signing key, in the order of configuration
+	Verification []*Key
+}
+
+// keySetConfig - settings which define a key set
+type keySetConfig struct {
+	algorithm            string
+	secret               string
+	signingKeyPath       string
+	verificationKeyPaths string
+}
+
+// LoadKeySet - reads keys of the application configuration. It's called once when the application starts,
+// so restart the application to apply new keys.
+func LoadKeySet(ac config.AppConfig) (*KeySet, error) {
+	return newKeySet(keySetConfig{
+		algorithm:            ac.JWTAlgorithm,
+		secret:               ac.Secret,
+		signingKeyPath:       ac.JWTSigningKeyPath,
+		verificationKeyPaths: ac.JWTVerificationKeyPaths,
+	})
+}
+
+func newKeySet(cfg keySetConfig) (*KeySet, error) {
+	var signing *Key
+	var err error
+
+	switch cfg.algorithm {
+	case AlgorithmHS256, "":
+		if cfg.secret == "" {
+			return nil, errors.New("APP_SECRET is required for HS256 signing")
+		}
+
+		signing = &Key{Algorithm: AlgorithmHS256, Public: []byte(cfg.secret), Private: []byte(cfg.secret)}
+	case AlgorithmRS256, AlgorithmEdDSA:
+		if cfg.signingKeyPath == "" {
+			return nil, fmt.Errorf("signing key file is required for %s signing", cfg.algorithm)
+		}
+
+		if signing, err = readKeyFile(cfg.signingKeyPath); err != nil {
+			return nil, err
+		}
+
+		if signing.Private == nil {
+			return nil, fmt.Errorf("%s: signing key file must contain a private key", cfg.signingKeyPath)
+		}
+
+		if signing.Algorithm != cfg.algorithm {
+			return nil, fmt.Errorf("%s: %s key cannot be used for %s signing",
+				cfg.signingKeyPath, signing.Algorithm, cfg.algorithm)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", cfg.algorithm)
+	}
+
+	keySet := &KeySet{Signing: signing, Verification: []*Key{signing}}
+	for _, path := range strings.Split(cfg.verificationKeyPaths, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		var key *Key
+		if key, err = readKeyFile(path); err != nil {
+			return nil, err
+		}
+
+		if keySet.find(key.ID) != nil {
+			continue
+		}
+
+		// Verification keys never sign anything
+		key.Private = nil
+		keySet.Verification = append(keySet.Verification, key)
+	}
+
+	return keySet, nil
+}
+
+func (ks *KeySet) find(id string) *Key {
+	for _, key := range ks.Verification {
+		if key.ID == id {
+			return key
+		}
+	}
+
+	return nil
+}
+
+// Keyfunc - selects the verification key by "kid" header of the token. Tokens without "kid" were issued
+// before key rotation was introduced or signed with HMAC, they are verified with the signing key.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (any, error) {
+	key := ks.Signing
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		if key = ks.find(kid); key == nil {
+			return nil, ErrUnknownKey
+		}
+	}
+
+	// The algorithm is defined by the key, never by the token, otherwise a public key could be used as HMAC secret
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("%w %v", ErrUnexpectedMethod, token.Header["alg"])
+	}
+
+	return key.Public, nil
+}
+
+// sign - signs the claims with the signing key, the key ID is added to the header
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.Signing.method(), claims)
+	if ks.Signing.ID != "" {
+		token.Header["kid"] = ks.Signing.ID
+	}
+
+	return token.SignedString(ks.Signing.Private)
+}
+
+// readKeyFile - reads the first PEM block of the file. Private keys may be PKCS #8 or PKCS #1 (RSA only),
+// public keys may be PKIX or PKCS #1 (RSA only).
+func readKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: PEM data not found", path)
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	key, err := newKey(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return key, nil
+}
+
+func newKey(parsed any) (*Key, error) {
+	key := &Key{}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm, key.Public, key.Private = AlgorithmRS256, &k.PublicKey, k
+	case *rsa.PublicKey:
+		key.Algorithm, key.Public = AlgorithmRS256, k
+	case ed25519.PrivateKey:
+		key.Algorithm, key.Public, key.Private = AlgorithmEdDSA, k.Public(), k
+	case ed25519.PublicKey:
+		key.Algorithm, key.Public = AlgorithmEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	if public, ok := key.Public.(*rsa.PublicKey); ok && public.N.BitLen() < minRSAKeySize {
+		return nil, fmt.Errorf("RSA key must be at least %d bits long", minRSAKeySize)
+	}
+
+	key.ID = thumbprint(key.Public)
+
+	return key, nil
+}
+
+// JWK - public key in JSON Web Key format, see RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	// Crv and X - members of Ed25519 keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	// N and E - members of RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+}
+
+// JWKSet - a set of public keys which is published by the JWKS endpoint
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeys - returns public parts of the keys which verify tokens. HMAC keys are never published.
+func (ks *KeySet) PublicKeys() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(ks.Verification))}
+	for _, key := range ks.Verification {
+		jwk, ok := publicJWK(key.Public)
+		if !ok {
+			continue
+		}
+
+		jwk.Use, jwk.Alg, jwk.Kid = "sig", key.Algorithm, key.ID
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+// Algorithms - returns algorithms of the keys which verify tokens without duplicates
+func (ks *KeySet) Algorithms() []string {
+	algorithms := make([]string, 0, len(ks.Verification))
+	for _, key := range ks.Verification {
+		if !lo.Contains(algorithms, key.Algorithm) {
+			algorithms = append(algorithms, key.Algorithm)
+		}
+	}
+
+	return algorithms
+}
+
+// publicJWK - returns the required members of the public key
+func publicJWK(public crypto.PublicKey) (JWK, bool) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return JWK{Kty: "RSA", N: encodeInt(k.N), E: encodeInt(big.NewInt(int64(k.E)))}, true
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(k)}, true
+	}
+
+	return JWK{}, false
+}
+
+// thumbprint - RFC 7638 JWK thumbprint: SHA-256 of the required members of the key. The members
+// are sorted lexicographically, which is the order of fields in the anonymous structs.
+func thumbprint(public crypto.PublicKey) string {
+	jwk, ok := publicJWK(public)
+	if !ok {
+		return ""
+	}
+
+	var members any
+	if jwk.Kty == "RSA" {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{E: jwk.E, Kty: jwk.Kty, N: jwk.N}
+	} else {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{Crv: jwk.Crv, Kty: jwk.Kty, X: jwk.X}
+	}
+
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func encodeInt(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/config"
+)
+
+// writeKeyFile - saves the key as PKCS #8 private key or PKIX public key
+func writeKeyFile(t *testing.T, key any) string {
+	t.Helper()
+
+	var block *pem.Block
+	if _, ok := key.(crypto.Signer); ok {
+		data, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: data}
+	}
+
+	if block == nil {
+		data, err := x509.MarshalPKIXPublicKey(key)
+		require.NoError(t, err)
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: data}
+	}
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0o600))
+
+	return path
+}
+
+func verify(t *testing.T, ac config.AppConfig, token string) error {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	keys, err := LoadKeySet(ac)
+	require.NoError(t, err)
+
+	_, _, err = JWTVerifier{Keys: keys}.VerifyAuthHeader(ac, httptest.NewRecorder(), req)
+
+	return err
+}
+
+func newAuth(t *testing.T, ac config.AppConfig) Auth {
+	t.Helper()
+
+	keys, err := LoadKeySet(ac)
+	require.NoError(t, err)
+
+	return New(ac, keys)
+}
+
+func TestGenerateTokenPairEdDSA(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ac := config.AppConfig{
+		JWTIssuer:         "localhost",
+		JWTAudience:       "localhost",
+		JWTAlgorithm:      AlgorithmEdDSA,
+		JWTSigningKeyPath: writeKeyFile(t, privateKey),
+		AccessTokenTTL:    time.Minute,
+		RefreshTokenTTL:   time.Hour,
+	}
+
+	tokens, err := newAuth(t, ac).GenerateTokenPair(&JWTUser{ID: "user@localhost"})
+	require.NoError(t, err)
+	require.NotEqual(t, tokens.AccessToken, tokens.RefreshToken)
+	require.NoError(t, verify(t, ac, tokens.AccessToken))
+
+	keys, err := LoadKeySet(ac)
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokens.AccessToken, claims, keys.Keyfunc)
+	require.NoError(t, err)
+	require.Equal(t, AlgorithmEdDSA, token.Method.Alg())
+	require.Equal(t, keys.Signing.ID, token.Header["kid"])
+	require.InDelta(t, time.Now().Add(time.Minute).Unix(), claims["exp"], 5)
+
+	refreshClaims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokens.RefreshToken, refreshClaims, keys.Keyfunc)
+	require.NoError(t, err)
+	require.Equal(t, "user@localhost", refreshClaims["sub"])
+	require.InDelta(t, time.Now().Add(time.Hour).Unix(), refreshClaims["exp"], 5)
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	_, newKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	oldConfig := config.AppConfig{
+		JWTIssuer:         "localhost",
+		JWTAudience:       "localhost",
+		JWTAlgorithm:      AlgorithmRS256,
+		JWTSigningKeyPath: writeKeyFile(t, oldKey),
+	}
+
+	oldTokens, err := newAuth(t, oldConfig).GenerateTokenPair(&JWTUser{ID: "user@localhost"})
+	require.NoError(t, err)
+
+	// The new key signs tokens, the public part of the old key still verifies tokens it has signed
+	newConfig := config.AppConfig{
+		JWTIssuer:               "localhost",
+		JWTAudience:             "localhost",
+		JWTAlgorithm:            AlgorithmEdDSA,
+		JWTSigningKeyPath:       writeKeyFile(t, newKey),
+		JWTVerificationKeyPaths: writeKeyFile(t, &oldKey.PublicKey),
+	}
+
+	newTokens, err := newAuth(t, newConfig).GenerateTokenPair(&JWTUser{ID: "user@localhost"})
+	require.NoError(t, err)
+
+	require.NoError(t, verify(t, newConfig, oldTokens.AccessToken))
+	require.NoError(t, verify(t, newConfig, newTokens.AccessToken))
+
+	// Without the old key its tokens are rejected
+	newConfig.JWTVerificationKeyPaths = ""
+	require.ErrorIs(t, verify(t, newConfig, oldTokens.AccessToken), ErrUnknownKey)
+}
+
+func TestKeyfuncRejectsAlgorithmConfusion(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ac := config.AppConfig{
+		Secret:            "romeo romeo whiskey",
+		JWTIssuer:         "localhost",
+		JWTAlgorithm:      AlgorithmEdDSA,
+		JWTSigningKeyPath: writeKeyFile(t, privateKey),
+	}
+
+	keys, err := LoadKeySet(ac)
+	require.NoError(t, err)
+
+	// HMAC tokens are not accepted, even with "kid" of the signing key
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": "localhost"})
+	token.Header["kid"] = keys.Signing.ID
+	signed, err := token.SignedString([]byte(ac.Secret))
+	require.NoError(t, err)
+
+	require.ErrorIs(t, verify(t, ac, signed), ErrUnexpectedMethod)
+}
+
+func TestVerifyAuthHeaderWithoutKeys(t *testing.T) {
+	tokens, err := newAuth(t, config.AppConfig{Secret: "romeo romeo whiskey"}).
+		GenerateTokenPair(&JWTUser{ID: "user@localhost"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	_, _, err = JWTVerifier{}.VerifyAuthHeader(config.AppConfig{}, httptest.NewRecorder(), req)
+	require.ErrorIs(t, err, errNoVerificationKeys)
+}
+
+func TestLoadKeySetErrors(t *testing.T) {
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		ac   config.AppConfig
+	}{
+		{
+			name: "HS256 without secret",
+			ac:   config.AppConfig{JWTAlgorithm: AlgorithmHS256},
+		},
+		{
+			name: "Unsupported algorithm",
+			ac:   config.AppConfig{JWTAlgorithm: "none", Secret: "secret"},
+		},
+		{
+			name: "EdDSA without key file",
+			ac:   config.AppConfig{JWTAlgorithm: AlgorithmEdDSA},
+		},
+		{
+			name: "Key doesn't match the algorithm",
+			ac:   config.AppConfig{JWTAlgorithm: AlgorithmRS256, JWTSigningKeyPath: writeKeyFile(t, edKey)},
+		},
+		{
+			name: "Public key can't sign",
+			ac: config.AppConfig{
+				JWTAlgorithm:      AlgorithmEdDSA,
+				JWTSigningKeyPath: writeKeyFile(t, edKey.Public()),
+			},
+		},
+		{
+			name: "Short RSA key",
+			ac:   config.AppConfig{JWTAlgorithm: AlgorithmRS256, JWTSigningKeyPath: writeKeyFile(t, weakKey)},
+		},
+		{
+			name: "Missing verification key file",
+			ac: config.AppConfig{
+				Secret:                  "secret",
+				JWTVerificationKeyPaths: filepath.Join(t.TempDir(), "missing.pem"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadKeySet(tt.ac)
+			require.Error(t, err)
+		})
+	}
+}
@@ -13,3 +13,12 @@ type ContextKey string
 
 // ContextUserLogin - used to store user login in context
 const ContextUserLogin ContextKey = "login"
+
+// ContextUserRole - used to store role of the user in context, it's taken from the access token
+const ContextUserRole ContextKey = "role"
+
+// ContextAPIToken - used to store personal API token in context, if the request is authenticated with it
+const ContextAPIToken ContextKey = "api_token"
+
+// ContextDataKey - used to store the data key in context, if it was unwrapped with personal API token
+const ContextDataKey ContextKey = "data_key"
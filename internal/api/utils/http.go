@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"net"
 	"net/http"
 )
 
@@ -64,3 +65,14 @@ func ReadJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
 
 	return nil
 }
+
+// ClientIP returns IP address of the client without the port. Headers which are set by
+// reverse proxies are not trusted, because they can be set by the client as well.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
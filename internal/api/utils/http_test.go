@@ -125,3 +125,22 @@ func TestReadJSON(t *testing.T) {
 		t.Errorf("Expected request body to be fully consumed (EOF), but got error: %v", readErr)
 	}
 }
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{remoteAddr: "192.0.2.1:1234", want: "192.0.2.1"},
+		{remoteAddr: "[2001:db8::1]:443", want: "2001:db8::1"},
+		{remoteAddr: "192.0.2.1", want: "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		r.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+		require.Equal(t, tt.want, ClientIP(r))
+	}
+}
@@ -5,22 +5,9 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"io"
-	mathrand "math/rand"
-	"time"
+	"math/big"
 )
 
-// IsUsernameConformsPolicy - checks if username conforms with security policy. Stub function.
-// Normally we should have generic settings for username and password complexity. But I'm reluctant
-// to complicate this logic for a pet project.
-func IsUsernameConformsPolicy(username string) bool {
-	return len(username) > 0
-}
-
-// IsPasswordConformsPolicy - checks if password conforms with security policy. Stub function.
-func IsPasswordConformsPolicy(password string) bool {
-	return len(password) > 0
-}
-
 var (
 	aesKeyLength     = 24
 	validRandomChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!@#$%^&*()-_=+[]{}|;:,.<>?~"
@@ -29,11 +16,16 @@ var (
 // GenerateRandomPassword - generates password which is used to encrypt user data
 // Returns string of the same length as aesKeyLength
 func GenerateRandomPassword() string {
-	mathrand.Seed(time.Now().UnixNano())
-
+	charsCount := big.NewInt(int64(len(validRandomChars)))
 	key := make([]byte, aesKeyLength)
 	for i := range key {
-		key[i] = validRandomChars[mathrand.Intn(len(validRandomChars))]
+		n, err := rand.Int(rand.Reader, charsCount)
+		if err != nil {
+			// crypto/rand never fails on supported platforms, if it does, no keys can be generated anyway
+			panic(err)
+		}
+
+		key[i] = validRandomChars[n.Int64()]
 	}
 
 	return string(key)
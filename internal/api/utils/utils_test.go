@@ -10,64 +10,6 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestIsPasswordConformsPolicy(t *testing.T) {
-	type args struct {
-		password string
-	}
-	tests := []struct {
-		name string
-		args args
-		want bool
-	}{
-		{
-			name: "HashedPassword is OK",
-			args: args{password: "1"},
-			want: true,
-		},
-		{
-			name: "HashedPassword is empty",
-			args: args{password: ""},
-			want: false,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := IsPasswordConformsPolicy(tt.args.password); got != tt.want {
-				t.Errorf("IsPasswordConformsPolicy() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
-func TestIsUsernameConformsPolicy(t *testing.T) {
-	type args struct {
-		username string
-	}
-	tests := []struct {
-		name string
-		args args
-		want bool
-	}{
-		{
-			name: "Login is OK",
-			args: args{username: "tony.tester@example.com"},
-			want: true,
-		},
-		{
-			name: "Login is empty",
-			args: args{username: ""},
-			want: false,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := IsUsernameConformsPolicy(tt.args.username); got != tt.want {
-				t.Errorf("IsUsernameConformsPolicy() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
 func TestDecrypt(t *testing.T) {
 	type args struct {
 		cipherdata []byte
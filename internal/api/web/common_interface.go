@@ -3,22 +3,101 @@ package web
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/grafviktor/keep-my-secret/internal/api/auth"
 	"github.com/grafviktor/keep-my-secret/internal/model"
+	"github.com/grafviktor/keep-my-secret/internal/oidc"
 )
 
 type userStorage interface {
 	AddUser(ctx context.Context, user *model.User) (*model.User, error)
 	GetUser(ctx context.Context, login string) (*model.User, error)
+	SetUserKeyPair(ctx context.Context, user *model.User) error
+	UpdateUserPassword(ctx context.Context, user *model.User) error
+	// Users can register only if the registration is open
+	GetServerSettings(ctx context.Context) (*model.ServerSettings, error)
+}
+
+type oidcStorage interface {
+	userStorage
+	AddExternalUser(ctx context.Context, user *model.User, identity *model.Identity) error
+	GetUserByIdentity(ctx context.Context, issuer, subject string) (*model.User, error)
+	SetUserDataKey(ctx context.Context, user *model.User) error
+}
+
+// passwordStorage - the password of the user confirms sensitive operations
+type passwordStorage interface {
+	GetUser(ctx context.Context, login string) (*model.User, error)
+}
+
+type webauthnStorage interface {
+	passwordStorage
+	AddWebAuthnCredential(ctx context.Context, credential *model.WebAuthnCredential) error
+	GetWebAuthnCredentials(ctx context.Context, login string) ([]*model.WebAuthnCredential, error)
+	GetWebAuthnCredential(ctx context.Context, id string) (*model.WebAuthnCredential, error)
+	UpdateWebAuthnCredential(ctx context.Context, credential *model.WebAuthnCredential, previousSignCount uint32) error
+	DeleteWebAuthnCredential(ctx context.Context, id, login string) error
+}
+
+// adminStorage - administrators manage accounts and settings of the server, but not secrets of the users
+type adminStorage interface {
+	GetUser(ctx context.Context, login string) (*model.User, error)
+	GetUsers(ctx context.Context) ([]*model.UserSummary, error)
+	SetUserDisabled(ctx context.Context, login string, disabled bool) error
+	RevokeUserSessions(ctx context.Context, login string, revokedAt time.Time) error
+	GetStorageUsage(ctx context.Context) (*model.StorageUsage, error)
+	GetServerSettings(ctx context.Context) (*model.ServerSettings, error)
+	SaveServerSettings(ctx context.Context, settings *model.ServerSettings) error
+}
+
+type apiTokenStorage interface {
+	passwordStorage
+	AddAPIToken(ctx context.Context, token *model.APIToken) error
+	GetAPITokens(ctx context.Context, login string) ([]*model.APIToken, error)
+	GetAPITokenByHash(ctx context.Context, hash string) (*model.APIToken, error)
+	TouchAPIToken(ctx context.Context, id int64) error
+	DeleteAPIToken(ctx context.Context, id int64, login string) error
+	// Tokens can be limited only to secrets and vaults which the user can access
+	GetSecret(ctx context.Context, secretID, login string) (*model.Secret, error)
+	GetShare(ctx context.Context, secretID, login string) (*model.Share, error)
+	GetVaultAccess(ctx context.Context, vaultID int64, login string) (*model.VaultAccess, error)
+}
+
+// secondFactor - confirms login with a password by another factor
+type secondFactor interface {
+	// RequireSecondFactor - returns true if the user has to confirm the login, the response is written then.
+	// The data key is released only after the confirmation.
+	RequireSecondFactor(w http.ResponseWriter, r *http.Request, login, dataKey string) bool
+}
+
+type identityProvider interface {
+	Issuer() string
+	AuthCodeURL(ctx context.Context, request *oidc.AuthRequest) (string, error)
+	Exchange(ctx context.Context, code string, request *oidc.AuthRequest) (*oidc.Claims, error)
 }
 
 type keyCache interface {
 	Set(login, key string)
 	Get(login string) (string, error)
+	Delete(login string)
 }
 
 type authUtils interface {
 	GenerateTokenPair(user *auth.JWTUser) (auth.TokenPair, error)
 	GetRefreshCookie(token string) *http.Cookie
+	GetExpiredRefreshCookie() *http.Cookie
+}
+
+type breachChecker interface {
+	IsCompromised(password string) (bool, error)
+}
+
+type loginThrottler interface {
+	Attempt(ctx context.Context, login, ip string) (time.Duration, error)
+	Succeed(ctx context.Context, login, ip string) error
+}
+
+type auditRecorder interface {
+	Record(ctx context.Context, event *model.AuditEvent) error
 }
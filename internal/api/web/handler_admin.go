@@ -0,0 +1,262 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/api/utils"
+	"github.com/grafviktor/keep-my-secret/internal/audit"
+	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/keycache"
+)
+
+var errSessionRevoked = errors.New("session is revoked")
+
+// adminHTTPHandler - handlers of server administration. Administrators manage accounts, but they never get
+// data keys of other users, so they can't read secrets.
+type adminHTTPHandler struct {
+	config   config.AppConfig
+	storage  adminStorage
+	keyCache keyCache
+	auditLog auditRecorder
+}
+
+// newAdminHandlerProvider - returns a set of handlers of server administration, which also verifies
+// that sessions of the users are not revoked
+func newAdminHandlerProvider(
+	appConfig config.AppConfig,
+	storage adminStorage,
+	auditLog auditRecorder,
+) adminHTTPHandler {
+	return adminHTTPHandler{
+		config:   appConfig,
+		storage:  storage,
+		keyCache: keycache.GetInstance(),
+		auditLog: auditLog,
+	}
+}
+
+// VerifySession - rejects tokens of disabled users, and tokens which were issued before the sessions
+// of the user were revoked. Returns the role of the user from the storage.
+func (h *adminHTTPHandler) VerifySession(ctx context.Context, login string, issuedAt time.Time) (string, error) {
+	user, err := h.storage.GetUser(ctx, login)
+	if err != nil {
+		return "", err
+	}
+
+	if user.Disabled {
+		return "", constant.ErrAccountDisabled
+	}
+
+	if user.SessionRevoked(issuedAt) {
+		return "", errSessionRevoked
+	}
+
+	return user.Role, nil
+}
+
+// VerifyAccount - rejects API tokens of disabled users. API tokens are deleted when sessions of the user
+// are revoked, so the time of the revocation is not checked.
+func (h *adminHTTPHandler) VerifyAccount(ctx context.Context, login string) error {
+	user, err := h.storage.GetUser(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	if user.Disabled {
+		return constant.ErrAccountDisabled
+	}
+
+	return nil
+}
+
+// ListUsersHandler - HTTP handler which returns all users with the number and the size of their secrets
+func (h *adminHTTPHandler) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := h.storage.GetUsers(r.Context())
+	if err != nil {
+		log.Printf("ListUsersHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   users,
+	})
+}
+
+// DisableUserHandler - HTTP handler which disables the account. The user is signed out, and can't sign in
+// until the account is enabled.
+func (h *adminHTTPHandler) DisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	login, ok := h.targetLogin(w, r, "DisableUserHandler")
+	if !ok {
+		return
+	}
+
+	err := h.storage.SetUserDisabled(r.Context(), login, true)
+	if err == nil {
+		// Tokens must not become valid again, when the account is enabled
+		err = h.storage.RevokeUserSessions(r.Context(), login, time.Now())
+	}
+
+	if err != nil {
+		log.Printf("DisableUserHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	h.keyCache.Delete(login)
+	recordAuditEvent(h.auditLog, r, audit.EventUserDisable, login, "")
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   nil,
+	})
+}
+
+// EnableUserHandler - HTTP handler which enables the account which was disabled
+func (h *adminHTTPHandler) EnableUserHandler(w http.ResponseWriter, r *http.Request) {
+	login, ok := h.targetLogin(w, r, "EnableUserHandler")
+	if !ok {
+		return
+	}
+
+	if err := h.storage.SetUserDisabled(r.Context(), login, false); err != nil {
+		log.Printf("EnableUserHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	recordAuditEvent(h.auditLog, r, audit.EventUserEnable, login, "")
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   nil,
+	})
+}
+
+// LogoutUserHandler - HTTP handler which signs the user out on all devices. Issued tokens and personal
+// API tokens are not accepted anymore, and the data key is removed from memory.
+func (h *adminHTTPHandler) LogoutUserHandler(w http.ResponseWriter, r *http.Request) {
+	login, ok := h.targetLogin(w, r, "LogoutUserHandler")
+	if !ok {
+		return
+	}
+
+	if err := h.storage.RevokeUserSessions(r.Context(), login, time.Now()); err != nil {
+		log.Printf("LogoutUserHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	h.keyCache.Delete(login)
+	recordAuditEvent(h.auditLog, r, audit.EventUserLogout, login, "")
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   nil,
+	})
+}
+
+// targetLogin - returns the login of the account which is managed. Administrators can't disable or sign out
+// themselves, otherwise the server could be left without an administrator who can sign in.
+func (h *adminHTTPHandler) targetLogin(w http.ResponseWriter, r *http.Request, handler string) (string, bool) {
+	login := chi.URLParam(r, "login")
+	if login == "" || login == r.Context().Value(api.ContextUserLogin).(string) {
+		log.Printf("%s error: account '%s' cannot be managed by its owner\n", handler, login)
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return "", false
+	}
+
+	return login, true
+}
+
+// StorageUsageHandler - HTTP handler which returns the number of users and secrets, and the size
+// of the storage
+func (h *adminHTTPHandler) StorageUsageHandler(w http.ResponseWriter, r *http.Request) {
+	usage, err := h.storage.GetStorageUsage(r.Context())
+	if err != nil {
+		log.Printf("StorageUsageHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   usage,
+	})
+}
+
+// GetSettingsHandler - HTTP handler which returns settings of the server
+func (h *adminHTTPHandler) GetSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.storage.GetServerSettings(r.Context())
+	if err != nil {
+		log.Printf("GetSettingsHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   settings,
+	})
+}
+
+// UpdateSettingsHandler - HTTP handler which changes settings of the server. Settings which are not
+// in the request keep their values.
+func (h *adminHTTPHandler) UpdateSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	settings, err := h.storage.GetServerSettings(r.Context())
+	if err != nil {
+		log.Printf("UpdateSettingsHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	if err = utils.ReadJSON(w, r, settings); err != nil {
+		log.Printf("UpdateSettingsHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	if err = h.storage.SaveServerSettings(r.Context(), settings); err != nil {
+		log.Printf("UpdateSettingsHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	recordAuditEvent(h.auditLog, r, audit.EventSettingsUpdate, login, "")
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   settings,
+	})
+}
@@ -0,0 +1,124 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/api/auth"
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+func TestAdminHandlers(t *testing.T) {
+	storage := newAPITokenTestStorage()
+	settings := model.DefaultServerSettings()
+	storage.settings = &settings
+	for _, user := range []*model.User{
+		{Login: "admin", Role: model.UserRoleAdmin},
+		{Login: "alice", Role: model.UserRoleUser, DataKey: "wrapped data key of alice"},
+		{Login: "bob", Role: model.UserRoleUser},
+	} {
+		storage.users[user.Login] = user
+	}
+
+	bobToken := addTestAPIToken(t, storage, model.APIToken{
+		Login:      "bob",
+		Permission: model.APITokenRead,
+		ExpiresAt:  time.Now().Add(time.Hour),
+	})
+
+	// Issuer and audience of access tokens are verified
+	adminConfig := appConfig
+	adminConfig.JWTIssuer = "localhost"
+	adminConfig.JWTAudience = "localhost"
+
+	router := NewHTTPRouter(adminConfig, storage, newTestServices(t, adminConfig))
+	accessToken := func(login, role string) string {
+		tokens, err := auth.New(adminConfig, newTestKeys(t, adminConfig)).GenerateTokenPair(&auth.JWTUser{ID: login, Role: role})
+		require.NoError(t, err)
+
+		return tokens.AccessToken
+	}
+
+	adminToken := accessToken("admin", model.UserRoleAdmin)
+	aliceToken := accessToken("alice", model.UserRoleUser)
+	bobAccessToken := accessToken("bob", model.UserRoleUser)
+
+	serve := func(method, url, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	manageUser := func(login, action string) int {
+		return serve(http.MethodPost, "/api/v1/admin/users/"+login+"/"+action, adminToken, "").Code
+	}
+
+	// Regular users and API tokens can't administer the server
+	require.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/api/v1/admin/users", aliceToken, "").Code)
+	require.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/api/v1/admin/users", bobToken, "").Code)
+
+	rr := serve(http.MethodGet, "/api/v1/admin/users", adminToken, "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	// Administrators see accounts, but not the keys of the users
+	require.NotContains(t, rr.Body.String(), "wrapped data key of alice")
+
+	var users struct {
+		Data []model.UserSummary `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &users))
+	require.Len(t, users.Data, 3)
+
+	require.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/v1/admin/usage", adminToken, "").Code)
+
+	// Administrators can't lock themselves out
+	require.Equal(t, http.StatusBadRequest, manageUser("admin", "disable"))
+	require.Equal(t, http.StatusBadRequest, manageUser("admin", "logout"))
+	require.Equal(t, http.StatusNotFound, manageUser("carol", "disable"))
+
+	require.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/v1/user/tokens/", aliceToken, "").Code)
+	require.Equal(t, http.StatusOK, manageUser("alice", "disable"))
+	require.True(t, storage.users["alice"].Disabled)
+	require.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/api/v1/user/tokens/", aliceToken, "").Code)
+
+	require.Equal(t, http.StatusOK, manageUser("alice", "enable"))
+	require.False(t, storage.users["alice"].Disabled)
+	// Tokens which were issued before the account was disabled don't become valid again
+	require.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/api/v1/user/tokens/", aliceToken, "").Code)
+
+	// Force logout revokes access tokens and personal API tokens of the user
+	require.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/v1/user/tokens/", bobAccessToken, "").Code)
+	require.Equal(t, http.StatusOK, manageUser("bob", "logout"))
+	require.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/api/v1/user/tokens/", bobAccessToken, "").Code)
+	require.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/api/v1/secrets/", bobToken, "").Code)
+	for _, apiToken := range storage.apiTokens {
+		require.NotEqual(t, "bob", apiToken.Login)
+	}
+
+	rr = serve(http.MethodGet, "/api/v1/admin/settings", adminToken, "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Contains(t, rr.Body.String(), `"registration_open":true`)
+
+	require.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "/api/v1/admin/settings", adminToken, "").Code)
+	rr = serve(http.MethodPut, "/api/v1/admin/settings", adminToken, `{"registration_open":false}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.False(t, storage.settings.RegistrationOpen)
+
+	rr = serve(http.MethodPost, "/api/v1/user/register", "", `{"username":"carol","password":"Carol-Password-1"}`)
+	require.Equal(t, http.StatusForbidden, rr.Code)
+	require.Contains(t, rr.Body.String(), constant.APIMessageRegistrationClosed)
+
+	// The role is loaded from the storage, so a demoted administrator loses access before the token expires
+	storage.users["admin"].Role = model.UserRoleUser
+	require.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/api/v1/admin/users", adminToken, "").Code)
+	require.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/v1/user/tokens/", adminToken, "").Code)
+}
@@ -0,0 +1,352 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/api/utils"
+	"github.com/grafviktor/keep-my-secret/internal/audit"
+	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/keycache"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+const (
+	// maxAPITokenNameLength - the name is chosen by the user to tell tokens apart
+	maxAPITokenNameLength   = 64
+	defaultAPITokenLifetime = 30 * 24 * time.Hour
+)
+
+// apiTokenRoutes - the only routes which can be called with a personal API token, and the permission
+// which the token must have. Tokens can't manage users, tokens, teams and shares, or export the vault.
+var apiTokenRoutes = map[string]string{
+	"GET /api/v1/secrets":                           model.APITokenRead,
+	"GET /api/v1/secrets/search":                    model.APITokenRead,
+	"GET /api/v1/secrets/{id}":                      model.APITokenRead,
+	"GET /api/v1/secrets/file/{id}":                 model.APITokenRead,
+	"GET /api/v1/vaults/{id}/secrets":               model.APITokenRead,
+	"GET /api/v1/vaults/{id}/secrets/{secretID}":    model.APITokenRead,
+	"POST /api/v1/secrets":                          model.APITokenReadWrite,
+	"PUT /api/v1/secrets/{id}":                      model.APITokenReadWrite,
+	"DELETE /api/v1/secrets/{id}":                   model.APITokenReadWrite,
+	"POST /api/v1/vaults/{id}/secrets":              model.APITokenReadWrite,
+	"PUT /api/v1/vaults/{id}/secrets/{secretID}":    model.APITokenReadWrite,
+	"DELETE /api/v1/vaults/{id}/secrets/{secretID}": model.APITokenReadWrite,
+}
+
+var errAPITokenExpired = errors.New("API token is expired")
+
+type tokenHTTPHandler struct {
+	config   config.AppConfig
+	storage  apiTokenStorage
+	keyCache keyCache
+	auditLog auditRecorder
+	// throttler - limits wrong passwords, which confirm creation of tokens
+	throttler loginThrottler
+	// routes - the router which serves requests, it tells which route the request goes to
+	routes *chi.Mux
+}
+
+// newTokenHandlerProvider - returns a set of handlers which manage personal API tokens of the user,
+// and verifies the tokens when they are used
+func newTokenHandlerProvider(
+	appConfig config.AppConfig,
+	storage apiTokenStorage,
+	auditLog auditRecorder,
+	throttler loginThrottler,
+	routes *chi.Mux,
+) tokenHTTPHandler {
+	return tokenHTTPHandler{
+		config:    appConfig,
+		storage:   storage,
+		keyCache:  keycache.GetInstance(),
+		auditLog:  auditLog,
+		throttler: throttler,
+		routes:    routes,
+	}
+}
+
+type apiTokenRequest struct {
+	Name       string     `json:"name"`
+	Permission string     `json:"permission"`
+	SecretIDs  []int64    `json:"secret_ids"`
+	VaultIDs   []int64    `json:"vault_ids"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	// Password - the password of the user, which confirms creation of the token
+	Password string `json:"password"`
+}
+
+// apiTokenResponse - the token is returned only once, when it's created
+type apiTokenResponse struct {
+	Token    string          `json:"token"`
+	APIToken *model.APIToken `json:"api_token"`
+}
+
+// newAPIToken - validates the request and creates a token, which can access only the secrets and vaults
+// which the user can access
+//
+//nolint:lll
+func (h *tokenHTTPHandler) newAPIToken(ctx context.Context, request apiTokenRequest, login string, now time.Time) (*model.APIToken, error) {
+	if request.Name == "" || utf8.RuneCountInString(request.Name) > maxAPITokenNameLength {
+		return nil, errors.New("invalid token name")
+	}
+
+	if !model.IsValidAPITokenPermission(request.Permission) {
+		return nil, errors.New("invalid token permission")
+	}
+
+	lifetime := defaultAPITokenLifetime
+	if h.config.APITokenMaxLifetime < lifetime {
+		lifetime = h.config.APITokenMaxLifetime
+	}
+
+	expiresAt := now.Add(lifetime)
+	if request.ExpiresAt != nil {
+		expiresAt = *request.ExpiresAt
+	}
+
+	if !expiresAt.After(now) || expiresAt.After(now.Add(h.config.APITokenMaxLifetime)) {
+		return nil, errors.New("invalid expiration time")
+	}
+
+	for _, id := range request.SecretIDs {
+		secretID := strconv.FormatInt(id, 10)
+		_, err := h.storage.GetSecret(ctx, secretID, login)
+		if errors.Is(err, constant.ErrNotFound) {
+			_, err = h.storage.GetShare(ctx, secretID, login)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("secret %d: %w", id, err)
+		}
+	}
+
+	for _, id := range request.VaultIDs {
+		if _, err := h.storage.GetVaultAccess(ctx, id, login); err != nil {
+			return nil, fmt.Errorf("vault %d: %w", id, err)
+		}
+	}
+
+	return &model.APIToken{
+		Login:      login,
+		Name:       request.Name,
+		Permission: request.Permission,
+		SecretIDs:  request.SecretIDs,
+		VaultIDs:   request.VaultIDs,
+		ExpiresAt:  expiresAt.UTC(),
+	}, nil
+}
+
+// ListTokensHandler - HTTP handler which returns personal API tokens of the user, tokens themselves
+// are not returned
+func (h *tokenHTTPHandler) ListTokensHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	tokens, err := h.storage.GetAPITokens(r.Context(), login)
+	if err != nil {
+		log.Printf("ListTokensHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   tokens,
+	})
+}
+
+// CreateTokenHandler - HTTP handler which creates a personal API token. The token gets its own copy
+// of the data key, so the user confirms creation of the token with the password, or with the master
+// password if they sign in with an identity provider.
+func (h *tokenHTTPHandler) CreateTokenHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	var request apiTokenRequest
+	err := utils.ReadJSON(w, r, &request)
+
+	var apiToken *model.APIToken
+	if err == nil {
+		apiToken, err = h.newAPIToken(r.Context(), request, login, time.Now().UTC())
+	}
+
+	if err != nil {
+		log.Printf("CreateTokenHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	if !confirmPassword(w, r, h.storage, h.throttler, "CreateTokenHandler", login, request.Password) {
+		return
+	}
+
+	dataKey, err := h.keyCache.Get(login)
+	if err != nil {
+		log.Printf("CreateTokenHandler error: %s\n", err.Error())
+		writeUnauthorized(w)
+
+		return
+	}
+
+	token, err := apiToken.GenerateToken(dataKey)
+	if err == nil {
+		err = h.storage.AddAPIToken(r.Context(), apiToken)
+	}
+
+	if err != nil {
+		log.Printf("CreateTokenHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	recordAuditEvent(h.auditLog, r, audit.EventAPITokenCreate, login, "")
+
+	_ = utils.WriteJSON(w, http.StatusCreated, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   apiTokenResponse{Token: token, APIToken: apiToken},
+	})
+}
+
+// DeleteTokenHandler - HTTP handler which revokes a personal API token
+func (h *tokenHTTPHandler) DeleteTokenHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	id, err := idParam(r, "id")
+	if err != nil {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	if err = h.storage.DeleteAPIToken(r.Context(), id, login); err != nil {
+		log.Printf("DeleteTokenHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	recordAuditEvent(h.auditLog, r, audit.EventAPITokenRevoke, login, "")
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   nil,
+	})
+}
+
+// VerifyAPIToken - finds the token, unwraps the data key with it and checks that the token permits
+// the route of the request
+func (h *tokenHTTPHandler) VerifyAPIToken(r *http.Request, token string) (*model.APIToken, string, error) {
+	apiToken, err := h.storage.GetAPITokenByHash(r.Context(), model.HashAPIToken(token))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if apiToken.IsExpired(time.Now()) {
+		return nil, "", errAPITokenExpired
+	}
+
+	dataKey, err := apiToken.UnwrapDataKey(token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	permission, ok := h.routePermission(r)
+	if !ok || (permission == model.APITokenReadWrite && !apiToken.CanWrite()) {
+		return nil, "", fmt.Errorf("%s %s: %w", r.Method, r.URL.Path, constant.ErrForbidden)
+	}
+
+	if err = h.storage.TouchAPIToken(r.Context(), apiToken.ID); err != nil {
+		// The time of the last use is informational, it must not break the request
+		log.Printf("VerifyAPIToken error: %s\n", err.Error())
+	}
+
+	return apiToken, dataKey, nil
+}
+
+// routePermission - returns the permission which the route of the request requires from a token
+func (h *tokenHTTPHandler) routePermission(r *http.Request) (string, bool) {
+	if h.routes == nil {
+		return "", false
+	}
+
+	rctx := chi.NewRouteContext()
+	if !h.routes.Match(rctx, r.Method, r.URL.Path) {
+		return "", false
+	}
+
+	permission, ok := apiTokenRoutes[r.Method+" "+rctx.RoutePattern()]
+
+	return permission, ok
+}
+
+// getDataKey - returns the data key of the user. A request which is authenticated with an API token
+// carries the key which is unwrapped with the token, otherwise the key is taken from the cache.
+func getDataKey(r *http.Request, cache keyCache, login string) (string, error) {
+	if dataKey, ok := r.Context().Value(api.ContextDataKey).(string); ok {
+		return dataKey, nil
+	}
+
+	return cache.Get(login)
+}
+
+// apiTokenFromContext - returns the token which the request is authenticated with, or nil
+func apiTokenFromContext(r *http.Request) *model.APIToken {
+	apiToken, _ := r.Context().Value(api.ContextAPIToken).(*model.APIToken)
+
+	return apiToken
+}
+
+// tokenAllowsSecret - checks that the token of the request, if there is any, can access the secret
+func tokenAllowsSecret(r *http.Request, secretID string) bool {
+	apiToken := apiTokenFromContext(r)
+	if apiToken == nil {
+		return true
+	}
+
+	id, err := strconv.ParseInt(secretID, 10, 64)
+
+	return err == nil && apiToken.AllowsSecret(id)
+}
+
+// tokenAllowsVaultSecret - checks that the token of the request, if there is any, can access the secret
+// of the vault. Either the whole vault or the secret itself can be allowed.
+func tokenAllowsVaultSecret(r *http.Request, vaultID int64, secretID string) bool {
+	apiToken := apiTokenFromContext(r)
+
+	return apiToken == nil || apiToken.AllowsVault(vaultID) || tokenAllowsSecret(r, secretID)
+}
+
+// filterTokenSecrets - removes secrets which the token of the request can't access
+func filterTokenSecrets(r *http.Request, secrets map[int]*model.Secret) {
+	apiToken := apiTokenFromContext(r)
+	if apiToken == nil {
+		return
+	}
+
+	for id, secret := range secrets {
+		if !apiToken.AllowsSecret(secret.ID) {
+			delete(secrets, id)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+func newAPITokenTestStorage() *MockStorage {
+	return &MockStorage{
+		users:     map[string]*model.User{},
+		apiTokens: map[int64]model.APIToken{},
+	}
+}
+
+// addTestAPIToken - saves a token of the user and returns the token itself
+func addTestAPIToken(t *testing.T, storage *MockStorage, apiToken model.APIToken) string {
+	t.Helper()
+
+	token, err := apiToken.GenerateToken("mock data key")
+	require.NoError(t, err)
+	require.NoError(t, storage.AddAPIToken(context.Background(), &apiToken))
+
+	return token
+}
+
+func TestAPITokenHandlers(t *testing.T) {
+	const password = "Password-1"
+
+	storage := newAPITokenTestStorage()
+	for _, login := range []string{"validLogin", "recipient", "team_reader", "invalid_user"} {
+		user, err := model.NewUser(login, password)
+		require.NoError(t, err)
+		storage.users[login] = user
+	}
+
+	h := tokenHTTPHandler{
+		config:    config.AppConfig{APITokenMaxLifetime: 24 * time.Hour},
+		storage:   storage,
+		keyCache:  &MockKeyCache{getReturnValue: "mock data key"},
+		throttler: newTestLoginThrottler(),
+	}
+
+	router := chi.NewRouter()
+	router.Get("/tokens", h.ListTokensHandler)
+	router.Post("/tokens", h.CreateTokenHandler)
+	router.Delete("/tokens/{id}", h.DeleteTokenHandler)
+
+	serve := func(method, url, login string, body any) *httptest.ResponseRecorder {
+		var payload bytes.Buffer
+		require.NoError(t, json.NewEncoder(&payload).Encode(body))
+
+		req := httptest.NewRequest(method, url, &payload)
+		req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, login))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	invalidRequests := []apiTokenRequest{
+		{Permission: model.APITokenRead},
+		{Name: "ci", Permission: "admin"},
+		{Name: "ci", Permission: model.APITokenRead, ExpiresAt: lo.ToPtr(time.Now().Add(48 * time.Hour))},
+		{Name: "ci", Permission: model.APITokenRead, ExpiresAt: lo.ToPtr(time.Now().Add(-time.Hour))},
+		{Name: "ci", Permission: model.APITokenRead, SecretIDs: []int64{99}},
+		{Name: "ci", Permission: model.APITokenRead, VaultIDs: []int64{1}},
+	}
+	for _, request := range invalidRequests {
+		rr := serve(http.MethodPost, "/tokens", "validLogin", request)
+		require.Equal(t, http.StatusBadRequest, rr.Code, request)
+	}
+
+	// Secrets which are shared with the user and vaults of the user's teams are allowed too
+	rr := serve(http.MethodPost, "/tokens", "recipient", apiTokenRequest{
+		Name:       "ci",
+		Permission: model.APITokenRead,
+		SecretIDs:  []int64{1},
+		Password:   password,
+	})
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	rr = serve(http.MethodPost, "/tokens", "team_reader", apiTokenRequest{
+		Name:       "ci",
+		Permission: model.APITokenRead,
+		VaultIDs:   []int64{1},
+		Password:   password,
+	})
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	request := apiTokenRequest{Name: "ci", Permission: model.APITokenRead, Password: password}
+	rr = serve(http.MethodPost, "/tokens", "invalid_user", request)
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// An access token alone is not enough to get a copy of the data key
+	request = apiTokenRequest{Name: "ci", Permission: model.APITokenReadWrite}
+	rr = serve(http.MethodPost, "/tokens", "validLogin", request)
+	require.Equal(t, http.StatusForbidden, rr.Code)
+
+	request.Password = "Wrong-Password-1"
+	rr = serve(http.MethodPost, "/tokens", "validLogin", request)
+	require.Equal(t, http.StatusForbidden, rr.Code)
+
+	request.Password = password
+	rr = serve(http.MethodPost, "/tokens", "validLogin", request)
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	var created struct {
+		Data apiTokenResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	require.Contains(t, created.Data.Token, model.APITokenPrefix)
+	require.WithinDuration(t, time.Now().Add(24*time.Hour), created.Data.APIToken.ExpiresAt, time.Minute)
+
+	// The token itself is not kept, the data key can be unwrapped only with the token from the response
+	saved, err := storage.GetAPITokenByHash(context.Background(), model.HashAPIToken(created.Data.Token))
+	require.NoError(t, err)
+	dataKey, err := saved.UnwrapDataKey(created.Data.Token)
+	require.NoError(t, err)
+	require.Equal(t, "mock data key", dataKey)
+
+	rr = serve(http.MethodGet, "/tokens", "validLogin", nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.NotContains(t, rr.Body.String(), created.Data.Token)
+	require.NotContains(t, rr.Body.String(), saved.Hash)
+
+	var listed struct {
+		Data []model.APIToken `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listed))
+	require.Len(t, listed.Data, 1)
+	require.Equal(t, "ci", listed.Data[0].Name)
+
+	// Tokens of other users can't be revoked
+	rr = serve(http.MethodDelete, "/tokens/1", "validLogin", nil)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = serve(http.MethodDelete, "/tokens/invalid", "validLogin", nil)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = serve(http.MethodDelete, "/tokens/3", "validLogin", nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	_, err = storage.GetAPITokenByHash(context.Background(), saved.Hash)
+	require.Error(t, err)
+}
+
+func TestVerifyAPIToken(t *testing.T) {
+	storage := newAPITokenTestStorage()
+	// Tokens of unknown users are rejected, like tokens of disabled users
+	storage.users["validLogin"] = &model.User{Login: "validLogin", Role: model.UserRoleUser}
+	router := NewHTTPRouter(appConfig, storage, newTestServices(t, appConfig))
+
+	expiresAt := time.Now().Add(time.Hour)
+	readToken := addTestAPIToken(t, storage, model.APIToken{
+		Login:      "validLogin",
+		Permission: model.APITokenRead,
+		ExpiresAt:  expiresAt,
+	})
+	limitedToken := addTestAPIToken(t, storage, model.APIToken{
+		Login:      "validLogin",
+		Permission: model.APITokenReadWrite,
+		SecretIDs:  []int64{7},
+		ExpiresAt:  expiresAt,
+	})
+	expiredToken := addTestAPIToken(t, storage, model.APIToken{
+		Login:      "validLogin",
+		Permission: model.APITokenRead,
+		ExpiresAt:  time.Now().Add(-time.Minute),
+	})
+
+	testCases := []struct {
+		name           string
+		method         string
+		url            string
+		token          string
+		httpStatusCode int
+		secretsFound   int
+	}{
+		{
+			name:           "read token lists secrets",
+			method:         http.MethodGet,
+			url:            "/api/v1/secrets/search?q=git",
+			token:          readToken,
+			httpStatusCode: http.StatusOK,
+			secretsFound:   1,
+		},
+		{
+			name:           "limited token sees only its secrets in the list",
+			method:         http.MethodGet,
+			url:            "/api/v1/secrets/",
+			token:          limitedToken,
+			httpStatusCode: http.StatusOK,
+			secretsFound:   0,
+		},
+		{
+			name:           "limited token sees only its secrets",
+			method:         http.MethodGet,
+			url:            "/api/v1/secrets/search?q=git",
+			token:          limitedToken,
+			httpStatusCode: http.StatusOK,
+			secretsFound:   0,
+		},
+		{
+			name:           "limited token can't read other secrets",
+			method:         http.MethodGet,
+			url:            "/api/v1/secrets/1",
+			token:          limitedToken,
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "limited token can't create secrets",
+			method:         http.MethodPost,
+			url:            "/api/v1/secrets/",
+			token:          limitedToken,
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "read token can't change secrets",
+			method:         http.MethodDelete,
+			url:            "/api/v1/secrets/1",
+			token:          readToken,
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "route is not allowed for tokens",
+			method:         http.MethodGet,
+			url:            "/api/v1/secrets/recent",
+			token:          readToken,
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "tokens can't manage tokens",
+			method:         http.MethodGet,
+			url:            "/api/v1/user/tokens/",
+			token:          readToken,
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "expired token",
+			method:         http.MethodGet,
+			url:            "/api/v1/secrets/search?q=git",
+			token:          expiredToken,
+			httpStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "unknown token",
+			method:         http.MethodGet,
+			url:            "/api/v1/secrets/search?q=git",
+			token:          readToken + "A",
+			httpStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(`{"title":"new"}`))
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.httpStatusCode, rr.Code, rr.Body.String())
+
+			if tc.httpStatusCode == http.StatusOK {
+				var response struct {
+					Data map[int]*model.Secret `json:"data"`
+				}
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				require.Len(t, response.Data, tc.secretsFound)
+			}
+		})
+	}
+
+	tokens, err := storage.GetAPITokens(context.Background(), "validLogin")
+	require.NoError(t, err)
+	for _, apiToken := range tokens {
+		// Only verified tokens are marked as used
+		require.Equal(t, apiToken.IsExpired(time.Now()), apiToken.LastUsedAt == nil)
+	}
+
+	// Revoking sessions deletes API tokens of the user, the tokens which are created later are accepted,
+	// though the storage keeps the time of creation in seconds
+	revokedAt := time.Now()
+	require.NoError(t, storage.RevokeUserSessions(context.Background(), "validLogin", revokedAt))
+	tokens, err = storage.GetAPITokens(context.Background(), "validLogin")
+	require.NoError(t, err)
+	require.Empty(t, tokens)
+
+	readToken = addTestAPIToken(t, storage, model.APIToken{
+		Login:      "validLogin",
+		Permission: model.APITokenRead,
+		ExpiresAt:  expiresAt,
+	})
+	for id, apiToken := range storage.apiTokens {
+		apiToken.CreatedAt = revokedAt.Truncate(time.Second)
+		storage.apiTokens[id] = apiToken
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/search?q=git", nil)
+	req.Header.Set("Authorization", "Bearer "+readToken)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+}
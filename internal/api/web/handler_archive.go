@@ -0,0 +1,609 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/api/utils"
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/importer"
+	"github.com/grafviktor/keep-my-secret/internal/kdbx"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+	"github.com/grafviktor/keep-my-secret/internal/vaultarchive"
+)
+
+// archivePasswordHeader - archive password is passed in a header, so it doesn't get into access logs
+const archivePasswordHeader = "X-Archive-Password"
+
+// keePassDatabaseName - name of the exported KeePass database and its root group
+const keePassDatabaseName = "Keep My Secret"
+
+// maxArchiveSize - maximum size of an imported archive in bytes
+var maxArchiveSize int64 = 64 * 1024 * 1024
+
+const (
+	// maxConcurrentImports - keys of imported files are derived with parameters which are chosen by the author
+	// of the file, so only a few imports can run at once, other requests are rejected
+	maxConcurrentImports = 2
+	// importRetryAfter - when the client may try again if all import slots are busy
+	importRetryAfter = 10 * time.Second
+)
+
+// importSlots - imports which are running now, shared by all users
+var importSlots = make(chan struct{}, maxConcurrentImports)
+
+// acquireImportSlot - returns false and writes the response if too many imports are running,
+// otherwise the slot must be released with releaseImportSlot
+func acquireImportSlot(w http.ResponseWriter) bool {
+	select {
+	case importSlots <- struct{}{}:
+		return true
+	default:
+		writeTooManyRequests(w, importRetryAfter)
+
+		return false
+	}
+}
+
+func releaseImportSlot() {
+	<-importSlots
+}
+
+// Strategies of handling imported secrets which already exist in the vault
+const (
+	conflictSkip     = "skip"
+	conflictReplace  = "replace"
+	conflictKeepBoth = "keep_both"
+)
+
+// Actions which are taken on an imported secret
+const (
+	actionImport  = "import"
+	actionReplace = "replace"
+	actionSkip    = "skip"
+)
+
+type importResult struct {
+	Imported int `json:"imported"`
+	Replaced int `json:"replaced"`
+	Skipped  int `json:"skipped"`
+	// Errors - items of the imported file which cannot be converted into secrets
+	Errors []importer.ItemError `json:"errors,omitempty"`
+	// Preview - what would happen with every secret, it's returned only if the import is a dry run
+	Preview []importPreview `json:"preview,omitempty"`
+}
+
+type importPreview struct {
+	Item   int    `json:"item"`
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Action string `json:"action"`
+}
+
+// importOptions - reads "conflict" and "dry_run" query parameters of an import request
+func importOptions(r *http.Request) (conflict string, dryRun bool, err error) {
+	conflict = r.URL.Query().Get("conflict")
+	if conflict == "" {
+		conflict = conflictSkip
+	}
+
+	if conflict != conflictSkip && conflict != conflictReplace && conflict != conflictKeepBoth {
+		return "", false, errors.New("unknown conflict strategy")
+	}
+
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			return "", false, errors.New("invalid dry_run value")
+		}
+	}
+
+	return conflict, dryRun, nil
+}
+
+// secretIdentity - secrets of the same type with the same title and login are considered duplicates
+func secretIdentity(secret *model.Secret) string {
+	return fmt.Sprintf("%s\x00%s\x00%s", secret.Type, secret.Title, secret.Login)
+}
+
+// getDecryptedSecrets - returns all personal secrets of the user ordered by identifier
+//
+//nolint:lll
+func (a *apiRouteProvider) getDecryptedSecrets(ctx context.Context, login, dataKey string) ([]*model.Secret, error) {
+	secrets, err := a.storage.GetSecretsByUser(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = decryptSecrets(secrets, dataKey, login); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(secrets))
+	for id := range secrets {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	result := make([]*model.Secret, 0, len(secrets))
+	for _, id := range ids {
+		result = append(result, secrets[id])
+	}
+
+	return result, nil
+}
+
+// checkArchivePassword - archive password must be different from the login password, otherwise anyone
+// who gets the archive could use it to guess the password of the account
+func (a *apiRouteProvider) checkArchivePassword(ctx context.Context, password, login string) error {
+	if violations := a.passwordPolicy.CheckPassword("password", password, login); len(violations) > 0 {
+		return fmt.Errorf("archive password doesn't conform to the password policy: %s", violations[0].Message)
+	}
+
+	user, err := a.storage.GetUser(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	matches, err := user.PasswordMatches(password)
+	if err != nil {
+		return err
+	}
+
+	if matches {
+		return errors.New("archive password must differ from the login password")
+	}
+
+	return nil
+}
+
+// ExportVaultHandler - HTTP handler that returns all personal secrets of the user, including
+// file attachments, as an archive encrypted with the password from X-Archive-Password header
+func (a *apiRouteProvider) ExportVaultHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("ExportVaultHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	password := r.Header.Get(archivePasswordHeader)
+	err = a.checkArchivePassword(r.Context(), password, login)
+	if err != nil {
+		log.Printf("ExportVaultHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: err.Error(),
+			Data:    nil,
+		})
+
+		return
+	}
+
+	// The archive is built in memory, so a failure doesn't leave the client with a truncated file
+	archive := bytes.Buffer{}
+	secrets, err := a.getDecryptedSecrets(r.Context(), login, key)
+	if err == nil {
+		err = vaultarchive.Write(&archive, secrets, password, vaultarchive.DefaultParams)
+	}
+
+	if err != nil {
+		log.Printf("ExportVaultHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	if err = writeExportedFile(w, "kmsx", archive.Bytes()); err != nil {
+		log.Printf("ExportVaultHandler error: %s\n", err.Error())
+	}
+}
+
+// writeExportedFile - sends exported vault as a file attachment, which must not be cached
+func writeExportedFile(w http.ResponseWriter, extension string, data []byte) error {
+	fileName := fmt.Sprintf("kms-vault-%s.%s", time.Now().UTC().Format("20060102"), extension)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	_, err := w.Write(data)
+
+	return err
+}
+
+// keePassParams - reads Argon2id parameters of an exported KeePass database from "iterations",
+// "memory" (in MiB) and "parallelism" query parameters. Omitted parameters get default values.
+func keePassParams(r *http.Request) (kdbx.Params, error) {
+	params := kdbx.DefaultParams
+	query := r.URL.Query()
+
+	values := []struct {
+		name       string
+		multiplier uint64
+		set        func(value uint64)
+	}{
+		{"iterations", 1, func(value uint64) { params.Iterations = value }},
+		{"memory", 1024 * 1024, func(value uint64) { params.Memory = value }},
+		{"parallelism", 1, func(value uint64) { params.Parallelism = uint32(value) }},
+	}
+
+	for _, v := range values {
+		if query.Get(v.name) == "" {
+			continue
+		}
+
+		value, err := strconv.ParseUint(query.Get(v.name), 10, 32)
+		if err != nil {
+			return params, fmt.Errorf("invalid %s value", v.name)
+		}
+
+		v.set(value * v.multiplier)
+	}
+
+	return params, params.Validate()
+}
+
+// newKeePassDatabase - converts secrets into KeePass entries. Card details become custom fields,
+// a file becomes an attachment of the entry.
+func newKeePassDatabase(secrets []*model.Secret) (*kdbx.Database, error) {
+	rootUUID, err := kdbx.NewUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	root := &kdbx.Group{UUID: rootUUID, Name: keePassDatabaseName}
+	db := &kdbx.Database{
+		Meta:     kdbx.Meta{Generator: keePassDatabaseName, DatabaseName: keePassDatabaseName},
+		Root:     kdbx.Root{Groups: []*kdbx.Group{root}},
+		Binaries: make([][]byte, 0),
+	}
+
+	now := time.Now()
+	for _, secret := range secrets {
+		entry := &kdbx.Entry{}
+		if entry.UUID, err = kdbx.NewUUID(); err != nil {
+			return nil, err
+		}
+
+		createdAt := now
+		if secret.CreatedAt != nil {
+			createdAt = *secret.CreatedAt
+		}
+
+		updatedAt := createdAt
+		if secret.UpdatedAt != nil {
+			updatedAt = *secret.UpdatedAt
+		}
+
+		entry.Times = kdbx.Times{
+			CreationTime:         kdbx.FormatTime(createdAt),
+			LastModificationTime: kdbx.FormatTime(updatedAt),
+			ExpiryTime:           kdbx.FormatTime(updatedAt),
+		}
+
+		if secret.ExpiresAt != nil {
+			entry.Times.ExpiryTime = kdbx.FormatTime(*secret.ExpiresAt)
+			entry.Times.Expires = true
+		}
+
+		// Standard fields are always present, custom fields only if they have a value
+		fields := []struct {
+			key       string
+			value     string
+			protected bool
+			custom    bool
+		}{
+			{kdbx.FieldTitle, secret.Title, false, false},
+			{kdbx.FieldUserName, secret.Login, false, false},
+			{kdbx.FieldPassword, secret.Password, true, false},
+			{kdbx.FieldURL, secret.URL, false, false},
+			{kdbx.FieldNotes, secret.Note, false, false},
+			{"Cardholder name", secret.CardholderName, false, true},
+			{"Card number", secret.CardNumber, true, true},
+			{"Expiration", secret.Expiration, false, true},
+			{"Security code", secret.SecurityCode, true, true},
+		}
+
+		for _, f := range fields {
+			if f.custom && f.value == "" {
+				continue
+			}
+
+			entry.Strings = append(entry.Strings, kdbx.String{
+				Key:   f.key,
+				Value: kdbx.StringValue{Protected: kdbx.Bool(f.protected), Content: f.value},
+			})
+		}
+
+		if len(secret.File) > 0 {
+			ref := kdbx.BinaryRef{Key: secret.FileName}
+			if ref.Key == "" {
+				ref.Key = secret.Title
+			}
+
+			ref.Value.Ref = strconv.Itoa(len(db.Binaries))
+			db.Binaries = append(db.Binaries, secret.File)
+			entry.Binaries = append(entry.Binaries, ref)
+		}
+
+		root.Entries = append(root.Entries, entry)
+	}
+
+	return db, nil
+}
+
+// ExportKeePassHandler - HTTP handler that returns all personal secrets of the user as a KeePass KDBX 4 database,
+// which can be opened without the server. The database is protected with the password from X-Archive-Password
+// header, the key is derived with Argon2id, which parameters can be changed with "iterations", "memory" (in MiB)
+// and "parallelism" query parameters.
+func (a *apiRouteProvider) ExportKeePassHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("ExportKeePassHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	password := r.Header.Get(archivePasswordHeader)
+	params, err := keePassParams(r)
+	if err == nil {
+		err = a.checkArchivePassword(r.Context(), password, login)
+	}
+
+	if err != nil {
+		log.Printf("ExportKeePassHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: err.Error(),
+			Data:    nil,
+		})
+
+		return
+	}
+
+	var db *kdbx.Database
+	database := bytes.Buffer{}
+	secrets, err := a.getDecryptedSecrets(r.Context(), login, key)
+	if err == nil {
+		db, err = newKeePassDatabase(secrets)
+	}
+
+	if err == nil {
+		err = kdbx.Write(&database, db, password, params)
+	}
+
+	if err != nil {
+		log.Printf("ExportKeePassHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	if err = writeExportedFile(w, "kdbx", database.Bytes()); err != nil {
+		log.Printf("ExportKeePassHandler error: %s\n", err.Error())
+	}
+}
+
+// ImportVaultHandler - HTTP handler that restores secrets from an archive created by ExportVaultHandler.
+// The archive is passed in the request body, its password in X-Archive-Password header. The "conflict" query
+// parameter defines what happens with secrets which already exist: "skip" (default), "replace" or "keep_both".
+// If "dry_run" query parameter is true, nothing is saved and the response contains a preview of the import.
+func (a *apiRouteProvider) ImportVaultHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("ImportVaultHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	if !acquireImportSlot(w) {
+		log.Printf("ImportVaultHandler error: too many imports are running\n")
+
+		return
+	}
+	defer releaseImportSlot()
+
+	var secrets []*model.Secret
+	conflict, dryRun, err := importOptions(r)
+	if err == nil {
+		body := http.MaxBytesReader(w, r.Body, maxArchiveSize)
+		secrets, err = vaultarchive.Read(body, r.Header.Get(archivePasswordHeader))
+	}
+
+	if err != nil {
+		log.Printf("ImportVaultHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: err.Error(),
+			Data:    nil,
+		})
+
+		return
+	}
+
+	items := make([]importer.Item, 0, len(secrets))
+	for i, secret := range secrets {
+		items = append(items, importer.Item{Index: i + 1, Secret: secret})
+	}
+
+	result, err := a.importSecrets(r.Context(), items, conflict, dryRun, login, key)
+	if err != nil {
+		log.Printf("ImportVaultHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   result,
+	})
+}
+
+// ImportFormatHandler - HTTP handler that imports secrets from a file exported by another password manager.
+// The format is a part of the path, see importer package for the list of supported formats. The file is passed
+// in the request body, the master password of an encrypted file in X-Archive-Password header. Query parameters
+// are the same as ImportVaultHandler has. Items which cannot be imported are listed in the response.
+func (a *apiRouteProvider) ImportFormatHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("ImportFormatHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	if !acquireImportSlot(w) {
+		log.Printf("ImportFormatHandler error: too many imports are running\n")
+
+		return
+	}
+	defer releaseImportSlot()
+
+	var data []byte
+	var parsed *importer.Result
+	conflict, dryRun, err := importOptions(r)
+	if err == nil {
+		data, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxArchiveSize))
+	}
+
+	if err == nil {
+		parsed, err = importer.Parse(chi.URLParam(r, "format"), data, r.Header.Get(archivePasswordHeader))
+	}
+
+	if err != nil {
+		log.Printf("ImportFormatHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: err.Error(),
+			Data:    nil,
+		})
+
+		return
+	}
+
+	result, err := a.importSecrets(r.Context(), parsed.Items, conflict, dryRun, login, key)
+	if err != nil {
+		log.Printf("ImportFormatHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	result.Errors = parsed.Errors
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   result,
+	})
+}
+
+// importSecrets - saves imported secrets and counts them. If dryRun is true, nothing is saved, instead
+// the result contains a preview of actions which would be taken.
+//
+//nolint:lll
+func (a *apiRouteProvider) importSecrets(ctx context.Context, items []importer.Item, conflict string, dryRun bool, login, dataKey string) (importResult, error) {
+	result := importResult{}
+
+	existing, err := a.getDecryptedSecrets(ctx, login, dataKey)
+	if err != nil {
+		return result, err
+	}
+
+	existingIDs := make(map[string]int64, len(existing))
+	for _, secret := range existing {
+		existingIDs[secretIdentity(secret)] = secret.ID
+	}
+
+	for _, item := range items {
+		secret := item.Secret
+		id, found := existingIDs[secretIdentity(secret)]
+
+		action := actionImport
+		switch {
+		case found && conflict == conflictSkip:
+			action = actionSkip
+			result.Skipped++
+		case found && conflict == conflictReplace:
+			action = actionReplace
+			// The file may contain the same secret twice, the replaced secret cannot be replaced again
+			delete(existingIDs, secretIdentity(secret))
+			result.Replaced++
+		default:
+			result.Imported++
+		}
+
+		if dryRun {
+			result.Preview = append(result.Preview, importPreview{
+				Item:   item.Index,
+				Type:   secret.Type,
+				Title:  secret.Title,
+				Action: action,
+			})
+
+			continue
+		}
+
+		if action == actionSkip {
+			continue
+		}
+
+		if action == actionReplace {
+			if err = a.storage.DeleteSecret(ctx, fmt.Sprintf("%d", id), login); err != nil {
+				return result, err
+			}
+		}
+
+		if err = a.createSecret(ctx, secret, login, dataKey); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,489 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/importer"
+	"github.com/grafviktor/keep-my-secret/internal/kdbx"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+	"github.com/grafviktor/keep-my-secret/internal/policy"
+	"github.com/grafviktor/keep-my-secret/internal/vaultarchive"
+)
+
+// newArchiveTestProvider - creates a route provider with "validLogin", whose secrets can be exported,
+// and "other_user", whose secrets cannot be read from the storage. Both users have "password" password.
+func newArchiveTestProvider(t *testing.T) *apiRouteProvider {
+	t.Helper()
+
+	users := make(map[string]*model.User)
+	for _, login := range []string{"validLogin", "other_user"} {
+		user, err := model.NewUser(login, "password")
+		require.NoError(t, err)
+
+		users[login] = user
+	}
+
+	return &apiRouteProvider{
+		config:   config.AppConfig{},
+		storage:  &MockStorage{users: users},
+		keyCache: &MockKeyCache{getReturnValue: "mock data key"},
+
+		passwordPolicy: &policy.Policy{},
+	}
+}
+
+func newArchiveRequest(method, path, login, password string, body []byte) *http.Request {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if password != "" {
+		req.Header.Set(archivePasswordHeader, password)
+	}
+
+	return req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, login))
+}
+
+func TestExportVaultHandler(t *testing.T) {
+	handler := newArchiveTestProvider(t)
+	router := chi.NewRouter()
+	router.Get("/vault/export", handler.ExportVaultHandler)
+
+	testCases := []struct {
+		name           string
+		login          string
+		password       string
+		httpStatusCode int
+	}{
+		{
+			name:           "vault is exported",
+			login:          "validLogin",
+			password:       "archive password",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "archive password is required",
+			login:          "validLogin",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "login password cannot protect the archive",
+			login:          "validLogin",
+			password:       "password",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "storage error",
+			login:          "other_user",
+			password:       "archive password",
+			httpStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "key cache error",
+			login:          "invalid_user",
+			password:       "archive password",
+			httpStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newArchiveRequest("GET", "/vault/export", tc.login, tc.password, nil))
+
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+		})
+	}
+
+	t.Run("archive contains secrets with files", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newArchiveRequest("GET", "/vault/export", "validLogin", "archive password", nil))
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "application/octet-stream", rr.Header().Get("Content-Type"))
+		require.Contains(t, rr.Header().Get("Content-Disposition"), ".kmsx")
+
+		secrets, err := vaultarchive.Read(rr.Body, "archive password")
+		require.NoError(t, err)
+		require.Len(t, secrets, 2)
+		require.Equal(t, []byte("Mock file content 1"), secrets[0].File)
+		require.Equal(t, []byte("Mock file content 2"), secrets[1].File)
+	})
+}
+
+func TestExportKeePassHandler(t *testing.T) {
+	handler := newArchiveTestProvider(t)
+	router := chi.NewRouter()
+	router.Get("/vault/export/kdbx", handler.ExportKeePassHandler)
+
+	// weakParams - keep the test fast, the memory is set in MiB
+	weakParams := "?iterations=1&memory=1&parallelism=1"
+
+	testCases := []struct {
+		name           string
+		login          string
+		query          string
+		password       string
+		httpStatusCode int
+	}{
+		{
+			name:           "vault is exported",
+			login:          "validLogin",
+			query:          weakParams,
+			password:       "database password",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "database password is required",
+			login:          "validLogin",
+			query:          weakParams,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "login password cannot protect the database",
+			login:          "validLogin",
+			query:          weakParams,
+			password:       "password",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "too expensive key derivation",
+			login:          "validLogin",
+			query:          "?memory=4096",
+			password:       "database password",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid key derivation parameter",
+			login:          "validLogin",
+			query:          "?iterations=many",
+			password:       "database password",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "storage error",
+			login:          "other_user",
+			query:          weakParams,
+			password:       "database password",
+			httpStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "key cache error",
+			login:          "invalid_user",
+			query:          weakParams,
+			password:       "database password",
+			httpStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newArchiveRequest("GET", "/vault/export/kdbx"+tc.query, tc.login, tc.password, nil))
+
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+		})
+	}
+
+	t.Run("database contains secrets with attachments", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := newArchiveRequest("GET", "/vault/export/kdbx"+weakParams, "validLogin", "database password", nil)
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Contains(t, rr.Header().Get("Content-Disposition"), ".kdbx")
+
+		db, err := kdbx.Open(rr.Body.Bytes(), "database password")
+		require.NoError(t, err)
+
+		entries := db.Entries()
+		require.Len(t, entries, 2)
+		for i, entry := range entries {
+			require.Len(t, entry.Binaries, 1)
+
+			var content []byte
+			content, err = db.Attachment(entry.Binaries[0])
+			require.NoError(t, err)
+			require.Equal(t, []byte(fmt.Sprintf("Mock file content %d", i+1)), content)
+		}
+	})
+}
+
+func TestNewKeePassDatabase(t *testing.T) {
+	expiresAt := time.Date(2027, 8, 1, 0, 0, 0, 0, time.UTC)
+	secrets := []*model.Secret{
+		{
+			Type:     model.SecretTypePassword,
+			Title:    "mail",
+			Login:    "tony",
+			Password: "secret",
+			URL:      "https://mail.example.com",
+			Note:     "note",
+		},
+		{
+			Type:           model.SecretTypeCard,
+			Title:          "visa",
+			CardholderName: "TONY TESTER",
+			CardNumber:     "4111111111111111",
+			Expiration:     "07/2027",
+			SecurityCode:   "123",
+			ExpiresAt:      &expiresAt,
+		},
+	}
+
+	db, err := newKeePassDatabase(secrets)
+	require.NoError(t, err)
+
+	entries := db.Entries()
+	require.Len(t, entries, 2)
+	require.Empty(t, db.Binaries)
+
+	require.Equal(t, "tony", entries[0].Get(kdbx.FieldUserName))
+	require.Equal(t, "secret", entries[0].Get(kdbx.FieldPassword))
+	require.Equal(t, "https://mail.example.com", entries[0].Get(kdbx.FieldURL))
+	require.Equal(t, "note", entries[0].Get(kdbx.FieldNotes))
+	require.Empty(t, entries[0].CustomFields())
+	require.False(t, bool(entries[0].Times.Expires))
+
+	custom := entries[1].CustomFields()
+	require.Equal(t, []kdbx.String{
+		{Key: "Cardholder name", Value: kdbx.StringValue{Content: "TONY TESTER"}},
+		{Key: "Card number", Value: kdbx.StringValue{Protected: true, Content: "4111111111111111"}},
+		{Key: "Expiration", Value: kdbx.StringValue{Content: "07/2027"}},
+		{Key: "Security code", Value: kdbx.StringValue{Protected: true, Content: "123"}},
+	}, custom)
+
+	expires, ok := kdbx.ParseTime(entries[1].Times.ExpiryTime)
+	require.True(t, ok)
+	require.True(t, bool(entries[1].Times.Expires))
+	require.Equal(t, expiresAt, expires)
+	require.NotEqual(t, entries[0].UUID, entries[1].UUID)
+}
+
+func TestImportVaultHandler(t *testing.T) {
+	handler := newArchiveTestProvider(t)
+	router := chi.NewRouter()
+	router.Post("/vault/import", handler.ImportVaultHandler)
+
+	// The first secret is the same as secrets which are returned by the mock storage
+	archive := bytes.Buffer{}
+	secrets := []*model.Secret{{}, {Type: model.SecretTypeNote, Title: "new note", Note: "text"}}
+	params := vaultarchive.Params{Time: 1, Memory: 1024, Threads: 1}
+	require.NoError(t, vaultarchive.Write(&archive, secrets, "archive password", params))
+
+	testCases := []struct {
+		name           string
+		login          string
+		query          string
+		password       string
+		httpStatusCode int
+		want           importResult
+	}{
+		{
+			name:           "existing secrets are skipped by default",
+			login:          "validLogin",
+			password:       "archive password",
+			httpStatusCode: http.StatusOK,
+			want:           importResult{Imported: 1, Skipped: 1},
+		},
+		{
+			name:           "existing secrets are replaced",
+			login:          "validLogin",
+			query:          "?conflict=replace",
+			password:       "archive password",
+			httpStatusCode: http.StatusOK,
+			want:           importResult{Imported: 1, Replaced: 1},
+		},
+		{
+			name:           "both secrets are kept",
+			login:          "validLogin",
+			query:          "?conflict=keep_both",
+			password:       "archive password",
+			httpStatusCode: http.StatusOK,
+			want:           importResult{Imported: 2},
+		},
+		{
+			name:           "dry run doesn't change the vault",
+			login:          "validLogin",
+			query:          "?dry_run=true",
+			password:       "archive password",
+			httpStatusCode: http.StatusOK,
+			want: importResult{Imported: 1, Skipped: 1, Preview: []importPreview{
+				{Item: 1, Action: actionSkip},
+				{Item: 2, Type: model.SecretTypeNote, Title: "new note", Action: actionImport},
+			}},
+		},
+		{
+			name:           "invalid dry run value",
+			login:          "validLogin",
+			query:          "?dry_run=maybe",
+			password:       "archive password",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown conflict strategy",
+			login:          "validLogin",
+			query:          "?conflict=merge",
+			password:       "archive password",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "wrong archive password",
+			login:          "validLogin",
+			password:       "wrong password",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "storage error",
+			login:          "other_user",
+			password:       "archive password",
+			httpStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "key cache error",
+			login:          "invalid_user",
+			password:       "archive password",
+			httpStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := newArchiveRequest("POST", "/vault/import"+tc.query, tc.login, tc.password, archive.Bytes())
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+			if tc.httpStatusCode != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data importResult `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			require.Equal(t, tc.want, response.Data)
+		})
+	}
+}
+
+func TestImportFormatHandler(t *testing.T) {
+	handler := newArchiveTestProvider(t)
+	router := chi.NewRouter()
+	router.Post("/vault/import/{format}", handler.ImportFormatHandler)
+
+	csv := []byte("name,url,username,password\nMail,https://mail.example.com,tony,secret\n,,tony,secret\n")
+
+	testCases := []struct {
+		name           string
+		login          string
+		path           string
+		body           []byte
+		httpStatusCode int
+		want           importResult
+	}{
+		{
+			name:           "secrets are imported, invalid items are reported",
+			login:          "validLogin",
+			path:           "/vault/import/csv",
+			body:           csv,
+			httpStatusCode: http.StatusOK,
+			want: importResult{
+				Imported: 1,
+				Errors:   []importer.ItemError{{Item: 2, Error: importer.ErrMissingTitle.Error()}},
+			},
+		},
+		{
+			name:           "dry run",
+			login:          "validLogin",
+			path:           "/vault/import/csv?dry_run=1",
+			body:           csv,
+			httpStatusCode: http.StatusOK,
+			want: importResult{
+				Imported: 1,
+				Errors:   []importer.ItemError{{Item: 2, Error: importer.ErrMissingTitle.Error()}},
+				Preview:  []importPreview{{Item: 1, Type: model.SecretTypePassword, Title: "Mail", Action: actionImport}},
+			},
+		},
+		{
+			name:           "unknown format",
+			login:          "validLogin",
+			path:           "/vault/import/lastpass",
+			body:           csv,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid file",
+			login:          "validLogin",
+			path:           "/vault/import/bitwarden",
+			body:           csv,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "storage error",
+			login:          "other_user",
+			path:           "/vault/import/csv",
+			body:           csv,
+			httpStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "key cache error",
+			login:          "invalid_user",
+			path:           "/vault/import/csv",
+			body:           csv,
+			httpStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newArchiveRequest("POST", tc.path, tc.login, "", tc.body))
+
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+			if tc.httpStatusCode != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data importResult `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			require.Equal(t, tc.want, response.Data)
+		})
+	}
+}
+
+func TestImportIsRejectedWhenSlotsAreBusy(t *testing.T) {
+	handler := newArchiveTestProvider(t)
+	router := chi.NewRouter()
+	router.Post("/vault/import", handler.ImportVaultHandler)
+	router.Post("/vault/import/{format}", handler.ImportFormatHandler)
+
+	for i := 0; i < maxConcurrentImports; i++ {
+		importSlots <- struct{}{}
+	}
+	defer func() {
+		for i := 0; i < maxConcurrentImports; i++ {
+			releaseImportSlot()
+		}
+	}()
+
+	for _, path := range []string{"/vault/import", "/vault/import/csv"} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newArchiveRequest("POST", path, "validLogin", "", []byte("name,password\n")))
+
+		require.Equal(t, http.StatusTooManyRequests, rr.Code)
+		require.Equal(t, "10", rr.Header().Get("Retry-After"))
+	}
+}
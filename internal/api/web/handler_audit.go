@@ -0,0 +1,83 @@
+package web
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/api/utils"
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+const (
+	// defaultAuditLimit and maxAuditLimit - number of events which are returned by ListAuditEventsHandler
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// recordAuditEvent - appends an event to the audit log. A failure to write the audit log is only logged,
+// so it doesn't make the service unavailable. Handlers which are created without audit log don't record events.
+func recordAuditEvent(auditLog auditRecorder, r *http.Request, eventType, login, secretID string) {
+	if auditLog == nil {
+		return
+	}
+
+	event := &model.AuditEvent{
+		Type:       eventType,
+		Login:      login,
+		SecretID:   secretID,
+		RemoteAddr: utils.ClientIP(r),
+		UserAgent:  r.UserAgent(),
+	}
+
+	if err := auditLog.Record(r.Context(), event); err != nil {
+		log.Printf("Audit log error: cannot record %s event of '%s': %s\n", eventType, login, err.Error())
+	}
+}
+
+// ListAuditEventsHandler - HTTP handler that returns audit events of the user, newest events go first.
+// Events can be filtered by 'type', 'before' is the ID of the last event of the previous page.
+func (a *apiRouteProvider) ListAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+	query := r.URL.Query()
+
+	filter := model.AuditFilter{Type: query.Get("type"), Limit: defaultAuditLimit}
+	var err error
+	if value := query.Get("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err == nil && (filter.Limit <= 0 || filter.Limit > maxAuditLimit) {
+			err = strconv.ErrRange
+		}
+	}
+
+	if value := query.Get("before"); value != "" && err == nil {
+		filter.Before, err = strconv.ParseInt(value, 10, 64)
+	}
+
+	if err != nil {
+		log.Printf("ListAuditEventsHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	events, err := a.storage.GetAuditEvents(r.Context(), login, filter)
+	if err != nil {
+		log.Printf("ListAuditEventsHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   events,
+	})
+}
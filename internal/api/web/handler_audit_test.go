@@ -0,0 +1,146 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/audit"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+func TestListAuditEventsHandler(t *testing.T) {
+	handler := &apiRouteProvider{storage: &MockStorage{}}
+
+	testCases := []struct {
+		name           string
+		login          string
+		query          string
+		httpStatusCode int
+		wantIDs        []int64
+	}{
+		{
+			name:           "all events",
+			login:          "validLogin",
+			httpStatusCode: http.StatusOK,
+			wantIDs:        []int64{2, 1},
+		},
+		{
+			name:           "events of a type",
+			login:          "validLogin",
+			query:          "?type=login_success",
+			httpStatusCode: http.StatusOK,
+			wantIDs:        []int64{1},
+		},
+		{
+			name:           "next page",
+			login:          "validLogin",
+			query:          "?before=2&limit=10",
+			httpStatusCode: http.StatusOK,
+			wantIDs:        []int64{1},
+		},
+		{
+			name:           "limit is out of range",
+			login:          "validLogin",
+			query:          "?limit=5000",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid cursor",
+			login:          "validLogin",
+			query:          "?before=last",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "storage error",
+			login:          "other_user",
+			httpStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/audit"+tc.query, nil)
+			req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, tc.login))
+			rr := httptest.NewRecorder()
+
+			handler.ListAuditEventsHandler(rr, req)
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+
+			if tc.httpStatusCode != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data []*model.AuditEvent `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+
+			ids := make([]int64, 0, len(response.Data))
+			for _, event := range response.Data {
+				ids = append(ids, event.ID)
+			}
+			require.Equal(t, tc.wantIDs, ids)
+		})
+	}
+}
+
+func TestLoginAuditEvents(t *testing.T) {
+	storage := &MockStorage{users: map[string]*model.User{
+		"tony.tester@example.com": {
+			Login:          "tony.tester@example.com",
+			HashedPassword: "$2a$10$AokZyUVIqfgBtEwCNhOzbeE68Zk6uwZ42NvDdPK24Xesmb08OJ.DO",
+		},
+	}}
+	auditLog := &mockAuditLog{}
+	handler := newUserHandlerProvider(
+		appConfig, storage, auditLog, newTestLoginThrottler(), mockSecondFactor{},
+		newTestPolicy(t, appConfig), newTestKeys(t, appConfig),
+	)
+
+	for _, body := range []string{
+		`{"username":"tony.tester@example.com", "password":"wrong"}`,
+		`{"username":"unknown@example.com", "password":"wrong"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		handler.LoginHandler(rr, req)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+	}
+
+	require.Equal(t, []string{audit.EventLoginFailure, audit.EventLoginFailure}, auditLog.types())
+	require.Equal(t, "tony.tester@example.com", auditLog.events[0].Login)
+	require.Equal(t, "unknown@example.com", auditLog.events[1].Login)
+}
+
+func TestSecretAuditEvents(t *testing.T) {
+	auditLog := &mockAuditLog{}
+	handler := &apiRouteProvider{storage: &MockStorage{}, auditLog: auditLog}
+
+	router := chi.NewRouter()
+	router.Delete("/secrets/{id}", handler.DeleteSecretHandler)
+
+	req := httptest.NewRequest(http.MethodDelete, "/secrets/7", nil)
+	req.Header.Set("User-Agent", "test agent")
+	req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, "test_user"))
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusAccepted, rr.Code)
+
+	require.Len(t, auditLog.events, 1)
+	event := auditLog.events[0]
+	require.Equal(t, audit.EventSecretDelete, event.Type)
+	require.Equal(t, "test_user", event.Login)
+	require.Equal(t, "7", event.SecretID)
+	require.Equal(t, "192.0.2.1", event.RemoteAddr)
+	require.Equal(t, "test agent", event.UserAgent)
+}
@@ -0,0 +1,304 @@
+package web
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/api/utils"
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/emergency"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+type emergencyContactRequest struct {
+	Login    string `json:"login"`
+	WaitDays int    `json:"wait_days"`
+}
+
+// writeEmergencyAccessError - writes conflict response if the action is not allowed in the current state
+func writeEmergencyAccessError(w http.ResponseWriter, err error) {
+	if errors.Is(err, emergency.ErrInvalidTransition) {
+		_ = utils.WriteJSON(w, http.StatusConflict, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: err.Error(),
+			Data:    nil,
+		})
+
+		return
+	}
+
+	writeStorageError(w, err)
+}
+
+// InviteEmergencyContactHandler - HTTP handler that designates another user as an emergency contact.
+// The data key of the current user is encrypted with the contact's public key right away, because
+// the server cannot decrypt it later without the user. The key is used only after access is approved.
+func (a *apiRouteProvider) InviteEmergencyContactHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("InviteEmergencyContactHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	var request emergencyContactRequest
+	err = utils.ReadJSON(w, r, &request)
+
+	if request.WaitDays == 0 {
+		request.WaitDays = emergency.DefaultWaitDays
+	}
+
+	if err != nil || request.Login == "" || request.Login == login ||
+		request.WaitDays < 0 || request.WaitDays > emergency.MaxWaitDays {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	grantee, err := a.storage.GetUser(r.Context(), request.Login)
+	if err != nil {
+		log.Printf("InviteEmergencyContactHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	if grantee.PublicKey == "" {
+		_ = utils.WriteJSON(w, http.StatusConflict, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: "user should log in before they can become an emergency contact",
+			Data:    nil,
+		})
+
+		return
+	}
+
+	access := &model.EmergencyAccess{
+		Grantor:  login,
+		Grantee:  grantee.Login,
+		State:    emergency.StateInvited,
+		WaitDays: request.WaitDays,
+	}
+
+	access.SealedKey, err = model.SealKey(key, grantee.PublicKey)
+	if err == nil {
+		err = a.storage.SaveEmergencyAccess(r.Context(), access)
+	}
+
+	if err != nil {
+		log.Printf("InviteEmergencyContactHandler error: %s\n", err.Error())
+
+		if errors.Is(err, constant.ErrDuplicateRecord) {
+			_ = utils.WriteJSON(w, http.StatusConflict, api.Response{
+				Status:  constant.APIStatusFail,
+				Message: "user is already an emergency contact",
+				Data:    nil,
+			})
+		} else {
+			writeStorageError(w, err)
+		}
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusCreated, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   access,
+	})
+}
+
+// ListEmergencyAccessHandler - HTTP handler that returns emergency contacts of the current user
+// and the users who designated the current user as their emergency contact
+func (a *apiRouteProvider) ListEmergencyAccessHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	list, err := a.storage.GetEmergencyAccessList(r.Context(), login)
+	if err != nil {
+		log.Printf("ListEmergencyAccessHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   list,
+	})
+}
+
+// RevokeEmergencyAccessHandler - HTTP handler that removes an emergency contact. The grantor can revoke
+// access at any time, the grantee can decline the invitation or give up the access.
+func (a *apiRouteProvider) RevokeEmergencyAccessHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	id, err := idParam(r, "id")
+	if err != nil {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	err = a.storage.DeleteEmergencyAccess(r.Context(), id, login)
+	if err != nil {
+		log.Printf("RevokeEmergencyAccessHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusAccepted, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   id,
+	})
+}
+
+// AcceptEmergencyInviteHandler - HTTP handler that lets the grantee accept the invitation
+func (a *apiRouteProvider) AcceptEmergencyInviteHandler(w http.ResponseWriter, r *http.Request) {
+	a.applyEmergencyEvent(w, r, emergency.EventAccept, "AcceptEmergencyInviteHandler")
+}
+
+// RequestEmergencyAccessHandler - HTTP handler that lets the grantee request access to the grantor's secrets.
+// The access is approved automatically after the waiting period, unless the grantor rejects it.
+func (a *apiRouteProvider) RequestEmergencyAccessHandler(w http.ResponseWriter, r *http.Request) {
+	a.applyEmergencyEvent(w, r, emergency.EventRequest, "RequestEmergencyAccessHandler")
+}
+
+// ApproveEmergencyAccessHandler - HTTP handler that lets the grantor approve the request without waiting
+func (a *apiRouteProvider) ApproveEmergencyAccessHandler(w http.ResponseWriter, r *http.Request) {
+	a.applyEmergencyEvent(w, r, emergency.EventApprove, "ApproveEmergencyAccessHandler")
+}
+
+// RejectEmergencyAccessHandler - HTTP handler that lets the grantor reject the request or take back
+// the approved access. The contact stays designated and can request access again.
+func (a *apiRouteProvider) RejectEmergencyAccessHandler(w http.ResponseWriter, r *http.Request) {
+	a.applyEmergencyEvent(w, r, emergency.EventReject, "RejectEmergencyAccessHandler")
+}
+
+//nolint:lll
+func (a *apiRouteProvider) applyEmergencyEvent(w http.ResponseWriter, r *http.Request, event, handlerName string) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	id, err := idParam(r, "id")
+	if err != nil {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	access, err := a.storage.GetEmergencyAccess(r.Context(), id, login)
+	var fromState string
+	if err == nil {
+		fromState = access.State
+		err = emergency.Apply(access, event, login, time.Now().UTC())
+	}
+
+	if err == nil {
+		err = a.storage.UpdateEmergencyAccess(r.Context(), access, fromState)
+	}
+
+	if err != nil {
+		log.Printf("%s error: %s\n", handlerName, err.Error())
+		writeEmergencyAccessError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   access,
+	})
+}
+
+// EmergencySecretsHandler - HTTP handler that returns secrets of the grantor to the grantee,
+// once emergency access is approved. The secrets are read-only for the grantee.
+func (a *apiRouteProvider) EmergencySecretsHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("EmergencySecretsHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	id, err := idParam(r, "id")
+	if err != nil {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	access, err := a.storage.GetEmergencyAccess(r.Context(), id, login)
+	if err == nil && (access.Grantee != login || access.State != emergency.StateRecoveryApproved) {
+		err = constant.ErrForbidden
+	}
+
+	var grantee *model.User
+	if err == nil {
+		grantee, err = a.storage.GetUser(r.Context(), login)
+	}
+
+	var privateKey *[32]byte
+	if err == nil {
+		privateKey, err = grantee.GetPrivateKey(key)
+	}
+
+	var grantorKey string
+	if err == nil {
+		grantorKey, err = model.OpenSealedKey(access.SealedKey, grantee.PublicKey, privateKey)
+	}
+
+	var secrets map[int]*model.Secret
+	if err == nil {
+		secrets, err = a.storage.GetSecretsByUser(r.Context(), access.Grantor)
+	}
+
+	if err == nil {
+		err = decryptSecrets(secrets, grantorKey, access.Grantor)
+	}
+
+	if err != nil {
+		log.Printf("EmergencySecretsHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   secrets,
+	})
+}
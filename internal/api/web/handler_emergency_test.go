@@ -0,0 +1,284 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// newEmergencyTestProvider - creates a route provider with "validLogin", who trusts "grantee",
+// "new_contact" who can be invited and "no_keys_user" who cannot. Key cache returns data keys of the users.
+func newEmergencyTestProvider(t *testing.T) *apiRouteProvider {
+	t.Helper()
+
+	users := make(map[string]*model.User)
+	keys := make(map[string]string)
+	for _, login := range []string{"validLogin", "grantee", "new_contact"} {
+		user, err := model.NewUser(login, "password")
+		require.NoError(t, err)
+
+		keys[login], err = user.GetDataKey("password")
+		require.NoError(t, err)
+
+		users[login] = user
+	}
+
+	noKeysUser, err := model.NewUser("no_keys_user", "password")
+	require.NoError(t, err)
+	noKeysUser.PublicKey = ""
+	users[noKeysUser.Login] = noKeysUser
+
+	return &apiRouteProvider{
+		config:   config.AppConfig{},
+		storage:  &MockStorage{users: users},
+		keyCache: &MockKeyCache{keys: keys},
+	}
+}
+
+func TestInviteEmergencyContactHandler(t *testing.T) {
+	handler := newEmergencyTestProvider(t)
+	router := chi.NewRouter()
+	router.Get("/emergency", handler.ListEmergencyAccessHandler)
+	router.Post("/emergency", handler.InviteEmergencyContactHandler)
+	router.Delete("/emergency/{id}", handler.RevokeEmergencyAccessHandler)
+
+	runTeamTestCases(t, router, []teamTestCase{
+		{
+			name:           "contact is invited",
+			login:          "validLogin",
+			method:         "POST",
+			path:           "/emergency",
+			payload:        `{"login": "new_contact", "wait_days": 3}`,
+			httpStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "default waiting period",
+			login:          "validLogin",
+			method:         "POST",
+			path:           "/emergency",
+			payload:        `{"login": "new_contact"}`,
+			httpStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "waiting period is too long",
+			login:          "validLogin",
+			method:         "POST",
+			path:           "/emergency",
+			payload:        `{"login": "new_contact", "wait_days": 1000}`,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "user cannot trust themselves",
+			login:          "validLogin",
+			method:         "POST",
+			path:           "/emergency",
+			payload:        `{"login": "validLogin"}`,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "contact doesn't exist",
+			login:          "validLogin",
+			method:         "POST",
+			path:           "/emergency",
+			payload:        `{"login": "unknown"}`,
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "contact without keys",
+			login:          "validLogin",
+			method:         "POST",
+			path:           "/emergency",
+			payload:        `{"login": "no_keys_user"}`,
+			httpStatusCode: http.StatusConflict,
+		},
+		{
+			name:           "contact is already invited",
+			login:          "validLogin",
+			method:         "POST",
+			path:           "/emergency",
+			payload:        `{"login": "grantee"}`,
+			httpStatusCode: http.StatusConflict,
+		},
+		{
+			name:           "key cache error",
+			login:          "invalid_user",
+			method:         "POST",
+			path:           "/emergency",
+			payload:        `{"login": "new_contact"}`,
+			httpStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "list emergency access",
+			login:          "grantee",
+			method:         "GET",
+			path:           "/emergency",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "storage error when listing emergency access",
+			login:          "valid_user",
+			method:         "GET",
+			path:           "/emergency",
+			httpStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "grantor revokes access",
+			login:          "validLogin",
+			method:         "DELETE",
+			path:           "/emergency/4",
+			httpStatusCode: http.StatusAccepted,
+		},
+		{
+			name:           "grantee declines invitation",
+			login:          "grantee",
+			method:         "DELETE",
+			path:           "/emergency/1",
+			httpStatusCode: http.StatusAccepted,
+		},
+		{
+			name:           "other users cannot revoke access",
+			login:          "new_contact",
+			method:         "DELETE",
+			path:           "/emergency/1",
+			httpStatusCode: http.StatusNotFound,
+		},
+	})
+}
+
+func TestEmergencyAccessTransitionHandlers(t *testing.T) {
+	handler := newEmergencyTestProvider(t)
+	router := chi.NewRouter()
+	router.Post("/emergency/{id}/accept", handler.AcceptEmergencyInviteHandler)
+	router.Post("/emergency/{id}/request", handler.RequestEmergencyAccessHandler)
+	router.Post("/emergency/{id}/approve", handler.ApproveEmergencyAccessHandler)
+	router.Post("/emergency/{id}/reject", handler.RejectEmergencyAccessHandler)
+
+	runTeamTestCases(t, router, []teamTestCase{
+		{
+			name:           "grantee accepts invitation",
+			login:          "grantee",
+			method:         "POST",
+			path:           "/emergency/1/accept",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "grantor cannot accept invitation",
+			login:          "validLogin",
+			method:         "POST",
+			path:           "/emergency/1/accept",
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "invitation must be accepted before requesting access",
+			login:          "grantee",
+			method:         "POST",
+			path:           "/emergency/1/request",
+			httpStatusCode: http.StatusConflict,
+		},
+		{
+			name:           "grantee requests access",
+			login:          "grantee",
+			method:         "POST",
+			path:           "/emergency/2/request",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "grantor approves request",
+			login:          "validLogin",
+			method:         "POST",
+			path:           "/emergency/3/approve",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "grantee cannot approve own request",
+			login:          "grantee",
+			method:         "POST",
+			path:           "/emergency/3/approve",
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "grantor rejects request",
+			login:          "validLogin",
+			method:         "POST",
+			path:           "/emergency/3/reject",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "grantor takes approved access back",
+			login:          "validLogin",
+			method:         "POST",
+			path:           "/emergency/4/reject",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "other users cannot see emergency access",
+			login:          "new_contact",
+			method:         "POST",
+			path:           "/emergency/2/request",
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "invalid id",
+			login:          "grantee",
+			method:         "POST",
+			path:           "/emergency/abc/accept",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "storage error",
+			login:          "grantee",
+			method:         "POST",
+			path:           "/emergency/5/accept",
+			httpStatusCode: http.StatusInternalServerError,
+		},
+	})
+}
+
+func TestEmergencySecretsHandler(t *testing.T) {
+	handler := newEmergencyTestProvider(t)
+	router := chi.NewRouter()
+	router.Get("/emergency/{id}/secrets", handler.EmergencySecretsHandler)
+
+	runTeamTestCases(t, router, []teamTestCase{
+		{
+			name:           "grantee reads secrets after approval",
+			login:          "grantee",
+			method:         "GET",
+			path:           "/emergency/4/secrets",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "secrets are not available while waiting",
+			login:          "grantee",
+			method:         "GET",
+			path:           "/emergency/3/secrets",
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "grantor cannot use own emergency access",
+			login:          "validLogin",
+			method:         "GET",
+			path:           "/emergency/4/secrets",
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "other users cannot read secrets",
+			login:          "new_contact",
+			method:         "GET",
+			path:           "/emergency/4/secrets",
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "key cache error",
+			login:          "invalid_user",
+			method:         "GET",
+			path:           "/emergency/4/secrets",
+			httpStatusCode: http.StatusUnauthorized,
+		},
+	})
+}
@@ -0,0 +1,491 @@
+package web
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/api/auth"
+	"github.com/grafviktor/keep-my-secret/internal/api/utils"
+	"github.com/grafviktor/keep-my-secret/internal/audit"
+	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/keycache"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+	"github.com/grafviktor/keep-my-secret/internal/oidc"
+	"github.com/grafviktor/keep-my-secret/internal/policy"
+	"github.com/grafviktor/keep-my-secret/internal/throttle"
+)
+
+const (
+	// oidcStateCookie - binds the callback to the browser which has started the sign in
+	oidcStateCookie = "kms_oidc_state"
+	oidcCookiePath  = "/api/v1/user/oidc/"
+	// oidcRequestLifetime - how long the user may stay at the identity provider
+	oidcRequestLifetime = 10 * time.Minute
+)
+
+// Vault states which are passed to the client application after sign in with the identity provider
+const (
+	// vaultStateSetup - the user has to set the master password, which creates the data key
+	vaultStateSetup = "setup"
+	// vaultStateLocked - the user has to enter the master password to decrypt the data key
+	vaultStateLocked = "locked"
+)
+
+type oidcHTTPHandler struct {
+	config    config.AppConfig
+	storage   oidcStorage
+	keyCache  keyCache
+	authUtils authUtils
+	auditLog  auditRecorder
+	throttler loginThrottler
+	policy    *policy.Policy
+	// secondFactor - confirms unlocking of the vault if the user has registered a security key
+	secondFactor secondFactor
+	// provider - nil if sign in with the identity provider is not configured
+	provider identityProvider
+	requests *oidc.RequestStore
+}
+
+// newOIDCHandlerProvider - returns a set of handlers which sign users in with an external identity provider.
+// Users of the provider don't have a login password, their data key is encrypted with a master password.
+func newOIDCHandlerProvider(
+	appConfig config.AppConfig,
+	storage oidcStorage,
+	auditLog auditRecorder,
+	throttler loginThrottler,
+	secondFactor secondFactor,
+	passwordPolicy *policy.Policy,
+	keys *auth.KeySet,
+	provider *oidc.Provider,
+) oidcHTTPHandler {
+	h := oidcHTTPHandler{
+		config:       appConfig,
+		storage:      storage,
+		keyCache:     keycache.GetInstance(),
+		authUtils:    auth.New(appConfig, keys),
+		auditLog:     auditLog,
+		throttler:    throttler,
+		policy:       passwordPolicy,
+		secondFactor: secondFactor,
+		requests:     oidc.NewRequestStore(),
+	}
+
+	// A nil pointer would make the interface not nil
+	if provider != nil {
+		h.provider = provider
+	}
+
+	return h
+}
+
+// LoginHandler - HTTP handler which redirects the user to the identity provider
+func (h *oidcHTTPHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	if h.provider == nil {
+		writeOIDCNotConfigured(w)
+
+		return
+	}
+
+	request, err := oidc.NewAuthRequest(oidcRequestLifetime)
+	if err == nil {
+		err = h.requests.Save(request)
+	}
+
+	var authURL string
+	if err == nil {
+		authURL, err = h.provider.AuthCodeURL(r.Context(), request)
+	}
+
+	if err != nil {
+		log.Printf("OIDCLoginHandler error: %s\n", err.Error())
+
+		if errors.Is(err, oidc.ErrTooManyRequests) {
+			writeTooManyRequests(w, oidcRequestLifetime)
+		} else {
+			_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+				Status:  constant.APIStatusError,
+				Message: constant.APIMessageServerError,
+				Data:    nil,
+			})
+		}
+
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    request.State,
+		Path:     oidcCookiePath,
+		MaxAge:   int(oidcRequestLifetime.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		// The cookie must be sent when the provider redirects the user back
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// CallbackHandler - HTTP handler which completes sign in when the identity provider redirects the user back.
+// A user is created when the subject signs in for the first time. The refresh token is set, and the user is
+// redirected to the client application, which gets the access token using the refresh token.
+func (h *oidcHTTPHandler) CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if h.provider == nil {
+		writeOIDCNotConfigured(w)
+
+		return
+	}
+
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		log.Printf("OIDCCallbackHandler error: provider returned %s: %s\n", providerError, query.Get("error_description"))
+		writeUnauthorized(w)
+
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		log.Println("OIDCCallbackHandler error: state doesn't match")
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: oidcCookiePath, MaxAge: -1, Secure: true, HttpOnly: true})
+
+	request, ok := h.requests.Take(state)
+	if !ok {
+		log.Println("OIDCCallbackHandler error: authorization request is expired or unknown")
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	claims, err := h.provider.Exchange(r.Context(), query.Get("code"), request)
+	if err != nil {
+		log.Printf("OIDCCallbackHandler error: %s\n", err.Error())
+		writeUnauthorized(w)
+
+		return
+	}
+
+	user, ok := h.externalUser(w, r, claims)
+	if !ok {
+		return
+	}
+
+	if user.Disabled {
+		log.Printf("OIDCCallbackHandler error: account of '%s' is disabled\n", user.Login)
+		recordAuditEvent(h.auditLog, r, audit.EventLoginFailure, user.Login, "")
+		writeAccountDisabled(w)
+
+		return
+	}
+
+	tokens, err := h.authUtils.GenerateTokenPair(newJWTUser(user))
+	if err != nil {
+		log.Printf("OIDCCallbackHandler error: cannot generate tokens. Error: %s", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+			Status:  constant.APIStatusError,
+			Message: constant.APIMessageServerError,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	http.SetCookie(w, h.authUtils.GetRefreshCookie(tokens.RefreshToken))
+	recordAuditEvent(h.auditLog, r, audit.EventLoginSuccess, user.Login, "")
+	log.Printf("OIDCCallbackHandler success: Login '%s'\n", user.Login)
+
+	vaultState := vaultStateLocked
+	if user.DataKey == "" {
+		vaultState = vaultStateSetup
+	}
+
+	http.Redirect(w, r, h.clientURL(vaultState), http.StatusSeeOther)
+}
+
+// externalUser - returns the user of the subject, the user is created on first sign in if the registration
+// is open. An existing user with the same login is never linked to the subject, otherwise the identity
+// provider could take over any account. Writes the response if the user cannot be returned.
+func (h *oidcHTTPHandler) externalUser(
+	w http.ResponseWriter,
+	r *http.Request,
+	claims *oidc.Claims,
+) (*model.User, bool) {
+	user, err := h.storage.GetUserByIdentity(r.Context(), h.provider.Issuer(), claims.Subject)
+	if err == nil {
+		return user, true
+	}
+
+	if !errors.Is(err, constant.ErrNotFound) {
+		log.Printf("OIDCCallbackHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return nil, false
+	}
+
+	settings, err := h.storage.GetServerSettings(r.Context())
+	if err != nil {
+		log.Printf("OIDCCallbackHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return nil, false
+	}
+
+	if !settings.RegistrationOpen {
+		log.Println("OIDCCallbackHandler error: registration is closed")
+
+		_ = utils.WriteJSON(w, http.StatusForbidden, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageRegistrationClosed,
+			Data:    nil,
+		})
+
+		return nil, false
+	}
+
+	login := claims.Username(h.config.OIDCUsernameClaim)
+	if violations := h.policy.CheckUsername("username", login); len(violations) > 0 {
+		log.Printf("OIDCCallbackHandler error: username '%s' of the subject doesn't conform to the policy\n", login)
+		writePolicyViolations(w, violations)
+
+		return nil, false
+	}
+
+	user = model.NewExternalUser(login)
+	identity := &model.Identity{Issuer: h.provider.Issuer(), Subject: claims.Subject}
+	if err = h.storage.AddExternalUser(r.Context(), user, identity); err != nil {
+		log.Printf("OIDCCallbackHandler error: %s\n", err.Error())
+
+		if errors.Is(err, constant.ErrDuplicateRecord) {
+			_ = utils.WriteJSON(w, http.StatusConflict, api.Response{
+				Status:  constant.APIStatusFail,
+				Message: "user already exists",
+				Data:    nil,
+			})
+		} else {
+			writeStorageError(w, err)
+		}
+
+		return nil, false
+	}
+
+	recordAuditEvent(h.auditLog, r, audit.EventRegister, login, "")
+
+	return user, true
+}
+
+// clientURL - address of the client application with the state of the vault
+func (h *oidcHTTPHandler) clientURL(vaultState string) string {
+	clientURL, err := url.Parse(h.config.ClientAppURL)
+	if err != nil || h.config.ClientAppURL == "" {
+		clientURL = &url.URL{Path: "/"}
+	}
+
+	query := clientURL.Query()
+	query.Set("vault", vaultState)
+	clientURL.RawQuery = query.Encode()
+
+	return clientURL.String()
+}
+
+type masterPassword struct {
+	Password string `json:"password"`
+}
+
+// MasterPasswordHandler - HTTP handler which sets the master password of a user who signed in with
+// the identity provider for the first time. The master password encrypts the data key, it cannot be
+// changed or restored, because the server never knows it.
+func (h *oidcHTTPHandler) MasterPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	var body masterPassword
+	if err := utils.ReadJSON(w, r, &body); err != nil {
+		log.Printf("MasterPasswordHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	if violations := h.policy.CheckPassword("password", body.Password, login); len(violations) > 0 {
+		log.Printf("MasterPasswordHandler error: master password of '%s' doesn't conform to the policy\n", login)
+		writePolicyViolations(w, violations)
+
+		return
+	}
+
+	user, err := h.storage.GetUser(r.Context(), login)
+	if err != nil {
+		log.Printf("MasterPasswordHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	dataKey, err := user.SetMasterPassword(body.Password)
+	if err == nil {
+		err = h.storage.SetUserDataKey(r.Context(), user)
+	}
+
+	if err != nil {
+		log.Printf("MasterPasswordHandler error: %s\n", err.Error())
+
+		if errors.Is(err, model.ErrMasterPasswordSet) || errors.Is(err, constant.ErrDuplicateRecord) {
+			_ = utils.WriteJSON(w, http.StatusConflict, api.Response{
+				Status:  constant.APIStatusFail,
+				Message: model.ErrMasterPasswordSet.Error(),
+				Data:    nil,
+			})
+		} else {
+			writeStorageError(w, err)
+		}
+
+		return
+	}
+
+	h.keyCache.Set(login, dataKey)
+	recordAuditEvent(h.auditLog, r, audit.EventMasterPasswordSet, login, "")
+
+	_ = utils.WriteJSON(w, http.StatusCreated, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   nil,
+	})
+}
+
+// UnlockHandler - HTTP handler which decrypts the data key with the master password. Wrong guesses
+// are throttled the same way as failed logins. If the user has registered a security key, the data key
+// is released only when the key confirms unlocking, like the second factor of the login with a password.
+func (h *oidcHTTPHandler) UnlockHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	var body masterPassword
+	if err := utils.ReadJSON(w, r, &body); err != nil {
+		log.Printf("UnlockHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	clientIP := utils.ClientIP(r)
+	retryAfter, err := h.throttler.Attempt(r.Context(), login, clientIP)
+	if err != nil {
+		log.Printf("UnlockHandler error: %s\n", err.Error())
+		writeThrottlerError(w, err, retryAfter)
+
+		return
+	}
+
+	user, err := h.storage.GetUser(r.Context(), login)
+	if err != nil {
+		log.Printf("UnlockHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	if user.DataKey == "" {
+		log.Printf("UnlockHandler error: '%s' has not set the master password\n", login)
+
+		_ = utils.WriteJSON(w, http.StatusConflict, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: "master password is not set",
+			Data:    nil,
+		})
+
+		return
+	}
+
+	dataKey, err := user.UnlockDataKey(body.Password)
+	if err != nil {
+		log.Printf("UnlockHandler error: '%s' cannot unlock the vault: %s\n", login, err.Error())
+		recordAuditEvent(h.auditLog, r, audit.EventVaultUnlockFailure, login, "")
+
+		_ = utils.WriteJSON(w, http.StatusForbidden, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageForbidden,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	// Failed attempts are reset only when unlocking is confirmed
+	if h.secondFactor.RequireSecondFactor(w, r, login, dataKey) {
+		return
+	}
+
+	if err = h.throttler.Succeed(r.Context(), login, clientIP); err != nil {
+		log.Printf("UnlockHandler error: cannot reset failed attempts: %s\n", err.Error())
+	}
+
+	h.keyCache.Set(login, dataKey)
+	recordAuditEvent(h.auditLog, r, audit.EventVaultUnlock, login, "")
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   nil,
+	})
+}
+
+func writeOIDCNotConfigured(w http.ResponseWriter) {
+	_ = utils.WriteJSON(w, http.StatusNotFound, api.Response{
+		Status:  constant.APIStatusFail,
+		Message: oidc.ErrNotConfigured.Error(),
+		Data:    nil,
+	})
+}
+
+func writeUnauthorized(w http.ResponseWriter) {
+	_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+		Status:  constant.APIStatusFail,
+		Message: constant.APIMessageUnauthorized,
+		Data:    nil,
+	})
+}
+
+// writeThrottlerError - the attempt is rejected either because of too many failures, or because
+// failures cannot be counted
+func writeThrottlerError(w http.ResponseWriter, err error, retryAfter time.Duration) {
+	if errors.Is(err, throttle.ErrThrottled) {
+		writeTooManyRequests(w, retryAfter)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+		Status:  constant.APIStatusError,
+		Message: constant.APIMessageServerError,
+		Data:    nil,
+	})
+}
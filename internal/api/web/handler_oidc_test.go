@@ -0,0 +1,247 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/api/auth"
+	"github.com/grafviktor/keep-my-secret/internal/audit"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+	"github.com/grafviktor/keep-my-secret/internal/oidc"
+	"github.com/grafviktor/keep-my-secret/internal/oidc/oidctest"
+	"github.com/grafviktor/keep-my-secret/internal/webauthn/webauthntest"
+)
+
+const oidcCallbackURL = "https://kms.example.com/api/v1/user/oidc/callback"
+
+func newOIDCTestHandler(t *testing.T) (*oidcHTTPHandler, *oidctest.Provider, *MockStorage, *mockAuditLog) {
+	t.Helper()
+
+	idp := oidctest.NewProvider("kms", "client secret")
+	t.Cleanup(idp.Close)
+
+	oidcConfig := appConfig
+	oidcConfig.OIDCIssuerURL = idp.Issuer()
+	oidcConfig.OIDCClientID = "kms"
+	oidcConfig.OIDCClientSecret = "client secret"
+	oidcConfig.OIDCRedirectURL = oidcCallbackURL
+	oidcConfig.OIDCUsernameClaim = oidc.ClaimEmail
+	oidcConfig.PasswordMinLength = 10
+
+	storage := &MockStorage{users: map[string]*model.User{}, identities: map[[2]string]string{}}
+	auditLog := &mockAuditLog{}
+	services := newTestServices(t, oidcConfig)
+	require.NotNil(t, services.IdentityProvider)
+
+	handler := newOIDCHandlerProvider(
+		oidcConfig, storage, auditLog, newTestLoginThrottler(), mockSecondFactor{},
+		services.PasswordPolicy, services.Keys, services.IdentityProvider,
+	)
+	handler.keyCache = &MockKeyCache{}
+
+	return &handler, idp, storage, auditLog
+}
+
+// oidcSignIn - starts sign in, lets the provider authorize the user and passes the code to the callback
+func oidcSignIn(t *testing.T, handler *oidcHTTPHandler, idp *oidctest.Provider) *httptest.ResponseRecorder {
+	t.Helper()
+
+	res := httptest.NewRecorder()
+	handler.LoginHandler(res, httptest.NewRequest(http.MethodGet, "/api/v1/user/oidc/login", nil))
+	require.Equal(t, http.StatusFound, res.Code)
+
+	callback, err := idp.Authorize(res.Header().Get("Location"))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(callback, oidcCallbackURL))
+
+	req := httptest.NewRequest(http.MethodGet, callback, nil)
+	for _, cookie := range res.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	res = httptest.NewRecorder()
+	handler.CallbackHandler(res, req)
+
+	return res
+}
+
+func postMasterPassword(handler http.HandlerFunc, login, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, login))
+	res := httptest.NewRecorder()
+	handler(res, req)
+
+	return res
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	handler, idp, storage, auditLog := newOIDCTestHandler(t)
+	login := idp.User.Email
+
+	// The first sign in creates the user, who has to set the master password
+	res := oidcSignIn(t, handler, idp)
+	require.Equal(t, http.StatusSeeOther, res.Code)
+	require.Equal(t, "/?vault=setup", res.Header().Get("Location"))
+	require.Contains(t, strings.Join(res.Header().Values("Set-Cookie"), "\n"), auth.CookieName+"=")
+	require.Contains(t, storage.users, login)
+
+	user := storage.users[login]
+	matches, err := user.PasswordMatches("")
+	require.NoError(t, err)
+	require.False(t, matches)
+
+	res = postMasterPassword(handler.MasterPasswordHandler, login, `{"password":"short"}`)
+	require.Equal(t, http.StatusNotAcceptable, res.Code)
+
+	res = postMasterPassword(handler.MasterPasswordHandler, login, `{"password":"Master-Password-1"}`)
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	keyCache := handler.keyCache.(*MockKeyCache)
+	dataKey := keyCache.setSecret
+	require.NotEmpty(t, dataKey)
+	require.NotEmpty(t, storage.users[login].PublicKey)
+
+	// The master password is never replaced, it would make existing secrets unreadable
+	res = postMasterPassword(handler.MasterPasswordHandler, login, `{"password":"Master-Password-2"}`)
+	require.Equal(t, http.StatusConflict, res.Code)
+
+	// The next sign in finds the user by the subject, the vault has to be unlocked
+	res = oidcSignIn(t, handler, idp)
+	require.Equal(t, http.StatusSeeOther, res.Code)
+	require.Equal(t, "/?vault=locked", res.Header().Get("Location"))
+
+	keyCache.setSecret = ""
+	res = postMasterPassword(handler.UnlockHandler, login, `{"password":"Wrong-Password-1"}`)
+	require.Equal(t, http.StatusForbidden, res.Code)
+	require.Empty(t, keyCache.setSecret)
+
+	res = postMasterPassword(handler.UnlockHandler, login, `{"password":"Master-Password-1"}`)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Equal(t, dataKey, keyCache.setSecret)
+
+	require.Equal(t, []string{
+		audit.EventRegister,
+		audit.EventLoginSuccess,
+		audit.EventMasterPasswordSet,
+		audit.EventLoginSuccess,
+		audit.EventVaultUnlockFailure,
+		audit.EventVaultUnlock,
+	}, auditLog.types())
+}
+
+func TestOIDCUnlockSecondFactor(t *testing.T) {
+	handler, idp, storage, _ := newOIDCTestHandler(t)
+	login := idp.User.Email
+	keyCache := handler.keyCache.(*MockKeyCache)
+
+	webauthnConfig := appConfig
+	webauthnConfig.WebAuthnRPID = "kms.example.com"
+	services := newTestServices(t, webauthnConfig)
+	webauthnHandler := newWebAuthnHandlerProvider(
+		webauthnConfig, storage, &mockAuditLog{}, newTestLoginThrottler(), services.Keys, services.RelyingParty,
+	)
+	webauthnHandler.keyCache = keyCache
+	handler.secondFactor = &webauthnHandler
+	storage.credentials = map[string]model.WebAuthnCredential{}
+
+	res := oidcSignIn(t, handler, idp)
+	require.Equal(t, "/?vault=setup", res.Header().Get("Location"))
+	res = postMasterPassword(handler.MasterPasswordHandler, login, `{"password":"Master-Password-1"}`)
+	require.Equal(t, http.StatusCreated, res.Code)
+	dataKey := keyCache.setSecret
+
+	// The user confirms registration of the security key with the master password
+	authenticator := webauthntest.New(webauthnOrigin)
+	res = postWebAuthn(webauthnHandler.BeginRegistrationHandler, login, `{"password":"Master-Password-1"}`)
+	require.Equal(t, http.StatusOK, res.Code)
+	session, options := ceremonyOptions(t, res)
+	credential, err := authenticator.Create(options)
+	require.NoError(t, err)
+	res = postWebAuthn(webauthnHandler.FinishRegistrationHandler, login, ceremonyBody(t, session, credential))
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	// The master password alone doesn't unlock the vault anymore
+	keyCache.setSecret = ""
+	res = postMasterPassword(handler.UnlockHandler, login, `{"password":"Master-Password-1"}`)
+	require.Equal(t, http.StatusAccepted, res.Code)
+	require.Empty(t, keyCache.setSecret)
+
+	session, options = ceremonyOptions(t, res)
+	credential, err = authenticator.Get(options)
+	require.NoError(t, err)
+	res = postWebAuthn(webauthnHandler.SecondFactorHandler, "", ceremonyBody(t, session, credential))
+	require.Equal(t, http.StatusCreated, res.Code)
+	require.Equal(t, dataKey, keyCache.setSecret)
+}
+
+func TestOIDCSignInErrors(t *testing.T) {
+	t.Run("Existing user is not linked to the subject", func(t *testing.T) {
+		handler, idp, storage, _ := newOIDCTestHandler(t)
+		user, err := model.NewUser(idp.User.Email, "password")
+		require.NoError(t, err)
+		storage.users[user.Login] = user
+
+		require.Equal(t, http.StatusConflict, oidcSignIn(t, handler, idp).Code)
+		require.Empty(t, storage.identities)
+	})
+
+	t.Run("Unverified e-mail is not used as login", func(t *testing.T) {
+		handler, idp, storage, _ := newOIDCTestHandler(t)
+		idp.User.EmailVerified = false
+
+		require.Equal(t, http.StatusNotAcceptable, oidcSignIn(t, handler, idp).Code)
+		require.Empty(t, storage.users)
+	})
+
+	t.Run("ID token for another client", func(t *testing.T) {
+		handler, idp, storage, _ := newOIDCTestHandler(t)
+		idp.Claims = func(claims jwt.MapClaims) {
+			claims["aud"] = "another client"
+		}
+
+		require.Equal(t, http.StatusUnauthorized, oidcSignIn(t, handler, idp).Code)
+		require.Empty(t, storage.users)
+	})
+
+	t.Run("State doesn't match the cookie", func(t *testing.T) {
+		handler, idp, _, _ := newOIDCTestHandler(t)
+
+		res := httptest.NewRecorder()
+		handler.LoginHandler(res, httptest.NewRequest(http.MethodGet, "/", nil))
+		callback, err := idp.Authorize(res.Header().Get("Location"))
+		require.NoError(t, err)
+
+		// The callback is opened in another browser, for instance the link was sent to a victim
+		req := httptest.NewRequest(http.MethodGet, callback, nil)
+		req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: "attacker state"})
+		res = httptest.NewRecorder()
+		handler.CallbackHandler(res, req)
+		require.Equal(t, http.StatusBadRequest, res.Code)
+	})
+
+	t.Run("Provider returns an error", func(t *testing.T) {
+		handler, _, _, _ := newOIDCTestHandler(t)
+
+		res := httptest.NewRecorder()
+		handler.CallbackHandler(res, httptest.NewRequest(http.MethodGet, "/?error=access_denied", nil))
+		require.Equal(t, http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("Provider is not configured", func(t *testing.T) {
+		handler := newOIDCHandlerProvider(
+			appConfig, &MockStorage{}, &mockAuditLog{}, newTestLoginThrottler(), mockSecondFactor{},
+			newTestPolicy(t, appConfig), newTestKeys(t, appConfig), nil,
+		)
+
+		res := httptest.NewRecorder()
+		handler.LoginHandler(res, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusNotFound, res.Code)
+	})
+}
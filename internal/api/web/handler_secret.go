@@ -2,22 +2,33 @@ package web
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/samber/lo"
 
 	"github.com/grafviktor/keep-my-secret/internal/api"
 	"github.com/grafviktor/keep-my-secret/internal/api/utils"
+	"github.com/grafviktor/keep-my-secret/internal/audit"
+	"github.com/grafviktor/keep-my-secret/internal/breach"
 	"github.com/grafviktor/keep-my-secret/internal/config"
 	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/health"
 	"github.com/grafviktor/keep-my-secret/internal/keycache"
 	"github.com/grafviktor/keep-my-secret/internal/model"
+	"github.com/grafviktor/keep-my-secret/internal/policy"
+	"github.com/grafviktor/keep-my-secret/internal/reminder"
+	"github.com/grafviktor/keep-my-secret/internal/search"
 	"github.com/grafviktor/keep-my-secret/internal/storage"
 )
 
@@ -25,17 +36,54 @@ type apiRouteProvider struct {
 	config   config.AppConfig
 	storage  storage.Storage
 	keyCache keyCache
+	// breachChecker is nil when breached password corpus is not configured
+	breachChecker breachChecker
+	auditLog      auditRecorder
+	// passwordPolicy is applied to passwords of archives
+	passwordPolicy *policy.Policy
 }
 
 // newSecretHandlerProvider - self-explanatory
-func newSecretHandlerProvider(appConfig config.AppConfig, appStorage storage.Storage) apiRouteProvider {
-	return apiRouteProvider{
+func newSecretHandlerProvider(
+	appConfig config.AppConfig,
+	appStorage storage.Storage,
+	auditLog auditRecorder,
+	passwordPolicy *policy.Policy,
+) apiRouteProvider {
+	provider := apiRouteProvider{
 		config:   appConfig,
 		storage:  appStorage,
 		keyCache: keycache.GetInstance(),
+		auditLog: auditLog,
+
+		passwordPolicy: passwordPolicy,
+	}
+
+	if appConfig.BreachCorpusPath != "" {
+		corpus, err := breach.Open(appConfig.BreachCorpusPath)
+		if err != nil {
+			log.Printf("Breached password check is disabled: %s\n", err.Error())
+		} else {
+			provider.breachChecker = corpus
+		}
 	}
+
+	return provider
 }
 
+const (
+	// touchTimeout - how long a background update of secret access time may take
+	touchTimeout = 5 * time.Second
+	// defaultRecentLimit and maxRecentLimit - number of items which are returned by RecentSecretsHandler
+	defaultRecentLimit = 10
+	maxRecentLimit     = 100
+	// maxReminderDays - the longest reminder lead time which can be requested, longer durations would overflow
+	maxReminderDays = 3650
+	// maxSearchQueryLength - every trigram of a query becomes a bound parameter of the search statement,
+	// so a long query would exceed the limit of the database on the number of parameters
+	maxSearchQueryLength = 256
+)
+
 // TODO: maxFileSize should be moved to application configuration level instead of hardcoding it here
 var maxFileSize int64 = 1024 * 1024 * 1 // 1MB
 func parseMultiPartSecretRequest(r *http.Request, secret *model.Secret) error {
@@ -67,18 +115,19 @@ func parseMultiPartSecretRequest(r *http.Request, secret *model.Secret) error {
 	return nil
 }
 
+// readSecretRequest - reads a secret either from JSON body, or from multipart form if a file is attached
+func readSecretRequest(w http.ResponseWriter, r *http.Request, secret *model.Secret) error {
+	if strings.Contains(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return parseMultiPartSecretRequest(r, secret)
+	}
+
+	return utils.ReadJSON(w, r, secret)
+}
+
 // SaveSecretHandler - HTTP handler for saving a secret user data
 func (a *apiRouteProvider) SaveSecretHandler(w http.ResponseWriter, r *http.Request) {
-	contentType := r.Header.Get("Content-Type")
 	var secret model.Secret
-	var err error
-
-	if strings.Contains(contentType, "multipart/form-data") {
-		err = parseMultiPartSecretRequest(r, &secret)
-	} else {
-		err = utils.ReadJSON(w, r, &secret)
-	}
-
+	err := readSecretRequest(w, r, &secret)
 	if err != nil {
 		log.Printf("SaveSecretHandler error: %s\n", err.Error())
 
@@ -106,7 +155,15 @@ func (a *apiRouteProvider) SaveSecretHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	key, err := a.keyCache.Get(login)
+	// A token which is limited to particular secrets can change only them
+	if !tokenAllowsSecret(r, strconv.FormatInt(secret.ID, 10)) {
+		log.Printf("SaveSecretHandler error: secret %d is not allowed for the API token\n", secret.ID)
+		writeStorageError(w, constant.ErrForbidden)
+
+		return
+	}
+
+	key, err := getDataKey(r, a.keyCache, login)
 	if err != nil {
 		log.Printf("SaveSecretHandler error: %s\n", err.Error())
 
@@ -119,20 +176,48 @@ func (a *apiRouteProvider) SaveSecretHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = secret.Encrypt(key, login)
+	// Every secret is encrypted with its own key. Secrets which were shared with the user
+	// are saved on behalf of the owner.
+	access := secretAccess{owner: login}
+	auditEvent := audit.EventSecretUpdate
+	if secret.ID == 0 {
+		auditEvent = audit.EventSecretCreate
+		access.key, err = secret.GenerateKey(key)
+	} else {
+		access, err = a.getSecretAccessForUpdate(r.Context(), &secret, login, key)
+	}
+
 	if err != nil {
 		log.Printf("SaveSecretHandler error: %s\n", err.Error())
-
-		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
-			Status:  constant.APIStatusError,
-			Message: constant.APIMessageServerError,
-			Data:    nil,
-		})
+		writeStorageError(w, err)
 
 		return
 	}
 
-	_, err = a.storage.SaveSecret(r.Context(), &secret, login)
+	secret.SetCardExpiresAt()
+	secret.Compromised = a.isCompromised(&secret)
+
+	// Search tokens must be built before the secret is encrypted. Search key is derived from the owner's
+	// data key, so other users can't change the title and URL, see getSecretAccessForUpdate.
+	var searchTokens []string
+	if access.isOwner() {
+		var searchKey []byte
+		searchKey, err = search.DeriveKey(key)
+		if err != nil {
+			log.Printf("SaveSecretHandler error: %s\n", err.Error())
+
+			_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+				Status:  constant.APIStatusError,
+				Message: constant.APIMessageServerError,
+				Data:    nil,
+			})
+
+			return
+		}
+		searchTokens = search.Tokens(searchKey, secret.Title, secret.URL)
+	}
+
+	err = secret.Encrypt(access.key, access.owner)
 	if err != nil {
 		log.Printf("SaveSecretHandler error: %s\n", err.Error())
 
@@ -145,6 +230,17 @@ func (a *apiRouteProvider) SaveSecretHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// The search index is saved along with the secret, nil tokens keep the index of the owner
+	_, err = a.storage.SaveSecret(r.Context(), &secret, searchTokens, access.owner)
+	if err != nil {
+		log.Printf("SaveSecretHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	recordAuditEvent(a.auditLog, r, auditEvent, login, strconv.FormatInt(secret.ID, 10))
+
 	_ = utils.WriteJSON(w, http.StatusCreated, api.Response{
 		Status: constant.APIStatusSuccess,
 		Data:   secret,
@@ -154,7 +250,7 @@ func (a *apiRouteProvider) SaveSecretHandler(w http.ResponseWriter, r *http.Requ
 // ListSecretsHandler - HTTP handler that returns all user's secret items
 func (a *apiRouteProvider) ListSecretsHandler(w http.ResponseWriter, r *http.Request) {
 	login := r.Context().Value(api.ContextUserLogin).(string)
-	key, err := a.keyCache.Get(login)
+	key, err := getDataKey(r, a.keyCache, login)
 	if err != nil {
 		log.Printf("ListSecretsHandler error: %s\n", err.Error())
 
@@ -180,10 +276,136 @@ func (a *apiRouteProvider) ListSecretsHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	filterTokenSecrets(r, secrets)
+
+	err = decryptSecrets(secrets, key, login)
+	if err != nil {
+		log.Printf("ListSecretsHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+			Status:  constant.APIStatusError,
+			Message: constant.APIMessageServerError,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   secrets,
+	})
+}
+
+// GetSecretHandler - HTTP handler that returns a single secret item
+func (a *apiRouteProvider) GetSecretHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+	secretID := chi.URLParam(r, "id")
+
+	if !tokenAllowsSecret(r, secretID) {
+		log.Printf("GetSecretHandler error: secret %s is not allowed for the API token\n", secretID)
+		writeStorageError(w, constant.ErrForbidden)
+
+		return
+	}
+
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("GetSecretHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	secret, access, err := a.getSecretAccess(r.Context(), secretID, login, key)
+	if err != nil {
+		log.Printf("GetSecretHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	err = secret.Decrypt(access.key, access.owner)
+	if err != nil {
+		log.Printf("GetSecretHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+			Status:  constant.APIStatusError,
+			Message: constant.APIMessageServerError,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	if access.isOwner() {
+		a.touchSecret(secretID, login)
+	}
+
+	recordAuditEvent(a.auditLog, r, audit.EventSecretRead, login, secretID)
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   secret,
+	})
+}
+
+// RecentSecretsHandler - HTTP handler that returns user's secret items ordered by access time,
+// most recently used items go first. Number of items can be set with 'limit' query parameter.
+func (a *apiRouteProvider) RecentSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	limit := defaultRecentLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxRecentLimit {
+			_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+				Status:  constant.APIStatusFail,
+				Message: constant.APIMessageBadRequest,
+				Data:    nil,
+			})
+
+			return
+		}
+
+		limit = parsed
+	}
+
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("RecentSecretsHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	secrets, err := a.storage.GetRecentSecrets(r.Context(), login, limit)
+	if err != nil {
+		log.Printf("RecentSecretsHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+			Status:  constant.APIStatusError,
+			Message: constant.APIMessageServerError,
+			Data:    nil,
+		})
+
+		return
+	}
+
 	for _, secret := range secrets {
-		err = secret.Decrypt(key, login)
+		err = secret.DecryptWithDataKey(key, login)
 		if err != nil {
-			log.Printf("ListSecretsHandler error: %s\n", err.Error())
+			log.Printf("RecentSecretsHandler error: %s\n", err.Error())
 
 			_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
 				Status:  constant.APIStatusError,
@@ -201,24 +423,312 @@ func (a *apiRouteProvider) ListSecretsHandler(w http.ResponseWriter, r *http.Req
 	})
 }
 
+// DueSecretsHandler - HTTP handler that returns reminders for user's secrets which are expired, or should be
+// rotated soon. Reminder lead time can be set in days using 'days' query parameter.
+// Reminders are built from secret metadata, so the handler doesn't decrypt anything.
+func (a *apiRouteProvider) DueSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	leadTime := a.config.ReminderLeadTime
+	if value := r.URL.Query().Get("days"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 || days > maxReminderDays {
+			_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+				Status:  constant.APIStatusFail,
+				Message: constant.APIMessageBadRequest,
+				Data:    nil,
+			})
+
+			return
+		}
+
+		leadTime = time.Duration(days) * 24 * time.Hour
+	}
+
+	secrets, err := a.storage.GetSecretsByUser(r.Context(), login)
+	if err != nil {
+		log.Printf("DueSecretsHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+			Status:  constant.APIStatusError,
+			Message: constant.APIMessageServerError,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   reminder.Collect(lo.Values(secrets), login, time.Now().UTC().Add(leadTime)),
+	})
+}
+
+// VaultHealthHandler - HTTP handler that analyzes user's secrets and reports weak, reused, old and breached
+// passwords, as well as expired cards. The report contains only secret identifiers and finding types.
+func (a *apiRouteProvider) VaultHealthHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("VaultHealthHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	secrets, err := a.storage.GetSecretsByUser(r.Context(), login)
+	if err != nil {
+		log.Printf("VaultHealthHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+			Status:  constant.APIStatusError,
+			Message: constant.APIMessageServerError,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	err = decryptSecrets(secrets, key, login)
+	if err != nil {
+		log.Printf("VaultHealthHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+			Status:  constant.APIStatusError,
+			Message: constant.APIMessageServerError,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	if a.breachChecker != nil {
+		// The corpus could be updated after the secrets were saved, so the stored flags are refreshed
+		for _, secret := range secrets {
+			compromised := a.isCompromised(secret)
+			if compromised == secret.Compromised {
+				continue
+			}
+
+			secret.Compromised = compromised
+			err = a.storage.SetSecretCompromised(r.Context(), secret.ID, compromised, login)
+			if err != nil {
+				log.Printf("VaultHealthHandler error: cannot update compromised flag: %s\n", err.Error())
+			}
+		}
+	}
+
+	report := health.Analyze(lo.Values(secrets), health.Options{
+		Now:      time.Now().UTC(),
+		MinScore: health.DefaultMinScore,
+		MaxAge:   a.config.PasswordMaxAge,
+	})
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   report,
+	})
+}
+
+// isCompromised - checks password of a decrypted secret against breached password corpus.
+// Corpus errors are only logged, so a broken corpus doesn't prevent users from saving their secrets.
+func (a *apiRouteProvider) isCompromised(secret *model.Secret) bool {
+	if a.breachChecker == nil || secret.Type != model.SecretTypePassword || secret.Password == "" {
+		return false
+	}
+
+	compromised, err := a.breachChecker.IsCompromised(secret.Password)
+	if err != nil {
+		log.Printf("isCompromised error: %s\n", err.Error())
+
+		return false
+	}
+
+	return compromised
+}
+
+// touchSecret - updates secret access time in background, so the client does not wait for the storage.
+// Request context cannot be used here, because it's cancelled as soon as the response is sent.
+func (a *apiRouteProvider) touchSecret(secretID, login string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), touchTimeout)
+		defer cancel()
+
+		if err := a.storage.TouchSecret(ctx, secretID, login); err != nil {
+			log.Printf("touchSecret error: %s\n", err.Error())
+		}
+	}()
+}
+
+// SearchSecretsHandler - HTTP handler that returns user's secret items which titles or URLs match
+// the search query. The query is matched against the blind index, so the server doesn't need to decrypt
+// all user secrets to find the matching ones.
+func (a *apiRouteProvider) SearchSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("SearchSecretsHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	searchKey, err := search.DeriveKey(key)
+	if err != nil {
+		log.Printf("SearchSecretsHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+			Status:  constant.APIStatusError,
+			Message: constant.APIMessageServerError,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	if utf8.RuneCountInString(query) > maxSearchQueryLength {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: "search query is too long",
+			Data:    nil,
+		})
+
+		return
+	}
+
+	tokens := search.QueryTokens(searchKey, query)
+	if len(tokens) == 0 {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: "search query is too short",
+			Data:    nil,
+		})
+
+		return
+	}
+
+	secrets, err := a.storage.SearchSecrets(r.Context(), tokens, login)
+	if err != nil {
+		log.Printf("SearchSecretsHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+			Status:  constant.APIStatusError,
+			Message: constant.APIMessageServerError,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	filterTokenSecrets(r, secrets)
+
+	err = decryptSecrets(secrets, key, login)
+	if err != nil {
+		log.Printf("SearchSecretsHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+			Status:  constant.APIStatusError,
+			Message: constant.APIMessageServerError,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   secrets,
+	})
+}
+
+// decryptSecrets - decrypts all secrets in place using user's data key
+func decryptSecrets(secrets map[int]*model.Secret, key, login string) error {
+	for _, secret := range secrets {
+		if err := secret.DecryptWithDataKey(key, login); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createSecret - encrypts a new secret with its own key and saves it along with the search index
+func (a *apiRouteProvider) createSecret(ctx context.Context, secret *model.Secret, login, dataKey string) error {
+	secret.ID = 0
+	key, err := secret.GenerateKey(dataKey)
+	if err != nil {
+		return err
+	}
+
+	secret.SetCardExpiresAt()
+	secret.Compromised = a.isCompromised(secret)
+
+	searchKey, err := search.DeriveKey(dataKey)
+	if err != nil {
+		return err
+	}
+
+	searchTokens := search.Tokens(searchKey, secret.Title, secret.URL)
+	if err = secret.Encrypt(key, login); err != nil {
+		return err
+	}
+
+	_, err = a.storage.SaveSecret(ctx, secret, searchTokens, login)
+
+	return err
+}
+
 // DeleteSecretHandler - HTTP handler for deleting a secret item
 func (a *apiRouteProvider) DeleteSecretHandler(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	login := r.Context().Value(api.ContextUserLogin).(string)
 
+	if !tokenAllowsSecret(r, id) {
+		log.Printf("DeleteSecretHandler error: secret %s is not allowed for the API token\n", id)
+		writeStorageError(w, constant.ErrForbidden)
+
+		return
+	}
+
 	err := a.storage.DeleteSecret(r.Context(), id, login)
+	if errors.Is(err, constant.ErrNotFound) {
+		// The secret could be shared with the user by another user
+		err = a.deleteSharedSecret(r.Context(), id, login)
+	}
+
 	if err != nil {
 		log.Printf("DeleteSecretHandler error: %s\n", err.Error())
 
-		_ = utils.WriteJSON(w, http.StatusNotFound, api.Response{
-			Status:  constant.APIStatusFail,
-			Message: constant.APIMessageNotFound,
-			Data:    nil,
-		})
+		if errors.Is(err, constant.ErrForbidden) {
+			_ = utils.WriteJSON(w, http.StatusForbidden, api.Response{
+				Status:  constant.APIStatusFail,
+				Message: constant.APIMessageForbidden,
+				Data:    nil,
+			})
+		} else {
+			_ = utils.WriteJSON(w, http.StatusNotFound, api.Response{
+				Status:  constant.APIStatusFail,
+				Message: constant.APIMessageNotFound,
+				Data:    nil,
+			})
+		}
 
 		return
 	}
 
+	recordAuditEvent(a.auditLog, r, audit.EventSecretDelete, login, id)
+
 	_ = utils.WriteJSON(w, http.StatusAccepted, api.Response{
 		Status: constant.APIStatusSuccess,
 		Data:   id,
@@ -230,7 +740,15 @@ func (a *apiRouteProvider) DownloadSecretFileHandler(w http.ResponseWriter, r *h
 	login := r.Context().Value(api.ContextUserLogin).(string)
 	secretID := chi.URLParam(r, "id")
 
-	key, err := a.keyCache.Get(login)
+	if !tokenAllowsSecret(r, secretID) {
+		log.Printf("DownloadSecretFileHandler error: secret %s is not allowed for the API token\n", secretID)
+
+		http.Error(w, constant.APIMessageForbidden, http.StatusForbidden)
+
+		return
+	}
+
+	key, err := getDataKey(r, a.keyCache, login)
 	if err != nil {
 		log.Printf("DownloadSecretFileHandler error: %s\n", err.Error())
 
@@ -239,7 +757,7 @@ func (a *apiRouteProvider) DownloadSecretFileHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	secret, err := a.storage.GetSecret(r.Context(), secretID, login)
+	secret, access, err := a.getSecretAccess(r.Context(), secretID, login, key)
 	if err != nil {
 		log.Printf("DownloadSecretFileHandler error: %s\n", err.Error())
 
@@ -253,7 +771,7 @@ func (a *apiRouteProvider) DownloadSecretFileHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	err = secret.Decrypt(key, login)
+	err = secret.Decrypt(access.key, access.owner)
 	if err != nil {
 		log.Printf("DownloadSecretFileHandler error: %s\n", err.Error())
 
@@ -266,6 +784,12 @@ func (a *apiRouteProvider) DownloadSecretFileHandler(w http.ResponseWriter, r *h
 		return
 	}
 
+	if access.isOwner() {
+		a.touchSecret(secretID, login)
+	}
+
+	recordAuditEvent(a.auditLog, r, audit.EventSecretDownload, login, secretID)
+
 	// Set headers for the download
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", secret.FileName))
 	w.Header().Set("Content-Type", "application/octet-stream")
@@ -10,6 +10,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
@@ -418,3 +419,319 @@ func TestDownloadSecretFileHandler(t *testing.T) {
 	// Check the response status code for internal server error.
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 }
+
+func TestSearchSecretsHandler(t *testing.T) {
+	handler := &apiRouteProvider{
+		config: config.AppConfig{},
+		storage: &MockStorage{
+			users: make(map[string]*model.User),
+		},
+		keyCache: &MockKeyCache{},
+	}
+
+	testCases := []struct {
+		name           string
+		login          string
+		query          string
+		httpStatusCode int
+	}{
+		{
+			name:           "secrets found",
+			login:          "validLogin",
+			query:          "git",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "query is too short",
+			login:          "validLogin",
+			query:          "g",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "query is too long",
+			login:          "validLogin",
+			query:          strings.Repeat("git", maxSearchQueryLength),
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "error getting decrypt key from keycache",
+			login:          "invalid_user",
+			query:          "git",
+			httpStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "storage error",
+			login:          "valid_user",
+			query:          "git",
+			httpStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/secrets/search?q="+tc.query, nil)
+			req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, tc.login))
+			rr := httptest.NewRecorder()
+
+			handler.SearchSecretsHandler(rr, req)
+
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+		})
+	}
+}
+
+func TestGetSecretHandler(t *testing.T) {
+	r := chi.NewRouter()
+	apiProvider := &apiRouteProvider{
+		storage:  &MockStorage{},
+		keyCache: &MockKeyCache{},
+	}
+	r.Get("/secrets/{id}", apiProvider.GetSecretHandler)
+
+	testCases := []struct {
+		name           string
+		login          string
+		secretID       string
+		httpStatusCode int
+	}{
+		{
+			name:           "secret found",
+			login:          "valid_user",
+			secretID:       "valid_id",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "secret not found",
+			login:          "valid_user",
+			secretID:       "not_found_id",
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "storage error",
+			login:          "valid_user",
+			secretID:       "error_id",
+			httpStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "error getting decrypt key from keycache",
+			login:          "invalid_user",
+			secretID:       "valid_id",
+			httpStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/secrets/"+tc.secretID, nil)
+			req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, tc.login))
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			require.Equal(t, tc.httpStatusCode, w.Code)
+		})
+	}
+}
+
+func TestRecentSecretsHandler(t *testing.T) {
+	handler := &apiRouteProvider{
+		storage:  &MockStorage{},
+		keyCache: &MockKeyCache{},
+	}
+
+	testCases := []struct {
+		name           string
+		login          string
+		url            string
+		httpStatusCode int
+	}{
+		{
+			name:           "default limit",
+			login:          "validLogin",
+			url:            "/secrets/recent",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "custom limit",
+			login:          "validLogin",
+			url:            "/secrets/recent?limit=5",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "invalid limit",
+			login:          "validLogin",
+			url:            "/secrets/recent?limit=abc",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "limit is too big",
+			login:          "validLogin",
+			url:            "/secrets/recent?limit=1000",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "error getting decrypt key from keycache",
+			login:          "invalid_user",
+			url:            "/secrets/recent",
+			httpStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "storage error",
+			login:          "valid_user",
+			url:            "/secrets/recent",
+			httpStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.url, nil)
+			req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, tc.login))
+			rr := httptest.NewRecorder()
+
+			handler.RecentSecretsHandler(rr, req)
+
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+		})
+	}
+}
+
+func TestDueSecretsHandler(t *testing.T) {
+	handler := &apiRouteProvider{
+		config:   config.AppConfig{ReminderLeadTime: time.Hour},
+		storage:  &MockStorage{},
+		keyCache: &MockKeyCache{},
+	}
+
+	testCases := []struct {
+		name           string
+		login          string
+		url            string
+		httpStatusCode int
+	}{
+		{
+			name:           "default lead time",
+			login:          "validLogin",
+			url:            "/secrets/due",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "custom lead time",
+			login:          "validLogin",
+			url:            "/secrets/due?days=30",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "invalid lead time",
+			login:          "validLogin",
+			url:            "/secrets/due?days=-1",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "lead time is too long",
+			login:          "validLogin",
+			url:            "/secrets/due?days=3651",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "storage error",
+			login:          "valid_user",
+			url:            "/secrets/due",
+			httpStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.url, nil)
+			req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, tc.login))
+			rr := httptest.NewRecorder()
+
+			handler.DueSecretsHandler(rr, req)
+
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+		})
+	}
+}
+
+func TestVaultHealthHandler(t *testing.T) {
+	handler := &apiRouteProvider{
+		config:   config.AppConfig{},
+		storage:  &MockStorage{},
+		keyCache: &MockKeyCache{},
+	}
+
+	testCases := []struct {
+		name           string
+		login          string
+		httpStatusCode int
+	}{
+		{
+			name:           "report is created",
+			login:          "validLogin",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "error getting decrypt key from keycache",
+			login:          "invalid_user",
+			httpStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "storage error",
+			login:          "valid_user",
+			httpStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/secrets/health", nil)
+			req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, tc.login))
+			rr := httptest.NewRecorder()
+
+			handler.VaultHealthHandler(rr, req)
+
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+		})
+	}
+}
+
+func TestIsCompromised(t *testing.T) {
+	handler := &apiRouteProvider{breachChecker: mockBreachChecker{}}
+
+	testCases := []struct {
+		name        string
+		secret      model.Secret
+		compromised bool
+	}{
+		{
+			name:        "breached password",
+			secret:      model.Secret{Type: model.SecretTypePassword, Password: "password"},
+			compromised: true,
+		},
+		{
+			name:        "unique password",
+			secret:      model.Secret{Type: model.SecretTypePassword, Password: "h7#Lq9!vZr2@mWx"},
+			compromised: false,
+		},
+		{
+			name:        "only passwords are checked",
+			secret:      model.Secret{Type: model.SecretTypeNote, Password: "password"},
+			compromised: false,
+		},
+		{
+			name:        "corpus error",
+			secret:      model.Secret{Type: model.SecretTypePassword, Password: "corpus_error"},
+			compromised: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.compromised, handler.isCompromised(&tc.secret))
+		})
+	}
+
+	handler.breachChecker = nil
+	require.False(t, handler.isCompromised(&model.Secret{Type: model.SecretTypePassword, Password: "password"}))
+}
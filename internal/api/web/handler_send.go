@@ -0,0 +1,239 @@
+package web
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/api/utils"
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// sendPasswordHeader - passphrase of a protected send is passed in a header, so it doesn't get into access logs
+const sendPasswordHeader = "X-Send-Password"
+
+const (
+	// defaultSendLifetime - how long a send is available if expiration time is not set by the user
+	defaultSendLifetime = 24 * time.Hour
+	// maxSendViews - how many times a send can be viewed at most
+	maxSendViews = 100
+	// maxSendPasswordFailures - how many times the passphrase can be entered wrong before the send is destroyed
+	maxSendPasswordFailures = 5
+)
+
+type sendRequest struct {
+	Type      string     `json:"type"`
+	Payload   string     `json:"payload"`
+	FileName  string     `json:"file_name"`
+	MaxViews  int        `json:"max_views"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Password  string     `json:"password"`
+}
+
+// newSend - validates the request and creates a send with a random identifier
+func (a *apiRouteProvider) newSend(request sendRequest, now time.Time) (*model.Send, error) {
+	if !model.IsValidSendType(request.Type) || request.Payload == "" {
+		return nil, errors.New("send type and payload are required")
+	}
+
+	// The server cannot check that the payload is encrypted, but at least it should be a valid ciphertext encoding
+	if _, err := base64.StdEncoding.DecodeString(request.Payload); err != nil {
+		return nil, err
+	}
+
+	maxViews := request.MaxViews
+	if maxViews == 0 {
+		maxViews = 1
+	}
+
+	if maxViews < 0 || maxViews > maxSendViews {
+		return nil, errors.New("invalid number of views")
+	}
+
+	lifetime := defaultSendLifetime
+	if a.config.SendMaxLifetime < lifetime {
+		lifetime = a.config.SendMaxLifetime
+	}
+
+	expiresAt := now.Add(lifetime)
+	if request.ExpiresAt != nil {
+		expiresAt = *request.ExpiresAt
+	}
+
+	if !expiresAt.After(now) || expiresAt.After(now.Add(a.config.SendMaxLifetime)) {
+		return nil, errors.New("invalid expiration time")
+	}
+
+	send := &model.Send{
+		Type:      request.Type,
+		Payload:   request.Payload,
+		FileName:  request.FileName,
+		MaxViews:  maxViews,
+		ExpiresAt: expiresAt.UTC(),
+	}
+
+	if err := send.GenerateID(); err != nil {
+		return nil, err
+	}
+
+	if err := send.SetPassword(request.Password); err != nil {
+		return nil, err
+	}
+
+	return send, nil
+}
+
+// CreateSendHandler - HTTP handler that creates a one-time secret link. The payload must be encrypted
+// by the client, the decryption key should be kept in the URL fragment, so it never reaches the server.
+func (a *apiRouteProvider) CreateSendHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	var request sendRequest
+	err := utils.ReadJSON(w, r, &request)
+
+	var send *model.Send
+	if err == nil {
+		send, err = a.newSend(request, time.Now().UTC())
+	}
+
+	if err != nil {
+		log.Printf("CreateSendHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	err = a.storage.SaveSend(r.Context(), send, login)
+	if err != nil {
+		log.Printf("CreateSendHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	// The client already has the payload, there is no need to send it back
+	send.Payload = ""
+
+	_ = utils.WriteJSON(w, http.StatusCreated, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   send,
+	})
+}
+
+// ListSendsHandler - HTTP handler that returns one-time secret links of the current user without payloads
+func (a *apiRouteProvider) ListSendsHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	sends, err := a.storage.GetSends(r.Context(), login)
+	if err != nil {
+		log.Printf("ListSendsHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   sends,
+	})
+}
+
+// DeleteSendHandler - HTTP handler that revokes a one-time secret link before it's viewed or expired
+func (a *apiRouteProvider) DeleteSendHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+	id := chi.URLParam(r, "id")
+
+	err := a.storage.DeleteSend(r.Context(), id, login)
+	if err != nil {
+		log.Printf("DeleteSendHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusAccepted, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   id,
+	})
+}
+
+// ReceiveSendHandler - public HTTP handler that returns the encrypted payload of a one-time secret link.
+// Every successful request is counted as a view, the send is removed after the last view.
+// Requests with a wrong passphrase are counted as failures, the send is destroyed after
+// maxSendPasswordFailures failures.
+func (a *apiRouteProvider) ReceiveSendHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	send, err := a.storage.GetSend(r.Context(), id)
+	if err == nil && !send.IsAvailable(time.Now().UTC()) {
+		err = constant.ErrNotFound
+	}
+
+	var failures int
+	if err == nil && send.IsPasswordProtected() {
+		failures, err = a.storage.AttemptSendPassword(r.Context(), id, maxSendPasswordFailures)
+	}
+
+	if err != nil {
+		log.Printf("ReceiveSendHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	matches, err := send.PasswordMatches(r.Header.Get(sendPasswordHeader))
+	if err != nil {
+		log.Printf("ReceiveSendHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+			Status:  constant.APIStatusError,
+			Message: constant.APIMessageServerError,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	if !matches {
+		log.Printf("ReceiveSendHandler error: wrong passphrase for send '%s'\n", id)
+
+		if failures >= maxSendPasswordFailures {
+			if err = a.storage.DestroySend(r.Context(), id); err != nil {
+				log.Printf("ReceiveSendHandler error: %s\n", err.Error())
+			}
+		}
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	send, err = a.storage.ConsumeSend(r.Context(), id)
+	if err != nil {
+		log.Printf("ReceiveSendHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   send,
+	})
+}
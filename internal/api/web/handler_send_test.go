@@ -0,0 +1,232 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/config"
+)
+
+func newSendTestProvider() *apiRouteProvider {
+	return &apiRouteProvider{
+		config:   config.AppConfig{SendMaxLifetime: 72 * time.Hour},
+		storage:  &MockStorage{},
+		keyCache: &MockKeyCache{},
+	}
+}
+
+func TestCreateSendHandler(t *testing.T) {
+	handler := newSendTestProvider()
+	router := chi.NewRouter()
+	router.Post("/sends", handler.CreateSendHandler)
+
+	expiresAt := time.Now().Add(48 * time.Hour).UTC().Format(time.RFC3339)
+	tooLate := time.Now().Add(96 * time.Hour).UTC().Format(time.RFC3339)
+
+	testCases := []struct {
+		name           string
+		login          string
+		payload        string
+		httpStatusCode int
+	}{
+		{
+			name:           "text send is created",
+			login:          "validLogin",
+			payload:        `{"type": "text", "payload": "Y2lwaGVydGV4dA=="}`,
+			httpStatusCode: http.StatusCreated,
+		},
+		{
+			name:  "protected file send is created",
+			login: "validLogin",
+			payload: `{"type": "file", "payload": "Y2lwaGVydGV4dA==", "file_name": "bmFtZQ==", "max_views": 3, ` +
+				`"expires_at": "` + expiresAt + `", "password": "passphrase"}`,
+			httpStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "invalid type",
+			login:          "validLogin",
+			payload:        `{"type": "card", "payload": "Y2lwaGVydGV4dA=="}`,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "payload is not base64 encoded",
+			login:          "validLogin",
+			payload:        `{"type": "text", "payload": "plain text"}`,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "too many views",
+			login:          "validLogin",
+			payload:        `{"type": "text", "payload": "Y2lwaGVydGV4dA==", "max_views": 1000}`,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "expiration time exceeds maximum lifetime",
+			login:          "validLogin",
+			payload:        `{"type": "text", "payload": "Y2lwaGVydGV4dA==", "expires_at": "` + tooLate + `"}`,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "expiration time in the past",
+			login:          "validLogin",
+			payload:        `{"type": "text", "payload": "Y2lwaGVydGV4dA==", "expires_at": "2020-01-01T00:00:00Z"}`,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "storage error",
+			login:          "valid_user",
+			payload:        `{"type": "text", "payload": "Y2lwaGVydGV4dA=="}`,
+			httpStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/sends", strings.NewReader(tc.payload))
+			req.Header.Set("Content-Type", "application/json")
+			req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, tc.login))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+			if rr.Code == http.StatusCreated {
+				require.NotContains(t, rr.Body.String(), "Y2lwaGVydGV4dA==", "payload should not be sent back")
+			}
+		})
+	}
+}
+
+func TestReceiveSendHandler(t *testing.T) {
+	handler := newSendTestProvider()
+	router := chi.NewRouter()
+	router.Get("/sends/{id}", handler.ReceiveSendHandler)
+
+	testCases := []struct {
+		name           string
+		id             string
+		password       string
+		httpStatusCode int
+	}{
+		{
+			name:           "send is received",
+			id:             "text_send",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "protected send is received",
+			id:             "protected_send",
+			password:       "passphrase",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "wrong passphrase",
+			id:             "protected_send",
+			password:       "wrong",
+			httpStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "passphrase is required",
+			id:             "protected_send",
+			httpStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "send is destroyed after wrong passphrases",
+			id:             "guessed_send",
+			password:       "passphrase",
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "expired send",
+			id:             "expired_send",
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "send not found",
+			id:             "unknown",
+			httpStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/sends/"+tc.id, nil)
+			if tc.password != "" {
+				req.Header.Set(sendPasswordHeader, tc.password)
+			}
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+			if rr.Code == http.StatusOK {
+				require.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+				require.Contains(t, rr.Body.String(), "Y2lwaGVydGV4dA==")
+			}
+		})
+	}
+}
+
+func TestSendOwnerHandlers(t *testing.T) {
+	handler := newSendTestProvider()
+	router := chi.NewRouter()
+	router.Get("/sends", handler.ListSendsHandler)
+	router.Delete("/sends/{id}", handler.DeleteSendHandler)
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		login          string
+		httpStatusCode int
+	}{
+		{
+			name:           "list sends",
+			method:         "GET",
+			path:           "/sends",
+			login:          "validLogin",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "storage error when listing sends",
+			method:         "GET",
+			path:           "/sends",
+			login:          "valid_user",
+			httpStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "send is revoked",
+			method:         "DELETE",
+			path:           "/sends/text_send",
+			login:          "validLogin",
+			httpStatusCode: http.StatusAccepted,
+		},
+		{
+			name:           "send of another user cannot be revoked",
+			method:         "DELETE",
+			path:           "/sends/text_send",
+			login:          "recipient",
+			httpStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, tc.login))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+		})
+	}
+}
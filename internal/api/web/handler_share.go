@@ -0,0 +1,453 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/api/utils"
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+type shareRequest struct {
+	Login      string `json:"login"`
+	Permission string `json:"permission"`
+}
+
+// secretAccess - describes how the current user can access a secret, which is either owned by the user
+// or shared with them by another user
+type secretAccess struct {
+	owner string
+	// key encrypts the secret fields, the owner's login is always used as salt
+	key string
+	// share is nil when the user owns the secret
+	share *model.Share
+}
+
+func (sa secretAccess) isOwner() bool {
+	return sa.share == nil
+}
+
+func (sa secretAccess) canEdit() bool {
+	return sa.share == nil || sa.share.CanEdit()
+}
+
+// getSecretAccess - returns an encrypted secret which is either owned by the user or shared with them,
+// and the key which should be used to decrypt it
+//
+//nolint:lll
+func (a *apiRouteProvider) getSecretAccess(ctx context.Context, secretID, login, dataKey string) (*model.Secret, secretAccess, error) {
+	secret, err := a.storage.GetSecret(ctx, secretID, login)
+	if err == nil {
+		var key string
+		key, err = secret.Key(dataKey)
+
+		return secret, secretAccess{owner: login, key: key}, err
+	}
+
+	if !errors.Is(err, constant.ErrNotFound) {
+		return nil, secretAccess{}, err
+	}
+
+	share, err := a.storage.GetShare(ctx, secretID, login)
+	if err != nil {
+		return nil, secretAccess{}, err
+	}
+
+	user, err := a.storage.GetUser(ctx, login)
+	if err != nil {
+		return nil, secretAccess{}, err
+	}
+
+	key, err := openShareKey(share, user, dataKey)
+	if err != nil {
+		return nil, secretAccess{}, err
+	}
+
+	secret, err = a.storage.GetSecret(ctx, secretID, share.Owner)
+	if err != nil {
+		return nil, secretAccess{}, err
+	}
+
+	return secret, secretAccess{owner: share.Owner, key: key, share: share}, nil
+}
+
+// openShareKey - decrypts the key of a shared secret using the recipient's key pair
+func openShareKey(share *model.Share, recipient *model.User, dataKey string) (string, error) {
+	privateKey, err := recipient.GetPrivateKey(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return share.OpenKey(recipient.PublicKey, privateKey)
+}
+
+// getSecretAccessForUpdate - checks that the user is allowed to update the secret and returns the key
+// which the updated secret should be encrypted with. Secrets which were created before per-secret keys
+// were introduced are re-encrypted with their own key, because the update doesn't replace the attached file.
+// Users with whom the secret is shared can't change its title and URL.
+func (a *apiRouteProvider) getSecretAccessForUpdate(
+	ctx context.Context,
+	secret *model.Secret,
+	login, dataKey string,
+) (secretAccess, error) {
+	stored, access, err := a.getSecretAccess(ctx, strconv.FormatInt(secret.ID, 10), login, dataKey)
+	if err != nil {
+		return secretAccess{}, err
+	}
+
+	if !access.canEdit() {
+		return secretAccess{}, constant.ErrForbidden
+	}
+
+	// The search index of the owner can be updated only with the owner's data key, so other users
+	// can't change the fields which are indexed
+	if !access.isOwner() {
+		if err = stored.Decrypt(access.key, access.owner); err != nil {
+			return secretAccess{}, err
+		}
+
+		if stored.Title != secret.Title || stored.URL != secret.URL {
+			return secretAccess{}, fmt.Errorf("title and URL can be changed only by the owner: %w", constant.ErrForbidden)
+		}
+	}
+
+	// Shared secrets always have their own key, so only the owner's secrets can be re-encrypted here
+	if access.isOwner() && len(stored.WrappedKey) == 0 {
+		access.key, err = stored.Rekey(dataKey, login)
+		if err == nil {
+			err = a.storage.UpdateSecretKey(ctx, stored, nil, login)
+		}
+	}
+
+	secret.WrappedKey = stored.WrappedKey
+
+	return access, err
+}
+
+// ensureSecretKey - returns the secret's own key. Secrets which were created before per-secret keys
+// were introduced are re-encrypted with their own key, because the data key must never be given to other users.
+//
+//nolint:lll
+func (a *apiRouteProvider) ensureSecretKey(ctx context.Context, secret *model.Secret, dataKey, login string) (string, error) {
+	if len(secret.WrappedKey) > 0 {
+		return secret.Key(dataKey)
+	}
+
+	key, err := secret.Rekey(dataKey, login)
+	if err != nil {
+		return "", err
+	}
+
+	return key, a.storage.UpdateSecretKey(ctx, secret, nil, login)
+}
+
+// sealSharedKeys - encrypts the secret key with the public key of every recipient of the secret
+func (a *apiRouteProvider) sealSharedKeys(ctx context.Context, shares []*model.Share, secretKey string) error {
+	for _, share := range shares {
+		recipient, err := a.storage.GetUser(ctx, share.Recipient)
+		if err != nil {
+			return err
+		}
+
+		if err = share.SealKey(secretKey, recipient.PublicKey); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RotateSecretKeyHandler - HTTP handler that re-encrypts the secret with a new random key. Users whom
+// the secret is shared with receive the new key, other secrets of the user are not affected.
+func (a *apiRouteProvider) RotateSecretKeyHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+	secretID := chi.URLParam(r, "id")
+
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("RotateSecretKeyHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	// Only the owner is allowed to rotate the key
+	secret, err := a.storage.GetSecret(r.Context(), secretID, login)
+	if err != nil {
+		log.Printf("RotateSecretKeyHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	shares, err := a.storage.GetSecretShares(r.Context(), secretID, login)
+	if err == nil {
+		var secretKey string
+		secretKey, err = secret.Rekey(key, login)
+		if err == nil {
+			err = a.sealSharedKeys(r.Context(), shares, secretKey)
+		}
+	}
+
+	if err == nil {
+		err = a.storage.UpdateSecretKey(r.Context(), secret, shares, login)
+	}
+
+	if err != nil {
+		log.Printf("RotateSecretKeyHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusAccepted, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   secretID,
+	})
+}
+
+// ShareSecretHandler - HTTP handler that shares user's secret with another user. The secret key
+// is encrypted with the recipient's public key, so the recipient can decrypt the secret with their own keys.
+// If the secret is already shared with the recipient, the permission is updated.
+func (a *apiRouteProvider) ShareSecretHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+	secretID := chi.URLParam(r, "id")
+
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("ShareSecretHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	var request shareRequest
+	err = utils.ReadJSON(w, r, &request)
+	if request.Permission == "" {
+		request.Permission = model.PermissionRead
+	}
+
+	if err != nil || request.Login == "" || request.Login == login || !model.IsValidPermission(request.Permission) {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	// Only the owner is allowed to share a secret
+	secret, err := a.storage.GetSecret(r.Context(), secretID, login)
+	if err != nil {
+		log.Printf("ShareSecretHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	recipient, err := a.storage.GetUser(r.Context(), request.Login)
+	if err != nil {
+		log.Printf("ShareSecretHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	if recipient.PublicKey == "" {
+		_ = utils.WriteJSON(w, http.StatusConflict, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: "recipient should log in before secrets can be shared with them",
+			Data:    nil,
+		})
+
+		return
+	}
+
+	secretKey, err := a.ensureSecretKey(r.Context(), secret, key, login)
+	if err != nil {
+		log.Printf("ShareSecretHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	share := &model.Share{
+		SecretID:   secret.ID,
+		Recipient:  recipient.Login,
+		Permission: request.Permission,
+	}
+
+	err = share.SealKey(secretKey, recipient.PublicKey)
+	if err == nil {
+		err = a.storage.SaveShare(r.Context(), share, login)
+	}
+
+	if err != nil {
+		log.Printf("ShareSecretHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusCreated, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   share,
+	})
+}
+
+// ListSecretSharesHandler - HTTP handler that returns users whom the secret is shared with
+func (a *apiRouteProvider) ListSecretSharesHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+	secretID := chi.URLParam(r, "id")
+
+	shares, err := a.storage.GetSecretShares(r.Context(), secretID, login)
+	if err != nil {
+		log.Printf("ListSecretSharesHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   shares,
+	})
+}
+
+// RevokeShareHandler - HTTP handler that revokes access to the secret from another user
+func (a *apiRouteProvider) RevokeShareHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+	secretID := chi.URLParam(r, "id")
+	recipient := chi.URLParam(r, "login")
+
+	err := a.storage.DeleteShare(r.Context(), secretID, recipient, login)
+	if err != nil {
+		log.Printf("RevokeShareHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusAccepted, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   recipient,
+	})
+}
+
+// SharedSecretsHandler - HTTP handler that returns secrets which other users shared with the current user
+func (a *apiRouteProvider) SharedSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("SharedSecretsHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	shares, err := a.storage.GetSharedSecrets(r.Context(), login)
+	if err == nil && len(shares) > 0 {
+		err = a.decryptSharedSecrets(r.Context(), shares, login, key)
+	}
+
+	if err != nil {
+		log.Printf("SharedSecretsHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+			Status:  constant.APIStatusError,
+			Message: constant.APIMessageServerError,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   shares,
+	})
+}
+
+//nolint:lll
+func (a *apiRouteProvider) decryptSharedSecrets(ctx context.Context, shares []*model.Share, login, dataKey string) error {
+	recipient, err := a.storage.GetUser(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	for _, share := range shares {
+		var key string
+		key, err = openShareKey(share, recipient, dataKey)
+		if err != nil {
+			return err
+		}
+
+		if err = share.Secret.Decrypt(key, share.Owner); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteSharedSecret - deletes a secret which was shared with the user, if the user is allowed to edit it
+func (a *apiRouteProvider) deleteSharedSecret(ctx context.Context, secretID, login string) error {
+	share, err := a.storage.GetShare(ctx, secretID, login)
+	if err != nil {
+		return err
+	}
+
+	if !share.CanEdit() {
+		return constant.ErrForbidden
+	}
+
+	return a.storage.DeleteSecret(ctx, secretID, share.Owner)
+}
+
+// writeStorageError - writes not found or server error response depending on the storage error
+func writeStorageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, constant.ErrNotFound):
+		_ = utils.WriteJSON(w, http.StatusNotFound, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageNotFound,
+			Data:    nil,
+		})
+	case errors.Is(err, constant.ErrForbidden):
+		_ = utils.WriteJSON(w, http.StatusForbidden, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageForbidden,
+			Data:    nil,
+		})
+	default:
+		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+			Status:  constant.APIStatusError,
+			Message: constant.APIMessageServerError,
+			Data:    nil,
+		})
+	}
+}
@@ -0,0 +1,352 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// newShareTestProvider - creates a route provider with two users: "recipient", who has a key pair,
+// and "no_keys_user", who was registered before secret sharing was introduced.
+// Key cache returns the recipient's data key.
+func newShareTestProvider(t *testing.T) *apiRouteProvider {
+	t.Helper()
+
+	recipient, err := model.NewUser("recipient", "password")
+	require.NoError(t, err)
+
+	dataKey, err := recipient.GetDataKey("password")
+	require.NoError(t, err)
+
+	noKeysUser, err := model.NewUser("no_keys_user", "password")
+	require.NoError(t, err)
+	noKeysUser.PublicKey = ""
+
+	return &apiRouteProvider{
+		config: config.AppConfig{},
+		storage: &MockStorage{
+			users: map[string]*model.User{
+				recipient.Login:  recipient,
+				noKeysUser.Login: noKeysUser,
+			},
+		},
+		keyCache: &MockKeyCache{getReturnValue: dataKey},
+	}
+}
+
+func TestShareSecretHandler(t *testing.T) {
+	handler := newShareTestProvider(t)
+	router := chi.NewRouter()
+	router.Post("/secrets/{id}/shares", handler.ShareSecretHandler)
+
+	testCases := []struct {
+		name           string
+		login          string
+		secretID       string
+		payload        string
+		httpStatusCode int
+	}{
+		{
+			name:           "secret is shared",
+			login:          "validLogin",
+			secretID:       "valid_id",
+			payload:        `{"login": "recipient", "permission": "edit"}`,
+			httpStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "read permission is used by default",
+			login:          "validLogin",
+			secretID:       "valid_id",
+			payload:        `{"login": "recipient"}`,
+			httpStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "invalid permission",
+			login:          "validLogin",
+			secretID:       "valid_id",
+			payload:        `{"login": "recipient", "permission": "admin"}`,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "secret cannot be shared with the owner",
+			login:          "validLogin",
+			secretID:       "valid_id",
+			payload:        `{"login": "validLogin"}`,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "recipient not found",
+			login:          "validLogin",
+			secretID:       "valid_id",
+			payload:        `{"login": "unknown"}`,
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "recipient has no key pair",
+			login:          "validLogin",
+			secretID:       "valid_id",
+			payload:        `{"login": "no_keys_user"}`,
+			httpStatusCode: http.StatusConflict,
+		},
+		{
+			name:           "secret not found",
+			login:          "validLogin",
+			secretID:       "not_found_id",
+			payload:        `{"login": "recipient"}`,
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "shared secret cannot be shared by recipient",
+			login:          "recipient",
+			secretID:       "1",
+			payload:        `{"login": "no_keys_user"}`,
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "error getting decrypt key from keycache",
+			login:          "invalid_user",
+			secretID:       "valid_id",
+			payload:        `{"login": "recipient"}`,
+			httpStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/secrets/"+tc.secretID+"/shares", strings.NewReader(tc.payload))
+			req.Header.Set("Content-Type", "application/json")
+			req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, tc.login))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+		})
+	}
+}
+
+func TestSharedSecretPermissions(t *testing.T) {
+	handler := newShareTestProvider(t)
+	router := chi.NewRouter()
+	router.Get("/secrets/{id}", handler.GetSecretHandler)
+	router.Put("/secrets/{id}", handler.SaveSecretHandler)
+	router.Delete("/secrets/{id}", handler.DeleteSecretHandler)
+
+	testCases := []struct {
+		name           string
+		method         string
+		secretID       string
+		payload        string
+		httpStatusCode int
+	}{
+		{
+			name:           "read shared secret",
+			method:         "GET",
+			secretID:       "2",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "update secret shared for editing",
+			method:         "PUT",
+			secretID:       "1",
+			payload:        `{"id": 1, "title": "Test", "note": "shared"}`,
+			httpStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "rename secret shared for editing",
+			method:         "PUT",
+			secretID:       "1",
+			payload:        `{"id": 1, "title": "shared"}`,
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "change URL of secret shared for editing",
+			method:         "PUT",
+			secretID:       "1",
+			payload:        `{"id": 1, "title": "Test", "url": "https://example.com"}`,
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "update read-only secret",
+			method:         "PUT",
+			secretID:       "2",
+			payload:        `{"id": 2, "title": "shared"}`,
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "update secret which is not shared",
+			method:         "PUT",
+			secretID:       "3",
+			payload:        `{"id": 3, "title": "shared"}`,
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "delete read-only secret",
+			method:         "DELETE",
+			secretID:       "2",
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "delete secret shared for editing",
+			method:         "DELETE",
+			secretID:       "1",
+			httpStatusCode: http.StatusAccepted,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/secrets/"+tc.secretID, strings.NewReader(tc.payload))
+			req.Header.Set("Content-Type", "application/json")
+			req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, "recipient"))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+		})
+	}
+}
+
+func TestSecretSharesHandlers(t *testing.T) {
+	handler := newShareTestProvider(t)
+	router := chi.NewRouter()
+	router.Get("/secrets/shared", handler.SharedSecretsHandler)
+	router.Get("/secrets/{id}/shares", handler.ListSecretSharesHandler)
+	router.Delete("/secrets/{id}/shares/{login}", handler.RevokeShareHandler)
+
+	testCases := []struct {
+		name           string
+		method         string
+		url            string
+		login          string
+		httpStatusCode int
+	}{
+		{
+			name:           "list secrets shared with user",
+			method:         "GET",
+			url:            "/secrets/shared",
+			login:          "validLogin",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "list shared secrets storage error",
+			method:         "GET",
+			url:            "/secrets/shared",
+			login:          "valid_user",
+			httpStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "list shared secrets keycache error",
+			method:         "GET",
+			url:            "/secrets/shared",
+			login:          "invalid_user",
+			httpStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "list secret shares",
+			method:         "GET",
+			url:            "/secrets/valid_id/shares",
+			login:          "validLogin",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "list secret shares storage error",
+			method:         "GET",
+			url:            "/secrets/valid_id/shares",
+			login:          "valid_user",
+			httpStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "revoke share",
+			method:         "DELETE",
+			url:            "/secrets/valid_id/shares/recipient",
+			login:          "validLogin",
+			httpStatusCode: http.StatusAccepted,
+		},
+		{
+			name:           "revoke unknown share",
+			method:         "DELETE",
+			url:            "/secrets/valid_id/shares/unknown",
+			login:          "validLogin",
+			httpStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, tc.login))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+		})
+	}
+}
+
+func TestRotateSecretKeyHandler(t *testing.T) {
+	handler := newShareTestProvider(t)
+	router := chi.NewRouter()
+	router.Post("/secrets/{id}/rotate-key", handler.RotateSecretKeyHandler)
+
+	testCases := []struct {
+		name           string
+		login          string
+		secretID       string
+		httpStatusCode int
+	}{
+		{
+			name:           "key is rotated",
+			login:          "validLogin",
+			secretID:       "valid_id",
+			httpStatusCode: http.StatusAccepted,
+		},
+		{
+			name:           "secret not found",
+			login:          "validLogin",
+			secretID:       "not_found_id",
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "only owner can rotate the key",
+			login:          "recipient",
+			secretID:       "1",
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "storage error",
+			login:          "valid_user",
+			secretID:       "valid_id",
+			httpStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "error getting decrypt key from keycache",
+			login:          "invalid_user",
+			secretID:       "valid_id",
+			httpStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/secrets/"+tc.secretID+"/rotate-key", nil)
+			req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, tc.login))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+		})
+	}
+}
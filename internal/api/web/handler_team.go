@@ -0,0 +1,623 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/samber/lo"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/api/utils"
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+type teamRequest struct {
+	Name string `json:"name"`
+}
+
+type memberRequest struct {
+	Login string `json:"login"`
+	Role  string `json:"role"`
+}
+
+// idParam - reads a numeric identifier from the URL
+func idParam(r *http.Request, name string) (int64, error) {
+	return strconv.ParseInt(chi.URLParam(r, name), 10, 64)
+}
+
+// canAssignRole - owners and admins manage team members, but only owners can grant or revoke owner role
+func canAssignRole(actorRole, role string) bool {
+	return model.CanManageTeam(actorRole) && (role != model.RoleOwner || actorRole == model.RoleOwner)
+}
+
+// openVault - returns the vault which the user can access and decrypts the vault key with the user's key pair
+//
+//nolint:lll
+func (a *apiRouteProvider) openVault(ctx context.Context, vaultID int64, login, dataKey string) (*model.VaultAccess, string, error) {
+	access, err := a.storage.GetVaultAccess(ctx, vaultID, login)
+	if err != nil {
+		return nil, "", err
+	}
+
+	user, err := a.storage.GetUser(ctx, login)
+	if err != nil {
+		return nil, "", err
+	}
+
+	privateKey, err := user.GetPrivateKey(dataKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	vaultKey, err := model.OpenSealedKey(access.SealedKey, user.PublicKey, privateKey)
+
+	return access, vaultKey, err
+}
+
+// sealVaultKey - encrypts the vault key with the public key of every team member
+//
+//nolint:lll
+func (a *apiRouteProvider) sealVaultKey(ctx context.Context, vaultID int64, vaultKey string, members []*model.TeamMember) ([]*model.VaultKey, error) {
+	keys := make([]*model.VaultKey, 0, len(members))
+	for _, member := range members {
+		user, err := a.storage.GetUser(ctx, member.Login)
+		if err != nil {
+			return nil, err
+		}
+
+		sealed, err := model.SealKey(vaultKey, user.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &model.VaultKey{VaultID: vaultID, Login: member.Login, SealedKey: sealed})
+	}
+
+	return keys, nil
+}
+
+// shareVaultKeys - encrypts keys of all team vaults with the public key of a new team member
+//
+//nolint:lll
+func (a *apiRouteProvider) shareVaultKeys(ctx context.Context, teamID int64, login, dataKey string, recipient *model.User) ([]*model.VaultKey, error) {
+	vaults, err := a.storage.GetVaults(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*model.VaultKey, 0, len(vaults))
+	for _, vault := range vaults {
+		var vaultKey, sealed string
+		_, vaultKey, err = a.openVault(ctx, vault.ID, login, dataKey)
+		if err != nil {
+			return nil, err
+		}
+
+		sealed, err = model.SealKey(vaultKey, recipient.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &model.VaultKey{VaultID: vault.ID, Login: recipient.Login, SealedKey: sealed})
+	}
+
+	return keys, nil
+}
+
+// rotateVaultKeys - generates new keys for all team vaults and seals them for every member except the removed one.
+// Secret keys are wrapped with the new vault key, the secrets themselves are not re-encrypted. The storage
+// rejects the rotations if the team was changed before they are saved.
+//
+//nolint:lll
+func (a *apiRouteProvider) rotateVaultKeys(ctx context.Context, teamID int64, removed, login, dataKey string) ([]*model.VaultRotation, error) {
+	members, err := a.storage.GetTeamMembers(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := lo.Filter(members, func(member *model.TeamMember, _ int) bool {
+		return member.Login != removed
+	})
+
+	vaults, err := a.storage.GetVaults(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	rotations := make([]*model.VaultRotation, 0, len(vaults))
+	for _, vault := range vaults {
+		var oldKey string
+		_, oldKey, err = a.openVault(ctx, vault.ID, login, dataKey)
+		if err != nil {
+			return nil, err
+		}
+
+		var secrets map[int]*model.Secret
+		secrets, err = a.storage.GetVaultSecrets(ctx, vault.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		newKey := utils.GenerateRandomPassword()
+		rotation := &model.VaultRotation{VaultID: vault.ID}
+		for _, secret := range secrets {
+			if err = secret.RewrapKey(oldKey, newKey); err != nil {
+				return nil, err
+			}
+
+			rotation.Secrets = append(rotation.Secrets, secret)
+		}
+
+		rotation.Keys, err = a.sealVaultKey(ctx, vault.ID, newKey, remaining)
+		if err != nil {
+			return nil, err
+		}
+
+		rotations = append(rotations, rotation)
+	}
+
+	return rotations, nil
+}
+
+// isLastOwner - a team must always have an owner, so the last one cannot leave the team or give up the role
+func (a *apiRouteProvider) isLastOwner(ctx context.Context, teamID int64) (bool, error) {
+	members, err := a.storage.GetTeamMembers(ctx, teamID)
+	if err != nil {
+		return false, err
+	}
+
+	owners := lo.CountBy(members, func(member *model.TeamMember) bool {
+		return member.Role == model.RoleOwner
+	})
+
+	return owners <= 1, nil
+}
+
+// writeLastOwnerError - writes conflict response when the last team owner is about to be removed or demoted
+func writeLastOwnerError(w http.ResponseWriter) {
+	_ = utils.WriteJSON(w, http.StatusConflict, api.Response{
+		Status:  constant.APIStatusFail,
+		Message: "team should have at least one owner",
+		Data:    nil,
+	})
+}
+
+// CreateTeamHandler - HTTP handler that creates a new team, the current user becomes the team owner
+func (a *apiRouteProvider) CreateTeamHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	var request teamRequest
+	err := utils.ReadJSON(w, r, &request)
+	if err != nil || strings.TrimSpace(request.Name) == "" {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	team := &model.Team{Name: strings.TrimSpace(request.Name)}
+	err = a.storage.CreateTeam(r.Context(), team, login)
+	if err != nil {
+		log.Printf("CreateTeamHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusCreated, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   team,
+	})
+}
+
+// ListTeamsHandler - HTTP handler that returns teams of the current user
+func (a *apiRouteProvider) ListTeamsHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	teams, err := a.storage.GetTeams(r.Context(), login)
+	if err != nil {
+		log.Printf("ListTeamsHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   teams,
+	})
+}
+
+// ListTeamMembersHandler - HTTP handler that returns members of a team, only team members can see the list
+func (a *apiRouteProvider) ListTeamMembersHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	teamID, err := idParam(r, "id")
+	if err != nil {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	_, err = a.storage.GetTeamMember(r.Context(), teamID, login)
+	if err != nil {
+		log.Printf("ListTeamMembersHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	members, err := a.storage.GetTeamMembers(r.Context(), teamID)
+	if err != nil {
+		log.Printf("ListTeamMembersHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   members,
+	})
+}
+
+// AddTeamMemberHandler - HTTP handler that adds a user to the team. Keys of all team vaults are encrypted
+// with the new member's public key, so the member can decrypt vault secrets with their own keys.
+func (a *apiRouteProvider) AddTeamMemberHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("AddTeamMemberHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	var request memberRequest
+	teamID, err := idParam(r, "id")
+	if err == nil {
+		err = utils.ReadJSON(w, r, &request)
+	}
+
+	if request.Role == "" {
+		request.Role = model.RoleMember
+	}
+
+	if err != nil || request.Login == "" || !model.IsValidRole(request.Role) {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	actor, err := a.storage.GetTeamMember(r.Context(), teamID, login)
+	if err == nil && !canAssignRole(actor.Role, request.Role) {
+		err = constant.ErrForbidden
+	}
+
+	if err != nil {
+		log.Printf("AddTeamMemberHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_, err = a.storage.GetTeamMember(r.Context(), teamID, request.Login)
+	if err == nil {
+		_ = utils.WriteJSON(w, http.StatusConflict, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: "user is already a team member",
+			Data:    nil,
+		})
+
+		return
+	}
+
+	var user *model.User
+	if errors.Is(err, constant.ErrNotFound) {
+		user, err = a.storage.GetUser(r.Context(), request.Login)
+	}
+
+	if err != nil {
+		log.Printf("AddTeamMemberHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	if user.PublicKey == "" {
+		_ = utils.WriteJSON(w, http.StatusConflict, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: "user should log in before they can be added to a team",
+			Data:    nil,
+		})
+
+		return
+	}
+
+	member := &model.TeamMember{TeamID: teamID, Login: user.Login, Role: request.Role}
+	keys, err := a.shareVaultKeys(r.Context(), teamID, login, key, user)
+	if err == nil {
+		err = a.storage.AddTeamMember(r.Context(), member, keys)
+	}
+
+	if err != nil {
+		log.Printf("AddTeamMemberHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusCreated, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   member,
+	})
+}
+
+// UpdateTeamMemberHandler - HTTP handler that changes a role of a team member
+func (a *apiRouteProvider) UpdateTeamMemberHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	var request memberRequest
+	teamID, err := idParam(r, "id")
+	if err == nil {
+		err = utils.ReadJSON(w, r, &request)
+	}
+
+	if err != nil || !model.IsValidRole(request.Role) {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	actor, err := a.storage.GetTeamMember(r.Context(), teamID, login)
+	var member *model.TeamMember
+	if err == nil {
+		member, err = a.storage.GetTeamMember(r.Context(), teamID, chi.URLParam(r, "login"))
+	}
+
+	if err == nil && (!canAssignRole(actor.Role, member.Role) || !canAssignRole(actor.Role, request.Role)) {
+		err = constant.ErrForbidden
+	}
+
+	if err != nil {
+		log.Printf("UpdateTeamMemberHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	if member.Role == model.RoleOwner && request.Role != model.RoleOwner {
+		var lastOwner bool
+		lastOwner, err = a.isLastOwner(r.Context(), teamID)
+		if err != nil {
+			log.Printf("UpdateTeamMemberHandler error: %s\n", err.Error())
+			writeStorageError(w, err)
+
+			return
+		}
+
+		if lastOwner {
+			writeLastOwnerError(w)
+
+			return
+		}
+	}
+
+	member.Role = request.Role
+	err = a.storage.UpdateTeamMember(r.Context(), member)
+	if err != nil {
+		log.Printf("UpdateTeamMemberHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   member,
+	})
+}
+
+// RemoveTeamMemberHandler - HTTP handler that removes a user from the team. Any member can leave the team.
+// Keys of all team vaults are rotated, so the removed member can't decrypt vault secrets anymore.
+func (a *apiRouteProvider) RemoveTeamMemberHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+	removed := chi.URLParam(r, "login")
+
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("RemoveTeamMemberHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	teamID, err := idParam(r, "id")
+	if err != nil {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	actor, err := a.storage.GetTeamMember(r.Context(), teamID, login)
+	var member *model.TeamMember
+	if err == nil {
+		member, err = a.storage.GetTeamMember(r.Context(), teamID, removed)
+	}
+
+	if err == nil && removed != login && !canAssignRole(actor.Role, member.Role) {
+		err = constant.ErrForbidden
+	}
+
+	var lastOwner bool
+	if err == nil && member.Role == model.RoleOwner {
+		lastOwner, err = a.isLastOwner(r.Context(), teamID)
+	}
+
+	if err != nil {
+		log.Printf("RemoveTeamMemberHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	if lastOwner {
+		writeLastOwnerError(w)
+
+		return
+	}
+
+	rotations, err := a.rotateVaultKeys(r.Context(), teamID, removed, login, key)
+	if err == nil {
+		err = a.storage.RemoveTeamMember(r.Context(), member, rotations)
+	}
+
+	if errors.Is(err, constant.ErrConflict) {
+		// Vaults, secrets or members were changed while the keys were rotated, nothing is saved
+		log.Printf("RemoveTeamMemberHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusConflict, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: "team was changed during the key rotation, try again",
+			Data:    nil,
+		})
+
+		return
+	}
+
+	if err != nil {
+		log.Printf("RemoveTeamMemberHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusAccepted, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   removed,
+	})
+}
+
+// CreateVaultHandler - HTTP handler that creates a team vault. A new random vault key is encrypted
+// with the public key of every team member.
+func (a *apiRouteProvider) CreateVaultHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	var request teamRequest
+	teamID, err := idParam(r, "id")
+	if err == nil {
+		err = utils.ReadJSON(w, r, &request)
+	}
+
+	if err != nil || strings.TrimSpace(request.Name) == "" {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	actor, err := a.storage.GetTeamMember(r.Context(), teamID, login)
+	if err == nil && !model.CanManageTeam(actor.Role) {
+		err = constant.ErrForbidden
+	}
+
+	var members []*model.TeamMember
+	if err == nil {
+		members, err = a.storage.GetTeamMembers(r.Context(), teamID)
+	}
+
+	var keys []*model.VaultKey
+	if err == nil {
+		keys, err = a.sealVaultKey(r.Context(), 0, utils.GenerateRandomPassword(), members)
+	}
+
+	vault := &model.Vault{TeamID: teamID, Name: strings.TrimSpace(request.Name)}
+	if err == nil {
+		err = a.storage.CreateVault(r.Context(), vault, keys)
+	}
+
+	if err != nil {
+		log.Printf("CreateVaultHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusCreated, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   vault,
+	})
+}
+
+// ListVaultsHandler - HTTP handler that returns vaults of a team
+func (a *apiRouteProvider) ListVaultsHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	teamID, err := idParam(r, "id")
+	if err != nil {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	_, err = a.storage.GetTeamMember(r.Context(), teamID, login)
+	var vaults []*model.Vault
+	if err == nil {
+		vaults, err = a.storage.GetVaults(r.Context(), teamID)
+	}
+
+	if err != nil {
+		log.Printf("ListVaultsHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   vaults,
+	})
+}
@@ -0,0 +1,340 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// newTeamTestProvider - creates a route provider with members of the mock team, "new_user" who isn't
+// a team member yet, and "no_keys_user", who was registered before secret sharing was introduced.
+// Key cache returns the data key of every user.
+func newTeamTestProvider(t *testing.T) *apiRouteProvider {
+	t.Helper()
+
+	users := make(map[string]*model.User)
+	keys := make(map[string]string)
+	for _, login := range []string{"team_owner", "team_admin", "team_member", "team_reader", "new_user"} {
+		user, err := model.NewUser(login, "password")
+		require.NoError(t, err)
+
+		keys[login], err = user.GetDataKey("password")
+		require.NoError(t, err)
+
+		users[login] = user
+	}
+
+	noKeysUser, err := model.NewUser("no_keys_user", "password")
+	require.NoError(t, err)
+	noKeysUser.PublicKey = ""
+	users[noKeysUser.Login] = noKeysUser
+
+	return &apiRouteProvider{
+		config:   config.AppConfig{},
+		storage:  &MockStorage{users: users},
+		keyCache: &MockKeyCache{keys: keys},
+	}
+}
+
+type teamTestCase struct {
+	name           string
+	login          string
+	method         string
+	path           string
+	payload        string
+	httpStatusCode int
+}
+
+func runTeamTestCases(t *testing.T, router http.Handler, testCases []teamTestCase) {
+	t.Helper()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.payload))
+			req.Header.Set("Content-Type", "application/json")
+			req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, tc.login))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+		})
+	}
+}
+
+func TestTeamHandlers(t *testing.T) {
+	handler := newTeamTestProvider(t)
+	router := chi.NewRouter()
+	router.Get("/teams", handler.ListTeamsHandler)
+	router.Post("/teams", handler.CreateTeamHandler)
+	router.Get("/teams/{id}/members", handler.ListTeamMembersHandler)
+	router.Get("/teams/{id}/vaults", handler.ListVaultsHandler)
+	router.Post("/teams/{id}/vaults", handler.CreateVaultHandler)
+
+	runTeamTestCases(t, router, []teamTestCase{
+		{
+			name:           "team is created",
+			login:          "new_user",
+			method:         "POST",
+			path:           "/teams",
+			payload:        `{"name": "developers"}`,
+			httpStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "team name is required",
+			login:          "new_user",
+			method:         "POST",
+			path:           "/teams",
+			payload:        `{"name": " "}`,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "storage error when creating a team",
+			login:          "valid_user",
+			method:         "POST",
+			path:           "/teams",
+			payload:        `{"name": "developers"}`,
+			httpStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "list teams",
+			login:          "team_member",
+			method:         "GET",
+			path:           "/teams",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "list members",
+			login:          "team_reader",
+			method:         "GET",
+			path:           "/teams/1/members",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "members are hidden from other users",
+			login:          "new_user",
+			method:         "GET",
+			path:           "/teams/1/members",
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "invalid team id",
+			login:          "team_member",
+			method:         "GET",
+			path:           "/teams/abc/members",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "storage error when listing members",
+			login:          "team_member",
+			method:         "GET",
+			path:           "/teams/2/members",
+			httpStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "admin creates a vault",
+			login:          "team_admin",
+			method:         "POST",
+			path:           "/teams/1/vaults",
+			payload:        `{"name": "production"}`,
+			httpStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "member cannot create a vault",
+			login:          "team_member",
+			method:         "POST",
+			path:           "/teams/1/vaults",
+			payload:        `{"name": "production"}`,
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "vault name is required",
+			login:          "team_admin",
+			method:         "POST",
+			path:           "/teams/1/vaults",
+			payload:        `{}`,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "list vaults",
+			login:          "team_reader",
+			method:         "GET",
+			path:           "/teams/1/vaults",
+			httpStatusCode: http.StatusOK,
+		},
+	})
+}
+
+func TestTeamMemberHandlers(t *testing.T) {
+	handler := newTeamTestProvider(t)
+	router := chi.NewRouter()
+	router.Post("/teams/{id}/members", handler.AddTeamMemberHandler)
+	router.Put("/teams/{id}/members/{login}", handler.UpdateTeamMemberHandler)
+	router.Delete("/teams/{id}/members/{login}", handler.RemoveTeamMemberHandler)
+
+	runTeamTestCases(t, router, []teamTestCase{
+		{
+			name:           "owner adds a member",
+			login:          "team_owner",
+			method:         "POST",
+			path:           "/teams/1/members",
+			payload:        `{"login": "new_user"}`,
+			httpStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "admin adds a read-only member",
+			login:          "team_admin",
+			method:         "POST",
+			path:           "/teams/1/members",
+			payload:        `{"login": "new_user", "role": "read-only"}`,
+			httpStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "admin cannot add an owner",
+			login:          "team_admin",
+			method:         "POST",
+			path:           "/teams/1/members",
+			payload:        `{"login": "new_user", "role": "owner"}`,
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "member cannot add members",
+			login:          "team_member",
+			method:         "POST",
+			path:           "/teams/1/members",
+			payload:        `{"login": "new_user"}`,
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "invalid role",
+			login:          "team_owner",
+			method:         "POST",
+			path:           "/teams/1/members",
+			payload:        `{"login": "new_user", "role": "guest"}`,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "user is already a member",
+			login:          "team_owner",
+			method:         "POST",
+			path:           "/teams/1/members",
+			payload:        `{"login": "team_reader"}`,
+			httpStatusCode: http.StatusConflict,
+		},
+		{
+			name:           "user not found",
+			login:          "team_owner",
+			method:         "POST",
+			path:           "/teams/1/members",
+			payload:        `{"login": "unknown"}`,
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "user has no key pair",
+			login:          "team_owner",
+			method:         "POST",
+			path:           "/teams/1/members",
+			payload:        `{"login": "no_keys_user"}`,
+			httpStatusCode: http.StatusConflict,
+		},
+		{
+			name:           "error getting decrypt key from keycache",
+			login:          "invalid_user",
+			method:         "POST",
+			path:           "/teams/1/members",
+			payload:        `{"login": "new_user"}`,
+			httpStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "owner promotes a member",
+			login:          "team_owner",
+			method:         "PUT",
+			path:           "/teams/1/members/team_member",
+			payload:        `{"role": "admin"}`,
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "admin changes role of a member",
+			login:          "team_admin",
+			method:         "PUT",
+			path:           "/teams/1/members/team_member",
+			payload:        `{"role": "read-only"}`,
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "admin cannot demote an owner",
+			login:          "team_admin",
+			method:         "PUT",
+			path:           "/teams/1/members/team_owner",
+			payload:        `{"role": "member"}`,
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "last owner cannot be demoted",
+			login:          "team_owner",
+			method:         "PUT",
+			path:           "/teams/1/members/team_owner",
+			payload:        `{"role": "admin"}`,
+			httpStatusCode: http.StatusConflict,
+		},
+		{
+			name:           "change role of unknown member",
+			login:          "team_owner",
+			method:         "PUT",
+			path:           "/teams/1/members/new_user",
+			payload:        `{"role": "admin"}`,
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "owner removes a member",
+			login:          "team_owner",
+			method:         "DELETE",
+			path:           "/teams/1/members/team_member",
+			httpStatusCode: http.StatusAccepted,
+		},
+		{
+			name:           "member leaves the team",
+			login:          "team_reader",
+			method:         "DELETE",
+			path:           "/teams/1/members/team_reader",
+			httpStatusCode: http.StatusAccepted,
+		},
+		{
+			name:           "member cannot remove other members",
+			login:          "team_member",
+			method:         "DELETE",
+			path:           "/teams/1/members/team_reader",
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "admin cannot remove an owner",
+			login:          "team_admin",
+			method:         "DELETE",
+			path:           "/teams/1/members/team_owner",
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "team is changed during the key rotation",
+			login:          "team_owner",
+			method:         "DELETE",
+			path:           "/teams/1/members/team_admin",
+			httpStatusCode: http.StatusConflict,
+		},
+		{
+			name:           "last owner cannot leave the team",
+			login:          "team_owner",
+			method:         "DELETE",
+			path:           "/teams/1/members/team_owner",
+			httpStatusCode: http.StatusConflict,
+		},
+	})
+}
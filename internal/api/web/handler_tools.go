@@ -0,0 +1,49 @@
+package web
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/api/utils"
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/passgen"
+)
+
+// PasswordGeneratorHandler - generates a random password or a diceware passphrase. Options which are not set
+// in the request body are taken from passgen.DefaultOptions. Response contains the password and its entropy.
+func PasswordGeneratorHandler(w http.ResponseWriter, r *http.Request) {
+	opts := passgen.DefaultOptions()
+	// Empty body is allowed, default options are used in this case
+	if err := utils.ReadJSON(w, r, &opts); err != nil && !errors.Is(err, io.EOF) {
+		log.Printf("PasswordGeneratorHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	result, err := passgen.Generate(opts)
+	if err != nil {
+		log.Printf("PasswordGeneratorHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: err.Error(),
+			Data:    nil,
+		})
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   result,
+	})
+}
@@ -0,0 +1,78 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/passgen"
+)
+
+func TestPasswordGeneratorHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		httpStatusCode int
+		wordsCount     int
+		length         int
+	}{
+		{
+			name:           "default options",
+			body:           "",
+			httpStatusCode: http.StatusOK,
+			length:         passgen.DefaultOptions().Length,
+		},
+		{
+			name:           "custom length",
+			body:           `{"length": 8}`,
+			httpStatusCode: http.StatusOK,
+			length:         8,
+		},
+		{
+			name:           "passphrase",
+			body:           `{"words": 5, "separator": " "}`,
+			httpStatusCode: http.StatusOK,
+			wordsCount:     5,
+		},
+		{
+			name:           "invalid options",
+			body:           `{"length": 1000}`,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown option",
+			body:           `{"colour": "red"}`,
+			httpStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/tools/password", strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+
+			PasswordGeneratorHandler(rr, req)
+			require.Equal(t, tc.httpStatusCode, rr.Code)
+
+			if tc.httpStatusCode != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data passgen.Result `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			require.Greater(t, response.Data.Entropy, float64(0))
+
+			if tc.wordsCount > 0 {
+				require.Len(t, strings.Split(response.Data.Password, " "), tc.wordsCount)
+			} else {
+				require.Len(t, response.Data.Password, tc.length)
+			}
+		})
+	}
+}
@@ -1,9 +1,13 @@
 package web
 
 import (
+	"context"
 	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/grafviktor/keep-my-secret/internal/api"
 	"github.com/grafviktor/keep-my-secret/internal/keycache"
@@ -12,27 +16,157 @@ import (
 
 	"github.com/grafviktor/keep-my-secret/internal/api/auth"
 	"github.com/grafviktor/keep-my-secret/internal/api/utils"
+	"github.com/grafviktor/keep-my-secret/internal/audit"
 	"github.com/grafviktor/keep-my-secret/internal/config"
 	"github.com/grafviktor/keep-my-secret/internal/constant"
 	"github.com/grafviktor/keep-my-secret/internal/model"
+	"github.com/grafviktor/keep-my-secret/internal/policy"
+	"github.com/grafviktor/keep-my-secret/internal/throttle"
 )
 
+// loginThrottleStoreStorage - failed login attempts are kept in the application storage
+const loginThrottleStoreStorage = "storage"
+
 type userHTTPHandler struct {
 	config    config.AppConfig
 	storage   userStorage
 	keyCache  keyCache
 	authUtils authUtils
+	// keys verify refresh tokens
+	keys      *auth.KeySet
+	auditLog  auditRecorder
+	throttler loginThrottler
+	policy    *policy.Policy
+	// secondFactor - confirms the login if the user has registered a security key
+	secondFactor secondFactor
 }
 
 // newUserHandlerProvider - returns a set of handlers to support auth requests
-func newUserHandlerProvider(appConfig config.AppConfig, storage userStorage) userHTTPHandler {
+func newUserHandlerProvider(
+	appConfig config.AppConfig,
+	storage userStorage,
+	auditLog auditRecorder,
+	throttler loginThrottler,
+	secondFactor secondFactor,
+	passwordPolicy *policy.Policy,
+	keys *auth.KeySet,
+) userHTTPHandler {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	return userHTTPHandler{
-		config:    appConfig,
-		storage:   storage,
-		keyCache:  keycache.GetInstance(),
-		authUtils: auth.New(appConfig),
+		config:       appConfig,
+		storage:      storage,
+		keyCache:     keycache.GetInstance(),
+		authUtils:    auth.New(appConfig, keys),
+		keys:         keys,
+		auditLog:     auditLog,
+		throttler:    throttler,
+		policy:       passwordPolicy,
+		secondFactor: secondFactor,
+	}
+}
+
+// writePolicyViolations - violations are returned in the response data, one item per violated rule
+func writePolicyViolations(w http.ResponseWriter, violations []policy.Violation) {
+	_ = utils.WriteJSON(w, http.StatusNotAcceptable, api.Response{
+		Status:  constant.APIStatusFail,
+		Message: constant.APIMessagePolicyViolation,
+		Data:    violations,
+	})
+}
+
+// newLoginThrottler - creates a throttler of login attempts, which are kept either in memory or in the storage
+func newLoginThrottler(appConfig config.AppConfig, appStorage throttle.Store) *throttle.Throttler {
+	store := appStorage
+	if appConfig.LoginThrottleStore != loginThrottleStoreStorage {
+		store = throttle.NewMemoryStore()
+	}
+
+	loginPolicy := throttle.DefaultLoginPolicy
+	loginPolicy.LockoutThreshold = appConfig.LoginMaxAttempts
+	loginPolicy.LockoutDuration = appConfig.LoginLockoutDuration
+
+	ipPolicy := throttle.DefaultIPPolicy
+	ipPolicy.LockoutThreshold = appConfig.LoginIPMaxAttempts
+	ipPolicy.LockoutDuration = appConfig.LoginLockoutDuration
+
+	return throttle.NewThrottler(store, loginPolicy, ipPolicy)
+}
+
+// writeTooManyRequests - tells the client when it may try again, the time is rounded up to seconds
+func writeTooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	headers := http.Header{}
+	headers.Set("Retry-After", strconv.FormatInt(seconds, 10))
+
+	_ = utils.WriteJSON(w, http.StatusTooManyRequests, api.Response{
+		Status:  constant.APIStatusFail,
+		Message: constant.APIMessageTooManyRequests,
+		Data:    nil,
+	}, headers)
+}
+
+// passwordConfirmation - the password of the signed-in user, which confirms a sensitive operation
+type passwordConfirmation struct {
+	Password string `json:"password"`
+}
+
+// confirmPassword - checks the password of the signed-in user before an operation which must not be possible
+// with a stolen access token alone. Users of identity providers confirm operations with the master password.
+// Wrong passwords are throttled like failed logins. Writes the response if the password is not confirmed.
+func confirmPassword(
+	w http.ResponseWriter,
+	r *http.Request,
+	storage passwordStorage,
+	throttler loginThrottler,
+	handlerName, login, password string,
+) bool {
+	clientIP := utils.ClientIP(r)
+	retryAfter, err := throttler.Attempt(r.Context(), login, clientIP)
+	if err != nil {
+		log.Printf("%s error: %s\n", handlerName, err.Error())
+		writeThrottlerError(w, err, retryAfter)
+
+		return false
+	}
+
+	user, err := storage.GetUser(r.Context(), login)
+	if err != nil {
+		log.Printf("%s error: %s\n", handlerName, err.Error())
+		writeStorageError(w, err)
+
+		return false
+	}
+
+	confirmed, err := user.ConfirmPassword(password)
+	if err != nil {
+		log.Printf("%s error: %s\n", handlerName, err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+			Status:  constant.APIStatusError,
+			Message: constant.APIMessageServerError,
+			Data:    nil,
+		})
+
+		return false
+	}
+
+	if !confirmed {
+		log.Printf("%s error: Login '%s' provided incorrect password\n", handlerName, login)
+
+		_ = utils.WriteJSON(w, http.StatusForbidden, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageForbidden,
+			Data:    nil,
+		})
+
+		return false
+	}
+
+	if err = throttler.Succeed(r.Context(), login, clientIP); err != nil {
+		log.Printf("%s error: cannot reset failed attempts: %s\n", handlerName, err.Error())
 	}
+
+	return true
 }
 
 type credentials struct {
@@ -60,10 +194,30 @@ func (h *userHTTPHandler) handleSuccessFullUserSignIn(w http.ResponseWriter, use
 		return
 	}
 
-	h.keyCache.Set(cred.Login, secret)
+	// Only regular users can register, administrators are promoted by the server owner
+	signIn(w, h.keyCache, h.authUtils, &auth.JWTUser{ID: cred.Login, Role: model.UserRoleUser}, secret)
+}
+
+// newJWTUser - the role of the user is included in the access token
+func newJWTUser(user *model.User) *auth.JWTUser {
+	return &auth.JWTUser{ID: user.Login, Role: user.Role}
+}
+
+// writeAccountDisabled - the user of a disabled account can't sign in, even with correct credentials
+func writeAccountDisabled(w http.ResponseWriter) {
+	_ = utils.WriteJSON(w, http.StatusForbidden, api.Response{
+		Status:  constant.APIStatusFail,
+		Message: constant.APIMessageAccountDisabled,
+		Data:    nil,
+	})
+}
+
+// signIn - keeps the data key of the user in memory and sets JWT tokens
+func signIn(w http.ResponseWriter, keyCache keyCache, authUtils authUtils, jwtUser *auth.JWTUser, dataKey string) {
+	login := jwtUser.ID
+	keyCache.Set(login, dataKey)
 
-	jwtUser := auth.JWTUser{ID: cred.Login}
-	tokens, err := h.authUtils.GenerateTokenPair(&jwtUser)
+	tokens, err := authUtils.GenerateTokenPair(jwtUser)
 	if err != nil {
 		log.Printf("LoginHandler error: cannot generate tokens. Error: %s", err.Error())
 
@@ -75,10 +229,10 @@ func (h *userHTTPHandler) handleSuccessFullUserSignIn(w http.ResponseWriter, use
 
 		return
 	}
-	refreshCookie := h.authUtils.GetRefreshCookie(tokens.RefreshToken)
+	refreshCookie := authUtils.GetRefreshCookie(tokens.RefreshToken)
 	http.SetCookie(w, refreshCookie)
 
-	log.Printf("LoginUser success: Login '%s'\n", cred.Login)
+	log.Printf("LoginUser success: Login '%s'\n", login)
 
 	_ = utils.WriteJSON(w, http.StatusCreated, api.Response{
 		Status: constant.APIStatusSuccess,
@@ -86,33 +240,48 @@ func (h *userHTTPHandler) handleSuccessFullUserSignIn(w http.ResponseWriter, use
 	})
 }
 
-// RegisterHandler - HTTP handler which handles user registration
+// RegisterHandler - HTTP handler which handles user registration, if the registration is open
 func (h *userHTTPHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
-	var cred credentials
-	if err := utils.ReadJSON(w, r, &cred); err != nil {
+	settings, err := h.storage.GetServerSettings(r.Context())
+	if err != nil {
 		log.Printf("RegisterHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
 
-		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+		return
+	}
+
+	if !settings.RegistrationOpen {
+		log.Println("RegisterHandler error: registration is closed")
+
+		_ = utils.WriteJSON(w, http.StatusForbidden, api.Response{
 			Status:  constant.APIStatusFail,
-			Message: constant.APIMessageBadRequest,
+			Message: constant.APIMessageRegistrationClosed,
 			Data:    nil,
 		})
 
 		return
 	}
 
-	if !utils.IsUsernameConformsPolicy(cred.Login) || !utils.IsPasswordConformsPolicy(cred.Password) {
-		log.Printf("%s password or username not complex enough", cred.Login)
+	var cred credentials
+	if err = utils.ReadJSON(w, r, &cred); err != nil {
+		log.Printf("RegisterHandler error: %s\n", err.Error())
 
-		_ = utils.WriteJSON(w, http.StatusNotAcceptable, api.Response{
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
 			Status:  constant.APIStatusFail,
-			Message: "password or username should not be empty",
+			Message: constant.APIMessageBadRequest,
 			Data:    nil,
 		})
 
 		return
 	}
 
+	if violations := h.policy.Check(cred.Login, cred.Password); len(violations) > 0 {
+		log.Printf("RegisterHandler error: credentials of '%s' don't conform to the policy\n", cred.Login)
+		writePolicyViolations(w, violations)
+
+		return
+	}
+
 	user, err := model.NewUser(cred.Login, cred.Password)
 	if err != nil {
 		log.Printf("RegisterHandler error: %s\n", err.Error())
@@ -147,6 +316,7 @@ func (h *userHTTPHandler) RegisterHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	recordAuditEvent(h.auditLog, r, audit.EventRegister, cred.Login, "")
 	h.handleSuccessFullUserSignIn(w, user, cred)
 }
 
@@ -166,12 +336,34 @@ func (h *userHTTPHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The attempt is counted as failed until the password is verified
+	clientIP := utils.ClientIP(r)
+	retryAfter, err := h.throttler.Attempt(r.Context(), cred.Login, clientIP)
+	if err != nil {
+		log.Printf("LoginHandler error: %s\n", err.Error())
+
+		if errors.Is(err, throttle.ErrThrottled) {
+			recordAuditEvent(h.auditLog, r, audit.EventLoginThrottled, cred.Login, "")
+			writeTooManyRequests(w, retryAfter)
+		} else {
+			_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+				Status:  constant.APIStatusError,
+				Message: constant.APIMessageServerError,
+				Data:    nil,
+			})
+		}
+
+		return
+	}
+
 	// Get password hash from the database
 	user, err := h.storage.GetUser(r.Context(), cred.Login)
 	if err != nil {
 		log.Printf("LoginHandler error: %s\n", err.Error())
 
 		if errors.Is(err, constant.ErrNotFound) {
+			recordAuditEvent(h.auditLog, r, audit.EventLoginFailure, cred.Login, "")
+
 			_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
 				Status:  constant.APIStatusFail,
 				Message: constant.APIMessageUnauthorized,
@@ -203,6 +395,7 @@ func (h *userHTTPHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 	if !isPasswordCorrect {
 		log.Printf("LoginHandler error: Login '%s' provided incorrect password\n", cred.Login)
+		recordAuditEvent(h.auditLog, r, audit.EventLoginFailure, cred.Login, "")
 
 		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
 			Status:  constant.APIStatusFail,
@@ -213,7 +406,175 @@ func (h *userHTTPHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.handleSuccessFullUserSignIn(w, user, cred)
+	dataKey, err := user.GetDataKey(cred.Password)
+	if err != nil {
+		log.Printf("LoginHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+			Status:  constant.APIStatusError,
+			Message: constant.APIMessageServerError,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	// The password is verified first, so the state of the account is not disclosed to anyone else
+	if user.Disabled {
+		log.Printf("LoginHandler error: account of '%s' is disabled\n", cred.Login)
+		recordAuditEvent(h.auditLog, r, audit.EventLoginFailure, cred.Login, "")
+		writeAccountDisabled(w)
+
+		return
+	}
+
+	if user.PublicKey == "" {
+		// Users which were registered before secret sharing was introduced don't have a key pair yet
+		h.createKeyPair(r.Context(), user, cred.Password)
+	}
+
+	// Failed attempts are reset only when the login is confirmed
+	if h.secondFactor.RequireSecondFactor(w, r, cred.Login, dataKey) {
+		return
+	}
+
+	if err = h.throttler.Succeed(r.Context(), cred.Login, clientIP); err != nil {
+		log.Printf("LoginHandler error: cannot reset failed attempts: %s\n", err.Error())
+	}
+
+	recordAuditEvent(h.auditLog, r, audit.EventLoginSuccess, cred.Login, "")
+	signIn(w, h.keyCache, h.authUtils, newJWTUser(user), dataKey)
+}
+
+// createKeyPair - creates a key pair for an existing user. Errors are only logged, because the user
+// still can use their own secrets, they just can't receive shared secrets.
+func (h *userHTTPHandler) createKeyPair(ctx context.Context, user *model.User, password string) {
+	dataKey, err := user.GetDataKey(password)
+	if err == nil {
+		err = user.GenerateKeyPair(dataKey)
+	}
+
+	if err == nil {
+		err = h.storage.SetUserKeyPair(ctx, user)
+	}
+
+	if err != nil {
+		log.Printf("LoginHandler error: cannot create key pair. Error: %s", err.Error())
+	}
+}
+
+type passwordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangePasswordHandler - HTTP handler which replaces the password of the signed-in user. The current
+// password is required, and wrong guesses are throttled the same way as failed logins.
+func (h *userHTTPHandler) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	var change passwordChange
+	if err := utils.ReadJSON(w, r, &change); err != nil {
+		log.Printf("ChangePasswordHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	violations := h.policy.CheckPassword("new_password", change.NewPassword, login)
+	if change.NewPassword != "" && change.NewPassword == change.CurrentPassword {
+		violations = append(violations, policy.Violation{
+			Field:   "new_password",
+			Code:    policy.CodeSameAsCurrent,
+			Message: "new password must differ from the current password",
+		})
+	}
+
+	if len(violations) > 0 {
+		log.Printf("ChangePasswordHandler error: new password of '%s' doesn't conform to the policy\n", login)
+		writePolicyViolations(w, violations)
+
+		return
+	}
+
+	clientIP := utils.ClientIP(r)
+	retryAfter, err := h.throttler.Attempt(r.Context(), login, clientIP)
+	if err != nil {
+		log.Printf("ChangePasswordHandler error: %s\n", err.Error())
+
+		if errors.Is(err, throttle.ErrThrottled) {
+			writeTooManyRequests(w, retryAfter)
+		} else {
+			_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+				Status:  constant.APIStatusError,
+				Message: constant.APIMessageServerError,
+				Data:    nil,
+			})
+		}
+
+		return
+	}
+
+	user, err := h.storage.GetUser(r.Context(), login)
+	if err != nil {
+		log.Printf("ChangePasswordHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	isPasswordCorrect, err := user.PasswordMatches(change.CurrentPassword)
+	if err != nil {
+		log.Printf("ChangePasswordHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+			Status:  constant.APIStatusError,
+			Message: constant.APIMessageServerError,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	if !isPasswordCorrect {
+		log.Printf("ChangePasswordHandler error: Login '%s' provided incorrect password\n", login)
+
+		_ = utils.WriteJSON(w, http.StatusForbidden, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageForbidden,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	if err = h.throttler.Succeed(r.Context(), login, clientIP); err != nil {
+		log.Printf("ChangePasswordHandler error: cannot reset failed attempts: %s\n", err.Error())
+	}
+
+	err = user.ChangePassword(change.CurrentPassword, change.NewPassword)
+	if err == nil {
+		err = h.storage.UpdateUserPassword(r.Context(), user)
+	}
+
+	if err != nil {
+		log.Printf("ChangePasswordHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	recordAuditEvent(h.auditLog, r, audit.EventPasswordChange, login, "")
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   nil,
+	})
 }
 
 // RefreshTokenHandler - HTTP handler which allows to refresh user tokens (including access token)
@@ -225,9 +586,7 @@ func (h *userHTTPHandler) RefreshTokenHandler(w http.ResponseWriter, r *http.Req
 			claims := &auth.Claims{}
 			refreshToken := cookie.Value
 
-			_, err := jwt.ParseWithClaims(refreshToken, claims, func(token *jwt.Token) (any, error) {
-				return []byte(h.config.Secret), nil
-			})
+			_, err := jwt.ParseWithClaims(refreshToken, claims, h.keys.Keyfunc)
 			if err != nil {
 				log.Printf("RefreshTokenHandler error: cannot parse refresh token claims. Error: %s", err.Error())
 
@@ -240,7 +599,11 @@ func (h *userHTTPHandler) RefreshTokenHandler(w http.ResponseWriter, r *http.Req
 				return
 			}
 
-			_, err = h.storage.GetUser(r.Context(), claims.Subject)
+			user, err := h.storage.GetUser(r.Context(), claims.Subject)
+			if err == nil && (user.Disabled || user.SessionRevoked(claims.IssuedAtTime())) {
+				err = constant.ErrAccountDisabled
+			}
+
 			if err != nil {
 				log.Println("RefreshTokenHandler error: unknown credentials")
 
@@ -253,9 +616,8 @@ func (h *userHTTPHandler) RefreshTokenHandler(w http.ResponseWriter, r *http.Req
 				return
 			}
 
-			jwtUser := auth.JWTUser{ID: claims.Subject}
-			// a := auth.New(h.config)
-			tokens, err := h.authUtils.GenerateTokenPair(&jwtUser)
+			// The role is taken from the storage, so it's changed when the token is refreshed
+			tokens, err := h.authUtils.GenerateTokenPair(newJWTUser(user))
 			if err != nil {
 				log.Println("RefreshTokenHandler error: cannot create tokens")
 
@@ -270,6 +632,7 @@ func (h *userHTTPHandler) RefreshTokenHandler(w http.ResponseWriter, r *http.Req
 
 			refreshCookie := h.authUtils.GetRefreshCookie(tokens.RefreshToken)
 			http.SetCookie(w, refreshCookie)
+			recordAuditEvent(h.auditLog, r, audit.EventTokenRefresh, claims.Subject, "")
 
 			_ = utils.WriteJSON(w, http.StatusOK, api.Response{
 				Status: constant.APIStatusSuccess,
@@ -281,8 +644,7 @@ func (h *userHTTPHandler) RefreshTokenHandler(w http.ResponseWriter, r *http.Req
 
 // LogoutHandler - HTTP handler which destroys user refresh token
 func (h *userHTTPHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	a := auth.New(h.config)
-	refreshCookie := a.GetExpiredRefreshCookie()
+	refreshCookie := h.authUtils.GetExpiredRefreshCookie()
 
 	http.SetCookie(w, refreshCookie)
 	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
@@ -1,24 +1,34 @@
 package web
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/grafviktor/keep-my-secret/internal/api/auth"
 
 	"github.com/grafviktor/keep-my-secret/internal/model"
 
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/audit"
 	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/policy"
 	"github.com/grafviktor/keep-my-secret/internal/storage"
+	"github.com/grafviktor/keep-my-secret/internal/throttle"
 )
 
 var appConfig = config.AppConfig{
 	StorageType: storage.TypeSQL,
+	Secret:      "test secret",
 }
 
 func TestUserHTTPHandler_Register(t *testing.T) {
@@ -44,7 +54,10 @@ func TestUserHTTPHandler_Register(t *testing.T) {
 	storage := &MockStorage{
 		users: make(map[string]*model.User),
 	}
-	handler := newUserHandlerProvider(appConfig, storage)
+	handler := newUserHandlerProvider(
+		appConfig, storage, &mockAuditLog{}, newTestLoginThrottler(), mockSecondFactor{},
+		newTestPolicy(t, appConfig), newTestKeys(t, appConfig),
+	)
 	urlPath := "/api/v1/user/register"
 
 	SuccessfulLogin := httpResponseTestCase{
@@ -98,7 +111,7 @@ func TestUserHTTPHandler_Register(t *testing.T) {
 		ErrorNoPasswordProvided,
 	}
 
-	r := NewHTTPRouter(appConfig, storage)
+	r := NewHTTPRouter(appConfig, storage, newTestServices(t, appConfig))
 	ts := httptest.NewServer(r)
 	defer ts.Close()
 	client := &http.Client{
@@ -157,7 +170,10 @@ func TestUserHTTPHandler_Login(t *testing.T) {
 		RestorePassword: "",
 	}
 
-	handler := newUserHandlerProvider(appConfig, &ls)
+	handler := newUserHandlerProvider(
+		appConfig, &ls, &mockAuditLog{}, newTestLoginThrottler(), mockSecondFactor{},
+		newTestPolicy(t, appConfig), newTestKeys(t, appConfig),
+	)
 	urlPath := "/api/v1/user/login"
 
 	// SuccessfulLogin := httpResponseTestCase{
@@ -211,7 +227,7 @@ func TestUserHTTPHandler_Login(t *testing.T) {
 		BadRequestLogin,
 	}
 
-	r := NewHTTPRouter(appConfig, &ls)
+	r := NewHTTPRouter(appConfig, &ls, newTestServices(t, appConfig))
 	ts := httptest.NewServer(r)
 	defer ts.Close()
 	client := &http.Client{
@@ -310,6 +326,8 @@ func TestRefreshTokenHandler(t *testing.T) {
 		responseStatus int
 		tokenSubject   string
 		authUtilsError bool
+		disabled       bool
+		revoked        bool
 	}{
 		{
 			name:           "Valid token",
@@ -337,6 +355,20 @@ func TestRefreshTokenHandler(t *testing.T) {
 			responseStatus: http.StatusInternalServerError,
 			tokenSubject:   validTokenSubject,
 			authUtilsError: true, // will trigger error in auth utils
+		}, {
+			name:           "Account is disabled",
+			secret:         "your-256-bit-secret",
+			token:          validToken,
+			responseStatus: http.StatusUnauthorized,
+			tokenSubject:   validTokenSubject,
+			disabled:       true,
+		}, {
+			name:           "Sessions are revoked after the token was issued",
+			secret:         "your-256-bit-secret",
+			token:          validToken,
+			responseStatus: http.StatusUnauthorized,
+			tokenSubject:   validTokenSubject,
+			revoked:        true,
 		},
 	}
 
@@ -366,12 +398,19 @@ func TestRefreshTokenHandler(t *testing.T) {
 			authUtils: &MockAuthUtils{
 				shouldTriggerError: testCase.authUtilsError,
 			},
+			keys: newTestKeys(t, appConfig),
+		}
+
+		user := &model.User{
+			Login:    testCase.tokenSubject,
+			Disabled: testCase.disabled,
+		}
+		if testCase.revoked {
+			user.SessionsRevokedAt = lo.ToPtr(time.Now())
 		}
 
 		//nolint:errcheck
-		handler.storage.AddUser(req.Context(), &model.User{
-			Login: testCase.tokenSubject,
-		})
+		handler.storage.AddUser(req.Context(), user)
 
 		// Call the RefreshTokenHandler
 		handler.RefreshTokenHandler(rr, req)
@@ -400,7 +439,8 @@ func TestLogoutHandler(t *testing.T) {
 
 	// Create an instance of my userHTTPHandler with the mock dependency
 	handler := &userHTTPHandler{
-		config: appConfig,
+		config:    appConfig,
+		authUtils: auth.New(appConfig, newTestKeys(t, appConfig)),
 	}
 
 	// Call the LogoutHandler
@@ -430,3 +470,212 @@ func TestLogoutHandler(t *testing.T) {
 		// }
 	}
 }
+
+func TestLoginHandlerThrottling(t *testing.T) {
+	storage := &MockStorage{users: map[string]*model.User{
+		"tony.tester@example.com": {
+			Login:          "tony.tester@example.com",
+			HashedPassword: "$2a$10$AokZyUVIqfgBtEwCNhOzbeE68Zk6uwZ42NvDdPK24Xesmb08OJ.DO",
+		},
+	}}
+	auditLog := &mockAuditLog{}
+	handler := newUserHandlerProvider(
+		appConfig, storage, auditLog, newTestLoginThrottler(), mockSecondFactor{},
+		newTestPolicy(t, appConfig), newTestKeys(t, appConfig),
+	)
+
+	login := func(remoteAddr string) *httptest.ResponseRecorder {
+		body := `{"username":"tony.tester@example.com", "password":"wrong"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/user/login", strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.LoginHandler(rr, req)
+
+		return rr
+	}
+
+	// The first attempts are not delayed
+	for i := 0; i < throttle.DefaultLoginPolicy.FreeAttempts; i++ {
+		require.Equal(t, http.StatusUnauthorized, login("192.0.2.1:1234").Code)
+	}
+
+	rr := login("192.0.2.1:1234")
+	require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	require.Equal(t, "1", rr.Header().Get("Retry-After"))
+
+	// The login is throttled regardless of the client address
+	require.Equal(t, http.StatusTooManyRequests, login("198.51.100.1:1234").Code)
+	require.Contains(t, auditLog.types(), audit.EventLoginThrottled)
+}
+
+func TestLoginHandlerDisabledAccount(t *testing.T) {
+	user, err := model.NewUser("tony.tester@example.com", "Current-Password-1")
+	require.NoError(t, err)
+	user.Disabled = true
+
+	storage := &MockStorage{users: map[string]*model.User{user.Login: user}}
+	keyCache := &MockKeyCache{}
+	handler := newUserHandlerProvider(
+		appConfig, storage, &mockAuditLog{}, newTestLoginThrottler(), mockSecondFactor{},
+		newTestPolicy(t, appConfig), newTestKeys(t, appConfig),
+	)
+	handler.keyCache = keyCache
+
+	login := func(password string) *httptest.ResponseRecorder {
+		body := `{"username":"tony.tester@example.com", "password":"` + password + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/user/login", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler.LoginHandler(rr, req)
+
+		return rr
+	}
+
+	// The state of the account is not disclosed to anyone who doesn't know the password
+	require.Equal(t, http.StatusUnauthorized, login("wrong").Code)
+
+	rr := login("Current-Password-1")
+	require.Equal(t, http.StatusForbidden, rr.Code)
+	require.Contains(t, rr.Body.String(), constant.APIMessageAccountDisabled)
+	require.False(t, keyCache.setCalled)
+}
+
+func TestRegisterHandlerRegistrationClosed(t *testing.T) {
+	storage := &MockStorage{
+		users:    make(map[string]*model.User),
+		settings: &model.ServerSettings{RegistrationOpen: false},
+	}
+	handler := newUserHandlerProvider(
+		appConfig, storage, &mockAuditLog{}, newTestLoginThrottler(), mockSecondFactor{},
+		newTestPolicy(t, appConfig), newTestKeys(t, appConfig),
+	)
+
+	body := `{"username":"tony.tester@example.com", "password":"Current-Password-1"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/user/register", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler.RegisterHandler(rr, req)
+
+	require.Equal(t, http.StatusForbidden, rr.Code)
+	require.Contains(t, rr.Body.String(), constant.APIMessageRegistrationClosed)
+	require.Empty(t, storage.users)
+}
+
+func TestRegisterHandlerPolicyViolations(t *testing.T) {
+	strictConfig := appConfig
+	strictConfig.PasswordMinLength = 10
+	strictConfig.PasswordCharClasses = 3
+	strictConfig.PasswordBlocklist = true
+	strictConfig.PasswordRejectUsername = true
+
+	storage := &MockStorage{users: make(map[string]*model.User)}
+	handler := newUserHandlerProvider(
+		strictConfig, storage, &mockAuditLog{}, newTestLoginThrottler(), mockSecondFactor{},
+		newTestPolicy(t, strictConfig), newTestKeys(t, strictConfig),
+	)
+
+	body := `{"username":"tony tester", "password":"password"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/user/register", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler.RegisterHandler(rr, req)
+
+	require.Equal(t, http.StatusNotAcceptable, rr.Code)
+
+	var response struct {
+		Message string             `json:"message"`
+		Data    []policy.Violation `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	require.Equal(t, constant.APIMessagePolicyViolation, response.Message)
+
+	violations := make([]string, 0, len(response.Data))
+	for _, v := range response.Data {
+		violations = append(violations, v.Field+":"+v.Code)
+	}
+	require.Equal(t, []string{
+		"username:invalid_characters",
+		"password:too_short",
+		"password:character_classes",
+		"password:common_password",
+	}, violations)
+	require.Empty(t, storage.users)
+}
+
+func TestChangePasswordHandler(t *testing.T) {
+	user, err := model.NewUser("tony.tester@example.com", "Current-Password-1")
+	require.NoError(t, err)
+
+	dataKey, err := user.GetDataKey("Current-Password-1")
+	require.NoError(t, err)
+
+	strictConfig := appConfig
+	strictConfig.PasswordMinLength = 10
+	strictConfig.PasswordRejectUsername = true
+
+	storage := &MockStorage{users: map[string]*model.User{user.Login: user}}
+	auditLog := &mockAuditLog{}
+	handler := newUserHandlerProvider(
+		strictConfig, storage, auditLog, newTestLoginThrottler(), mockSecondFactor{},
+		newTestPolicy(t, strictConfig), newTestKeys(t, strictConfig),
+	)
+
+	changePassword := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/user/password", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, user.Login))
+		rr := httptest.NewRecorder()
+		handler.ChangePasswordHandler(rr, req)
+
+		return rr
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+	}{
+		{
+			name:       "Malformed body",
+			body:       `{"current_password":`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "New password is too short",
+			body:       `{"current_password":"Current-Password-1", "new_password":"short"}`,
+			statusCode: http.StatusNotAcceptable,
+		},
+		{
+			name:       "New password contains the username",
+			body:       `{"current_password":"Current-Password-1", "new_password":"tony.tester-2023"}`,
+			statusCode: http.StatusNotAcceptable,
+		},
+		{
+			name:       "New password is the same as the current one",
+			body:       `{"current_password":"Current-Password-1", "new_password":"Current-Password-1"}`,
+			statusCode: http.StatusNotAcceptable,
+		},
+		{
+			name:       "Wrong current password",
+			body:       `{"current_password":"Wrong-Password-1", "new_password":"New-Password-2"}`,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "Password is changed",
+			body:       `{"current_password":"Current-Password-1", "new_password":"New-Password-2"}`,
+			statusCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.statusCode, changePassword(tt.body).Code)
+		})
+	}
+
+	changed := storage.users[user.Login]
+	matches, err := changed.PasswordMatches("New-Password-2")
+	require.NoError(t, err)
+	require.True(t, matches)
+
+	newDataKey, err := changed.GetDataKey("New-Password-2")
+	require.NoError(t, err)
+	require.Equal(t, dataKey, newDataKey)
+	require.Equal(t, []string{audit.EventPasswordChange}, auditLog.types())
+}
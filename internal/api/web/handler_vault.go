@@ -0,0 +1,273 @@
+package web
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/api/utils"
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// getVaultSecretKey - returns the key of an existing vault secret, the secret must belong to the vault
+//
+//nolint:lll
+func (a *apiRouteProvider) getVaultSecretKey(ctx context.Context, secret *model.Secret, vaultID int64, vaultKey string) (string, error) {
+	stored, err := a.storage.GetVaultSecret(ctx, vaultID, strconv.FormatInt(secret.ID, 10))
+	if err != nil {
+		return "", err
+	}
+
+	secret.WrappedKey = stored.WrappedKey
+
+	return stored.Key(vaultKey)
+}
+
+// ListVaultSecretsHandler - HTTP handler that returns all secrets of a team vault
+func (a *apiRouteProvider) ListVaultSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("ListVaultSecretsHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	vaultID, err := idParam(r, "id")
+	if err != nil {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	_, vaultKey, err := a.openVault(r.Context(), vaultID, login, key)
+	var secrets map[int]*model.Secret
+	if err == nil {
+		secrets, err = a.storage.GetVaultSecrets(r.Context(), vaultID)
+	}
+
+	// A token which is not allowed to access the whole vault sees only its secrets
+	if apiToken := apiTokenFromContext(r); err == nil && apiToken != nil && !apiToken.AllowsVault(vaultID) {
+		filterTokenSecrets(r, secrets)
+	}
+
+	if err == nil {
+		err = decryptSecrets(secrets, vaultKey, model.VaultSalt(vaultID))
+	}
+
+	if err != nil {
+		log.Printf("ListVaultSecretsHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   secrets,
+	})
+}
+
+// GetVaultSecretHandler - HTTP handler that returns a single secret of a team vault
+func (a *apiRouteProvider) GetVaultSecretHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+	secretID := chi.URLParam(r, "secretID")
+
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("GetVaultSecretHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	vaultID, err := idParam(r, "id")
+	if err != nil {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	_, vaultKey, err := a.openVault(r.Context(), vaultID, login, key)
+	if err == nil && !tokenAllowsVaultSecret(r, vaultID, secretID) {
+		err = constant.ErrForbidden
+	}
+
+	var secret *model.Secret
+	if err == nil {
+		secret, err = a.storage.GetVaultSecret(r.Context(), vaultID, secretID)
+	}
+
+	if err == nil {
+		err = secret.DecryptWithDataKey(vaultKey, model.VaultSalt(vaultID))
+	}
+
+	if err != nil {
+		log.Printf("GetVaultSecretHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   secret,
+	})
+}
+
+// SaveVaultSecretHandler - HTTP handler for saving a secret into a team vault. Every vault secret
+// is encrypted with its own key, which is wrapped with the vault key. Read-only members cannot save secrets.
+func (a *apiRouteProvider) SaveVaultSecretHandler(w http.ResponseWriter, r *http.Request) {
+	var secret model.Secret
+	err := readSecretRequest(w, r, &secret)
+
+	var vaultID int64
+	if err == nil {
+		vaultID, err = idParam(r, "id")
+	}
+
+	if err != nil {
+		log.Printf("SaveVaultSecretHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	login := r.Context().Value(api.ContextUserLogin).(string)
+	key, err := getDataKey(r, a.keyCache, login)
+	if err != nil {
+		log.Printf("SaveVaultSecretHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageUnauthorized,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	access, vaultKey, err := a.openVault(r.Context(), vaultID, login, key)
+	if err == nil && !model.CanWriteVault(access.Role) {
+		err = constant.ErrForbidden
+	}
+
+	if err == nil && !tokenAllowsVaultSecret(r, vaultID, strconv.FormatInt(secret.ID, 10)) {
+		err = constant.ErrForbidden
+	}
+
+	var secretKey string
+	if err == nil && secret.ID == 0 {
+		secretKey, err = secret.GenerateKey(vaultKey)
+	} else if err == nil {
+		secretKey, err = a.getVaultSecretKey(r.Context(), &secret, vaultID, vaultKey)
+	}
+
+	if err != nil {
+		log.Printf("SaveVaultSecretHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	secret.SetCardExpiresAt()
+	secret.Compromised = a.isCompromised(&secret)
+
+	err = secret.Encrypt(secretKey, model.VaultSalt(vaultID))
+	if err != nil {
+		log.Printf("SaveVaultSecretHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusInternalServerError, api.Response{
+			Status:  constant.APIStatusError,
+			Message: constant.APIMessageServerError,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	_, err = a.storage.SaveVaultSecret(r.Context(), &secret, vaultID)
+	if err != nil {
+		log.Printf("SaveVaultSecretHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusCreated, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   secret,
+	})
+}
+
+// DeleteVaultSecretHandler - HTTP handler for deleting a secret from a team vault
+func (a *apiRouteProvider) DeleteVaultSecretHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+	secretID := chi.URLParam(r, "secretID")
+
+	vaultID, err := idParam(r, "id")
+	if err != nil {
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	access, err := a.storage.GetVaultAccess(r.Context(), vaultID, login)
+	if err == nil && !model.CanWriteVault(access.Role) {
+		err = constant.ErrForbidden
+	}
+
+	if err == nil && !tokenAllowsVaultSecret(r, vaultID, secretID) {
+		err = constant.ErrForbidden
+	}
+
+	if err == nil {
+		err = a.storage.DeleteVaultSecret(r.Context(), vaultID, secretID)
+	}
+
+	if err != nil {
+		log.Printf("DeleteVaultSecretHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusAccepted, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   secretID,
+	})
+}
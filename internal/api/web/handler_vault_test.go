@@ -0,0 +1,131 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestVaultSecretHandlers(t *testing.T) {
+	handler := newTeamTestProvider(t)
+	router := chi.NewRouter()
+	router.Get("/vaults/{id}/secrets", handler.ListVaultSecretsHandler)
+	router.Get("/vaults/{id}/secrets/{secretID}", handler.GetVaultSecretHandler)
+	router.Post("/vaults/{id}/secrets", handler.SaveVaultSecretHandler)
+	router.Put("/vaults/{id}/secrets/{secretID}", handler.SaveVaultSecretHandler)
+	router.Delete("/vaults/{id}/secrets/{secretID}", handler.DeleteVaultSecretHandler)
+
+	runTeamTestCases(t, router, []teamTestCase{
+		{
+			name:           "list vault secrets",
+			login:          "team_reader",
+			method:         "GET",
+			path:           "/vaults/1/secrets",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "vault is hidden from other users",
+			login:          "new_user",
+			method:         "GET",
+			path:           "/vaults/1/secrets",
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "invalid vault id",
+			login:          "team_reader",
+			method:         "GET",
+			path:           "/vaults/abc/secrets",
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "storage error when listing vault secrets",
+			login:          "team_reader",
+			method:         "GET",
+			path:           "/vaults/2/secrets",
+			httpStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "error getting decrypt key from keycache",
+			login:          "invalid_user",
+			method:         "GET",
+			path:           "/vaults/1/secrets",
+			httpStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "get vault secret",
+			login:          "team_reader",
+			method:         "GET",
+			path:           "/vaults/1/secrets/1",
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name:           "vault secret not found",
+			login:          "team_reader",
+			method:         "GET",
+			path:           "/vaults/1/secrets/2",
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "member creates a vault secret",
+			login:          "team_member",
+			method:         "POST",
+			path:           "/vaults/1/secrets",
+			payload:        `{"title": "database", "password": "secret"}`,
+			httpStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "member updates a vault secret",
+			login:          "team_member",
+			method:         "PUT",
+			path:           "/vaults/1/secrets/1",
+			payload:        `{"id": 1, "title": "database"}`,
+			httpStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "update secret which doesn't belong to the vault",
+			login:          "team_member",
+			method:         "PUT",
+			path:           "/vaults/1/secrets/2",
+			payload:        `{"id": 2, "title": "database"}`,
+			httpStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "read-only member cannot save secrets",
+			login:          "team_reader",
+			method:         "POST",
+			path:           "/vaults/1/secrets",
+			payload:        `{"title": "database"}`,
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "invalid secret",
+			login:          "team_member",
+			method:         "POST",
+			path:           "/vaults/1/secrets",
+			payload:        `{"title": 1}`,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "member deletes a vault secret",
+			login:          "team_member",
+			method:         "DELETE",
+			path:           "/vaults/1/secrets/1",
+			httpStatusCode: http.StatusAccepted,
+		},
+		{
+			name:           "read-only member cannot delete secrets",
+			login:          "team_reader",
+			method:         "DELETE",
+			path:           "/vaults/1/secrets/1",
+			httpStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "delete vault secret which doesn't exist",
+			login:          "team_admin",
+			method:         "DELETE",
+			path:           "/vaults/1/secrets/2",
+			httpStatusCode: http.StatusNotFound,
+		},
+	})
+}
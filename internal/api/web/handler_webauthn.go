@@ -0,0 +1,599 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/api/auth"
+	"github.com/grafviktor/keep-my-secret/internal/api/utils"
+	"github.com/grafviktor/keep-my-secret/internal/audit"
+	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/keycache"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+	"github.com/grafviktor/keep-my-secret/internal/webauthn"
+)
+
+const (
+	// maxCredentialNameLength - the name is chosen by the user to tell security keys apart
+	maxCredentialNameLength = 64
+	defaultCredentialName   = "Security key"
+	userHandleLength        = 32
+)
+
+type webauthnHTTPHandler struct {
+	config    config.AppConfig
+	storage   webauthnStorage
+	keyCache  keyCache
+	authUtils authUtils
+	auditLog  auditRecorder
+	throttler loginThrottler
+	// relyingParty - nil if WebAuthn is not configured
+	relyingParty *webauthn.RelyingParty
+	sessions     *webauthn.SessionStore
+}
+
+// newWebAuthnHandlerProvider - returns a set of handlers which register passkeys and security keys, and sign
+// users in with them. A security key confirms login with a password, a passkey which supports PRF extension
+// also replaces the password, because PRF output unlocks the data key.
+func newWebAuthnHandlerProvider(
+	appConfig config.AppConfig,
+	storage webauthnStorage,
+	auditLog auditRecorder,
+	throttler loginThrottler,
+	keys *auth.KeySet,
+	relyingParty *webauthn.RelyingParty,
+) webauthnHTTPHandler {
+	return webauthnHTTPHandler{
+		config:    appConfig,
+		storage:   storage,
+		keyCache:  keycache.GetInstance(),
+		authUtils: auth.New(appConfig, keys),
+		auditLog:  auditLog,
+		throttler: throttler,
+		sessions:  webauthn.NewSessionStore(),
+
+		relyingParty: relyingParty,
+	}
+}
+
+// webauthnOptions - options of the ceremony, which the client passes to the authenticator
+type webauthnOptions struct {
+	Session   string `json:"session"`
+	PublicKey any    `json:"publicKey"`
+}
+
+// webauthnCeremony - response of the authenticator. Browsers add fields to the credential which differ
+// between versions, so it's decoded separately without checking for unknown fields.
+type webauthnCeremony struct {
+	Session    string          `json:"session"`
+	Name       string          `json:"name,omitempty"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+// readCeremony - reads the response of the authenticator and takes its session. Writes the response
+// if the request is invalid.
+func (h *webauthnHTTPHandler) readCeremony(
+	w http.ResponseWriter,
+	r *http.Request,
+	handlerName string,
+) (*webauthnCeremony, *webauthn.Response, *webauthn.Session, bool) {
+	if h.relyingParty == nil {
+		writeWebAuthnNotConfigured(w)
+
+		return nil, nil, nil, false
+	}
+
+	var ceremony webauthnCeremony
+	var response webauthn.Response
+	err := utils.ReadJSON(w, r, &ceremony)
+	if err == nil {
+		err = json.Unmarshal(ceremony.Credential, &response)
+	}
+
+	if err != nil {
+		log.Printf("%s error: %s\n", handlerName, err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return nil, nil, nil, false
+	}
+
+	session, ok := h.sessions.Take(ceremony.Session)
+	if !ok {
+		log.Printf("%s error: session is expired or unknown\n", handlerName)
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return nil, nil, nil, false
+	}
+
+	return &ceremony, &response, session, true
+}
+
+// writeOptions - saves the session and returns the options to the client
+func (h *webauthnHTTPHandler) writeOptions(
+	w http.ResponseWriter,
+	status int,
+	message string,
+	options any,
+	session *webauthn.Session,
+) {
+	if err := h.sessions.Save(session); err != nil {
+		log.Printf("WebAuthn error: %s\n", err.Error())
+
+		if errors.Is(err, webauthn.ErrTooManySessions) {
+			writeTooManyRequests(w, webauthn.CeremonyTimeout)
+		} else {
+			writeStorageError(w, err)
+		}
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, status, api.Response{
+		Status:  constant.APIStatusSuccess,
+		Message: message,
+		Data:    webauthnOptions{Session: session.ID, PublicKey: options},
+	})
+}
+
+// BeginRegistrationHandler - HTTP handler which returns options of navigator.credentials.create(). The user
+// confirms the registration with the password, or with the master password if they sign in with an identity provider.
+func (h *webauthnHTTPHandler) BeginRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	if h.relyingParty == nil {
+		writeWebAuthnNotConfigured(w)
+
+		return
+	}
+
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	var body passwordConfirmation
+	if err := utils.ReadJSON(w, r, &body); err != nil {
+		log.Printf("BeginRegistrationHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	// A new passkey can unlock the data key, so an access token alone is not enough to register it
+	if !confirmPassword(w, r, h.storage, h.throttler, "BeginRegistrationHandler", login, body.Password) {
+		return
+	}
+
+	credentials, err := h.storage.GetWebAuthnCredentials(r.Context(), login)
+	if err != nil {
+		log.Printf("BeginRegistrationHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	// The user handle must not reveal the login, and it must be the same for all credentials of the user,
+	// so an authenticator replaces the old passkey of the user instead of keeping both
+	userHandle := make([]byte, userHandleLength)
+	if len(credentials) > 0 {
+		userHandle = credentials[0].UserHandle
+	} else if _, err = rand.Read(userHandle); err != nil {
+		log.Printf("BeginRegistrationHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	options, session, err := h.relyingParty.BeginRegistration(login, userHandle, credentialIDs(credentials))
+	if err != nil {
+		log.Printf("BeginRegistrationHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	h.writeOptions(w, http.StatusOK, "", options, session)
+}
+
+// FinishRegistrationHandler - HTTP handler which saves the credential created by the authenticator.
+// If the authenticator has evaluated PRF extension, the data key is wrapped with its output, so the
+// credential can be used instead of the password.
+func (h *webauthnHTTPHandler) FinishRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	ceremony, response, session, ok := h.readCeremony(w, r, "FinishRegistrationHandler")
+	if !ok {
+		return
+	}
+
+	login := r.Context().Value(api.ContextUserLogin).(string)
+	if session.Login != login {
+		log.Printf("FinishRegistrationHandler error: session of '%s' is used by '%s'\n", session.Login, login)
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	created, err := h.relyingParty.FinishRegistration(session, response)
+	if err != nil {
+		log.Printf("FinishRegistrationHandler error: %s\n", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusBadRequest, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: constant.APIMessageBadRequest,
+			Data:    nil,
+		})
+
+		return
+	}
+
+	credential := &model.WebAuthnCredential{
+		ID:         base64.RawURLEncoding.EncodeToString(created.ID),
+		Login:      login,
+		Name:       credentialName(ceremony.Name),
+		UserHandle: created.UserHandle,
+		PublicKey:  created.PublicKey,
+		SignCount:  created.SignCount,
+		AAGUID:     formatAAGUID(created.AAGUID),
+	}
+
+	if created.PRF != nil {
+		h.wrapDataKey(credential, created.PRF, login)
+	}
+
+	if err = h.storage.AddWebAuthnCredential(r.Context(), credential); err != nil {
+		log.Printf("FinishRegistrationHandler error: %s\n", err.Error())
+
+		if errors.Is(err, constant.ErrDuplicateRecord) {
+			_ = utils.WriteJSON(w, http.StatusConflict, api.Response{
+				Status:  constant.APIStatusFail,
+				Message: "security key is already registered",
+				Data:    nil,
+			})
+		} else {
+			writeStorageError(w, err)
+		}
+
+		return
+	}
+
+	recordAuditEvent(h.auditLog, r, audit.EventWebAuthnRegister, login, "")
+
+	_ = utils.WriteJSON(w, http.StatusCreated, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   credential,
+	})
+}
+
+// wrapDataKey - the data key is available only while the vault is unlocked. Errors are only logged,
+// because the credential still works as a second factor.
+func (h *webauthnHTTPHandler) wrapDataKey(credential *model.WebAuthnCredential, prf []byte, login string) {
+	dataKey, err := h.keyCache.Get(login)
+	if err == nil {
+		err = credential.WrapDataKey(prf, dataKey)
+	}
+
+	if err != nil {
+		log.Printf("WebAuthn error: cannot wrap data key of '%s': %s\n", login, err.Error())
+	}
+}
+
+// ListCredentialsHandler - HTTP handler which returns security keys of the user
+func (h *webauthnHTTPHandler) ListCredentialsHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	credentials, err := h.storage.GetWebAuthnCredentials(r.Context(), login)
+	if err != nil {
+		log.Printf("ListCredentialsHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   credentials,
+	})
+}
+
+// DeleteCredentialHandler - HTTP handler which removes a security key of the user. When the last key
+// is removed, login with the password doesn't require the second factor anymore.
+func (h *webauthnHTTPHandler) DeleteCredentialHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.Context().Value(api.ContextUserLogin).(string)
+
+	if err := h.storage.DeleteWebAuthnCredential(r.Context(), chi.URLParam(r, "id"), login); err != nil {
+		log.Printf("DeleteCredentialHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	recordAuditEvent(h.auditLog, r, audit.EventWebAuthnRemove, login, "")
+
+	_ = utils.WriteJSON(w, http.StatusOK, api.Response{
+		Status: constant.APIStatusSuccess,
+		Data:   nil,
+	})
+}
+
+// RequireSecondFactor - starts authentication with one of the security keys of the user,
+// if the user has registered any
+func (h *webauthnHTTPHandler) RequireSecondFactor(w http.ResponseWriter, r *http.Request, login, dataKey string) bool {
+	if h.relyingParty == nil {
+		return false
+	}
+
+	credentials, err := h.storage.GetWebAuthnCredentials(r.Context(), login)
+	if err == nil && len(credentials) == 0 {
+		return false
+	}
+
+	var options *webauthn.RequestOptions
+	var session *webauthn.Session
+	if err == nil {
+		// User verification is not necessary for the second factor, but PRF output is used only when
+		// the authenticator verifies the user
+		options, session, err = h.relyingParty.BeginLogin(
+			login,
+			credentialIDs(credentials),
+			webauthn.UserVerificationPreferred,
+		)
+	}
+
+	if err != nil {
+		log.Printf("LoginHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return true
+	}
+
+	session.DataKey = dataKey
+	h.writeOptions(w, http.StatusAccepted, "second factor required", options, session)
+
+	return true
+}
+
+// SecondFactorHandler - HTTP handler which completes login with the password, when the user confirms it
+// with a security key. If the key supports PRF extension, but the data key is not wrapped with its output
+// yet, it's wrapped now, so the key can be used for passwordless login.
+func (h *webauthnHTTPHandler) SecondFactorHandler(w http.ResponseWriter, r *http.Request) {
+	_, response, session, ok := h.readCeremony(w, r, "SecondFactorHandler")
+	if !ok {
+		return
+	}
+
+	if session.DataKey == "" {
+		log.Println("SecondFactorHandler error: session is not a second factor session")
+		writeUnauthorized(w)
+
+		return
+	}
+
+	credential, _, ok := h.verifyAssertion(w, r, session, response, audit.EventSecondFactorFailure)
+	if !ok {
+		return
+	}
+
+	if err := h.throttler.Succeed(r.Context(), session.Login, utils.ClientIP(r)); err != nil {
+		log.Printf("SecondFactorHandler error: cannot reset failed attempts: %s\n", err.Error())
+	}
+
+	h.signInUser(w, r, credential.Login, session.DataKey)
+}
+
+// BeginLoginHandler - HTTP handler which returns options of passwordless login. The login is not required,
+// the user is identified by the passkey, which the user chooses in the browser.
+func (h *webauthnHTTPHandler) BeginLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if h.relyingParty == nil {
+		writeWebAuthnNotConfigured(w)
+
+		return
+	}
+
+	// The passkey replaces the password, so the authenticator must verify the user
+	options, session, err := h.relyingParty.BeginLogin("", nil, webauthn.UserVerificationRequired)
+	if err != nil {
+		log.Printf("BeginLoginHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	h.writeOptions(w, http.StatusOK, "", options, session)
+}
+
+// FinishLoginHandler - HTTP handler which completes passwordless login. The data key is unwrapped
+// with PRF output of the passkey.
+func (h *webauthnHTTPHandler) FinishLoginHandler(w http.ResponseWriter, r *http.Request) {
+	_, response, session, ok := h.readCeremony(w, r, "FinishLoginHandler")
+	if !ok {
+		return
+	}
+
+	if session.Login != "" || session.UserVerification != webauthn.UserVerificationRequired {
+		log.Println("FinishLoginHandler error: session is not a passwordless login session")
+		writeUnauthorized(w)
+
+		return
+	}
+
+	credential, assertion, ok := h.verifyAssertion(w, r, session, response, audit.EventLoginFailure)
+	if !ok {
+		return
+	}
+
+	dataKey, err := credential.UnwrapDataKey(assertion.PRF)
+	if err != nil {
+		log.Printf("FinishLoginHandler error: '%s' cannot unlock the vault: %s\n", credential.Login, err.Error())
+		recordAuditEvent(h.auditLog, r, audit.EventLoginFailure, credential.Login, "")
+
+		if errors.Is(err, model.ErrNoWrappedKey) {
+			_ = utils.WriteJSON(w, http.StatusConflict, api.Response{
+				Status:  constant.APIStatusFail,
+				Message: "security key cannot be used without password",
+				Data:    nil,
+			})
+		} else {
+			writeUnauthorized(w)
+		}
+
+		return
+	}
+
+	h.signInUser(w, r, credential.Login, dataKey)
+}
+
+// signInUser - completes login of the owner of the credential, unless the account is disabled
+func (h *webauthnHTTPHandler) signInUser(w http.ResponseWriter, r *http.Request, login, dataKey string) {
+	user, err := h.storage.GetUser(r.Context(), login)
+	if err != nil {
+		log.Printf("LoginHandler error: %s\n", err.Error())
+		writeStorageError(w, err)
+
+		return
+	}
+
+	if user.Disabled {
+		log.Printf("LoginHandler error: account of '%s' is disabled\n", login)
+		recordAuditEvent(h.auditLog, r, audit.EventLoginFailure, login, "")
+		writeAccountDisabled(w)
+
+		return
+	}
+
+	recordAuditEvent(h.auditLog, r, audit.EventLoginSuccess, login, "")
+	signIn(w, h.keyCache, h.authUtils, newJWTUser(user), dataKey)
+}
+
+// verifyAssertion - finds the credential of the response, verifies the signature and saves the signature
+// counter. Writes the response if the assertion is not valid.
+func (h *webauthnHTTPHandler) verifyAssertion(
+	w http.ResponseWriter,
+	r *http.Request,
+	session *webauthn.Session,
+	response *webauthn.Response,
+	failureEvent string,
+) (*model.WebAuthnCredential, *webauthn.Assertion, bool) {
+	id := base64.RawURLEncoding.EncodeToString(response.RawID)
+	credential, err := h.storage.GetWebAuthnCredential(r.Context(), id)
+	if err != nil {
+		log.Printf("WebAuthn error: %s\n", err.Error())
+
+		if errors.Is(err, constant.ErrNotFound) {
+			recordAuditEvent(h.auditLog, r, failureEvent, session.Login, "")
+			writeUnauthorized(w)
+		} else {
+			writeStorageError(w, err)
+		}
+
+		return nil, nil, false
+	}
+
+	assertion, err := h.relyingParty.FinishLogin(session, &webauthn.Credential{
+		ID:         response.RawID,
+		PublicKey:  credential.PublicKey,
+		SignCount:  credential.SignCount,
+		UserHandle: credential.UserHandle,
+	}, response)
+	if err == nil && session.Login != "" && session.Login != credential.Login {
+		err = errors.New("credential belongs to another user")
+	}
+
+	if err != nil {
+		log.Printf("WebAuthn error: login of '%s' is rejected: %s\n", credential.Login, err.Error())
+		recordAuditEvent(h.auditLog, r, failureEvent, credential.Login, "")
+		writeUnauthorized(w)
+
+		return nil, nil, false
+	}
+
+	previousSignCount := credential.SignCount
+	credential.SignCount = assertion.SignCount
+	if session.DataKey != "" && !credential.Passwordless && assertion.PRF != nil {
+		if err = credential.WrapDataKey(assertion.PRF, session.DataKey); err != nil {
+			log.Printf("WebAuthn error: cannot wrap data key of '%s': %s\n", credential.Login, err.Error())
+		}
+	}
+
+	if err = h.storage.UpdateWebAuthnCredential(r.Context(), credential, previousSignCount); err != nil {
+		// The counter was changed by a concurrent login with the same signature counter
+		log.Printf("WebAuthn error: cannot save credential of '%s': %s\n", credential.Login, err.Error())
+
+		if errors.Is(err, constant.ErrNotFound) {
+			recordAuditEvent(h.auditLog, r, failureEvent, credential.Login, "")
+			writeUnauthorized(w)
+		} else {
+			writeStorageError(w, err)
+		}
+
+		return nil, nil, false
+	}
+
+	return credential, assertion, true
+}
+
+func credentialIDs(credentials []*model.WebAuthnCredential) [][]byte {
+	ids := make([][]byte, 0, len(credentials))
+	for _, credential := range credentials {
+		if id, err := base64.RawURLEncoding.DecodeString(credential.ID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+func credentialName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return defaultCredentialName
+	}
+
+	if runes := []rune(name); len(runes) > maxCredentialNameLength {
+		return string(runes[:maxCredentialNameLength])
+	}
+
+	return name
+}
+
+// formatAAGUID - AAGUID is formatted as UUID, which identifies the model of the authenticator
+func formatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 {
+		return ""
+	}
+
+	s := hex.EncodeToString(aaguid)
+
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+func writeWebAuthnNotConfigured(w http.ResponseWriter) {
+	_ = utils.WriteJSON(w, http.StatusNotFound, api.Response{
+		Status:  constant.APIStatusFail,
+		Message: webauthn.ErrNotConfigured.Error(),
+		Data:    nil,
+	})
+}
@@ -0,0 +1,391 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/audit"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+	"github.com/grafviktor/keep-my-secret/internal/webauthn/webauthntest"
+)
+
+const (
+	webauthnOrigin   = "https://kms.example.com"
+	webauthnLogin    = "jane.doe@example.com"
+	webauthnPassword = "Master-Password-1"
+)
+
+type webauthnTestEnv struct {
+	handler     *webauthnHTTPHandler
+	userHandler *userHTTPHandler
+	storage     *MockStorage
+	keyCache    *MockKeyCache
+	auditLog    *mockAuditLog
+	dataKey     string
+}
+
+func newWebAuthnTestEnv(t *testing.T) *webauthnTestEnv {
+	t.Helper()
+
+	webauthnConfig := appConfig
+	webauthnConfig.WebAuthnRPID = "kms.example.com"
+	webauthnConfig.WebAuthnRPName = "Keep My Secret"
+
+	user, err := model.NewUser(webauthnLogin, webauthnPassword)
+	require.NoError(t, err)
+	dataKey, err := user.GetDataKey(webauthnPassword)
+	require.NoError(t, err)
+
+	storage := &MockStorage{
+		users:       map[string]*model.User{webauthnLogin: user},
+		credentials: map[string]model.WebAuthnCredential{},
+	}
+	keyCache := &MockKeyCache{keys: map[string]string{webauthnLogin: dataKey}}
+	auditLog := &mockAuditLog{}
+	throttler := newTestLoginThrottler()
+
+	services := newTestServices(t, webauthnConfig)
+	require.NotNil(t, services.RelyingParty)
+
+	handler := newWebAuthnHandlerProvider(
+		webauthnConfig, storage, auditLog, throttler, services.Keys, services.RelyingParty,
+	)
+	handler.keyCache = keyCache
+	userHandler := newUserHandlerProvider(
+		webauthnConfig, storage, auditLog, throttler, &handler, services.PasswordPolicy, services.Keys,
+	)
+	userHandler.keyCache = keyCache
+
+	return &webauthnTestEnv{
+		handler:     &handler,
+		userHandler: &userHandler,
+		storage:     storage,
+		keyCache:    keyCache,
+		auditLog:    auditLog,
+		dataKey:     dataKey,
+	}
+}
+
+// postWebAuthn - calls the handler on behalf of the signed-in user, or anonymously if the login is empty
+func postWebAuthn(handler http.HandlerFunc, login, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	if login != "" {
+		req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, login))
+	}
+
+	res := httptest.NewRecorder()
+	handler(res, req)
+
+	return res
+}
+
+// ceremonyOptions - returns the session and the options, which are passed to the authenticator
+func ceremonyOptions(t *testing.T, res *httptest.ResponseRecorder) (string, []byte) {
+	t.Helper()
+
+	var body struct {
+		Data struct {
+			Session   string          `json:"session"`
+			PublicKey json.RawMessage `json:"publicKey"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+	require.NotEmpty(t, body.Data.Session)
+
+	return body.Data.Session, body.Data.PublicKey
+}
+
+func ceremonyBody(t *testing.T, session string, credential []byte) string {
+	t.Helper()
+
+	body, err := json.Marshal(webauthnCeremony{Session: session, Name: "YubiKey", Credential: credential})
+	require.NoError(t, err)
+
+	return string(body)
+}
+
+func (env *webauthnTestEnv) register(
+	t *testing.T,
+	authenticator *webauthntest.Authenticator,
+) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body := `{"password":"` + webauthnPassword + `"}`
+	res := postWebAuthn(env.handler.BeginRegistrationHandler, webauthnLogin, body)
+	require.Equal(t, http.StatusOK, res.Code)
+	session, options := ceremonyOptions(t, res)
+
+	credential, err := authenticator.Create(options)
+	require.NoError(t, err)
+
+	return postWebAuthn(env.handler.FinishRegistrationHandler, webauthnLogin, ceremonyBody(t, session, credential))
+}
+
+// passwordLogin - signs in with the password and confirms the login with the authenticator
+func (env *webauthnTestEnv) passwordLogin(
+	t *testing.T,
+	authenticator *webauthntest.Authenticator,
+) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body := `{"username":"` + webauthnLogin + `","password":"` + webauthnPassword + `"}`
+	res := postWebAuthn(env.userHandler.LoginHandler, "", body)
+	require.Equal(t, http.StatusAccepted, res.Code)
+	session, options := ceremonyOptions(t, res)
+
+	credential, err := authenticator.Get(options)
+	require.NoError(t, err)
+
+	return postWebAuthn(env.handler.SecondFactorHandler, "", ceremonyBody(t, session, credential))
+}
+
+func (env *webauthnTestEnv) passwordlessLogin(
+	t *testing.T,
+	authenticator *webauthntest.Authenticator,
+) *httptest.ResponseRecorder {
+	t.Helper()
+
+	res := postWebAuthn(env.handler.BeginLoginHandler, "", "")
+	require.Equal(t, http.StatusOK, res.Code)
+	session, options := ceremonyOptions(t, res)
+
+	credential, err := authenticator.Get(options)
+	require.NoError(t, err)
+
+	return postWebAuthn(env.handler.FinishLoginHandler, "", ceremonyBody(t, session, credential))
+}
+
+func (env *webauthnTestEnv) credential(t *testing.T) model.WebAuthnCredential {
+	t.Helper()
+
+	require.Len(t, env.storage.credentials, 1)
+	for _, credential := range env.storage.credentials {
+		return credential
+	}
+
+	return model.WebAuthnCredential{}
+}
+
+func TestWebAuthnSecondFactor(t *testing.T) {
+	env := newWebAuthnTestEnv(t)
+	authenticator := webauthntest.New(webauthnOrigin)
+
+	res := env.register(t, authenticator)
+	require.Equal(t, http.StatusCreated, res.Code)
+	require.Contains(t, res.Body.String(), `"name":"YubiKey"`)
+	require.NotContains(t, res.Body.String(), "public")
+
+	// The authenticator evaluates PRF only during authentication, so the key is not passwordless yet
+	credential := env.credential(t)
+	require.Equal(t, webauthnLogin, credential.Login)
+	require.Empty(t, credential.DataKey)
+
+	// A stolen access token is not enough to register another key
+	res = postWebAuthn(env.handler.BeginRegistrationHandler, webauthnLogin, "")
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	res = postWebAuthn(env.handler.BeginRegistrationHandler, webauthnLogin, `{"password":"wrong password"}`)
+	require.Equal(t, http.StatusForbidden, res.Code)
+
+	// The same authenticator can't be registered twice
+	res = postWebAuthn(env.handler.BeginRegistrationHandler, webauthnLogin, `{"password":"`+webauthnPassword+`"}`)
+	_, options := ceremonyOptions(t, res)
+	_, err := authenticator.Create(options)
+	require.ErrorIs(t, err, webauthntest.ErrExcluded)
+
+	// The password alone is not enough anymore
+	res = env.passwordLogin(t, authenticator)
+	require.Equal(t, http.StatusCreated, res.Code)
+	require.Equal(t, env.dataKey, env.keyCache.setSecret)
+	require.Contains(t, strings.Join(res.Header().Values("Set-Cookie"), "\n"), "refresh_token=")
+
+	// PRF output of the second factor has wrapped the data key
+	credential = env.credential(t)
+	require.NotEmpty(t, credential.DataKey)
+	require.NotNil(t, credential.LastUsedAt)
+
+	// Another authenticator doesn't have the registered credential
+	_, err = webauthntest.New(webauthnOrigin).Get(options)
+	require.Error(t, err)
+
+	require.Equal(t, []string{
+		audit.EventWebAuthnRegister,
+		audit.EventLoginSuccess,
+	}, env.auditLog.types())
+}
+
+func TestWebAuthnSecondFactorErrors(t *testing.T) {
+	env := newWebAuthnTestEnv(t)
+	authenticator := webauthntest.New(webauthnOrigin)
+	require.Equal(t, http.StatusCreated, env.register(t, authenticator).Code)
+
+	body := `{"username":"` + webauthnLogin + `","password":"` + webauthnPassword + `"}`
+	res := postWebAuthn(env.userHandler.LoginHandler, "", body)
+	require.Equal(t, http.StatusAccepted, res.Code)
+	require.False(t, env.keyCache.setCalled)
+	session, options := ceremonyOptions(t, res)
+
+	// The session of the second factor can't be used for passwordless login
+	credential, err := authenticator.Get(options)
+	require.NoError(t, err)
+	res = postWebAuthn(env.handler.FinishLoginHandler, "", ceremonyBody(t, session, credential))
+	require.Equal(t, http.StatusUnauthorized, res.Code)
+
+	// The session is removed after the first attempt
+	res = postWebAuthn(env.handler.SecondFactorHandler, "", ceremonyBody(t, session, credential))
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.False(t, env.keyCache.setCalled)
+
+	// The signature is verified
+	res = postWebAuthn(env.userHandler.LoginHandler, "", body)
+	session, options = ceremonyOptions(t, res)
+	credential, err = authenticator.Get(options)
+	require.NoError(t, err)
+	tampered := strings.Replace(ceremonyBody(t, session, credential), `"signature":"`, `"signature":"AAAA`, 1)
+	res = postWebAuthn(env.handler.SecondFactorHandler, "", tampered)
+	require.Equal(t, http.StatusUnauthorized, res.Code)
+	require.False(t, env.keyCache.setCalled)
+	require.Contains(t, env.auditLog.types(), audit.EventSecondFactorFailure)
+}
+
+func TestWebAuthnPasswordlessLogin(t *testing.T) {
+	env := newWebAuthnTestEnv(t)
+	authenticator := webauthntest.New(webauthnOrigin)
+	authenticator.PRFOnCreate = true
+
+	require.Equal(t, http.StatusCreated, env.register(t, authenticator).Code)
+	require.NotEmpty(t, env.credential(t).DataKey)
+
+	res := env.passwordlessLogin(t, authenticator)
+	require.Equal(t, http.StatusCreated, res.Code)
+	require.Equal(t, webauthnLogin, env.keyCache.setLogin)
+	require.Equal(t, env.dataKey, env.keyCache.setSecret)
+
+	// The authenticator must verify the user, because the passkey replaces the password
+	env.keyCache.setCalled = false
+	authenticator.UserVerification = false
+	res = env.passwordlessLogin(t, authenticator)
+	require.Equal(t, http.StatusUnauthorized, res.Code)
+	require.False(t, env.keyCache.setCalled)
+
+	require.Equal(t, []string{
+		audit.EventWebAuthnRegister,
+		audit.EventLoginSuccess,
+		audit.EventLoginFailure,
+	}, env.auditLog.types())
+}
+
+func TestWebAuthnPasswordlessLoginErrors(t *testing.T) {
+	t.Run("Authenticator doesn't support PRF", func(t *testing.T) {
+		env := newWebAuthnTestEnv(t)
+		authenticator := webauthntest.New(webauthnOrigin)
+		authenticator.PRF = false
+
+		require.Equal(t, http.StatusCreated, env.register(t, authenticator).Code)
+		require.Equal(t, http.StatusCreated, env.passwordLogin(t, authenticator).Code)
+
+		env.keyCache.setCalled = false
+		require.Equal(t, http.StatusConflict, env.passwordlessLogin(t, authenticator).Code)
+		require.False(t, env.keyCache.setCalled)
+	})
+
+	t.Run("Authenticator doesn't verify the user", func(t *testing.T) {
+		env := newWebAuthnTestEnv(t)
+		authenticator := webauthntest.New(webauthnOrigin)
+		authenticator.UserVerification = false
+
+		// The key is still a second factor, but PRF output without user verification is not used
+		require.Equal(t, http.StatusCreated, env.register(t, authenticator).Code)
+		require.Equal(t, http.StatusCreated, env.passwordLogin(t, authenticator).Code)
+		require.Empty(t, env.credential(t).DataKey)
+
+		env.keyCache.setCalled = false
+		require.Equal(t, http.StatusUnauthorized, env.passwordlessLogin(t, authenticator).Code)
+		require.False(t, env.keyCache.setCalled)
+	})
+
+	t.Run("Cloned authenticator", func(t *testing.T) {
+		env := newWebAuthnTestEnv(t)
+		authenticator := webauthntest.New(webauthnOrigin)
+		authenticator.PRFOnCreate = true
+		require.Equal(t, http.StatusCreated, env.register(t, authenticator).Code)
+
+		clone := authenticator.Clone()
+		require.Equal(t, http.StatusCreated, env.passwordlessLogin(t, authenticator).Code)
+
+		// The signature counter of the clone is behind the counter of the original authenticator
+		env.keyCache.setCalled = false
+		require.Equal(t, http.StatusUnauthorized, env.passwordlessLogin(t, clone).Code)
+		require.False(t, env.keyCache.setCalled)
+		require.Equal(t, audit.EventLoginFailure, env.auditLog.types()[len(env.auditLog.events)-1])
+	})
+
+	t.Run("Credential is removed", func(t *testing.T) {
+		env := newWebAuthnTestEnv(t)
+		authenticator := webauthntest.New(webauthnOrigin)
+		authenticator.PRFOnCreate = true
+		require.Equal(t, http.StatusCreated, env.register(t, authenticator).Code)
+
+		env.storage.credentials = map[string]model.WebAuthnCredential{}
+		require.Equal(t, http.StatusUnauthorized, env.passwordlessLogin(t, authenticator).Code)
+	})
+}
+
+func TestWebAuthnCredentials(t *testing.T) {
+	env := newWebAuthnTestEnv(t)
+	authenticator := webauthntest.New(webauthnOrigin)
+	require.Equal(t, http.StatusCreated, env.register(t, authenticator).Code)
+	id := env.credential(t).ID
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, webauthnLogin))
+	res := httptest.NewRecorder()
+	env.handler.ListCredentialsHandler(res, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Body.String(), `"id":"`+id+`"`)
+	require.Contains(t, res.Body.String(), `"aaguid":"00000000-0000-0000-0000-000000000000"`)
+
+	router := chi.NewRouter()
+	router.Delete("/webauthn/credentials/{id}", env.handler.DeleteCredentialHandler)
+
+	deleteCredential := func(login string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/webauthn/credentials/"+id, nil)
+		req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, login))
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+
+		return res.Code
+	}
+
+	// Users can't remove credentials of each other
+	require.Equal(t, http.StatusNotFound, deleteCredential("john.doe@example.com"))
+	require.Equal(t, http.StatusOK, deleteCredential(webauthnLogin))
+	require.Empty(t, env.storage.credentials)
+
+	// Without security keys the password is enough
+	body := `{"username":"` + webauthnLogin + `","password":"` + webauthnPassword + `"}`
+	res = postWebAuthn(env.userHandler.LoginHandler, "", body)
+	require.Equal(t, http.StatusCreated, res.Code)
+	require.Contains(t, env.auditLog.types(), audit.EventWebAuthnRemove)
+}
+
+func TestWebAuthnNotConfigured(t *testing.T) {
+	storage := &MockStorage{credentials: map[string]model.WebAuthnCredential{}}
+	handler := newWebAuthnHandlerProvider(
+		appConfig, storage, &mockAuditLog{}, newTestLoginThrottler(), newTestKeys(t, appConfig), nil,
+	)
+
+	require.Equal(t, http.StatusNotFound, postWebAuthn(handler.BeginRegistrationHandler, webauthnLogin, "").Code)
+	require.Equal(t, http.StatusNotFound, postWebAuthn(handler.BeginLoginHandler, "", "").Code)
+	require.Equal(t, http.StatusNotFound, postWebAuthn(handler.FinishLoginHandler, "", "{}").Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	require.False(t, handler.RequireSecondFactor(httptest.NewRecorder(), req, webauthnLogin, "data key"))
+}
@@ -0,0 +1,65 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/grafviktor/keep-my-secret/internal/api/auth"
+	"github.com/grafviktor/keep-my-secret/internal/api/utils"
+	"github.com/grafviktor/keep-my-secret/internal/config"
+)
+
+const (
+	jwksPath = "/.well-known/jwks.json"
+	// wellKnownMaxAge - how long clients may cache the documents. Clients are expected to reload keys
+	// when they get a token with unknown "kid", so the period only limits the load
+	wellKnownMaxAge = "public, max-age=300"
+)
+
+// discoveryDocument - the part of OpenID Connect discovery document, which is required to verify tokens
+type discoveryDocument struct {
+	Issuer                           string   `json:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported                  []string `json:"claims_supported"`
+}
+
+type wellKnownHandler struct {
+	config config.AppConfig
+	keys   *auth.KeySet
+}
+
+// newWellKnownHandlerProvider - handlers of documents which allow other services to verify tokens
+func newWellKnownHandlerProvider(appConfig config.AppConfig, keys *auth.KeySet) wellKnownHandler {
+	return wellKnownHandler{config: appConfig, keys: keys}
+}
+
+// JWKSHandler - HTTP handler which publishes public keys that verify tokens in JWK Set format.
+// Tokens signed with HS256 cannot be verified by other services, so the set is empty in this case.
+func (h wellKnownHandler) JWKSHandler(w http.ResponseWriter, _ *http.Request) {
+	headers := http.Header{}
+	headers.Set("Cache-Control", wellKnownMaxAge)
+
+	_ = utils.WriteJSON(w, http.StatusOK, h.keys.PublicKeys(), headers)
+}
+
+// DiscoveryHandler - HTTP handler which returns OpenID Connect discovery document. If the issuer is not
+// a URL, the address of JWKS endpoint is built from the host of the request.
+func (h wellKnownHandler) DiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	baseURL := strings.TrimSuffix(h.config.JWTIssuer, "/")
+	if !strings.HasPrefix(baseURL, "https://") && !strings.HasPrefix(baseURL, "http://") {
+		baseURL = "https://" + r.Host
+	}
+
+	headers := http.Header{}
+	headers.Set("Cache-Control", wellKnownMaxAge)
+
+	_ = utils.WriteJSON(w, http.StatusOK, discoveryDocument{
+		Issuer:                           h.config.JWTIssuer,
+		JWKSURI:                          baseURL + jwksPath,
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: h.keys.Algorithms(),
+		ClaimsSupported:                  []string{"iss", "sub", "aud", "exp", "iat"},
+	}, headers)
+}
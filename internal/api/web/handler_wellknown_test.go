@@ -0,0 +1,103 @@
+package web
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/api/auth"
+	"github.com/grafviktor/keep-my-secret/internal/config"
+)
+
+func newEdDSAConfig(t *testing.T) config.AppConfig {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	data, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "signing.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: data}), 0o600))
+
+	return config.AppConfig{
+		JWTIssuer:         "https://kms.example.com/",
+		JWTAudience:       "kms.example.com",
+		JWTAlgorithm:      auth.AlgorithmEdDSA,
+		JWTSigningKeyPath: path,
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	ac := newEdDSAConfig(t)
+	keys := newTestKeys(t, ac)
+
+	res := httptest.NewRecorder()
+	newWellKnownHandlerProvider(ac, keys).JWKSHandler(res, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	require.Equal(t, http.StatusOK, res.Code)
+	require.NotEmpty(t, res.Header().Get("Cache-Control"))
+
+	var set auth.JWKSet
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &set))
+	require.Len(t, set.Keys, 1)
+	require.Equal(t, keys.Signing.ID, set.Keys[0].Kid)
+	require.Equal(t, "OKP", set.Keys[0].Kty)
+	require.Equal(t, auth.AlgorithmEdDSA, set.Keys[0].Alg)
+	require.NotContains(t, res.Body.String(), `"d"`)
+
+	// HMAC secret must never be published
+	res = httptest.NewRecorder()
+	newWellKnownHandlerProvider(appConfig, newTestKeys(t, appConfig)).
+		JWKSHandler(res, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, res.Code)
+	require.JSONEq(t, `{"keys": []}`, res.Body.String())
+}
+
+func TestDiscoveryHandler(t *testing.T) {
+	ac := newEdDSAConfig(t)
+
+	tests := []struct {
+		name    string
+		issuer  string
+		jwksURI string
+	}{
+		{
+			name:    "Issuer is a URL",
+			issuer:  "https://kms.example.com/",
+			jwksURI: "https://kms.example.com/.well-known/jwks.json",
+		},
+		{
+			name:    "Issuer is a domain name",
+			issuer:  "kms.example.com",
+			jwksURI: "https://localhost:8080/.well-known/jwks.json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ac.JWTIssuer = tt.issuer
+			req := httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)
+			req.Host = "localhost:8080"
+			res := httptest.NewRecorder()
+
+			newWellKnownHandlerProvider(ac, newTestKeys(t, ac)).DiscoveryHandler(res, req)
+			require.Equal(t, http.StatusOK, res.Code)
+
+			var document discoveryDocument
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &document))
+			require.Equal(t, tt.issuer, document.Issuer)
+			require.Equal(t, tt.jwksURI, document.JWKSURI)
+			require.Equal(t, []string{auth.AlgorithmEdDSA}, document.IDTokenSigningAlgValuesSupported)
+		})
+	}
+}
@@ -2,19 +2,33 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/grafviktor/keep-my-secret/internal/api"
 	"github.com/grafviktor/keep-my-secret/internal/api/utils"
 	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
 )
 
+// apiTokenHeaderPrefix - personal API tokens are sent the same way as JWT, but they are distinguished by the prefix
+const apiTokenHeaderPrefix = "Bearer " + model.APITokenPrefix
+
 // AuthRequired middleware for checking if user is authenticated
 // If user is not authenticated, it will return unauthorized response (401)
 // If user is authenticated, it will add user login to context
+// Personal API tokens are accepted too, the token and the data key are added to context then
 func (m *middleware) AuthRequired(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, apiTokenHeaderPrefix) {
+			m.authenticateAPIToken(w, r, strings.TrimPrefix(authHeader, "Bearer "), next)
+
+			return
+		}
+
 		_, claims, err := m.authVerifier.VerifyAuthHeader(m.config, w, r)
 		if err != nil {
 			log.Printf("auth: %v", err.Error())
@@ -28,8 +42,127 @@ func (m *middleware) AuthRequired(next http.Handler) http.Handler {
 			return
 		}
 
-		r = r.WithContext(context.WithValue(r.Context(), api.ContextUserLogin, claims.Subject))
+		role, ok := m.verifySession(w, r, claims.Subject, claims.Role, claims.IssuedAtTime())
+		if !ok {
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), api.ContextUserLogin, claims.Subject)
+		ctx = context.WithValue(ctx, api.ContextUserRole, role)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// AdminRequired middleware allows only administrators of the server, it must follow AuthRequired.
+// Requests with personal API tokens are rejected, because tokens have no role. The role is loaded
+// from the storage by AuthRequired, so demoted administrators lose access at once.
+func (m *middleware) AdminRequired(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if role, _ := r.Context().Value(api.ContextUserRole).(string); role != model.UserRoleAdmin {
+			log.Printf("auth: '%v' is not an administrator", r.Context().Value(api.ContextUserLogin))
+
+			_ = utils.WriteJSON(w, http.StatusForbidden, api.Response{
+				Status:  constant.APIStatusFail,
+				Message: constant.APIMessageForbidden,
+				Data:    nil,
+			})
+
+			return
+		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// verifySession - checks that the account is not disabled and the token is not revoked, returns the current
+// role of the user. Writes the response if it's not so. The role of the token is used only if sessions
+// are not verified.
+func (m *middleware) verifySession(
+	w http.ResponseWriter,
+	r *http.Request,
+	login, role string,
+	issuedAt time.Time,
+) (string, bool) {
+	if m.sessions == nil {
+		return role, true
+	}
+
+	role, err := m.sessions.VerifySession(r.Context(), login, issuedAt)
+	if err != nil {
+		log.Printf("auth: %v", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: "unauthorized",
+			Data:    nil,
+		})
+
+		return "", false
+	}
+
+	return role, true
+}
+
+// verifyAccount - checks that the account is not disabled. Writes the response if it's not so.
+func (m *middleware) verifyAccount(w http.ResponseWriter, r *http.Request, login string) bool {
+	if m.sessions == nil {
+		return true
+	}
+
+	if err := m.sessions.VerifyAccount(r.Context(), login); err != nil {
+		log.Printf("auth: %v", err.Error())
+
+		_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+			Status:  constant.APIStatusFail,
+			Message: "unauthorized",
+			Data:    nil,
+		})
+
+		return false
+	}
+
+	return true
+}
+
+// authenticateAPIToken - verifies personal API token, which also must permit the request
+func (m *middleware) authenticateAPIToken(w http.ResponseWriter, r *http.Request, token string, next http.Handler) {
+	w.Header().Add("Vary", "Authorization")
+
+	err := errors.New("API tokens are not accepted")
+	var apiToken *model.APIToken
+	var dataKey string
+	if m.apiTokens != nil {
+		apiToken, dataKey, err = m.apiTokens.VerifyAPIToken(r, token)
+	}
+
+	if err != nil {
+		log.Printf("auth: %v", err.Error())
+
+		if errors.Is(err, constant.ErrForbidden) {
+			_ = utils.WriteJSON(w, http.StatusForbidden, api.Response{
+				Status:  constant.APIStatusFail,
+				Message: constant.APIMessageForbidden,
+				Data:    nil,
+			})
+		} else {
+			_ = utils.WriteJSON(w, http.StatusUnauthorized, api.Response{
+				Status:  constant.APIStatusFail,
+				Message: "unauthorized",
+				Data:    nil,
+			})
+		}
+
+		return
+	}
+
+	if !m.verifyAccount(w, r, apiToken.Login) {
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), api.ContextUserLogin, apiToken.Login)
+	ctx = context.WithValue(ctx, api.ContextAPIToken, apiToken)
+	ctx = context.WithValue(ctx, api.ContextDataKey, dataKey)
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
@@ -1,14 +1,20 @@
 package middleware
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
 
 	"github.com/grafviktor/keep-my-secret/internal/api"
 	"github.com/grafviktor/keep-my-secret/internal/api/auth"
 	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
 )
 
 type mockAuthVerifier struct{}
@@ -24,6 +30,10 @@ func (m mockAuthVerifier) VerifyAuthHeader(config config.AppConfig, w http.Respo
 		return "", nil, errors.New("no auth header")
 	}
 
+	if authHeader == "Bearer admin" {
+		claims.Role = model.UserRoleAdmin
+	}
+
 	return "", claims, nil
 }
 
@@ -93,3 +103,137 @@ func TestAuthRequired(t *testing.T) {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, rr.Code)
 	}
 }
+
+type mockAPITokenVerifier struct{}
+
+//nolint:lll
+func (m mockAPITokenVerifier) VerifyAPIToken(r *http.Request, token string) (*model.APIToken, string, error) {
+	switch token {
+	case "kms_valid":
+		return &model.APIToken{Login: "testuser"}, "data key", nil
+	case "kms_forbidden":
+		return nil, "", constant.ErrForbidden
+	default:
+		return nil, "", errors.New("invalid token")
+	}
+}
+
+func TestAuthRequiredAPIToken(t *testing.T) {
+	mw := middleware{
+		config:       config.AppConfig{},
+		authVerifier: mockAuthVerifier{},
+		apiTokens:    mockAPITokenVerifier{},
+	}
+
+	handler := mw.AuthRequired(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "testuser", r.Context().Value(api.ContextUserLogin))
+		require.Equal(t, "data key", r.Context().Value(api.ContextDataKey))
+		require.NotNil(t, r.Context().Value(api.ContextAPIToken))
+
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	authenticate := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	require.Equal(t, http.StatusOK, authenticate("kms_valid"))
+	require.Equal(t, http.StatusForbidden, authenticate("kms_forbidden"))
+	require.Equal(t, http.StatusUnauthorized, authenticate("kms_invalid"))
+
+	// API tokens are rejected, if the verifier is not set
+	mw.apiTokens = nil
+	require.Equal(t, http.StatusUnauthorized, authenticate("kms_valid"))
+}
+
+type mockSessionVerifier struct {
+	disabled bool
+	role     string
+}
+
+func (m mockSessionVerifier) VerifySession(ctx context.Context, login string, issuedAt time.Time) (string, error) {
+	if m.disabled {
+		return "", errors.New("account is disabled")
+	}
+
+	return m.role, nil
+}
+
+func (m mockSessionVerifier) VerifyAccount(ctx context.Context, login string) error {
+	if m.disabled {
+		return errors.New("account is disabled")
+	}
+
+	return nil
+}
+
+func TestAuthRequiredSession(t *testing.T) {
+	mw := middleware{
+		config:       config.AppConfig{},
+		authVerifier: mockAuthVerifier{},
+		apiTokens:    mockAPITokenVerifier{},
+		sessions:     mockSessionVerifier{},
+	}
+
+	handler := mw.AuthRequired(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	authenticate := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	require.Equal(t, http.StatusOK, authenticate("bla-bla"))
+	require.Equal(t, http.StatusOK, authenticate("kms_valid"))
+
+	// Tokens of disabled users are rejected, though they are not expired
+	mw.sessions = mockSessionVerifier{disabled: true}
+	require.Equal(t, http.StatusUnauthorized, authenticate("bla-bla"))
+	require.Equal(t, http.StatusUnauthorized, authenticate("kms_valid"))
+}
+
+func TestAdminRequired(t *testing.T) {
+	mw := middleware{
+		config:       config.AppConfig{},
+		authVerifier: mockAuthVerifier{},
+		apiTokens:    mockAPITokenVerifier{},
+	}
+
+	handler := mw.AuthRequired(mw.AdminRequired(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, model.UserRoleAdmin, r.Context().Value(api.ContextUserRole))
+
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	authenticate := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	require.Equal(t, http.StatusOK, authenticate("admin"))
+	require.Equal(t, http.StatusForbidden, authenticate("bla-bla"))
+	// API tokens never grant administrator access
+	require.Equal(t, http.StatusForbidden, authenticate("kms_valid"))
+
+	// The role is taken from the session verifier, when it is set, the role of the token can be outdated
+	mw.sessions = mockSessionVerifier{role: model.UserRoleUser}
+	require.Equal(t, http.StatusForbidden, authenticate("admin"))
+
+	mw.sessions = mockSessionVerifier{role: model.UserRoleAdmin}
+	require.Equal(t, http.StatusOK, authenticate("admin"))
+	require.Equal(t, http.StatusForbidden, authenticate("kms_valid"))
+}
@@ -44,7 +44,7 @@ func TestEnableCORS(t *testing.T) {
 		"Access-Control-Allow-Credentials": "true",
 		"Access-Control-Expose-Headers":    "*",
 		"Access-Control-Allow-Methods":     "GET,POST,PUT,PATCH,DELETE,OPTIONS",
-		"Access-Control-Allow-Headers":     "Accept, Content-Type, X-CSRF-Token, Authorization",
+		"Access-Control-Allow-Headers":     "Accept, Content-Type, X-CSRF-Token, Authorization, X-Send-Password, X-Archive-Password",
 	}
 
 	for header, expectedValue := range expectedHeadersDevMode {
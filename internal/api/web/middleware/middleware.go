@@ -1,10 +1,13 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/grafviktor/keep-my-secret/internal/api/auth"
 	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/model"
 )
 
 // TokenVerifier is the interface to describe common logic. Used for dependency injection when testing the application
@@ -12,18 +15,53 @@ type TokenVerifier interface {
 	VerifyAuthHeader(config config.AppConfig, w http.ResponseWriter, r *http.Request) (string, *auth.Claims, error)
 }
 
+// APITokenVerifier verifies personal API tokens, which scripts send instead of JWT
+type APITokenVerifier interface {
+	// VerifyAPIToken - returns the token and the data key which it unwraps. Returns constant.ErrForbidden
+	// if the token is valid, but doesn't permit the request.
+	VerifyAPIToken(r *http.Request, token string) (*model.APIToken, string, error)
+}
+
+// SessionVerifier checks that the user can still use the token, which was issued earlier
+type SessionVerifier interface {
+	// VerifySession - returns the current role of the user, because the role in the token can be outdated.
+	// Returns an error if the account of the user is disabled, or if sessions of the user were revoked
+	// after the token was issued
+	VerifySession(ctx context.Context, login string, issuedAt time.Time) (string, error)
+	// VerifyAccount - returns an error if the account of the user is disabled. Personal API tokens are not
+	// sessions, they are deleted when sessions of the user are revoked.
+	VerifyAccount(ctx context.Context, login string) error
+}
+
 type middleware struct {
 	config       config.AppConfig
 	authVerifier TokenVerifier
+	// apiTokens is nil if personal API tokens are not accepted
+	apiTokens APITokenVerifier
+	// sessions is nil if tokens are trusted until they expire
+	sessions    SessionVerifier
+	rateLimiter *rateLimiter
 }
 
 // New creates a new middleware instance
 // appConfig is the application configuration
 // authVerifier is the auth verifier instance which can be substituted with a mock object
+// rateLimits are the limits of route groups, see ParseRateLimits
+// apiTokens verifies personal API tokens
+// sessions verifies that accounts are not disabled and sessions are not revoked
 // Returns new middleware instance
-func New(appConfig config.AppConfig) middleware {
+func New(
+	appConfig config.AppConfig,
+	authVerifier TokenVerifier,
+	rateLimits map[string]*RateLimit,
+	apiTokens APITokenVerifier,
+	sessions SessionVerifier,
+) middleware {
 	return middleware{
 		config:       appConfig,
-		authVerifier: auth.JWTVerifier{},
+		authVerifier: authVerifier,
+		apiTokens:    apiTokens,
+		sessions:     sessions,
+		rateLimiter:  newRateLimiter(rateLimits),
 	}
 }
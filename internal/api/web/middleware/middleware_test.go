@@ -5,6 +5,7 @@ import (
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/grafviktor/keep-my-secret/internal/api/auth"
 	"github.com/grafviktor/keep-my-secret/internal/config"
 )
 
@@ -13,7 +14,7 @@ func TestNewMiddleware(t *testing.T) {
 	appConfig := config.AppConfig{}
 
 	// Call the New function to create a middleware instance
-	mw := New(appConfig)
+	mw := New(appConfig, auth.JWTVerifier{}, nil, nil, nil)
 
 	// Check if the config field of the middleware matches the expected AppConfig
 	if mw.config != appConfig {
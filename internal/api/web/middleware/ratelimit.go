@@ -0,0 +1,239 @@
+package middleware
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/api/utils"
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+)
+
+// DefaultRateLimitGroup - limit of route groups which don't have their own limit
+const DefaultRateLimitGroup = "default"
+
+const (
+	rateLimitOff = "off"
+	// bucketCleanupInterval - how often buckets of clients, which are not active anymore, are removed
+	bucketCleanupInterval = time.Minute
+)
+
+// rejectedRequests - number of rejected requests per route group, it's published with expvar
+var rejectedRequests = expvar.NewMap("rate_limit_rejected")
+
+// RateLimit - a client can make Requests per Window on average, and up to Burst requests at once
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+	Burst    int
+}
+
+// perSecond - how fast the bucket is refilled
+func (l RateLimit) perSecond() float64 {
+	return float64(l.Requests) / l.Window.Seconds()
+}
+
+// ParseRateLimits - parses comma separated limits of route groups: "<group>=<requests>/<window>[:<burst>]",
+// for instance "default=300/1m,secrets=60/1m:20". Window is a duration, "1" can be omitted: "60/m".
+// Burst is equal to the number of requests if it's not set. A group with "off" limit is not limited.
+// Groups without a limit use the "default" limit, if there is no default limit, they are not limited either.
+func ParseRateLimits(spec string) (map[string]*RateLimit, error) {
+	limits := make(map[string]*RateLimit)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		group, value, ok := strings.Cut(item, "=")
+		group = strings.TrimSpace(group)
+		value = strings.TrimSpace(value)
+		if !ok || group == "" {
+			return nil, fmt.Errorf("invalid rate limit %q", item)
+		}
+
+		if value == rateLimitOff {
+			limits[group] = nil
+			continue
+		}
+
+		limit, err := parseRateLimit(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit %q: %w", item, err)
+		}
+
+		limits[group] = limit
+	}
+
+	return limits, nil
+}
+
+func parseRateLimit(value string) (*RateLimit, error) {
+	value, burst, hasBurst := strings.Cut(value, ":")
+	requests, window, ok := strings.Cut(value, "/")
+	if !ok {
+		return nil, errors.New("window is missing")
+	}
+
+	limit := &RateLimit{}
+	var err error
+	if limit.Requests, err = strconv.Atoi(requests); err != nil || limit.Requests <= 0 {
+		return nil, errors.New("number of requests must be positive")
+	}
+
+	if window != "" && (window[0] < '0' || window[0] > '9') {
+		window = "1" + window
+	}
+
+	if limit.Window, err = time.ParseDuration(window); err != nil || limit.Window <= 0 {
+		return nil, errors.New("window must be a positive duration")
+	}
+
+	limit.Burst = limit.Requests
+	if hasBurst {
+		if limit.Burst, err = strconv.Atoi(burst); err != nil || limit.Burst <= 0 {
+			return nil, errors.New("burst must be positive")
+		}
+	}
+
+	return limit, nil
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// rateLimiter - token buckets of all clients. Every client has its own bucket in every route group.
+type rateLimiter struct {
+	mu          sync.Mutex
+	limits      map[string]*RateLimit
+	buckets     map[string]*bucket
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+func newRateLimiter(limits map[string]*RateLimit) *rateLimiter {
+	return &rateLimiter{
+		limits:  limits,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// limit - returns the limit of the group, nil if the group is not limited
+func (rl *rateLimiter) limit(group string) *RateLimit {
+	if limit, ok := rl.limits[group]; ok {
+		return limit
+	}
+
+	return rl.limits[DefaultRateLimitGroup]
+}
+
+// take - takes a token from the bucket of the client. Returns the number of remaining tokens and the time
+// when the bucket is full again. If the bucket is empty, retryAfter is the time until the next token.
+//
+//nolint:lll
+func (rl *rateLimiter) take(limit *RateLimit, key string) (allowed bool, remaining int, reset, retryAfter time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	rl.cleanup(now)
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updatedAt: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updatedAt).Seconds()*limit.perSecond())
+	b.updatedAt = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		allowed = true
+	} else {
+		retryAfter = seconds((1 - b.tokens) / limit.perSecond())
+	}
+
+	reset = seconds((float64(limit.Burst) - b.tokens) / limit.perSecond())
+
+	return allowed, int(b.tokens), reset, retryAfter
+}
+
+// cleanup - removes buckets which are full, the clients get the same full bucket when they come back
+func (rl *rateLimiter) cleanup(now time.Time) {
+	if now.Sub(rl.lastCleanup) < bucketCleanupInterval {
+		return
+	}
+
+	for key, b := range rl.buckets {
+		limit := rl.limit(strings.SplitN(key, "|", 2)[0])
+		if limit == nil || b.tokens+now.Sub(b.updatedAt).Seconds()*limit.perSecond() >= float64(limit.Burst) {
+			delete(rl.buckets, key)
+		}
+	}
+
+	rl.lastCleanup = now
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
+
+// ceilSeconds - headers contain the number of seconds, which is rounded up, so the client doesn't come too early
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// RateLimit - limits requests of the route group. Authenticated clients are identified by their login,
+// so this middleware must be used after AuthRequired. Other clients are identified by their IP address.
+// Every response contains RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers, rejected
+// requests get 429 status and Retry-After header.
+func (m *middleware) RateLimit(group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := m.rateLimiter.limit(group)
+			if limit == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			client := "ip:" + utils.ClientIP(r)
+			if login, ok := r.Context().Value(api.ContextUserLogin).(string); ok {
+				client = "user:" + login
+			}
+
+			allowed, remaining, reset, retryAfter := m.rateLimiter.take(limit, group+"|"+client)
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("RateLimit-Reset", ceilSeconds(reset))
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", limit.Requests, ceilSeconds(limit.Window)))
+
+			if !allowed {
+				rejectedRequests.Add(group, 1)
+
+				headers := http.Header{}
+				headers.Set("Retry-After", ceilSeconds(retryAfter))
+				_ = utils.WriteJSON(w, http.StatusTooManyRequests, api.Response{
+					Status:  constant.APIStatusFail,
+					Message: constant.APIMessageTooManyRequests,
+					Data:    nil,
+				}, headers)
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/api"
+	"github.com/grafviktor/keep-my-secret/internal/config"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    map[string]*RateLimit
+		wantErr bool
+	}{
+		{
+			name: "several groups",
+			spec: "default=300/1m, secrets=60/m:20,tools=off",
+			want: map[string]*RateLimit{
+				"default": {Requests: 300, Window: time.Minute, Burst: 300},
+				"secrets": {Requests: 60, Window: time.Minute, Burst: 20},
+				"tools":   nil,
+			},
+		},
+		{
+			name: "empty",
+			spec: "",
+			want: map[string]*RateLimit{},
+		},
+		{name: "missing group", spec: "=10/s", wantErr: true},
+		{name: "missing window", spec: "default=10", wantErr: true},
+		{name: "invalid window", spec: "default=10/week", wantErr: true},
+		{name: "zero requests", spec: "default=0/s", wantErr: true},
+		{name: "invalid burst", spec: "default=10/s:-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits, err := ParseRateLimits(tt.spec)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, limits)
+		})
+	}
+}
+
+func TestRateLimiterTake(t *testing.T) {
+	now := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(nil)
+	limiter.now = func() time.Time {
+		return now
+	}
+
+	// One token per second, up to two tokens at once
+	limit := &RateLimit{Requests: 60, Window: time.Minute, Burst: 2}
+
+	allowed, remaining, reset, _ := limiter.take(limit, "client")
+	require.True(t, allowed)
+	require.Equal(t, 1, remaining)
+	require.Equal(t, time.Second, reset)
+
+	allowed, remaining, _, _ = limiter.take(limit, "client")
+	require.True(t, allowed)
+	require.Equal(t, 0, remaining)
+
+	allowed, _, _, retryAfter := limiter.take(limit, "client")
+	require.False(t, allowed)
+	require.Equal(t, time.Second, retryAfter)
+
+	// Other clients have their own buckets
+	allowed, _, _, _ = limiter.take(limit, "other client")
+	require.True(t, allowed)
+
+	now = now.Add(500 * time.Millisecond)
+	allowed, _, _, retryAfter = limiter.take(limit, "client")
+	require.False(t, allowed)
+	require.Equal(t, 500*time.Millisecond, retryAfter)
+
+	now = now.Add(500 * time.Millisecond)
+	allowed, _, _, _ = limiter.take(limit, "client")
+	require.True(t, allowed)
+
+	// Full buckets are removed
+	now = now.Add(time.Hour)
+	limiter.cleanup(now)
+	require.Empty(t, limiter.buckets)
+}
+
+func TestRateLimit(t *testing.T) {
+	limits, err := ParseRateLimits("default=2/1m,tools=off")
+	require.NoError(t, err)
+
+	mw := New(config.AppConfig{}, nil, limits, nil, nil)
+	handler := func(group string) http.Handler {
+		return mw.RateLimit(group)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+
+	request := func(group, login, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		if login != "" {
+			req = req.WithContext(context.WithValue(req.Context(), api.ContextUserLogin, login))
+		}
+
+		rr := httptest.NewRecorder()
+		handler(group).ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	rr := request("secrets", "alice", "192.0.2.1:1000")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "2", rr.Header().Get("RateLimit-Limit"))
+	require.Equal(t, "1", rr.Header().Get("RateLimit-Remaining"))
+	require.Equal(t, "30", rr.Header().Get("RateLimit-Reset"))
+	require.Equal(t, "2;w=60", rr.Header().Get("RateLimit-Policy"))
+
+	// The user is identified by login, regardless of the address
+	require.Equal(t, http.StatusOK, request("secrets", "alice", "198.51.100.1:1000").Code)
+
+	rejected := func() int64 {
+		if counter, ok := rejectedRequests.Get("secrets").(*expvar.Int); ok {
+			return counter.Value()
+		}
+
+		return 0
+	}
+
+	before := rejected()
+	rr = request("secrets", "alice", "192.0.2.1:1000")
+	require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	require.Equal(t, "30", rr.Header().Get("Retry-After"))
+	require.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+	require.Equal(t, before+1, rejected())
+
+	// Other users and anonymous clients have their own limits
+	require.Equal(t, http.StatusOK, request("secrets", "bob", "192.0.2.1:1000").Code)
+	require.Equal(t, http.StatusOK, request("secrets", "", "192.0.2.1:1000").Code)
+
+	// Groups have separate limits
+	require.Equal(t, http.StatusOK, request("teams", "alice", "192.0.2.1:1000").Code)
+
+	// The group is not limited
+	for i := 0; i < 5; i++ {
+		rr = request("tools", "alice", "192.0.2.1:1000")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Empty(t, rr.Header().Get("RateLimit-Limit"))
+	}
+}
@@ -5,12 +5,20 @@ import (
 	"errors"
 	"net/http"
 	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
 
 	"github.com/grafviktor/keep-my-secret/internal/api/auth"
 
+	"github.com/grafviktor/keep-my-secret/internal/config"
 	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/emergency"
 	"github.com/grafviktor/keep-my-secret/internal/model"
+	"github.com/grafviktor/keep-my-secret/internal/policy"
 	"github.com/grafviktor/keep-my-secret/internal/storage"
+	"github.com/grafviktor/keep-my-secret/internal/throttle"
 )
 
 var (
@@ -20,10 +28,22 @@ var (
 
 type MockStorage struct {
 	users map[string]*model.User
+	// identities - logins of users of identity providers by issuer and subject
+	identities map[[2]string]string
+	// credentials - WebAuthn credentials by ID, copies are returned, like rows of a database
+	credentials map[string]model.WebAuthnCredential
+	// apiTokens - personal API tokens by ID, copies are returned as well
+	apiTokens map[int64]model.APIToken
+	// settings - settings of the server, the registration is open if they are not set
+	settings *model.ServerSettings
 }
 
-//nolint:lll
-func (mockStorage MockStorage) SaveSecret(ctx context.Context, secret *model.Secret, login string) (*model.Secret, error) {
+func (mockStorage MockStorage) SaveSecret(
+	ctx context.Context,
+	secret *model.Secret,
+	searchTokens []string,
+	login string,
+) (*model.Secret, error) {
 	if login == "valid_user_invalid_secret" {
 		return nil, errors.New("mock storage error for invalid secret")
 	}
@@ -82,7 +102,7 @@ func (mockStorage MockStorage) GetSecretsByUser(ctx context.Context, login strin
 }
 
 func (mockStorage MockStorage) DeleteSecret(ctx context.Context, secretID, login string) error {
-	if secretID == "invalid_id" {
+	if secretID == "invalid_id" || login == "recipient" {
 		return constant.ErrNotFound
 	}
 
@@ -91,8 +111,11 @@ func (mockStorage MockStorage) DeleteSecret(ctx context.Context, secretID, login
 
 func (mockStorage MockStorage) GetSecret(ctx context.Context, secretID, login string) (*model.Secret, error) {
 	// Simulate fetching a secret based on the test scenario.
+	// Secrets "1" and "2" belong to "validLogin" and are shared with "recipient", see GetShare.
 	//nolint:gocritic
-	if secretID == "valid_id" {
+	if login == "recipient" {
+		return nil, constant.ErrNotFound
+	} else if secretID == "valid_id" || secretID == "1" || secretID == "2" {
 		secret := &model.Secret{
 			ID:             0,
 			Type:           "file",
@@ -118,6 +141,481 @@ func (mockStorage MockStorage) GetSecret(ctx context.Context, secretID, login st
 	}
 }
 
+//nolint:lll
+func (mockStorage MockStorage) GetRecentSecrets(ctx context.Context, login string, limit int) ([]*model.Secret, error) {
+	if login == "validLogin" {
+		secret := &model.Secret{ID: 1, Title: "recent"}
+		secret.SetEncryptor(mockEncryptor{})
+
+		return []*model.Secret{secret}, nil
+	}
+
+	return nil, errors.New("mockStorage: error")
+}
+
+func (mockStorage MockStorage) GetSecretsWithReminders(ctx context.Context) (map[string][]*model.Secret, error) {
+	return map[string][]*model.Secret{}, nil
+}
+
+func (mockStorage MockStorage) TouchSecret(ctx context.Context, secretID, login string) error {
+	return nil
+}
+
+//nolint:lll
+func (mockStorage MockStorage) SetSecretCompromised(ctx context.Context, secretID int64, compromised bool, login string) error {
+	if login == "validLogin" {
+		return nil
+	}
+
+	return errors.New("mock error")
+}
+
+//nolint:lll
+func (mockStorage MockStorage) SearchSecrets(ctx context.Context, tokens []string, login string) (map[int]*model.Secret, error) {
+	if login == "validLogin" {
+		secret := &model.Secret{ID: 1, Title: "github"}
+		secret.SetEncryptor(mockEncryptor{})
+
+		return map[int]*model.Secret{1: secret}, nil
+	}
+
+	return nil, errors.New("mockStorage: error")
+}
+
+func (mockStorage MockStorage) SetUserKeyPair(ctx context.Context, user *model.User) error {
+	return nil
+}
+
+//nolint:lll
+func (mockStorage MockStorage) UpdateSecretKey(ctx context.Context, secret *model.Secret, shares []*model.Share, login string) error {
+	if login == "validLogin" || login == "valid_user" {
+		return nil
+	}
+
+	return errors.New("mockStorage: error")
+}
+
+func (mockStorage MockStorage) SaveShare(ctx context.Context, share *model.Share, login string) error {
+	if login == "validLogin" {
+		return nil
+	}
+
+	return errors.New("mockStorage: error")
+}
+
+// GetShare - secret "1" is shared with "recipient" for editing, secret "2" is shared as read-only.
+// The key is sealed with the recipient's public key if the recipient is added to the storage.
+func (mockStorage MockStorage) GetShare(ctx context.Context, secretID, login string) (*model.Share, error) {
+	share := &model.Share{Owner: "validLogin", Recipient: login}
+
+	switch {
+	case login == "recipient" && secretID == "1":
+		share.Permission = model.PermissionEdit
+	case login == "recipient" && secretID == "2":
+		share.Permission = model.PermissionRead
+	default:
+		return nil, constant.ErrNotFound
+	}
+
+	if user, ok := mockStorage.users[login]; ok {
+		if err := share.SealKey("mock secret key", user.PublicKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return share, nil
+}
+
+//nolint:lll
+func (mockStorage MockStorage) GetSecretShares(ctx context.Context, secretID, login string) ([]*model.Share, error) {
+	if login == "validLogin" {
+		return []*model.Share{{Owner: login, Recipient: "recipient", Permission: model.PermissionRead}}, nil
+	}
+
+	return nil, errors.New("mockStorage: error")
+}
+
+func (mockStorage MockStorage) GetSharedSecrets(ctx context.Context, login string) ([]*model.Share, error) {
+	if login == "validLogin" {
+		return []*model.Share{}, nil
+	}
+
+	return nil, errors.New("mockStorage: error")
+}
+
+func (mockStorage MockStorage) DeleteShare(ctx context.Context, secretID, recipient, login string) error {
+	if recipient == "recipient" {
+		return nil
+	}
+
+	return constant.ErrNotFound
+}
+
+// mockTeamRoles - members of team 1, which owns vault 1. Team 2 and vault 2 always return a storage error.
+var mockTeamRoles = map[string]string{
+	"team_owner":  model.RoleOwner,
+	"team_admin":  model.RoleAdmin,
+	"team_member": model.RoleMember,
+	"team_reader": model.RoleReadOnly,
+}
+
+// mockVaultKey - key of vault 1, secrets of the vault are wrapped with this key
+const mockVaultKey = "mock vault key"
+
+func (mockStorage MockStorage) CreateTeam(ctx context.Context, team *model.Team, login string) error {
+	if login == "valid_user" {
+		return errors.New("mockStorage: error")
+	}
+
+	team.ID = 1
+	team.Role = model.RoleOwner
+
+	return nil
+}
+
+func (mockStorage MockStorage) GetTeams(ctx context.Context, login string) ([]*model.Team, error) {
+	if role, ok := mockTeamRoles[login]; ok {
+		return []*model.Team{{ID: 1, Name: "team", Role: role}}, nil
+	}
+
+	return []*model.Team{}, nil
+}
+
+//nolint:lll
+func (mockStorage MockStorage) GetTeamMember(ctx context.Context, teamID int64, login string) (*model.TeamMember, error) {
+	if teamID == 2 {
+		return nil, errors.New("mockStorage: error")
+	}
+
+	role, ok := mockTeamRoles[login]
+	if teamID != 1 || !ok {
+		return nil, constant.ErrNotFound
+	}
+
+	return &model.TeamMember{TeamID: teamID, Login: login, Role: role}, nil
+}
+
+func (mockStorage MockStorage) GetTeamMembers(ctx context.Context, teamID int64) ([]*model.TeamMember, error) {
+	if teamID != 1 {
+		return nil, errors.New("mockStorage: error")
+	}
+
+	members := make([]*model.TeamMember, 0, len(mockTeamRoles))
+	for login, role := range mockTeamRoles {
+		members = append(members, &model.TeamMember{TeamID: teamID, Login: login, Role: role})
+	}
+
+	return members, nil
+}
+
+//nolint:lll
+func (mockStorage MockStorage) AddTeamMember(ctx context.Context, member *model.TeamMember, keys []*model.VaultKey) error {
+	return nil
+}
+
+func (mockStorage MockStorage) UpdateTeamMember(ctx context.Context, member *model.TeamMember) error {
+	return nil
+}
+
+//nolint:lll
+func (mockStorage MockStorage) RemoveTeamMember(ctx context.Context, member *model.TeamMember, rotations []*model.VaultRotation) error {
+	// A secret is added to the vault while the keys of the admin are rotated
+	if member.Login == "team_admin" {
+		return constant.ErrConflict
+	}
+
+	return nil
+}
+
+func (mockStorage MockStorage) CreateVault(ctx context.Context, vault *model.Vault, keys []*model.VaultKey) error {
+	vault.ID = 1
+
+	return nil
+}
+
+func (mockStorage MockStorage) GetVaults(ctx context.Context, teamID int64) ([]*model.Vault, error) {
+	if teamID != 1 {
+		return nil, errors.New("mockStorage: error")
+	}
+
+	return []*model.Vault{{ID: 1, TeamID: 1, Name: "vault"}}, nil
+}
+
+// GetVaultAccess - vault key is sealed with the member's public key if the member is added to the storage
+//
+//nolint:lll
+func (mockStorage MockStorage) GetVaultAccess(ctx context.Context, vaultID int64, login string) (*model.VaultAccess, error) {
+	if vaultID == 2 {
+		return nil, errors.New("mockStorage: error")
+	}
+
+	role, ok := mockTeamRoles[login]
+	if vaultID != 1 || !ok {
+		return nil, constant.ErrNotFound
+	}
+
+	access := &model.VaultAccess{Vault: model.Vault{ID: vaultID, TeamID: 1, Name: "vault"}, Role: role}
+	if user, found := mockStorage.users[login]; found {
+		var err error
+		access.SealedKey, err = model.SealKey(mockVaultKey, user.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return access, nil
+}
+
+//nolint:lll
+func (mockStorage MockStorage) SaveVaultSecret(ctx context.Context, secret *model.Secret, vaultID int64) (*model.Secret, error) {
+	return secret, nil
+}
+
+func (mockStorage MockStorage) GetVaultSecrets(ctx context.Context, vaultID int64) (map[int]*model.Secret, error) {
+	secret, err := mockStorage.GetVaultSecret(ctx, vaultID, "1")
+	if err != nil {
+		return nil, err
+	}
+
+	return map[int]*model.Secret{1: secret}, nil
+}
+
+//nolint:lll
+func (mockStorage MockStorage) GetVaultSecret(ctx context.Context, vaultID int64, secretID string) (*model.Secret, error) {
+	if secretID != "1" {
+		return nil, constant.ErrNotFound
+	}
+
+	secret := &model.Secret{ID: 1, Title: "vault secret"}
+	secret.SetEncryptor(mockEncryptor{})
+	if _, err := secret.GenerateKey(mockVaultKey); err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+func (mockStorage MockStorage) DeleteVaultSecret(ctx context.Context, vaultID int64, secretID string) error {
+	if secretID != "1" {
+		return constant.ErrNotFound
+	}
+
+	return nil
+}
+
+// mockSend - returns sends which are used by tests: "text_send" is available, "protected_send" requires
+// "passphrase" passphrase, "guessed_send" requires it too, but it's out of attempts to enter the passphrase,
+// "expired_send" cannot be viewed anymore. Other sends don't exist.
+func mockSend(id string) (*model.Send, error) {
+	send := &model.Send{ID: id, Type: model.SendTypeText, Payload: "Y2lwaGVydGV4dA==", MaxViews: 1}
+	send.ExpiresAt = time.Now().Add(time.Hour)
+
+	switch id {
+	case "text_send":
+	case "protected_send", "guessed_send":
+		if err := send.SetPassword("passphrase"); err != nil {
+			return nil, err
+		}
+	case "expired_send":
+		send.ExpiresAt = time.Now().Add(-time.Hour)
+	default:
+		return nil, constant.ErrNotFound
+	}
+
+	return send, nil
+}
+
+func (mockStorage MockStorage) SaveSend(ctx context.Context, send *model.Send, login string) error {
+	if login == "valid_user" {
+		return errors.New("mockStorage: error")
+	}
+
+	return nil
+}
+
+func (mockStorage MockStorage) GetSends(ctx context.Context, login string) ([]*model.Send, error) {
+	if login == "validLogin" {
+		return []*model.Send{}, nil
+	}
+
+	return nil, errors.New("mockStorage: error")
+}
+
+func (mockStorage MockStorage) GetSend(ctx context.Context, id string) (*model.Send, error) {
+	return mockSend(id)
+}
+
+func (mockStorage MockStorage) ConsumeSend(ctx context.Context, id string) (*model.Send, error) {
+	send, err := mockSend(id)
+	if err != nil {
+		return nil, err
+	}
+
+	send.ViewCount++
+
+	return send, nil
+}
+
+func (mockStorage MockStorage) AttemptSendPassword(ctx context.Context, id string, maxFailures int) (int, error) {
+	if id == "guessed_send" {
+		return 0, constant.ErrNotFound
+	}
+
+	return 1, nil
+}
+
+func (mockStorage MockStorage) DestroySend(ctx context.Context, id string) error {
+	return nil
+}
+
+func (mockStorage MockStorage) DeleteSend(ctx context.Context, id, login string) error {
+	if id == "text_send" && login == "validLogin" {
+		return nil
+	}
+
+	return constant.ErrNotFound
+}
+
+func (mockStorage MockStorage) DeleteExpiredSends(ctx context.Context, now time.Time) (int64, error) {
+	return 0, nil
+}
+
+// mockEmergencyAccess - "validLogin" designated "grantee" as an emergency contact. Record 1 is invited,
+// 2 is accepted, 3 is waiting for approval and 4 is approved. Record 5 always returns a storage error.
+func (mockStorage MockStorage) mockEmergencyAccess(id int64) (*model.EmergencyAccess, error) {
+	states := map[int64]string{
+		1: emergency.StateInvited,
+		2: emergency.StateAccepted,
+		3: emergency.StateRecoveryRequested,
+		4: emergency.StateRecoveryApproved,
+	}
+
+	if id == 5 {
+		return nil, errors.New("mockStorage: error")
+	}
+
+	state, ok := states[id]
+	if !ok {
+		return nil, constant.ErrNotFound
+	}
+
+	access := &model.EmergencyAccess{ID: id, Grantor: "validLogin", Grantee: "grantee", State: state, WaitDays: 7}
+	if user, found := mockStorage.users[access.Grantee]; found {
+		var err error
+		access.SealedKey, err = model.SealKey("mock data key", user.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return access, nil
+}
+
+func (mockStorage MockStorage) SaveEmergencyAccess(ctx context.Context, access *model.EmergencyAccess) error {
+	if access.Grantee == "grantee" {
+		return constant.ErrDuplicateRecord
+	}
+
+	access.ID = 1
+
+	return nil
+}
+
+//nolint:lll
+func (mockStorage MockStorage) GetEmergencyAccess(ctx context.Context, id int64, login string) (*model.EmergencyAccess, error) {
+	access, err := mockStorage.mockEmergencyAccess(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if login != access.Grantor && login != access.Grantee {
+		return nil, constant.ErrNotFound
+	}
+
+	return access, nil
+}
+
+//nolint:lll
+func (mockStorage MockStorage) GetEmergencyAccessList(ctx context.Context, login string) ([]*model.EmergencyAccess, error) {
+	if login == "valid_user" {
+		return nil, errors.New("mockStorage: error")
+	}
+
+	return []*model.EmergencyAccess{}, nil
+}
+
+//nolint:lll
+func (mockStorage MockStorage) GetEmergencyAccessByState(ctx context.Context, state string) ([]*model.EmergencyAccess, error) {
+	return []*model.EmergencyAccess{}, nil
+}
+
+//nolint:lll
+func (mockStorage MockStorage) UpdateEmergencyAccess(ctx context.Context, access *model.EmergencyAccess, fromState string) error {
+	return nil
+}
+
+func (mockStorage MockStorage) DeleteEmergencyAccess(ctx context.Context, id int64, login string) error {
+	_, err := mockStorage.GetEmergencyAccess(ctx, id, login)
+
+	return err
+}
+
+func (mockStorage MockStorage) AddAuditEvent(ctx context.Context, event *model.AuditEvent) error {
+	return nil
+}
+
+func (mockStorage MockStorage) GetLastAuditEvent(ctx context.Context) (*model.AuditEvent, error) {
+	return nil, constant.ErrNotFound
+}
+
+//nolint:lll
+func (mockStorage MockStorage) GetAuditEvents(ctx context.Context, login string, filter model.AuditFilter) ([]*model.AuditEvent, error) {
+	switch login {
+	case "validLogin":
+		events := []*model.AuditEvent{
+			{ID: 2, Type: "secret_read", Login: login, SecretID: "1"},
+			{ID: 1, Type: "login_success", Login: login},
+		}
+
+		filtered := make([]*model.AuditEvent, 0, len(events))
+		for _, event := range events {
+			if (filter.Type == "" || event.Type == filter.Type) && (filter.Before == 0 || event.ID < filter.Before) {
+				filtered = append(filtered, event)
+			}
+		}
+
+		return filtered, nil
+	default:
+		return nil, errors.New("storage error")
+	}
+}
+
+func (mockStorage MockStorage) WalkAuditEvents(ctx context.Context, fn func(event *model.AuditEvent) error) error {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (mockStorage MockStorage) GetLoginAttempts(ctx context.Context, key string) (*model.LoginAttempts, error) {
+	return nil, constant.ErrNotFound
+}
+
+func (mockStorage MockStorage) SaveLoginAttempts(ctx context.Context, attempts *model.LoginAttempts) error {
+	return nil
+}
+
+func (mockStorage MockStorage) DeleteLoginAttempts(ctx context.Context, key string) error {
+	return nil
+}
+
+func (mockStorage MockStorage) DeleteStaleLoginAttempts(ctx context.Context, before, now time.Time) error {
+	return nil
+}
+
+func (mockStorage MockStorage) Backup(ctx context.Context, path string) error {
+	// TODO implement me
+	panic("implement me")
+}
+
 func (mockStorage MockStorage) Close() error {
 	// TODO implement me
 	panic("implement me")
@@ -147,6 +645,249 @@ func (mockStorage MockStorage) GetUser(ctx context.Context, login string) (*mode
 	return nil, constant.ErrNotFound
 }
 
+func (mockStorage MockStorage) UpdateUserPassword(ctx context.Context, user *model.User) error {
+	if _, ok := mockStorage.users[user.Login]; !ok {
+		return constant.ErrNotFound
+	}
+
+	mockStorage.users[user.Login] = user
+
+	return nil
+}
+
+func (mockStorage MockStorage) GetUsers(ctx context.Context) ([]*model.UserSummary, error) {
+	result := make([]*model.UserSummary, 0, len(mockStorage.users))
+	for _, user := range mockStorage.users {
+		result = append(result, &model.UserSummary{
+			ID:       user.ID,
+			Login:    user.Login,
+			Role:     user.Role,
+			Disabled: user.Disabled,
+			External: user.HashedPassword == "",
+		})
+	}
+
+	return result, nil
+}
+
+func (mockStorage MockStorage) SetUserRole(ctx context.Context, login, role string) error {
+	user, ok := mockStorage.users[login]
+	if !ok {
+		return constant.ErrNotFound
+	}
+
+	user.Role = role
+
+	return nil
+}
+
+func (mockStorage MockStorage) SetUserDisabled(ctx context.Context, login string, disabled bool) error {
+	user, ok := mockStorage.users[login]
+	if !ok {
+		return constant.ErrNotFound
+	}
+
+	user.Disabled = disabled
+
+	return nil
+}
+
+func (mockStorage MockStorage) RevokeUserSessions(ctx context.Context, login string, revokedAt time.Time) error {
+	user, ok := mockStorage.users[login]
+	if !ok {
+		return constant.ErrNotFound
+	}
+
+	user.SessionsRevokedAt = &revokedAt
+	for id, apiToken := range mockStorage.apiTokens {
+		if apiToken.Login == login {
+			delete(mockStorage.apiTokens, id)
+		}
+	}
+
+	return nil
+}
+
+func (mockStorage MockStorage) GetStorageUsage(ctx context.Context) (*model.StorageUsage, error) {
+	return &model.StorageUsage{Users: len(mockStorage.users)}, nil
+}
+
+func (mockStorage MockStorage) GetServerSettings(ctx context.Context) (*model.ServerSettings, error) {
+	settings := model.DefaultServerSettings()
+	if mockStorage.settings != nil {
+		settings = *mockStorage.settings
+	}
+
+	return &settings, nil
+}
+
+func (mockStorage MockStorage) SaveServerSettings(ctx context.Context, settings *model.ServerSettings) error {
+	if mockStorage.settings == nil {
+		return errors.New("mock settings are not set")
+	}
+
+	*mockStorage.settings = *settings
+
+	return nil
+}
+
+func (mockStorage MockStorage) AddExternalUser(ctx context.Context, user *model.User, identity *model.Identity) error {
+	if _, err := mockStorage.AddUser(ctx, user); err != nil {
+		return err
+	}
+
+	mockStorage.identities[[2]string{identity.Issuer, identity.Subject}] = user.Login
+	identity.Login = user.Login
+
+	return nil
+}
+
+func (mockStorage MockStorage) GetUserByIdentity(ctx context.Context, issuer, subject string) (*model.User, error) {
+	login, ok := mockStorage.identities[[2]string{issuer, subject}]
+	if !ok {
+		return nil, constant.ErrNotFound
+	}
+
+	return mockStorage.GetUser(ctx, login)
+}
+
+func (mockStorage MockStorage) SetUserDataKey(ctx context.Context, user *model.User) error {
+	if _, ok := mockStorage.users[user.Login]; !ok {
+		return constant.ErrNotFound
+	}
+
+	mockStorage.users[user.Login] = user
+
+	return nil
+}
+
+func (mockStorage MockStorage) AddWebAuthnCredential(ctx context.Context, credential *model.WebAuthnCredential) error {
+	if _, ok := mockStorage.credentials[credential.ID]; ok {
+		return constant.ErrDuplicateRecord
+	}
+
+	credential.CreatedAt = time.Now()
+	mockStorage.credentials[credential.ID] = *credential
+
+	return nil
+}
+
+//nolint:lll
+func (mockStorage MockStorage) GetWebAuthnCredentials(ctx context.Context, login string) ([]*model.WebAuthnCredential, error) {
+	result := make([]*model.WebAuthnCredential, 0)
+	for _, credential := range mockStorage.credentials {
+		if credential.Login == login {
+			credential := credential
+			result = append(result, &credential)
+		}
+	}
+
+	return result, nil
+}
+
+//nolint:lll
+func (mockStorage MockStorage) GetWebAuthnCredential(ctx context.Context, id string) (*model.WebAuthnCredential, error) {
+	credential, ok := mockStorage.credentials[id]
+	if !ok {
+		return nil, constant.ErrNotFound
+	}
+
+	credential.Passwordless = credential.DataKey != ""
+
+	return &credential, nil
+}
+
+func (mockStorage MockStorage) UpdateWebAuthnCredential(
+	ctx context.Context,
+	credential *model.WebAuthnCredential,
+	previousSignCount uint32,
+) error {
+	saved, ok := mockStorage.credentials[credential.ID]
+	if !ok || saved.SignCount != previousSignCount {
+		return constant.ErrNotFound
+	}
+
+	now := time.Now()
+	saved.SignCount = credential.SignCount
+	saved.DataKey = credential.DataKey
+	saved.LastUsedAt = &now
+	mockStorage.credentials[credential.ID] = saved
+	credential.LastUsedAt = &now
+
+	return nil
+}
+
+func (mockStorage MockStorage) DeleteWebAuthnCredential(ctx context.Context, id, login string) error {
+	credential, ok := mockStorage.credentials[id]
+	if !ok || credential.Login != login {
+		return constant.ErrNotFound
+	}
+
+	delete(mockStorage.credentials, id)
+
+	return nil
+}
+
+func (mockStorage MockStorage) AddAPIToken(ctx context.Context, token *model.APIToken) error {
+	token.ID = 1
+	for id := range mockStorage.apiTokens {
+		if id >= token.ID {
+			token.ID = id + 1
+		}
+	}
+
+	token.CreatedAt = time.Now()
+	mockStorage.apiTokens[token.ID] = *token
+
+	return nil
+}
+
+func (mockStorage MockStorage) GetAPITokens(ctx context.Context, login string) ([]*model.APIToken, error) {
+	result := make([]*model.APIToken, 0)
+	for _, token := range mockStorage.apiTokens {
+		if token.Login == login {
+			token := token
+			result = append(result, &token)
+		}
+	}
+
+	return result, nil
+}
+
+func (mockStorage MockStorage) GetAPITokenByHash(ctx context.Context, hash string) (*model.APIToken, error) {
+	for _, token := range mockStorage.apiTokens {
+		if token.Hash == hash {
+			return &token, nil
+		}
+	}
+
+	return nil, constant.ErrNotFound
+}
+
+func (mockStorage MockStorage) TouchAPIToken(ctx context.Context, id int64) error {
+	token, ok := mockStorage.apiTokens[id]
+	if !ok {
+		return constant.ErrNotFound
+	}
+
+	now := time.Now()
+	token.LastUsedAt = &now
+	mockStorage.apiTokens[id] = token
+
+	return nil
+}
+
+func (mockStorage MockStorage) DeleteAPIToken(ctx context.Context, id int64, login string) error {
+	token, ok := mockStorage.apiTokens[id]
+	if !ok || token.Login != login {
+		return constant.ErrNotFound
+	}
+
+	delete(mockStorage.apiTokens, id)
+
+	return nil
+}
+
 type MockUser struct{}
 
 func (u *MockUser) GetDataKey(password string) (string, error) {
@@ -160,6 +901,8 @@ type MockKeyCache struct {
 	getCalled      bool
 	getLogin       string
 	getReturnValue string
+	// keys - data keys of particular users, getReturnValue is returned for other users
+	keys map[string]string
 }
 
 func (kc *MockKeyCache) Set(login, secret string) {
@@ -175,9 +918,17 @@ func (kc *MockKeyCache) Get(login string) (string, error) {
 
 	kc.getCalled = true
 	kc.getLogin = login
+	if key, ok := kc.keys[login]; ok {
+		return key, nil
+	}
+
 	return kc.getReturnValue, nil
 }
 
+func (kc *MockKeyCache) Delete(login string) {
+	delete(kc.keys, login)
+}
+
 type MockAuthUtils struct {
 	generateTokenPairCalled bool
 	generateTokenPairUser   *auth.JWTUser
@@ -204,3 +955,79 @@ func (au *MockAuthUtils) GetRefreshCookie(token string) *http.Cookie {
 	au.getRefreshCookieToken = token
 	return au.getRefreshCookieReturn
 }
+
+func (au *MockAuthUtils) GetExpiredRefreshCookie() *http.Cookie {
+	return &http.Cookie{Name: auth.CookieName, MaxAge: -1}
+}
+
+type mockBreachChecker struct{}
+
+func (mockBreachChecker) IsCompromised(password string) (bool, error) {
+	switch password {
+	case "password":
+		return true, nil
+	case "corpus_error":
+		return false, errors.New("mock error")
+	default:
+		return false, nil
+	}
+}
+
+// mockAuditLog - collects recorded events
+type mockAuditLog struct {
+	events []*model.AuditEvent
+}
+
+func (m *mockAuditLog) Record(ctx context.Context, event *model.AuditEvent) error {
+	m.events = append(m.events, event)
+
+	return nil
+}
+
+func (m *mockAuditLog) types() []string {
+	types := make([]string, 0, len(m.events))
+	for _, event := range m.events {
+		types = append(types, event.Type)
+	}
+
+	return types
+}
+
+// mockSecondFactor - users don't have security keys
+type mockSecondFactor struct{}
+
+func (mockSecondFactor) RequireSecondFactor(w http.ResponseWriter, r *http.Request, login, dataKey string) bool {
+	return false
+}
+
+// newTestLoginThrottler - throttler with default policies, which keeps attempts in memory
+func newTestLoginThrottler() *throttle.Throttler {
+	return throttle.NewThrottler(throttle.NewMemoryStore(), throttle.DefaultLoginPolicy, throttle.DefaultIPPolicy)
+}
+
+func newTestServices(t *testing.T, appConfig config.AppConfig) Services {
+	t.Helper()
+
+	services, err := NewServices(appConfig)
+	require.NoError(t, err)
+
+	return services
+}
+
+func newTestKeys(t *testing.T, appConfig config.AppConfig) *auth.KeySet {
+	t.Helper()
+
+	keys, err := auth.LoadKeySet(appConfig)
+	require.NoError(t, err)
+
+	return keys
+}
+
+func newTestPolicy(t *testing.T, appConfig config.AppConfig) *policy.Policy {
+	t.Helper()
+
+	passwordPolicy, err := policy.New(appConfig)
+	require.NoError(t, err)
+
+	return passwordPolicy
+}
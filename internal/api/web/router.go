@@ -5,48 +5,200 @@ import (
 	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 
+	"github.com/grafviktor/keep-my-secret/internal/api/auth"
 	kmsMiddleware "github.com/grafviktor/keep-my-secret/internal/api/web/middleware"
 
+	"github.com/grafviktor/keep-my-secret/internal/audit"
 	"github.com/grafviktor/keep-my-secret/internal/config"
 	"github.com/grafviktor/keep-my-secret/internal/storage"
 )
 
 // NewHTTPRouter - main HTTP router of the application. Creates routes and enables middlewares.
-func NewHTTPRouter(appConfig config.AppConfig, storage storage.Storage) *chi.Mux {
+func NewHTTPRouter(appConfig config.AppConfig, storage storage.Storage, services Services) *chi.Mux {
 	router := chi.NewRouter()
 	if true {
 		router.Use(chiMiddleware.Recoverer)
 		router.Use(chiMiddleware.Logger)
 	}
 
-	m := kmsMiddleware.New(appConfig)
+	// Events are chained, so all handlers must share the same audit logger
+	auditLog := audit.NewLogger(storage)
+	// Wrong passwords are counted together, wherever they are entered
+	loginThrottler := newLoginThrottler(appConfig, storage)
+	// API tokens are verified against the route of the request, so the handler needs the router
+	tokenHandler := newTokenHandlerProvider(appConfig, storage, auditLog, loginThrottler, router)
+	adminHandler := newAdminHandlerProvider(appConfig, storage, auditLog)
+	m := kmsMiddleware.New(
+		appConfig, auth.JWTVerifier{Keys: services.Keys}, services.RateLimits, &tokenHandler, &adminHandler,
+	)
 
 	router.Route("/api/v1", func(apiRouter chi.Router) {
 		apiRouter.Use(m.EnableCORS)
 
 		apiRouter.Route("/user", func(userRouter chi.Router) {
-			apiHandler := newUserHandlerProvider(appConfig, storage)
+			userRouter.Use(m.RateLimit("user"))
+			webauthnHandler := newWebAuthnHandlerProvider(
+				appConfig, storage, auditLog, loginThrottler, services.Keys, services.RelyingParty,
+			)
+			apiHandler := newUserHandlerProvider(
+				appConfig, storage, auditLog, loginThrottler, &webauthnHandler, services.PasswordPolicy, services.Keys,
+			)
+			oidcHandler := newOIDCHandlerProvider(
+				appConfig, storage, auditLog, loginThrottler, &webauthnHandler,
+				services.PasswordPolicy, services.Keys, services.IdentityProvider,
+			)
 
 			userRouter.Post("/register", apiHandler.RegisterHandler)
 			userRouter.Post("/login", apiHandler.LoginHandler)
 			userRouter.Post("/logout", apiHandler.LogoutHandler)
 			userRouter.Get("/token-refresh", apiHandler.RefreshTokenHandler)
+			userRouter.With(m.AuthRequired).Post("/password", apiHandler.ChangePasswordHandler)
+
+			userRouter.Route("/tokens", func(tokensRouter chi.Router) {
+				tokensRouter.Use(m.AuthRequired)
+
+				tokensRouter.Get("/", tokenHandler.ListTokensHandler)
+				tokensRouter.Post("/", tokenHandler.CreateTokenHandler)
+				tokensRouter.Delete("/{id}", tokenHandler.DeleteTokenHandler)
+			})
+
+			userRouter.Route("/oidc", func(oidcRouter chi.Router) {
+				oidcRouter.Get("/login", oidcHandler.LoginHandler)
+				oidcRouter.Get("/callback", oidcHandler.CallbackHandler)
+				oidcRouter.With(m.AuthRequired).Post("/master-password", oidcHandler.MasterPasswordHandler)
+				oidcRouter.With(m.AuthRequired).Post("/unlock", oidcHandler.UnlockHandler)
+			})
+
+			userRouter.Route("/webauthn", func(webauthnRouter chi.Router) {
+				webauthnRouter.Post("/login/begin", webauthnHandler.BeginLoginHandler)
+				webauthnRouter.Post("/login/finish", webauthnHandler.FinishLoginHandler)
+				webauthnRouter.Post("/second-factor", webauthnHandler.SecondFactorHandler)
+
+				webauthnRouter.Group(func(authRouter chi.Router) {
+					authRouter.Use(m.AuthRequired)
+
+					authRouter.Post("/register/begin", webauthnHandler.BeginRegistrationHandler)
+					authRouter.Post("/register/finish", webauthnHandler.FinishRegistrationHandler)
+					authRouter.Get("/credentials", webauthnHandler.ListCredentialsHandler)
+					authRouter.Delete("/credentials/{id}", webauthnHandler.DeleteCredentialHandler)
+				})
+			})
 		})
 
+		secretHandler := newSecretHandlerProvider(appConfig, storage, auditLog, services.PasswordPolicy)
+
 		apiRouter.Route("/secrets", func(secretsRouter chi.Router) {
-			secretsRouter.Use(m.AuthRequired)
-			apiHandler := newSecretHandlerProvider(appConfig, storage)
+			secretsRouter.Use(m.AuthRequired, m.RateLimit("secrets"))
+
+			secretsRouter.Get("/", secretHandler.ListSecretsHandler)
+			secretsRouter.Get("/search", secretHandler.SearchSecretsHandler)
+			secretsRouter.Get("/recent", secretHandler.RecentSecretsHandler)
+			secretsRouter.Get("/due", secretHandler.DueSecretsHandler)
+			secretsRouter.Get("/health", secretHandler.VaultHealthHandler)
+			secretsRouter.Get("/shared", secretHandler.SharedSecretsHandler)
+			secretsRouter.Get("/{id}", secretHandler.GetSecretHandler)
+			secretsRouter.Post("/", secretHandler.SaveSecretHandler)
+			secretsRouter.Put("/{id}", secretHandler.SaveSecretHandler)
+			secretsRouter.Delete("/{id}", secretHandler.DeleteSecretHandler)
+			secretsRouter.Get("/file/{id}", secretHandler.DownloadSecretFileHandler)
+			secretsRouter.Get("/{id}/shares", secretHandler.ListSecretSharesHandler)
+			secretsRouter.Post("/{id}/shares", secretHandler.ShareSecretHandler)
+			secretsRouter.Delete("/{id}/shares/{login}", secretHandler.RevokeShareHandler)
+			secretsRouter.Post("/{id}/rotate-key", secretHandler.RotateSecretKeyHandler)
+		})
 
-			secretsRouter.Get("/", apiHandler.ListSecretsHandler)
-			secretsRouter.Post("/", apiHandler.SaveSecretHandler)
-			secretsRouter.Put("/{id}", apiHandler.SaveSecretHandler)
-			secretsRouter.Delete("/{id}", apiHandler.DeleteSecretHandler)
-			secretsRouter.Get("/file/{id}", apiHandler.DownloadSecretFileHandler)
+		apiRouter.Route("/vault", func(vaultRouter chi.Router) {
+			vaultRouter.Use(m.AuthRequired, m.RateLimit("vault"))
+
+			vaultRouter.Get("/export", secretHandler.ExportVaultHandler)
+			vaultRouter.Get("/export/kdbx", secretHandler.ExportKeePassHandler)
+			vaultRouter.Post("/import", secretHandler.ImportVaultHandler)
+			vaultRouter.Post("/import/{format}", secretHandler.ImportFormatHandler)
+		})
+
+		apiRouter.Route("/teams", func(teamsRouter chi.Router) {
+			teamsRouter.Use(m.AuthRequired, m.RateLimit("teams"))
+
+			teamsRouter.Get("/", secretHandler.ListTeamsHandler)
+			teamsRouter.Post("/", secretHandler.CreateTeamHandler)
+			teamsRouter.Get("/{id}/members", secretHandler.ListTeamMembersHandler)
+			teamsRouter.Post("/{id}/members", secretHandler.AddTeamMemberHandler)
+			teamsRouter.Put("/{id}/members/{login}", secretHandler.UpdateTeamMemberHandler)
+			teamsRouter.Delete("/{id}/members/{login}", secretHandler.RemoveTeamMemberHandler)
+			teamsRouter.Get("/{id}/vaults", secretHandler.ListVaultsHandler)
+			teamsRouter.Post("/{id}/vaults", secretHandler.CreateVaultHandler)
+		})
+
+		apiRouter.Route("/vaults", func(vaultsRouter chi.Router) {
+			vaultsRouter.Use(m.AuthRequired, m.RateLimit("vaults"))
+
+			vaultsRouter.Get("/{id}/secrets", secretHandler.ListVaultSecretsHandler)
+			vaultsRouter.Get("/{id}/secrets/{secretID}", secretHandler.GetVaultSecretHandler)
+			vaultsRouter.Post("/{id}/secrets", secretHandler.SaveVaultSecretHandler)
+			vaultsRouter.Put("/{id}/secrets/{secretID}", secretHandler.SaveVaultSecretHandler)
+			vaultsRouter.Delete("/{id}/secrets/{secretID}", secretHandler.DeleteVaultSecretHandler)
+		})
+
+		apiRouter.Route("/sends", func(sendsRouter chi.Router) {
+			// Anyone who knows the link can receive a send, authentication is not required
+			sendsRouter.With(m.RateLimit("sends")).Get("/{id}", secretHandler.ReceiveSendHandler)
+
+			sendsRouter.Group(func(authRouter chi.Router) {
+				authRouter.Use(m.AuthRequired, m.RateLimit("sends"))
+
+				authRouter.Get("/", secretHandler.ListSendsHandler)
+				authRouter.Post("/", secretHandler.CreateSendHandler)
+				authRouter.Delete("/{id}", secretHandler.DeleteSendHandler)
+			})
+		})
+
+		apiRouter.Route("/emergency", func(emergencyRouter chi.Router) {
+			emergencyRouter.Use(m.AuthRequired, m.RateLimit("emergency"))
+
+			emergencyRouter.Get("/", secretHandler.ListEmergencyAccessHandler)
+			emergencyRouter.Post("/", secretHandler.InviteEmergencyContactHandler)
+			emergencyRouter.Delete("/{id}", secretHandler.RevokeEmergencyAccessHandler)
+			emergencyRouter.Post("/{id}/accept", secretHandler.AcceptEmergencyInviteHandler)
+			emergencyRouter.Post("/{id}/request", secretHandler.RequestEmergencyAccessHandler)
+			emergencyRouter.Post("/{id}/approve", secretHandler.ApproveEmergencyAccessHandler)
+			emergencyRouter.Post("/{id}/reject", secretHandler.RejectEmergencyAccessHandler)
+			emergencyRouter.Get("/{id}/secrets", secretHandler.EmergencySecretsHandler)
+		})
+
+		apiRouter.Route("/audit", func(auditRouter chi.Router) {
+			auditRouter.Use(m.AuthRequired, m.RateLimit("audit"))
+
+			auditRouter.Get("/", secretHandler.ListAuditEventsHandler)
+		})
+
+		apiRouter.Route("/admin", func(adminRouter chi.Router) {
+			adminRouter.Use(m.AuthRequired, m.AdminRequired, m.RateLimit("admin"))
+
+			adminRouter.Get("/users", adminHandler.ListUsersHandler)
+			adminRouter.Post("/users/{login}/disable", adminHandler.DisableUserHandler)
+			adminRouter.Post("/users/{login}/enable", adminHandler.EnableUserHandler)
+			adminRouter.Post("/users/{login}/logout", adminHandler.LogoutUserHandler)
+			adminRouter.Get("/usage", adminHandler.StorageUsageHandler)
+			adminRouter.Get("/settings", adminHandler.GetSettingsHandler)
+			adminRouter.Put("/settings", adminHandler.UpdateSettingsHandler)
+		})
+
+		apiRouter.Route("/tools", func(toolsRouter chi.Router) {
+			toolsRouter.Use(m.AuthRequired, m.RateLimit("tools"))
+
+			toolsRouter.Post("/password", PasswordGeneratorHandler)
 		})
 
 		apiRouter.Get("/version", VersionHandler)
 	})
 
+	router.Route("/.well-known", func(wellKnownRouter chi.Router) {
+		wellKnownHandler := newWellKnownHandlerProvider(appConfig, services.Keys)
+
+		wellKnownRouter.Get("/jwks.json", wellKnownHandler.JWKSHandler)
+		wellKnownRouter.Get("/openid-configuration", wellKnownHandler.DiscoveryHandler)
+	})
+
 	registerStaticHandler(appConfig, router)
 
 	return router
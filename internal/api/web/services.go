@@ -0,0 +1,63 @@
+package web
+
+import (
+	"errors"
+
+	"github.com/grafviktor/keep-my-secret/internal/api/auth"
+	kmsMiddleware "github.com/grafviktor/keep-my-secret/internal/api/web/middleware"
+
+	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/oidc"
+	"github.com/grafviktor/keep-my-secret/internal/policy"
+	"github.com/grafviktor/keep-my-secret/internal/webauthn"
+)
+
+// Services - parts of the application which are built of the configuration once, when the application starts,
+// and are shared by the middlewares and handlers
+type Services struct {
+	RateLimits map[string]*kmsMiddleware.RateLimit
+	// PasswordPolicy is applied to passwords of accounts and archives
+	PasswordPolicy *policy.Policy
+	// Keys sign and verify tokens
+	Keys *auth.KeySet
+	// IdentityProvider is nil if sign in with OpenID Connect is not configured
+	IdentityProvider *oidc.Provider
+	// RelyingParty is nil if WebAuthn is not configured
+	RelyingParty *webauthn.RelyingParty
+}
+
+// NewServices - builds services of the application configuration, returns an error if the configuration is invalid
+func NewServices(appConfig config.AppConfig) (Services, error) {
+	rateLimits, err := kmsMiddleware.ParseRateLimits(appConfig.RateLimits)
+	if err != nil {
+		return Services{}, err
+	}
+
+	passwordPolicy, err := policy.New(appConfig)
+	if err != nil {
+		return Services{}, err
+	}
+
+	keys, err := auth.LoadKeySet(appConfig)
+	if err != nil {
+		return Services{}, err
+	}
+
+	identityProvider, err := oidc.New(appConfig)
+	if err != nil && !errors.Is(err, oidc.ErrNotConfigured) {
+		return Services{}, err
+	}
+
+	relyingParty, err := webauthn.New(appConfig)
+	if err != nil && !errors.Is(err, webauthn.ErrNotConfigured) {
+		return Services{}, err
+	}
+
+	return Services{
+		RateLimits:       rateLimits,
+		PasswordPolicy:   passwordPolicy,
+		Keys:             keys,
+		IdentityProvider: identityProvider,
+		RelyingParty:     relyingParty,
+	}, nil
+}
@@ -0,0 +1,159 @@
+// Package audit records security events into a tamper-evident log. Every event contains the hash
+// of the previous event and its own hash, which covers all its fields and the previous hash. If an event
+// is modified or removed from the middle of the log, the hashes don't match anymore, and Verify reports it.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// Types of audit events
+const (
+	EventLoginSuccess   = "login_success"
+	EventLoginFailure   = "login_failure"
+	EventLoginThrottled = "login_throttled"
+	EventRegister       = "register"
+	EventTokenRefresh   = "token_refresh"
+	EventPasswordChange = "password_change"
+	// EventMasterPasswordSet - a user of an identity provider has created the data key
+	EventMasterPasswordSet  = "master_password_set"
+	EventVaultUnlock        = "vault_unlock"
+	EventVaultUnlockFailure = "vault_unlock_failure"
+	EventSecretCreate       = "secret_create"
+	EventSecretRead         = "secret_read"
+	EventSecretUpdate       = "secret_update"
+	EventSecretDelete       = "secret_delete"
+	EventSecretDownload     = "secret_download"
+
+	// EventSecondFactorFailure - the password was correct, but the login wasn't confirmed with a security key
+	EventSecondFactorFailure = "second_factor_failure"
+	EventWebAuthnRegister    = "webauthn_register"
+	EventWebAuthnRemove      = "webauthn_remove"
+	EventAPITokenCreate      = "api_token_create"
+	EventAPITokenRevoke      = "api_token_revoke"
+
+	// Events of server administration. Events which change an account are recorded with the login of the account.
+	EventUserDisable    = "user_disable"
+	EventUserEnable     = "user_enable"
+	EventUserLogout     = "user_logout"
+	EventSettingsUpdate = "settings_update"
+)
+
+// maxUserAgentLength - user agent is provided by the client, so its length is limited
+const maxUserAgentLength = 256
+
+// ErrChainBroken - an event doesn't match its hash, or doesn't refer to the previous event
+var ErrChainBroken = errors.New("audit log chain is broken")
+
+// Store - storage of audit events
+type Store interface {
+	GetLastAuditEvent(ctx context.Context) (*model.AuditEvent, error)
+	AddAuditEvent(ctx context.Context, event *model.AuditEvent) error
+}
+
+// Logger - appends events to the audit log. Events are appended one by one, because every event
+// depends on the previous one.
+type Logger struct {
+	mu    sync.Mutex
+	store Store
+	now   func() time.Time
+}
+
+// NewLogger - creates audit logger. The application must use a single logger for the store.
+func NewLogger(store Store) *Logger {
+	return &Logger{
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// Record - sets time and hashes of the event and appends it to the log
+func (l *Logger) Record(ctx context.Context, event *model.AuditEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	prevHash := ""
+	last, err := l.store.GetLastAuditEvent(ctx)
+	switch {
+	case err == nil:
+		prevHash = last.Hash
+	case !errors.Is(err, constant.ErrNotFound):
+		return err
+	}
+
+	if len(event.UserAgent) > maxUserAgentLength {
+		event.UserAgent = event.UserAgent[:maxUserAgentLength]
+	}
+
+	event.CreatedAt = l.now().UTC()
+	event.PrevHash = prevHash
+	event.Hash = Hash(event)
+
+	return l.store.AddAuditEvent(ctx, event)
+}
+
+// hashedEvent - fields of the event which are covered by the hash, in a fixed order
+type hashedEvent struct {
+	PrevHash   string `json:"prev_hash"`
+	Type       string `json:"type"`
+	Login      string `json:"login"`
+	SecretID   string `json:"secret_id"`
+	RemoteAddr string `json:"remote_addr"`
+	UserAgent  string `json:"user_agent"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// Hash - calculates the hash of the event, the event ID is not included because it's assigned by the storage
+func Hash(event *model.AuditEvent) string {
+	// Marshalling of a struct with string fields never fails
+	data, _ := json.Marshal(hashedEvent{
+		PrevHash:   event.PrevHash,
+		Type:       event.Type,
+		Login:      event.Login,
+		SecretID:   event.SecretID,
+		RemoteAddr: event.RemoteAddr,
+		UserAgent:  event.UserAgent,
+		CreatedAt:  event.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Walker - storage which can read all events in the order they were recorded
+type Walker interface {
+	WalkAuditEvents(ctx context.Context, fn func(event *model.AuditEvent) error) error
+}
+
+// Verify - checks the whole chain and returns the number of events. If the chain is broken, the error
+// refers to the first event which doesn't match.
+func Verify(ctx context.Context, walker Walker) (int, error) {
+	count := 0
+	prevHash := ""
+	err := walker.WalkAuditEvents(ctx, func(event *model.AuditEvent) error {
+		if event.PrevHash != prevHash {
+			return fmt.Errorf("%w: event %d doesn't refer to the previous event", ErrChainBroken, event.ID)
+		}
+
+		if Hash(event) != event.Hash {
+			return fmt.Errorf("%w: event %d was modified", ErrChainBroken, event.ID)
+		}
+
+		prevHash = event.Hash
+		count++
+
+		return nil
+	})
+
+	return count, err
+}
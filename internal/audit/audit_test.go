@@ -0,0 +1,186 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+type memoryStore struct {
+	mu     sync.Mutex
+	events []*model.AuditEvent
+}
+
+func (s *memoryStore) GetLastAuditEvent(ctx context.Context) (*model.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.events) == 0 {
+		return nil, constant.ErrNotFound
+	}
+
+	event := *s.events[len(s.events)-1]
+
+	return &event, nil
+}
+
+func (s *memoryStore) AddAuditEvent(ctx context.Context, event *model.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.events {
+		if e.PrevHash == event.PrevHash {
+			return constant.ErrDuplicateRecord
+		}
+	}
+
+	event.ID = int64(len(s.events) + 1)
+	copied := *event
+	s.events = append(s.events, &copied)
+
+	return nil
+}
+
+func (s *memoryStore) WalkAuditEvents(ctx context.Context, fn func(event *model.AuditEvent) error) error {
+	for _, event := range s.events {
+		copied := *event
+		if err := fn(&copied); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type failingStore struct{}
+
+func (failingStore) GetLastAuditEvent(ctx context.Context) (*model.AuditEvent, error) {
+	return nil, errors.New("database is locked")
+}
+
+func (failingStore) AddAuditEvent(ctx context.Context, event *model.AuditEvent) error {
+	return nil
+}
+
+func newTestLog(t *testing.T, count int) *memoryStore {
+	t.Helper()
+
+	store := &memoryStore{}
+	logger := NewLogger(store)
+	logger.now = func() time.Time {
+		return time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	for i := 0; i < count; i++ {
+		err := logger.Record(context.Background(), &model.AuditEvent{Type: EventSecretRead, Login: "user", SecretID: "1"})
+		require.NoError(t, err)
+	}
+
+	return store
+}
+
+func TestRecord(t *testing.T) {
+	store := newTestLog(t, 3)
+
+	require.Len(t, store.events, 3)
+	require.Empty(t, store.events[0].PrevHash)
+	for i, event := range store.events {
+		require.Equal(t, Hash(event), event.Hash)
+		if i > 0 {
+			require.Equal(t, store.events[i-1].Hash, event.PrevHash)
+		}
+	}
+
+	// Identical events get different hashes because they are chained
+	require.NotEqual(t, store.events[0].Hash, store.events[1].Hash)
+}
+
+func TestRecordTruncatesUserAgent(t *testing.T) {
+	store := &memoryStore{}
+	event := &model.AuditEvent{Type: EventLoginSuccess, Login: "user", UserAgent: strings.Repeat("a", 1000)}
+
+	require.NoError(t, NewLogger(store).Record(context.Background(), event))
+	require.Len(t, store.events[0].UserAgent, maxUserAgentLength)
+}
+
+func TestRecordStoreError(t *testing.T) {
+	err := NewLogger(failingStore{}).Record(context.Background(), &model.AuditEvent{Type: EventLoginSuccess})
+	require.Error(t, err)
+}
+
+func TestRecordConcurrently(t *testing.T) {
+	store := &memoryStore{}
+	logger := NewLogger(store)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, logger.Record(context.Background(), &model.AuditEvent{Type: EventLoginSuccess}))
+		}()
+	}
+	wg.Wait()
+
+	count, err := Verify(context.Background(), store)
+	require.NoError(t, err)
+	require.Equal(t, 20, count)
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(store *memoryStore)
+		wantErr bool
+	}{
+		{
+			name:   "intact log",
+			tamper: func(store *memoryStore) {},
+		},
+		{
+			name:   "empty log",
+			tamper: func(store *memoryStore) { store.events = nil },
+		},
+		{
+			name:    "modified event",
+			tamper:  func(store *memoryStore) { store.events[1].SecretID = "2" },
+			wantErr: true,
+		},
+		{
+			name:    "removed event",
+			tamper:  func(store *memoryStore) { store.events = append(store.events[:1], store.events[2:]...) },
+			wantErr: true,
+		},
+		{
+			name: "rehashed event",
+			tamper: func(store *memoryStore) {
+				store.events[0].Login = "someone else"
+				store.events[0].Hash = Hash(store.events[0])
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestLog(t, 3)
+			tt.tamper(store)
+
+			count, err := Verify(context.Background(), store)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrChainBroken)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, len(store.events), count)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+// Package backup creates verified copies of the application database and restores them.
+//
+// A backup is a file "kms-YYYYMMDD-HHMMSS.db" which is accompanied by "kms-YYYYMMDD-HHMMSS.db.sha256"
+// in the format of sha256sum utility. A backup is written to a temporary file first, and it appears
+// in the backup directory only after its integrity is checked and its checksum is saved.
+package backup
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/storage/sql"
+)
+
+const (
+	filePrefix     = "kms-"
+	fileExt        = ".db"
+	checksumExt    = ".sha256"
+	tempExt        = ".tmp"
+	timeLayout     = "20060102-150405"
+	restoredSuffix = ".before-restore-"
+)
+
+// journalSuffixes - files which SQLite keeps next to the database. They belong to the replaced
+// database and would damage the restored one, so they are moved away together with it.
+var journalSuffixes = []string{"-journal", "-wal", "-shm"}
+
+var (
+	ErrChecksumMismatch = errors.New("backup checksum doesn't match")
+	ErrChecksumMissing  = errors.New("backup checksum file is missing")
+	ErrSchemaMismatch   = errors.New("backup schema version doesn't match the application")
+)
+
+// Source - a database which can be copied while it's being used
+type Source interface {
+	Backup(ctx context.Context, path string) error
+}
+
+// Manager - creates backups in a directory and keeps only a limited number of the latest ones
+type Manager struct {
+	source Source
+	dir    string
+	keep   int
+	now    func() time.Time
+}
+
+// NewManager - creates a backup manager. If keep is zero or negative, old backups are never removed.
+func NewManager(source Source, dir string, keep int) *Manager {
+	return &Manager{
+		source: source,
+		dir:    dir,
+		keep:   keep,
+		now:    time.Now,
+	}
+}
+
+// Backup - creates a new backup, verifies it and removes the oldest backups. Returns path of the new backup.
+func (m *Manager) Backup(ctx context.Context) (string, error) {
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return "", err
+	}
+
+	name := filePrefix + m.now().UTC().Format(timeLayout) + fileExt
+	path := filepath.Join(m.dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("backup %s already exists", path)
+	}
+
+	// VACUUM INTO refuses to overwrite a file, which could be left by a failed backup
+	tempPath := path + tempExt
+	_ = os.Remove(tempPath)
+
+	err := m.source.Backup(ctx, tempPath)
+	if err == nil {
+		_, err = sql.InspectDatabase(ctx, tempPath)
+	}
+
+	var sum string
+	if err == nil {
+		sum, err = checksum(tempPath)
+	}
+
+	if err == nil {
+		err = os.Rename(tempPath, path)
+	}
+
+	if err != nil {
+		_ = os.Remove(tempPath)
+		return "", fmt.Errorf("cannot create backup: %w", err)
+	}
+
+	if err = writeChecksum(path, sum); err != nil {
+		_ = os.Remove(path)
+		return "", fmt.Errorf("cannot create backup: %w", err)
+	}
+
+	return path, m.rotate()
+}
+
+// Run - creates a backup, it is used as a scheduled job
+func (m *Manager) Run(ctx context.Context) error {
+	path, err := m.Backup(ctx)
+	if err == nil {
+		log.Printf("Database backup is saved to %s\n", path)
+	}
+
+	return err
+}
+
+// rotate - removes the oldest backups, so only the configured number of backups is kept
+func (m *Manager) rotate() error {
+	if m.keep <= 0 {
+		return nil
+	}
+
+	backups, err := List(m.dir)
+	if err != nil || len(backups) <= m.keep {
+		return err
+	}
+
+	for _, path := range backups[:len(backups)-m.keep] {
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+
+		if err = os.Remove(path + checksumExt); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// List - returns paths of backups in the directory, from the oldest to the newest
+func List(dir string) ([]string, error) {
+	backups, err := filepath.Glob(filepath.Join(dir, filePrefix+"*"+fileExt))
+	if err != nil {
+		return nil, err
+	}
+
+	// Names contain creation time, so alphabetical order is chronological
+	sort.Strings(backups)
+
+	return backups, nil
+}
+
+// Verify - checks the checksum and integrity of the backup and returns its schema version
+func Verify(ctx context.Context, path string) (int, error) {
+	expected, err := readChecksum(path)
+	if err != nil {
+		return 0, err
+	}
+
+	actual, err := checksum(path)
+	if err != nil {
+		return 0, err
+	}
+
+	if actual != expected {
+		return 0, ErrChecksumMismatch
+	}
+
+	return sql.InspectDatabase(ctx, path)
+}
+
+// Restore - replaces the database file with the backup. The server must be stopped during the restore.
+// The backup must have the same schema version as the application. The replaced database isn't removed,
+// it's renamed to "<database>.before-restore-YYYYMMDD-HHMMSS". Returns path of the replaced database,
+// or an empty string if there was no database.
+func Restore(ctx context.Context, backupPath, databasePath string) (string, error) {
+	version, err := Verify(ctx, backupPath)
+	if err != nil {
+		return "", err
+	}
+
+	if version != sql.SchemaVersion() {
+		return "", fmt.Errorf("%w: backup version is %d, application version is %d",
+			ErrSchemaMismatch, version, sql.SchemaVersion())
+	}
+
+	// The backup is copied next to the database first, so the database is replaced by an atomic rename
+	tempPath := databasePath + tempExt
+	if err = copyFile(backupPath, tempPath); err != nil {
+		_ = os.Remove(tempPath)
+		return "", err
+	}
+
+	replacedPath := ""
+	if _, err = os.Stat(databasePath); err == nil {
+		replacedPath = databasePath + restoredSuffix + time.Now().UTC().Format(timeLayout)
+		for _, suffix := range append([]string{""}, journalSuffixes...) {
+			err = os.Rename(databasePath+suffix, replacedPath+suffix)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				_ = os.Remove(tempPath)
+				return "", err
+			}
+		}
+	}
+
+	if err = os.Rename(tempPath, databasePath); err != nil {
+		return "", err
+	}
+
+	return replacedPath, nil
+}
+
+// DatabasePath - returns path of the database file, which is defined by SQLite DSN
+func DatabasePath(dsn string) string {
+	path := strings.TrimPrefix(dsn, "file:")
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+
+	return path
+}
+
+func checksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// writeChecksum - writes the checksum in the format of sha256sum, so it can be checked with 'sha256sum -c'
+func writeChecksum(path, sum string) error {
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(path))
+
+	return os.WriteFile(path+checksumExt, []byte(line), 0o600)
+}
+
+func readChecksum(path string) (string, error) {
+	file, err := os.Open(path + checksumExt)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrChecksumMissing
+	}
+
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", ErrChecksumMissing
+	}
+
+	return strings.ToLower(fields[0]), nil
+}
+
+func copyFile(source, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	// The file must be on the disk before it replaces the database
+	if err = out.Sync(); err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,190 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/model"
+	"github.com/grafviktor/keep-my-secret/internal/storage/sql"
+)
+
+type failingSource struct{}
+
+func (failingSource) Backup(ctx context.Context, path string) error {
+	return errors.New("disk is full")
+}
+
+// newTestManager - creates a manager which creates backups one second apart
+func newTestManager(source Source, dir string, keep int) *Manager {
+	manager := NewManager(source, dir, keep)
+	now := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	manager.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	return manager
+}
+
+func addUser(t *testing.T, dsn, login string) {
+	t.Helper()
+
+	db := sql.NewSQLStorage(context.Background(), dsn)
+	defer db.Close()
+
+	_, err := db.AddUser(context.Background(), &model.User{Login: login, HashedPassword: "hash"})
+	require.NoError(t, err)
+}
+
+func TestBackupRotation(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dsn := filepath.Join(dir, "kms.db")
+	backupDir := filepath.Join(dir, "backup")
+
+	db := sql.NewSQLStorage(ctx, dsn)
+	defer db.Close()
+
+	manager := newTestManager(db, backupDir, 2)
+	created := make([]string, 0)
+	for i := 0; i < 3; i++ {
+		path, err := manager.Backup(ctx)
+		require.NoError(t, err)
+		created = append(created, path)
+	}
+
+	backups, err := List(backupDir)
+	require.NoError(t, err)
+	require.Equal(t, created[1:], backups)
+	require.Equal(t, "kms-20231001-000003.db", filepath.Base(backups[1]))
+
+	_, err = os.Stat(created[0] + checksumExt)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	for _, path := range backups {
+		var version int
+		version, err = Verify(ctx, path)
+		require.NoError(t, err)
+		require.Equal(t, sql.SchemaVersion(), version)
+	}
+}
+
+func TestBackupSourceError(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := newTestManager(failingSource{}, dir, 1).Backup(context.Background())
+	require.Error(t, err)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	db := sql.NewSQLStorage(ctx, filepath.Join(dir, "kms.db"))
+	defer db.Close()
+
+	path, err := newTestManager(db, dir, 0).Backup(ctx)
+	require.NoError(t, err)
+
+	t.Run("modified backup", func(t *testing.T) {
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		modifiedPath := filepath.Join(dir, "modified.db")
+		content[len(content)-1] ^= 0xFF
+		require.NoError(t, os.WriteFile(modifiedPath, content, 0o600))
+		require.NoError(t, copyFile(path+checksumExt, modifiedPath+checksumExt))
+
+		_, err = Verify(ctx, modifiedPath)
+		require.ErrorIs(t, err, ErrChecksumMismatch)
+	})
+
+	t.Run("missing checksum", func(t *testing.T) {
+		copiedPath := filepath.Join(dir, "copied.db")
+		require.NoError(t, copyFile(path, copiedPath))
+
+		_, err := Verify(ctx, copiedPath)
+		require.ErrorIs(t, err, ErrChecksumMissing)
+	})
+
+	t.Run("not a database", func(t *testing.T) {
+		textPath := filepath.Join(dir, "text.db")
+		require.NoError(t, os.WriteFile(textPath, []byte("not a database"), 0o600))
+		sum, err := checksum(textPath)
+		require.NoError(t, err)
+		require.NoError(t, writeChecksum(textPath, sum))
+
+		_, err = Verify(ctx, textPath)
+		require.ErrorIs(t, err, sql.ErrCorrupted)
+	})
+}
+
+func TestRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dsn := filepath.Join(dir, "kms.db")
+
+	addUser(t, dsn, "before_backup")
+
+	db := sql.NewSQLStorage(ctx, dsn)
+	path, err := newTestManager(db, filepath.Join(dir, "backup"), 0).Backup(ctx)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	addUser(t, dsn, "after_backup")
+
+	replacedPath, err := Restore(ctx, path, dsn)
+	require.NoError(t, err)
+	require.NotEmpty(t, replacedPath)
+
+	db = sql.NewSQLStorage(ctx, dsn)
+	defer db.Close()
+
+	_, err = db.GetUser(ctx, "before_backup")
+	require.NoError(t, err)
+
+	_, err = db.GetUser(ctx, "after_backup")
+	require.Error(t, err)
+
+	replaced := sql.NewSQLStorage(ctx, replacedPath)
+	defer replaced.Close()
+
+	_, err = replaced.GetUser(ctx, "after_backup")
+	require.NoError(t, err)
+}
+
+func TestRestoreSchemaMismatch(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dsn := filepath.Join(dir, "kms.db")
+
+	db := sql.NewSQLStorage(ctx, dsn)
+	defer db.Close()
+
+	_, err := db.ExecContext(ctx, "PRAGMA user_version = 1;")
+	require.NoError(t, err)
+
+	path, err := newTestManager(db, filepath.Join(dir, "backup"), 0).Backup(ctx)
+	require.NoError(t, err)
+
+	_, err = Restore(ctx, path, filepath.Join(dir, "restored.db"))
+	require.ErrorIs(t, err, ErrSchemaMismatch)
+
+	_, err = os.Stat(filepath.Join(dir, "restored.db"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDatabasePath(t *testing.T) {
+	require.Equal(t, "./kms.db", DatabasePath("./kms.db"))
+	require.Equal(t, "/var/lib/kms.db", DatabasePath("file:/var/lib/kms.db?_busy_timeout=5000"))
+}
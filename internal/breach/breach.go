@@ -0,0 +1,238 @@
+// Package breach checks passwords against a local corpus of SHA-1 hashes of breached passwords.
+//
+// The corpus is imported from a file in "Have I Been Pwned" format, where every line contains
+// an uppercase SHA-1 hash of a password and a number of times it was seen in breaches, ordered by hash:
+//
+//	000000005AD76BD555C1D6D771DE417A4B87E4B4:10
+//
+// Imported corpus is a binary file which consists of a header and fixed size records sorted by hash.
+// Fixed size records allow to find all hashes which start with a given prefix using binary search,
+// the same way as k-anonymity range API of HIBP does, without loading the corpus into memory.
+package breach
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1" //nolint:gosec // SHA-1 is the hash function used by HIBP corpus
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	magic      = "KMSB"
+	version    = 1
+	headerSize = len(magic) + 1
+	hashSize   = sha1.Size
+	recordSize = hashSize + 4 // hash and big endian uint32 count
+	// PrefixLength - length of hex encoded hash prefix which is used by Range, the same as in HIBP range API
+	PrefixLength = 5
+)
+
+var (
+	ErrInvalidCorpus = errors.New("invalid breach corpus file")
+	ErrInvalidPrefix = errors.New("invalid hash prefix")
+)
+
+// Entry - a breached password hash and the number of times it was seen in breaches
+type Entry struct {
+	Hash  [hashSize]byte
+	Count uint32
+}
+
+// Corpus - sorted corpus of breached password hashes
+type Corpus struct {
+	file  *os.File
+	count int64
+}
+
+// Open - opens previously imported corpus
+func Open(path string) (*Corpus, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	header := make([]byte, headerSize)
+	if _, err = io.ReadFull(file, header); err != nil || string(header[:len(magic)]) != magic ||
+		header[len(magic)] != version || (info.Size()-int64(headerSize))%recordSize != 0 {
+		file.Close()
+		return nil, ErrInvalidCorpus
+	}
+
+	return &Corpus{
+		file:  file,
+		count: (info.Size() - int64(headerSize)) / recordSize,
+	}, nil
+}
+
+// Close - closes corpus file
+func (c *Corpus) Close() error {
+	return c.file.Close()
+}
+
+// Len - number of hashes in the corpus
+func (c *Corpus) Len() int64 {
+	return c.count
+}
+
+func (c *Corpus) record(i int64) (Entry, error) {
+	buf := make([]byte, recordSize)
+	if _, err := c.file.ReadAt(buf, int64(headerSize)+i*recordSize); err != nil {
+		return Entry{}, err
+	}
+
+	var entry Entry
+	copy(entry.Hash[:], buf[:hashSize])
+	entry.Count = binary.BigEndian.Uint32(buf[hashSize:])
+
+	return entry, nil
+}
+
+// Range - returns all entries which hash starts with the given hex encoded prefix of PrefixLength characters
+func (c *Corpus) Range(prefix string) ([]Entry, error) {
+	if len(prefix) != PrefixLength {
+		return nil, ErrInvalidPrefix
+	}
+
+	// Prefix has odd length, so it's padded to whole bytes. The lowest possible hash is used as a lower bound.
+	lowerBound, err := hex.DecodeString(prefix + "0")
+	if err != nil {
+		return nil, ErrInvalidPrefix
+	}
+
+	var searchErr error
+	first := sort.Search(int(c.count), func(i int) bool {
+		entry, err := c.record(int64(i))
+		if err != nil {
+			searchErr = err
+			return true
+		}
+
+		return bytes.Compare(entry.Hash[:len(lowerBound)], lowerBound) >= 0
+	})
+	if searchErr != nil {
+		return nil, searchErr
+	}
+
+	result := make([]Entry, 0)
+	for i := int64(first); i < c.count; i++ {
+		entry, err := c.record(i)
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.EqualFold(hex.EncodeToString(entry.Hash[:])[:PrefixLength], prefix) {
+			break
+		}
+
+		result = append(result, entry)
+	}
+
+	return result, nil
+}
+
+// IsCompromised - checks if the password is present in the corpus
+func (c *Corpus) IsCompromised(password string) (bool, error) {
+	hash := sha1.Sum([]byte(password)) //nolint:gosec // see import comment
+	entries, err := c.Range(hex.EncodeToString(hash[:])[:PrefixLength])
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range entries {
+		if entry.Hash == hash {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Import - converts HIBP-formatted text file into a binary corpus. Source must be sorted by hash,
+// which is true for the files published by HIBP. The corpus is written into a temporary file first
+// and then renamed, so an existing corpus is replaced only if import succeeds. Returns number of imported hashes.
+func Import(dst string, src io.Reader) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".breach-import-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	count, err := write(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return count, os.Rename(tmp.Name(), dst)
+}
+
+func write(w io.Writer, src io.Reader) (int64, error) {
+	out := bufio.NewWriter(w)
+	if _, err := out.Write(append([]byte(magic), version)); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	var previous []byte
+	record := make([]byte, recordSize)
+	lines := bufio.NewScanner(src)
+	lineNumber := 0
+
+	for lines.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(lines.Text())
+		if line == "" {
+			continue
+		}
+
+		hashHex, countStr, _ := strings.Cut(line, ":")
+		hash, err := hex.DecodeString(hashHex)
+		if err != nil || len(hash) != hashSize {
+			return 0, fmt.Errorf("line %d: invalid hash", lineNumber)
+		}
+
+		var seen uint64
+		if countStr != "" {
+			if seen, err = strconv.ParseUint(countStr, 10, 32); err != nil {
+				return 0, fmt.Errorf("line %d: invalid count", lineNumber)
+			}
+		}
+
+		if previous != nil && bytes.Compare(previous, hash) >= 0 {
+			return 0, fmt.Errorf("line %d: source is not sorted by hash", lineNumber)
+		}
+		previous = hash
+
+		copy(record, hash)
+		binary.BigEndian.PutUint32(record[hashSize:], uint32(seen))
+		if _, err = out.Write(record); err != nil {
+			return 0, err
+		}
+
+		count++
+	}
+
+	if err := lines.Err(); err != nil {
+		return 0, err
+	}
+
+	return count, out.Flush()
+}
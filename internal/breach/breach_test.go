@@ -0,0 +1,104 @@
+package breach
+
+import (
+	"crypto/sha1" //nolint:gosec // HIBP corpus uses SHA-1
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func hibpSource(passwords ...string) string {
+	lines := make([]string, 0, len(passwords))
+	for i, password := range passwords {
+		hash := sha1.Sum([]byte(password)) //nolint:gosec // see import comment
+		lines = append(lines, fmt.Sprintf("%s:%d", strings.ToUpper(hex.EncodeToString(hash[:])), i+1))
+	}
+	sort.Strings(lines)
+
+	return strings.Join(lines, "\r\n")
+}
+
+func importCorpus(t *testing.T, source string) *Corpus {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "corpus.kmsb")
+	_, err := Import(path, strings.NewReader(source))
+	require.NoError(t, err)
+
+	corpus, err := Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { corpus.Close() })
+
+	return corpus
+}
+
+func TestIsCompromised(t *testing.T) {
+	corpus := importCorpus(t, hibpSource("password", "123456", "qwerty", "letmein", "dragon"))
+	require.EqualValues(t, 5, corpus.Len())
+
+	for _, password := range []string{"password", "123456", "dragon"} {
+		compromised, err := corpus.IsCompromised(password)
+		require.NoError(t, err)
+		require.True(t, compromised, password)
+	}
+
+	compromised, err := corpus.IsCompromised("correct horse battery staple")
+	require.NoError(t, err)
+	require.False(t, compromised)
+}
+
+func TestRange(t *testing.T) {
+	// "password" SHA-1 is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	corpus := importCorpus(t, strings.Join([]string{
+		"5BAA5FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:1",
+		"5BAA60FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:2",
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:100",
+		"5BAA6FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:3",
+		"5BAA700000000000000000000000000000000000:4",
+	}, "\n"))
+
+	entries, err := corpus.Range("5baa6")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.EqualValues(t, 100, entries[1].Count)
+
+	entries, err = corpus.Range("5BAA8")
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	_, err = corpus.Range("5BAA")
+	require.ErrorIs(t, err, ErrInvalidPrefix)
+
+	_, err = corpus.Range("ZZZZZ")
+	require.ErrorIs(t, err, ErrInvalidPrefix)
+}
+
+func TestImportRejectsInvalidSource(t *testing.T) {
+	tests := map[string]string{
+		"unsorted":      "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:1\n000000005AD76BD555C1D6D771DE417A4B87E4B4:1",
+		"invalid hash":  "5BAA61E4:1",
+		"invalid count": "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:many",
+	}
+
+	for name, source := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "corpus.kmsb")
+			_, err := Import(path, strings.NewReader(source))
+			require.Error(t, err)
+			require.NoFileExists(t, path)
+		})
+	}
+}
+
+func TestOpenInvalidCorpus(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+
+	_, err = Open("breach.go")
+	require.ErrorIs(t, err, ErrInvalidCorpus)
+}
@@ -1,7 +1,14 @@
 // Package config - contains application configuration structures
 package config
 
-import "github.com/grafviktor/keep-my-secret/internal/storage"
+import (
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/storage"
+)
+
+// DefaultSecret - default value of APP_SECRET, which is known to everyone, so it's allowed only in dev mode
+const DefaultSecret = "romeo romeo whiskey"
 
 // EnvConfig is reqyured
 type EnvConfig struct {
@@ -21,6 +28,86 @@ type EnvConfig struct {
 	ClientURL string `env:"CLIENT_URL"        envDefault:"/"`
 	// DevMode enables CORS
 	DevMode bool `env:"DEV"                   envDefault:"false"`
+	// How often the application looks for expired secrets. Zero disables reminders
+	ReminderInterval time.Duration `env:"REMINDER_INTERVAL" envDefault:"1h"`
+	// How long before the due date a user should be notified
+	ReminderLeadTime time.Duration `env:"REMINDER_LEAD_TIME" envDefault:"168h"`
+	// Reminders are sent to this URL. If not set, reminders are only written to the log
+	ReminderWebhookURL string `env:"REMINDER_WEBHOOK_URL"`
+	// Passwords which were not changed for longer time are reported by vault health check. Zero disables the check
+	PasswordMaxAge time.Duration `env:"PASSWORD_MAX_AGE" envDefault:"8760h"`
+	// Path to breached password corpus created by 'kms breach import' command. If not set, the check is disabled
+	BreachCorpusPath string `env:"BREACH_CORPUS_PATH"`
+	// Maximum lifetime of one-time secret links
+	SendMaxLifetime time.Duration `env:"SEND_MAX_LIFETIME" envDefault:"720h"`
+	// How often expired one-time secret links are removed. Zero disables the cleanup
+	SendCleanupInterval time.Duration `env:"SEND_CLEANUP_INTERVAL" envDefault:"1h"`
+	// How often emergency access requests are checked for the end of the waiting period
+	EmergencyCheckInterval time.Duration `env:"EMERGENCY_CHECK_INTERVAL" envDefault:"1h"`
+	// Directory where database backups are saved. If not set, scheduled backups are disabled
+	BackupDir string `env:"BACKUP_DIR"`
+	// How often the database is backed up. Zero disables scheduled backups
+	BackupInterval time.Duration `env:"BACKUP_INTERVAL" envDefault:"24h"`
+	// Number of the latest backups which are kept. Zero keeps all backups
+	BackupKeep int `env:"BACKUP_KEEP" envDefault:"7"`
+	// Where failed login attempts are kept: "memory", or "storage" to keep them after restart
+	LoginThrottleStore string `env:"LOGIN_THROTTLE_STORE" envDefault:"memory"`
+	// Number of failed attempts which lock a login. Zero disables the lockout, but attempts are still delayed
+	LoginMaxAttempts int `env:"LOGIN_MAX_ATTEMPTS" envDefault:"10"`
+	// Number of failed attempts which lock a client IP address. Zero disables the lockout
+	LoginIPMaxAttempts int `env:"LOGIN_IP_MAX_ATTEMPTS" envDefault:"100"`
+	// How long a login or an IP address stays locked
+	LoginLockoutDuration time.Duration `env:"LOGIN_LOCKOUT_DURATION" envDefault:"15m"`
+	// Request limits of route groups: "<group>=<requests>/<window>[:<burst>]", separated by commas
+	RateLimits string `env:"RATE_LIMITS" envDefault:"default=300/1m:60,secrets=120/1m:30,vault=10/1m:5"`
+	// Address of the metrics endpoint, which should not be reachable from outside. If not set, metrics are disabled
+	MetricsAddr string `env:"METRICS_ADDRESS"`
+	// Minimum number of characters in a password
+	PasswordMinLength int `env:"PASSWORD_MIN_LENGTH" envDefault:"10"`
+	// How many character classes a password must contain: lowercase, uppercase letters, digits and symbols
+	PasswordCharClasses int `env:"PASSWORD_CHAR_CLASSES" envDefault:"3"`
+	// Rejects the most common passwords
+	PasswordBlocklist bool `env:"PASSWORD_BLOCKLIST" envDefault:"true"`
+	// Path to a file with additional passwords which are rejected, one per line
+	PasswordBlocklistPath string `env:"PASSWORD_BLOCKLIST_PATH"`
+	// Rejects passwords which contain the username
+	PasswordRejectUsername bool `env:"PASSWORD_REJECT_USERNAME" envDefault:"true"`
+	// Maximum number of characters in a username. Zero means unlimited
+	UsernameMaxLength int `env:"USERNAME_MAX_LENGTH" envDefault:"64"`
+	// Lifetime of access tokens
+	AccessTokenTTL time.Duration `env:"ACCESS_TOKEN_TTL" envDefault:"10m"`
+	// Lifetime of refresh tokens, which is also the longest session without re-login
+	RefreshTokenTTL time.Duration `env:"REFRESH_TOKEN_TTL" envDefault:"24h"`
+	// Algorithm which signs tokens: HS256 with APP_SECRET, RS256 or EdDSA with JWT_SIGNING_KEY_PATH
+	JWTAlgorithm string `env:"JWT_ALGORITHM" envDefault:"HS256"`
+	// PEM file with the private key which signs tokens. Required for RS256 and EdDSA
+	JWTSigningKeyPath string `env:"JWT_SIGNING_KEY_PATH"`
+	// PEM files with previous keys, separated by commas. Tokens signed with them are still accepted
+	JWTVerificationKeyPaths string `env:"JWT_VERIFICATION_KEY_PATHS"`
+	// "iss" claim of tokens. OpenID Connect clients expect the URL of the server. If not set, DOMAIN is used
+	JWTIssuer string `env:"JWT_ISSUER"`
+	// "aud" claim of tokens. If not set, DOMAIN is used
+	JWTAudience string `env:"JWT_AUDIENCE"`
+	// URL of OpenID Connect identity provider. If not set, sign in with the provider is disabled
+	OIDCIssuerURL string `env:"OIDC_ISSUER_URL"`
+	// Client ID which is registered at the identity provider
+	OIDCClientID string `env:"OIDC_CLIENT_ID"`
+	// Client secret. Not required for public clients, PKCE protects the authorization code anyway
+	OIDCClientSecret string `env:"OIDC_CLIENT_SECRET"`
+	// Address of the callback endpoint of this server, it must be registered at the identity provider
+	OIDCRedirectURL string `env:"OIDC_REDIRECT_URL"`
+	// Scopes which are requested from the identity provider, separated by spaces
+	OIDCScopes string `env:"OIDC_SCOPES" envDefault:"openid email profile"`
+	// ID token claim which becomes the login of new users: "email", "preferred_username" or "sub"
+	OIDCUsernameClaim string `env:"OIDC_USERNAME_CLAIM" envDefault:"email"`
+	// WebAuthn relying party ID, the domain of the client application. If not set, passkeys are disabled
+	WebAuthnRPID string `env:"WEBAUTHN_RP_ID"`
+	// Name of the server which authenticators show to users
+	WebAuthnRPName string `env:"WEBAUTHN_RP_NAME" envDefault:"Keep My Secret"`
+	// Origin of the client application. If not set, https://<WEBAUTHN_RP_ID> is used
+	WebAuthnOrigin string `env:"WEBAUTHN_ORIGIN"`
+	// Maximum lifetime of personal API tokens
+	APITokenMaxLifetime time.Duration `env:"API_TOKEN_MAX_LIFETIME" envDefault:"8760h"`
 }
 
 type AppConfig struct {
@@ -45,6 +132,82 @@ type AppConfig struct {
 	StorageType storage.Type
 	// If devmode is enabled, then CORS requests are allowed
 	DevMode bool
+	// How often the application looks for expired secrets
+	ReminderInterval time.Duration
+	// How long before the due date a user should be notified
+	ReminderLeadTime time.Duration
+	// Webhook which receives reminders
+	ReminderWebhookURL string
+	// Passwords which were not changed for longer time are considered old
+	PasswordMaxAge time.Duration
+	// Breached password corpus path
+	BreachCorpusPath string
+	// Maximum lifetime of one-time secret links
+	SendMaxLifetime time.Duration
+	// How often expired one-time secret links are removed
+	SendCleanupInterval time.Duration
+	// How often emergency access requests are approved after the waiting period
+	EmergencyCheckInterval time.Duration
+	// Directory where database backups are saved
+	BackupDir string
+	// How often the database is backed up
+	BackupInterval time.Duration
+	// Number of the latest backups which are kept
+	BackupKeep int
+	// Where failed login attempts are kept: "memory" or "storage"
+	LoginThrottleStore string
+	// Number of failed attempts which lock a login
+	LoginMaxAttempts int
+	// Number of failed attempts which lock a client IP address
+	LoginIPMaxAttempts int
+	// How long a login or an IP address stays locked
+	LoginLockoutDuration time.Duration
+	// Request limits of route groups, see middleware.ParseRateLimits
+	RateLimits string
+	// Address of the metrics endpoint
+	MetricsAddr string
+	// Minimum number of characters in a password
+	PasswordMinLength int
+	// How many character classes a password must contain
+	PasswordCharClasses int
+	// Rejects the most common passwords
+	PasswordBlocklist bool
+	// Path to a file with additional passwords which are rejected
+	PasswordBlocklistPath string
+	// Rejects passwords which contain the username
+	PasswordRejectUsername bool
+	// Maximum number of characters in a username
+	UsernameMaxLength int
+	// Lifetime of access tokens
+	AccessTokenTTL time.Duration
+	// Lifetime of refresh tokens
+	RefreshTokenTTL time.Duration
+	// Algorithm which signs tokens: HS256, RS256 or EdDSA
+	JWTAlgorithm string
+	// PEM file with the private key which signs tokens
+	JWTSigningKeyPath string
+	// PEM files with previous keys, separated by commas
+	JWTVerificationKeyPaths string
+	// URL of OpenID Connect identity provider
+	OIDCIssuerURL string
+	// Client ID which is registered at the identity provider
+	OIDCClientID string
+	// Client secret, empty for public clients
+	OIDCClientSecret string
+	// Address of the callback endpoint of this server
+	OIDCRedirectURL string
+	// Scopes which are requested from the identity provider, separated by spaces
+	OIDCScopes string
+	// ID token claim which becomes the login of new users
+	OIDCUsernameClaim string
+	// WebAuthn relying party ID
+	WebAuthnRPID string
+	// Name of the server which authenticators show to users
+	WebAuthnRPName string
+	// Origin of the client application, which is checked in WebAuthn responses
+	WebAuthnOrigin string
+	// Maximum lifetime of personal API tokens
+	APITokenMaxLifetime time.Duration
 }
 
 // New creates new App config instance with pre-defined parameters
@@ -55,11 +218,68 @@ func New(ec EnvConfig) AppConfig {
 		DSN:           ec.DSN,
 		HTTPSCertPath: ec.HTTPSCertPath,
 		HTTPSKeyPath:  ec.HTTPSKeyPath,
-		JWTAudience:   ec.Domain,
-		JWTIssuer:     ec.Domain,
+		JWTAudience:   defaultString(ec.JWTAudience, ec.Domain),
+		JWTIssuer:     defaultString(ec.JWTIssuer, ec.Domain),
 		Secret:        ec.Secret,
 		ServerAddr:    ec.ServerAddr,
 		StorageType:   storage.TypeSQL,
 		DevMode:       ec.DevMode,
+
+		ReminderInterval:   ec.ReminderInterval,
+		ReminderLeadTime:   ec.ReminderLeadTime,
+		ReminderWebhookURL: ec.ReminderWebhookURL,
+		PasswordMaxAge:     ec.PasswordMaxAge,
+		BreachCorpusPath:   ec.BreachCorpusPath,
+
+		SendMaxLifetime:     ec.SendMaxLifetime,
+		SendCleanupInterval: ec.SendCleanupInterval,
+
+		EmergencyCheckInterval: ec.EmergencyCheckInterval,
+
+		BackupDir:      ec.BackupDir,
+		BackupInterval: ec.BackupInterval,
+		BackupKeep:     ec.BackupKeep,
+
+		LoginThrottleStore:   ec.LoginThrottleStore,
+		LoginMaxAttempts:     ec.LoginMaxAttempts,
+		LoginIPMaxAttempts:   ec.LoginIPMaxAttempts,
+		LoginLockoutDuration: ec.LoginLockoutDuration,
+
+		RateLimits:  ec.RateLimits,
+		MetricsAddr: ec.MetricsAddr,
+
+		PasswordMinLength:      ec.PasswordMinLength,
+		PasswordCharClasses:    ec.PasswordCharClasses,
+		PasswordBlocklist:      ec.PasswordBlocklist,
+		PasswordBlocklistPath:  ec.PasswordBlocklistPath,
+		PasswordRejectUsername: ec.PasswordRejectUsername,
+		UsernameMaxLength:      ec.UsernameMaxLength,
+
+		AccessTokenTTL:          ec.AccessTokenTTL,
+		RefreshTokenTTL:         ec.RefreshTokenTTL,
+		JWTAlgorithm:            ec.JWTAlgorithm,
+		JWTSigningKeyPath:       ec.JWTSigningKeyPath,
+		JWTVerificationKeyPaths: ec.JWTVerificationKeyPaths,
+
+		OIDCIssuerURL:     ec.OIDCIssuerURL,
+		OIDCClientID:      ec.OIDCClientID,
+		OIDCClientSecret:  ec.OIDCClientSecret,
+		OIDCRedirectURL:   ec.OIDCRedirectURL,
+		OIDCScopes:        ec.OIDCScopes,
+		OIDCUsernameClaim: ec.OIDCUsernameClaim,
+
+		WebAuthnRPID:   ec.WebAuthnRPID,
+		WebAuthnRPName: ec.WebAuthnRPName,
+		WebAuthnOrigin: ec.WebAuthnOrigin,
+
+		APITokenMaxLifetime: ec.APITokenMaxLifetime,
 	}
 }
+
+func defaultString(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+
+	return value
+}
@@ -9,6 +9,9 @@ var (
 	ErrDeleted         = errors.New("deleted")
 	ErrNoUserID        = errors.New("no user ID")
 	ErrBadArgument     = errors.New("bad argument")
+	ErrForbidden       = errors.New("forbidden")
+	ErrAccountDisabled = errors.New("account is disabled")
+	ErrConflict        = errors.New("conflict")
 )
 
 const (
@@ -18,8 +21,13 @@ const (
 )
 
 const (
-	APIMessageUnauthorized = "unauthorized"
-	APIMessageBadRequest   = "bad request"
-	APIMessageServerError  = "server error"
-	APIMessageNotFound     = "not found"
+	APIMessageUnauthorized       = "unauthorized"
+	APIMessageBadRequest         = "bad request"
+	APIMessageServerError        = "server error"
+	APIMessageNotFound           = "not found"
+	APIMessageForbidden          = "forbidden"
+	APIMessageTooManyRequests    = "too many requests"
+	APIMessagePolicyViolation    = "credentials don't conform to the policy"
+	APIMessageAccountDisabled    = "account is disabled"
+	APIMessageRegistrationClosed = "registration is closed"
 )
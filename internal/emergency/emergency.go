@@ -0,0 +1,144 @@
+// Package emergency implements the state machine of emergency access. A grantor invites a trusted contact,
+// who accepts the invitation and may later request access to the grantor's secrets. The request is approved
+// by the grantor, or automatically when the waiting period is over and the grantor didn't reject it.
+package emergency
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// Emergency access states
+const (
+	StateInvited           = "invited"
+	StateAccepted          = "accepted"
+	StateRecoveryRequested = "recovery_requested"
+	StateRecoveryApproved  = "recovery_approved"
+)
+
+// Events which move emergency access from one state to another
+const (
+	// EventAccept - the grantee accepts the invitation
+	EventAccept = "accept"
+	// EventRequest - the grantee requests access to the grantor's secrets
+	EventRequest = "request"
+	// EventApprove - the grantor approves the request without waiting
+	EventApprove = "approve"
+	// EventReject - the grantor rejects the request or takes the approved access back
+	EventReject = "reject"
+)
+
+// Limits of the waiting period in days
+const (
+	DefaultWaitDays = 7
+	MaxWaitDays     = 90
+)
+
+// ErrInvalidTransition - the event is not allowed in the current state
+var ErrInvalidTransition = errors.New("invalid emergency access state transition")
+
+var transitions = map[string]map[string]string{
+	StateInvited:           {EventAccept: StateAccepted},
+	StateAccepted:          {EventRequest: StateRecoveryRequested},
+	StateRecoveryRequested: {EventApprove: StateRecoveryApproved, EventReject: StateAccepted},
+	StateRecoveryApproved:  {EventReject: StateAccepted},
+}
+
+// isGrantorEvent - approve and reject events belong to the grantor, the rest belong to the grantee
+func isGrantorEvent(event string) bool {
+	return event == EventApprove || event == EventReject
+}
+
+// Apply - moves emergency access to the next state on behalf of the user. Returns constant.ErrForbidden
+// if the event doesn't belong to the user, and ErrInvalidTransition if it's not allowed in the current state.
+func Apply(access *model.EmergencyAccess, event, login string, now time.Time) error {
+	actor := access.Grantee
+	if isGrantorEvent(event) {
+		actor = access.Grantor
+	}
+
+	if login != actor {
+		return constant.ErrForbidden
+	}
+
+	return transition(access, event, now)
+}
+
+func transition(access *model.EmergencyAccess, event string, now time.Time) error {
+	next, ok := transitions[access.State][event]
+	if !ok {
+		return ErrInvalidTransition
+	}
+
+	switch next {
+	case StateRecoveryRequested:
+		access.RequestedAt = &now
+	case StateAccepted:
+		access.RequestedAt = nil
+	}
+
+	access.State = next
+	access.UpdatedAt = &now
+
+	return nil
+}
+
+// IsWaitOver - checks if the request is waiting for approval longer than the waiting period
+func IsWaitOver(access *model.EmergencyAccess, now time.Time) bool {
+	if access.State != StateRecoveryRequested || access.RequestedAt == nil {
+		return false
+	}
+
+	return !now.Before(access.RequestedAt.AddDate(0, 0, access.WaitDays))
+}
+
+type accessStorage interface {
+	GetEmergencyAccessByState(ctx context.Context, state string) ([]*model.EmergencyAccess, error)
+	UpdateEmergencyAccess(ctx context.Context, access *model.EmergencyAccess, fromState string) error
+}
+
+// Approver - approves requests which the grantors didn't reject during the waiting period
+type Approver struct {
+	storage accessStorage
+}
+
+// NewApprover - creates a new Approver
+func NewApprover(storage accessStorage) *Approver {
+	return &Approver{storage: storage}
+}
+
+// Approve - approves all requests whose waiting period is over. The state is updated only if it wasn't
+// changed since the request was loaded, so a request which has just been rejected stays rejected.
+func (a *Approver) Approve(ctx context.Context) error {
+	requests, err := a.storage.GetEmergencyAccessByState(ctx, StateRecoveryRequested)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, access := range requests {
+		if !IsWaitOver(access, now) {
+			continue
+		}
+
+		if err = transition(access, EventApprove, now); err != nil {
+			return err
+		}
+
+		err = a.storage.UpdateEmergencyAccess(ctx, access, StateRecoveryRequested)
+		if errors.Is(err, constant.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		log.Printf("Emergency access %d of '%s' is approved for '%s'\n", access.ID, access.Grantor, access.Grantee)
+	}
+
+	return nil
+}
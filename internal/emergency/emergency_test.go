@@ -0,0 +1,173 @@
+package emergency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+func TestApply(t *testing.T) {
+	now := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		state     string
+		event     string
+		login     string
+		wantState string
+		wantErr   error
+	}{
+		{
+			name:      "grantee accepts invitation",
+			state:     StateInvited,
+			event:     EventAccept,
+			login:     "grantee",
+			wantState: StateAccepted,
+		},
+		{
+			name:      "grantee requests access",
+			state:     StateAccepted,
+			event:     EventRequest,
+			login:     "grantee",
+			wantState: StateRecoveryRequested,
+		},
+		{
+			name:      "grantor approves request",
+			state:     StateRecoveryRequested,
+			event:     EventApprove,
+			login:     "grantor",
+			wantState: StateRecoveryApproved,
+		},
+		{
+			name:      "grantor rejects request",
+			state:     StateRecoveryRequested,
+			event:     EventReject,
+			login:     "grantor",
+			wantState: StateAccepted,
+		},
+		{
+			name:      "grantor takes approved access back",
+			state:     StateRecoveryApproved,
+			event:     EventReject,
+			login:     "grantor",
+			wantState: StateAccepted,
+		},
+		{
+			name:    "grantee cannot approve own request",
+			state:   StateRecoveryRequested,
+			event:   EventApprove,
+			login:   "grantee",
+			wantErr: constant.ErrForbidden,
+		},
+		{
+			name:    "grantor cannot request access",
+			state:   StateAccepted,
+			event:   EventRequest,
+			login:   "grantor",
+			wantErr: constant.ErrForbidden,
+		},
+		{
+			name:    "invitation must be accepted first",
+			state:   StateInvited,
+			event:   EventRequest,
+			login:   "grantee",
+			wantErr: ErrInvalidTransition,
+		},
+		{
+			name:    "nothing to approve",
+			state:   StateAccepted,
+			event:   EventApprove,
+			login:   "grantor",
+			wantErr: ErrInvalidTransition,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			access := &model.EmergencyAccess{Grantor: "grantor", Grantee: "grantee", State: tt.state}
+
+			err := Apply(access, tt.event, tt.login, now)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				require.Equal(t, tt.state, access.State)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.wantState, access.State)
+			require.Equal(t, now, *access.UpdatedAt)
+
+			if tt.wantState == StateRecoveryRequested {
+				require.Equal(t, now, *access.RequestedAt)
+			} else if tt.wantState == StateAccepted {
+				require.Nil(t, access.RequestedAt)
+			}
+		})
+	}
+}
+
+func TestIsWaitOver(t *testing.T) {
+	now := time.Date(2023, 10, 10, 0, 0, 0, 0, time.UTC)
+	requestedAt := now.AddDate(0, 0, -7)
+
+	access := &model.EmergencyAccess{State: StateRecoveryRequested, WaitDays: 7, RequestedAt: &requestedAt}
+	require.True(t, IsWaitOver(access, now))
+	require.False(t, IsWaitOver(access, now.Add(-time.Second)))
+
+	access.State = StateAccepted
+	require.False(t, IsWaitOver(access, now))
+}
+
+type mockStorage struct {
+	requests []*model.EmergencyAccess
+	updated  []*model.EmergencyAccess
+	// rejected - requests which were rejected after they were loaded
+	rejected map[int64]bool
+}
+
+func (m *mockStorage) GetEmergencyAccessByState(ctx context.Context, state string) ([]*model.EmergencyAccess, error) {
+	if state != StateRecoveryRequested {
+		return nil, errors.New("unexpected state")
+	}
+
+	return m.requests, nil
+}
+
+//nolint:lll
+func (m *mockStorage) UpdateEmergencyAccess(ctx context.Context, access *model.EmergencyAccess, fromState string) error {
+	if m.rejected[access.ID] || fromState != StateRecoveryRequested {
+		return constant.ErrNotFound
+	}
+
+	m.updated = append(m.updated, access)
+
+	return nil
+}
+
+func TestApproverApprovesAfterWaitingPeriod(t *testing.T) {
+	now := time.Now().UTC()
+	longAgo := now.AddDate(0, 0, -8)
+	recently := now.AddDate(0, 0, -1)
+
+	storage := &mockStorage{
+		requests: []*model.EmergencyAccess{
+			{ID: 1, State: StateRecoveryRequested, WaitDays: 7, RequestedAt: &longAgo},
+			{ID: 2, State: StateRecoveryRequested, WaitDays: 7, RequestedAt: &recently},
+			{ID: 3, State: StateRecoveryRequested, WaitDays: 7, RequestedAt: &longAgo},
+		},
+		rejected: map[int64]bool{3: true},
+	}
+
+	err := NewApprover(storage).Approve(context.Background())
+	require.NoError(t, err)
+	require.Len(t, storage.updated, 1)
+	require.Equal(t, int64(1), storage.updated[0].ID)
+	require.Equal(t, StateRecoveryApproved, storage.updated[0].State)
+}
@@ -0,0 +1,119 @@
+// Package health analyzes user's vault and reports weak, reused, old and compromised passwords
+// as well as expired cards.
+// The report contains only secret identifiers and finding types, it never includes secret values.
+package health
+
+import (
+	"crypto/sha256"
+	"sort"
+	"time"
+
+	"github.com/nbutton23/zxcvbn-go"
+
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// Finding types
+const (
+	FindingWeak        = "weak"
+	FindingReused      = "reused"
+	FindingOld         = "old"
+	FindingCardExpired = "card_expired"
+	FindingCompromised = "compromised"
+)
+
+// Finding - a problem which was found in a secret
+type Finding struct {
+	SecretID int64  `json:"secret_id"`
+	Type     string `json:"type"`
+}
+
+// Report - result of vault analysis
+type Report struct {
+	// Checked - number of secrets which were analyzed
+	Checked  int       `json:"checked"`
+	Findings []Finding `json:"findings"`
+}
+
+// Options - analysis settings
+type Options struct {
+	// Now - the moment of time which is used for checking ages and expiration dates
+	Now time.Time
+	// MinScore - passwords which have lower zxcvbn score (0-4) are considered weak
+	MinScore int
+	// MaxAge - passwords which were not changed for longer time are considered old. Zero disables the check
+	MaxAge time.Duration
+}
+
+// DefaultMinScore - zxcvbn score 3 means "safely unguessable"
+const DefaultMinScore = 3
+
+// Analyze - checks decrypted secrets and returns a report. Secrets must be decrypted by the caller.
+func Analyze(secrets []*model.Secret, opts Options) Report {
+	report := Report{Findings: make([]Finding, 0)}
+	passwords := make(map[[sha256.Size]byte][]int64)
+
+	for _, secret := range secrets {
+		switch secret.Type {
+		case model.SecretTypePassword:
+			report.Checked++
+			if secret.Password == "" {
+				continue
+			}
+
+			if secret.Compromised {
+				report.Findings = append(report.Findings, Finding{SecretID: secret.ID, Type: FindingCompromised})
+			}
+
+			userInputs := []string{secret.Login, secret.Title, secret.URL}
+			if zxcvbn.PasswordStrength(secret.Password, userInputs).Score < opts.MinScore {
+				report.Findings = append(report.Findings, Finding{SecretID: secret.ID, Type: FindingWeak})
+			}
+
+			if opts.MaxAge > 0 && isOlderThan(secret, opts.Now.Add(-opts.MaxAge)) {
+				report.Findings = append(report.Findings, Finding{SecretID: secret.ID, Type: FindingOld})
+			}
+
+			// Only hashes are kept, so the same plain text password isn't copied around
+			hash := sha256.Sum256([]byte(secret.Password))
+			passwords[hash] = append(passwords[hash], secret.ID)
+		case model.SecretTypeCard:
+			report.Checked++
+			expiresAt, ok := model.ParseCardExpiration(secret.Expiration)
+			if ok && !expiresAt.After(opts.Now) {
+				report.Findings = append(report.Findings, Finding{SecretID: secret.ID, Type: FindingCardExpired})
+			}
+		}
+	}
+
+	for _, ids := range passwords {
+		if len(ids) < 2 {
+			continue
+		}
+
+		for _, id := range ids {
+			report.Findings = append(report.Findings, Finding{SecretID: id, Type: FindingReused})
+		}
+	}
+
+	sort.Slice(report.Findings, func(i, j int) bool {
+		if report.Findings[i].SecretID == report.Findings[j].SecretID {
+			return report.Findings[i].Type < report.Findings[j].Type
+		}
+
+		return report.Findings[i].SecretID < report.Findings[j].SecretID
+	})
+
+	return report
+}
+
+// isOlderThan - checks if the secret was changed before the given moment. Secrets without timestamps,
+// which were created before timestamps were introduced, are not considered old, because their age is unknown.
+func isOlderThan(secret *model.Secret, moment time.Time) bool {
+	changedAt := secret.UpdatedAt
+	if changedAt == nil {
+		changedAt = secret.CreatedAt
+	}
+
+	return changedAt != nil && changedAt.Before(moment)
+}
@@ -0,0 +1,48 @@
+package health
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+func TestAnalyze(t *testing.T) {
+	now := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	recently := now.AddDate(0, 0, -1)
+	longAgo := now.AddDate(-2, 0, 0)
+
+	secrets := []*model.Secret{
+		{ID: 1, Type: model.SecretTypePassword, Password: "password", UpdatedAt: &recently, Compromised: true},
+		{ID: 2, Type: model.SecretTypePassword, Password: "correct horse battery staple", UpdatedAt: &recently},
+		{ID: 3, Type: model.SecretTypePassword, Password: "correct horse battery staple", UpdatedAt: &longAgo},
+		{ID: 4, Type: model.SecretTypePassword, Password: "h7#Lq9!vZr2@mWx", CreatedAt: &longAgo},
+		{ID: 5, Type: model.SecretTypeCard, Expiration: "2023-09-03"},
+		{ID: 6, Type: model.SecretTypeCard, Expiration: "12/30"},
+		{ID: 7, Type: model.SecretTypeNote, Note: "password"},
+		{ID: 8, Type: model.SecretTypePassword, Password: "tony.tester1", Login: "tony.tester1"},
+	}
+
+	report := Analyze(secrets, Options{Now: now, MinScore: DefaultMinScore, MaxAge: 365 * 24 * time.Hour})
+
+	require.Equal(t, 7, report.Checked)
+	require.Equal(t, []Finding{
+		{SecretID: 1, Type: FindingCompromised},
+		{SecretID: 1, Type: FindingWeak},
+		{SecretID: 2, Type: FindingReused},
+		{SecretID: 3, Type: FindingOld},
+		{SecretID: 3, Type: FindingReused},
+		{SecretID: 4, Type: FindingOld},
+		{SecretID: 5, Type: FindingCardExpired},
+		{SecretID: 8, Type: FindingWeak},
+	}, report.Findings)
+}
+
+func TestAnalyzeEmptyVault(t *testing.T) {
+	report := Analyze(nil, Options{Now: time.Now(), MinScore: DefaultMinScore})
+	require.Equal(t, 0, report.Checked)
+	require.NotNil(t, report.Findings)
+	require.Empty(t, report.Findings)
+}
@@ -0,0 +1,172 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// Types of Bitwarden items
+const (
+	bitwardenLogin    = 1
+	bitwardenNote     = 2
+	bitwardenCard     = 3
+	bitwardenIdentity = 4
+)
+
+// Bitwarden doesn't export attachments and the values of "linked" custom fields
+type bitwardenExport struct {
+	Encrypted bool            `json:"encrypted"`
+	Items     []bitwardenItem `json:"items"`
+}
+
+type bitwardenItem struct {
+	Type         int                `json:"type"`
+	Name         string             `json:"name"`
+	Notes        string             `json:"notes"`
+	Favorite     bool               `json:"favorite"`
+	Fields       []bitwardenField   `json:"fields"`
+	Login        *bitwardenLoginBox `json:"login"`
+	Card         *bitwardenCardBox  `json:"card"`
+	Identity     map[string]any     `json:"identity"`
+	CreationDate time.Time          `json:"creationDate"`
+	RevisionDate time.Time          `json:"revisionDate"`
+}
+
+type bitwardenField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type bitwardenLoginBox struct {
+	URIs []struct {
+		URI string `json:"uri"`
+	} `json:"uris"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	TOTP     string `json:"totp"`
+}
+
+type bitwardenCardBox struct {
+	CardholderName string `json:"cardholderName"`
+	Brand          string `json:"brand"`
+	Number         string `json:"number"`
+	ExpMonth       string `json:"expMonth"`
+	ExpYear        string `json:"expYear"`
+	Code           string `json:"code"`
+}
+
+// bitwardenIdentityFields - fields of an identity item in the order they are shown in Bitwarden
+var bitwardenIdentityFields = []struct {
+	key  string
+	name string
+}{
+	{"title", "Title"},
+	{"firstName", "First name"},
+	{"middleName", "Middle name"},
+	{"lastName", "Last name"},
+	{"username", "Username"},
+	{"company", "Company"},
+	{"email", "Email"},
+	{"phone", "Phone"},
+	{"address1", "Address"},
+	{"address2", "Address 2"},
+	{"address3", "Address 3"},
+	{"city", "City"},
+	{"state", "State"},
+	{"postalCode", "Postal code"},
+	{"country", "Country"},
+	{"ssn", "Social security number"},
+	{"passportNumber", "Passport number"},
+	{"licenseNumber", "License number"},
+}
+
+func parseBitwarden(data []byte, _ string) (*Result, error) {
+	var export bitwardenExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, ErrInvalidFile
+	}
+
+	if export.Encrypted {
+		return nil, errors.New("encrypted Bitwarden exports are not supported, export the vault as unencrypted JSON")
+	}
+
+	result := &Result{}
+	for i, item := range export.Items {
+		index := i + 1
+
+		secret, err := item.secret()
+		if err != nil {
+			result.fail(index, item.Name, err)
+			continue
+		}
+
+		result.addEntry(index, secret, nil)
+	}
+
+	return result, nil
+}
+
+func (i bitwardenItem) secret() (*model.Secret, error) {
+	secret := &model.Secret{
+		Title:     i.Name,
+		Note:      i.Notes,
+		Favorite:  i.Favorite,
+		CreatedAt: timePtr(i.CreationDate),
+		UpdatedAt: timePtr(i.RevisionDate),
+	}
+
+	fields := make([]field, 0, len(i.Fields))
+	for _, f := range i.Fields {
+		fields = append(fields, field{name: f.Name, value: f.Value})
+	}
+
+	switch i.Type {
+	case bitwardenLogin, bitwardenNote, bitwardenIdentity:
+		if i.Login != nil {
+			secret.Login = i.Login.Username
+			secret.Password = i.Login.Password
+			for n, uri := range i.Login.URIs {
+				if n == 0 {
+					secret.URL = uri.URI
+				} else {
+					fields = append(fields, field{name: "URL", value: uri.URI})
+				}
+			}
+
+			fields = append(fields, field{name: "TOTP", value: i.Login.TOTP})
+		}
+
+		for _, f := range bitwardenIdentityFields {
+			value, _ := i.Identity[f.key].(string)
+			fields = append(fields, field{name: f.name, value: strings.TrimSpace(value)})
+		}
+	case bitwardenCard:
+		if i.Card == nil {
+			return nil, ErrEmptyItem
+		}
+
+		month, _ := strconv.Atoi(i.Card.ExpMonth)
+		year, _ := strconv.Atoi(i.Card.ExpYear)
+		secret.Type = model.SecretTypeCard
+		secret.CardholderName = i.Card.CardholderName
+		secret.CardNumber = i.Card.Number
+		secret.Expiration = cardExpiration(month, year)
+		secret.SecurityCode = i.Card.Code
+		fields = append(fields, field{name: "Brand", value: i.Card.Brand})
+	default:
+		return nil, fmt.Errorf("unsupported item type %d", i.Type)
+	}
+
+	secret.Note = appendFields(secret.Note, fields)
+	if secret.Type == "" {
+		classify(secret)
+	}
+
+	return secret, nil
+}
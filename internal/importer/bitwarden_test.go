@@ -0,0 +1,83 @@
+package importer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+func TestParseBitwarden(t *testing.T) {
+	result := parseFixture(t, FormatBitwarden, "bitwarden.json", "")
+	created := time.Date(2023, 5, 14, 10, 30, 0, 0, time.UTC)
+	updated := time.Date(2023, 6, 1, 8, 0, 0, 0, time.UTC)
+
+	require.Equal(t, []*model.Secret{
+		{
+			Type:     model.SecretTypePassword,
+			Title:    "Mail",
+			Login:    "tony",
+			Password: "mail password",
+			URL:      "https://mail.example.com",
+			Note: "personal mailbox\nPIN: 1234\nURL: https://webmail.example.com\n" +
+				"TOTP: otpauth://totp/Mail:tony?secret=JBSWY3DPEHPK3PXP",
+			Favorite:  true,
+			CreatedAt: &created,
+			UpdatedAt: &updated,
+		},
+		{
+			Type:      model.SecretTypeNote,
+			Title:     "Wi-Fi",
+			Note:      "network: home\npassword: qwerty",
+			CreatedAt: &created,
+			UpdatedAt: &created,
+		},
+		{
+			Type:           model.SecretTypeCard,
+			Title:          "Visa",
+			Note:           "Brand: Visa",
+			CardholderName: "TONY TESTER",
+			CardNumber:     "4111111111111111",
+			Expiration:     "07/2027",
+			SecurityCode:   "123",
+			CreatedAt:      &created,
+			UpdatedAt:      &created,
+		},
+		{
+			Type:  model.SecretTypeNote,
+			Title: "Tony",
+			Note: "Title: Mr\nFirst name: Tony\nLast name: Tester\nEmail: tony@example.com\n" +
+				"City: Berlin\nCountry: DE\nPassport number: C01X00T47",
+			CreatedAt: &created,
+			UpdatedAt: &created,
+		},
+	}, secrets(result))
+
+	require.Equal(t, []int{1, 2, 3, 4}, []int{
+		result.Items[0].Index, result.Items[1].Index, result.Items[2].Index, result.Items[3].Index,
+	})
+
+	require.Equal(t, []ItemError{
+		{Item: 5, Title: "Empty note", Error: ErrEmptyItem.Error()},
+		{Item: 6, Title: "Server key", Error: "unsupported item type 5"},
+	}, result.Errors)
+}
+
+func TestParseBitwardenInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "not JSON", data: "name,username,password"},
+		{name: "encrypted export", data: `{"encrypted":true,"passwordProtected":true,"data":"2.abc|def|ghi"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(FormatBitwarden, []byte(tt.data), "")
+			require.Error(t, err)
+		})
+	}
+}
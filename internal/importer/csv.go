@@ -0,0 +1,122 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// csvColumns - names of columns which are used by different applications for the same value:
+// Chrome exports "name,url,username,password,note", Firefox exports "url,username,password,...",
+// Bitwarden exports "folder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,...".
+var csvColumns = map[string][]string{
+	"title":    {"name", "title"},
+	"url":      {"url", "login_uri", "website", "web site"},
+	"login":    {"username", "login_username", "login", "user name"},
+	"password": {"password", "login_password"},
+	"note":     {"note", "notes", "extra"},
+	"totp":     {"login_totp", "totp", "otpauth"},
+	"favorite": {"favorite", "fav"},
+	"type":     {"type"},
+	"created":  {"timecreated"},
+	"updated":  {"timepasswordchanged"},
+}
+
+// csvHeader - maps values to column indexes
+type csvHeader map[string]int
+
+func newCSVHeader(record []string) (csvHeader, error) {
+	positions := make(map[string]int, len(record))
+	for i, name := range record {
+		positions[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	header := make(csvHeader)
+	for value, names := range csvColumns {
+		for _, name := range names {
+			if i, ok := positions[name]; ok {
+				header[value] = i
+				break
+			}
+		}
+	}
+
+	_, hasLogin := header["login"]
+	_, hasPassword := header["password"]
+	_, hasNote := header["note"]
+	if !hasLogin && !hasPassword && !hasNote {
+		return nil, errors.New("CSV file doesn't have username, password or note columns")
+	}
+
+	return header, nil
+}
+
+func (h csvHeader) get(record []string, value string) string {
+	i, ok := h[value]
+	if !ok || i >= len(record) {
+		return ""
+	}
+
+	return strings.TrimSpace(record[i])
+}
+
+// parseCSV - reads a CSV file with a header. Items without a title get the host name of their URL.
+func parseCSV(data []byte, _ string) (*Result, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil, ErrInvalidFile
+	}
+
+	header, err := newCSVHeader(records[0])
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	for i, record := range records[1:] {
+		index := i + 1
+		if len(record) != len(records[0]) {
+			result.fail(index, "", errors.New("wrong number of columns"))
+			continue
+		}
+
+		secret := &model.Secret{
+			Title:     header.get(record, "title"),
+			URL:       header.get(record, "url"),
+			Login:     header.get(record, "login"),
+			Password:  header.get(record, "password"),
+			Favorite:  header.get(record, "favorite") == "1" || strings.EqualFold(header.get(record, "favorite"), "true"),
+			CreatedAt: csvTime(header.get(record, "created")),
+			UpdatedAt: csvTime(header.get(record, "updated")),
+		}
+		secret.Note = appendFields(header.get(record, "note"), []field{{name: "TOTP", value: header.get(record, "totp")}})
+
+		if header.get(record, "type") == model.SecretTypeNote {
+			secret.Type = model.SecretTypeNote
+		} else {
+			classify(secret)
+		}
+
+		result.addEntry(index, secret, nil)
+	}
+
+	return result, nil
+}
+
+// csvTime - Firefox stores time as a number of milliseconds since Unix epoch
+func csvTime(value string) *time.Time {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms <= 0 {
+		return nil
+	}
+
+	return timePtr(time.UnixMilli(ms))
+}
@@ -0,0 +1,114 @@
+package importer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+func TestParseCSVChrome(t *testing.T) {
+	result := parseFixture(t, FormatCSV, "chrome.csv", "")
+
+	require.Equal(t, []*model.Secret{
+		{
+			Type:     model.SecretTypePassword,
+			Title:    "Mail",
+			Login:    "tony",
+			Password: "mail password",
+			URL:      "https://mail.example.com/",
+			Note:     "personal mailbox",
+		},
+		{
+			Type:     model.SecretTypePassword,
+			Title:    "shop.example.com",
+			Login:    "tony@example.com",
+			Password: "shop password",
+			URL:      "https://www.shop.example.com/login",
+		},
+		{
+			Type:     model.SecretTypePassword,
+			Title:    "Quoted, title",
+			Login:    "tony",
+			Password: `pa"ss`,
+			URL:      "https://quoted.example.com/",
+		},
+	}, secrets(result))
+
+	require.Equal(t, []ItemError{{Item: 4, Error: "wrong number of columns"}}, result.Errors)
+}
+
+func TestParseCSVFirefox(t *testing.T) {
+	result := parseFixture(t, FormatCSV, "firefox.csv", "")
+	created := time.Date(2023, 5, 14, 10, 30, 0, 0, time.UTC)
+	updated := time.Date(2023, 6, 1, 8, 0, 0, 0, time.UTC)
+
+	require.Equal(t, []*model.Secret{
+		{
+			Type:      model.SecretTypePassword,
+			Title:     "mail.example.com",
+			Login:     "tony",
+			Password:  "mail password",
+			URL:       "https://mail.example.com",
+			CreatedAt: &created,
+			UpdatedAt: &updated,
+		},
+		{
+			Type:      model.SecretTypePassword,
+			Title:     "forum.example.com",
+			Password:  "forum password",
+			URL:       "https://forum.example.com",
+			CreatedAt: &created,
+			UpdatedAt: &created,
+		},
+	}, secrets(result))
+	require.Empty(t, result.Errors)
+}
+
+func TestParseCSVBitwarden(t *testing.T) {
+	result := parseFixture(t, FormatCSV, "bitwarden.csv", "")
+
+	require.Equal(t, []*model.Secret{
+		{
+			Type:     model.SecretTypePassword,
+			Title:    "Mail",
+			Login:    "tony",
+			Password: "mail password",
+			URL:      "https://mail.example.com",
+			Note:     "personal mailbox\nTOTP: JBSWY3DPEHPK3PXP",
+			Favorite: true,
+		},
+		{
+			Type:  model.SecretTypeNote,
+			Title: "Wi-Fi",
+			Note:  "network: home\npassword: qwerty",
+		},
+	}, secrets(result))
+}
+
+func TestParseCSVInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "empty", data: ""},
+		{name: "unknown columns", data: "a,b,c\n1,2,3\n"},
+		{name: "broken quotes", data: "name,password\n\"Mail,secret\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(FormatCSV, []byte(tt.data), "")
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestParseCSVMissingTitle(t *testing.T) {
+	result, err := Parse(FormatCSV, []byte("name,username,password\n,tony,secret\n"), "")
+	require.NoError(t, err)
+	require.Empty(t, result.Items)
+	require.Equal(t, []ItemError{{Item: 1, Error: ErrMissingTitle.Error()}}, result.Errors)
+}
@@ -0,0 +1,206 @@
+// Package importer converts exports of other password managers into secrets.
+//
+// Supported formats:
+//
+//   - "bitwarden" - unencrypted JSON export of Bitwarden
+//   - "keepass" - KeePass KDBX 4 database or unencrypted KeePass XML export
+//   - "1password" - 1PUX export of 1Password
+//   - "csv" - CSV export of Chrome, Firefox, Bitwarden and other applications, columns are detected by the header
+//
+// Logins become password secrets, secure notes become notes, credit cards become card secrets.
+// Fields which don't have a counterpart in the secret, for instance custom fields or identity details,
+// are appended to the secret note. Every file attachment becomes a separate file secret.
+//
+// An item which cannot be converted doesn't stop the import, it is reported in Result.Errors.
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// Supported formats
+const (
+	FormatBitwarden   = "bitwarden"
+	FormatKeePass     = "keepass"
+	FormatOnePassword = "1password"
+	FormatCSV         = "csv"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown import format")
+	ErrInvalidFile   = errors.New("invalid import file")
+	ErrEmptyItem     = errors.New("item doesn't contain any data")
+	ErrMissingTitle  = errors.New("item doesn't have a title")
+)
+
+// utf8BOM - byte order mark, which some applications put at the beginning of exported files
+var utf8BOM = []byte("\xEF\xBB\xBF")
+
+// Item - a secret which is converted from an item of the imported file. An item with attachments
+// produces several secrets, all of them have the same index.
+type Item struct {
+	// Index - position of the item in the imported file, starting with 1
+	Index  int
+	Secret *model.Secret
+}
+
+// ItemError - describes an item of the imported file which cannot be converted into a secret
+type ItemError struct {
+	Item  int    `json:"item"`
+	Title string `json:"title,omitempty"`
+	Error string `json:"error"`
+}
+
+// Result - secrets which are converted from the imported file and items which cannot be converted
+type Result struct {
+	Items  []Item
+	Errors []ItemError
+}
+
+func (r *Result) add(index int, secret *model.Secret) {
+	r.Items = append(r.Items, Item{Index: index, Secret: secret})
+}
+
+func (r *Result) fail(index int, title string, err error) {
+	r.Errors = append(r.Errors, ItemError{Item: index, Title: title, Error: err.Error()})
+}
+
+// addEntry - adds a secret and its attachments. Empty secrets and secrets without a title are reported as errors.
+func (r *Result) addEntry(index int, secret *model.Secret, attachments []*model.Secret) {
+	if secret.Title == "" {
+		secret.Title = hostname(secret.URL)
+	}
+
+	switch {
+	case secret.Title == "":
+		r.fail(index, "", ErrMissingTitle)
+	case secret.Type == "" && len(attachments) == 0:
+		r.fail(index, secret.Title, ErrEmptyItem)
+	default:
+		if secret.Type != "" {
+			r.add(index, secret)
+		} else if len(attachments) == 1 {
+			// The item is just a container of the file, so the file gets the title of the item
+			attachments[0].Title = secret.Title
+		}
+
+		for _, attachment := range attachments {
+			r.add(index, attachment)
+		}
+	}
+}
+
+// parser - converts content of an imported file, password is required only by encrypted formats
+type parser func(data []byte, password string) (*Result, error)
+
+var parsers = map[string]parser{
+	FormatBitwarden:   parseBitwarden,
+	FormatKeePass:     parseKeePass,
+	FormatOnePassword: parseOnePassword,
+	FormatCSV:         parseCSV,
+}
+
+// Formats - returns names of supported formats
+func Formats() []string {
+	formats := make([]string, 0, len(parsers))
+	for format := range parsers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	return formats
+}
+
+// Parse - converts content of an exported file of the format into secrets
+func Parse(format string, data []byte, password string) (*Result, error) {
+	parse, ok := parsers[format]
+	if !ok {
+		return nil, ErrUnknownFormat
+	}
+
+	return parse(bytes.TrimPrefix(data, utf8BOM), password)
+}
+
+// field - a named value which doesn't have a counterpart in the secret
+type field struct {
+	name  string
+	value string
+}
+
+// appendFields - appends fields with non-empty values to the note, one field per line
+func appendFields(note string, fields []field) string {
+	lines := make([]string, 0, len(fields)+1)
+	if note != "" {
+		lines = append(lines, note)
+	}
+
+	for _, f := range fields {
+		if f.value != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", f.name, f.value))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// classify - sets the secret type based on its content: secrets with credentials are passwords,
+// secrets which have only a note are notes, and secrets without content don't get a type at all
+func classify(secret *model.Secret) {
+	switch {
+	case secret.Login != "" || secret.Password != "" || secret.URL != "":
+		secret.Type = model.SecretTypePassword
+	case secret.Note != "":
+		secret.Type = model.SecretTypeNote
+	}
+}
+
+// newFile - creates a file secret for an attachment of an item
+func newFile(title, fileName string, content []byte) *model.Secret {
+	return &model.Secret{
+		Type:     model.SecretTypeFile,
+		Title:    fmt.Sprintf("%s - %s", title, fileName),
+		FileName: fileName,
+		File:     content,
+	}
+}
+
+// cardExpiration - formats card expiration as MM/YYYY, which is understood by model.ParseCardExpiration
+func cardExpiration(month, year int) string {
+	if month < 1 || month > 12 || year <= 0 {
+		return ""
+	}
+
+	if year < 100 {
+		year += 2000
+	}
+
+	return fmt.Sprintf("%02d/%d", month, year)
+}
+
+// hostname - returns host name of the URL, which is used as a title of items which don't have one
+func hostname(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	t = t.UTC()
+
+	return &t
+}
@@ -0,0 +1,73 @@
+package importer
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+func parseFixture(t *testing.T, format, name, password string) *Result {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+
+	result, err := Parse(format, data, password)
+	require.NoError(t, err)
+
+	return result
+}
+
+// secrets - returns converted secrets without item indexes
+func secrets(result *Result) []*model.Secret {
+	converted := make([]*model.Secret, 0, len(result.Items))
+	for _, item := range result.Items {
+		converted = append(converted, item.Secret)
+	}
+
+	return converted
+}
+
+func TestParseUnknownFormat(t *testing.T) {
+	_, err := Parse("lastpass", []byte("url,username,password"), "")
+	require.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestFormats(t *testing.T) {
+	require.Equal(t, []string{FormatOnePassword, FormatBitwarden, FormatCSV, FormatKeePass}, Formats())
+}
+
+func TestParseSkipsBOM(t *testing.T) {
+	result, err := Parse(FormatCSV, []byte("\xEF\xBB\xBFname,username,password\nMail,tony,secret\n"), "")
+	require.NoError(t, err)
+	require.Len(t, result.Items, 1)
+	require.Equal(t, "Mail", result.Items[0].Secret.Title)
+}
+
+func TestAppendFields(t *testing.T) {
+	fields := []field{{name: "PIN", value: "1234"}, {name: "Empty"}, {name: "TOTP", value: "secret"}}
+
+	require.Equal(t, "note\nPIN: 1234\nTOTP: secret", appendFields("note", fields))
+	require.Equal(t, "PIN: 1234\nTOTP: secret", appendFields("", fields))
+	require.Equal(t, "note", appendFields("note", nil))
+}
+
+func TestCardExpiration(t *testing.T) {
+	require.Equal(t, "07/2027", cardExpiration(7, 2027))
+	require.Equal(t, "12/2030", cardExpiration(12, 30))
+	require.Equal(t, "", cardExpiration(13, 2027))
+	require.Equal(t, "", cardExpiration(1, 0))
+
+	_, ok := model.ParseCardExpiration(cardExpiration(7, 2027))
+	require.True(t, ok)
+}
+
+func TestHostname(t *testing.T) {
+	require.Equal(t, "shop.example.com", hostname("https://www.shop.example.com/login"))
+	require.Equal(t, "mail.example.com", hostname(" https://mail.example.com:8443 "))
+	require.Equal(t, "", hostname("not a url"))
+	require.Equal(t, "", hostname(""))
+}
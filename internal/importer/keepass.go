@@ -0,0 +1,85 @@
+package importer
+
+import (
+	"errors"
+
+	"github.com/grafviktor/keep-my-secret/internal/kdbx"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// parseKeePass - reads a KDBX file, if the data starts with KDBX signature, otherwise an XML export.
+// Entries of the recycle bin are not imported.
+func parseKeePass(data []byte, password string) (*Result, error) {
+	var db *kdbx.Database
+	var err error
+
+	if kdbx.IsKDBX(data) {
+		if password == "" {
+			return nil, errors.New("master password of the KeePass database is required")
+		}
+
+		db, err = kdbx.Open(data, password)
+	} else {
+		db, err = kdbx.ParseXML(data)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	for i, entry := range db.Entries() {
+		index := i + 1
+		title := entry.Get(kdbx.FieldTitle)
+
+		secret := &model.Secret{
+			Title:    title,
+			Login:    entry.Get(kdbx.FieldUserName),
+			Password: entry.Get(kdbx.FieldPassword),
+			URL:      entry.Get(kdbx.FieldURL),
+		}
+
+		fields := make([]field, 0)
+		for _, custom := range entry.CustomFields() {
+			fields = append(fields, field{name: custom.Key, value: custom.Value.Content})
+		}
+		secret.Note = appendFields(entry.Get(kdbx.FieldNotes), fields)
+
+		if created, ok := kdbx.ParseTime(entry.Times.CreationTime); ok {
+			secret.CreatedAt = timePtr(created)
+		}
+
+		if updated, ok := kdbx.ParseTime(entry.Times.LastModificationTime); ok {
+			secret.UpdatedAt = timePtr(updated)
+		}
+
+		if expires, ok := kdbx.ParseTime(entry.Times.ExpiryTime); ok && bool(entry.Times.Expires) {
+			secret.ExpiresAt = timePtr(expires)
+		}
+
+		classify(secret)
+
+		if secret.Title == "" {
+			secret.Title = hostname(secret.URL)
+		}
+
+		attachments := make([]*model.Secret, 0, len(entry.Binaries))
+		for _, ref := range entry.Binaries {
+			var content []byte
+			if content, err = db.Attachment(ref); err != nil {
+				break
+			}
+
+			attachments = append(attachments, newFile(secret.Title, ref.Key, content))
+		}
+
+		if err != nil {
+			result.fail(index, title, err)
+			continue
+		}
+
+		result.addEntry(index, secret, attachments)
+	}
+
+	return result, nil
+}
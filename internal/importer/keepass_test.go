@@ -0,0 +1,68 @@
+package importer
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/kdbx"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+func TestParseKeePass(t *testing.T) {
+	created := time.Date(2023, 5, 14, 10, 30, 0, 0, time.UTC)
+
+	want := []*model.Secret{
+		{
+			Type:      model.SecretTypePassword,
+			Title:     "Mail",
+			Login:     "tony",
+			Password:  "mail password",
+			URL:       "https://mail.example.com",
+			Note:      "personal mailbox\nPIN: 1234",
+			CreatedAt: &created,
+			UpdatedAt: &created,
+		},
+		{
+			Type:     model.SecretTypeFile,
+			Title:    "Passport",
+			FileName: "hello.txt",
+			File:     []byte("Hello, KeePass!"),
+		},
+		{
+			Type:      model.SecretTypePassword,
+			Title:     "VPN",
+			Login:     "t.tester",
+			Password:  "vpn <password> & more",
+			CreatedAt: &created,
+			UpdatedAt: &created,
+		},
+	}
+
+	// Both files contain the same database, entries of the recycle bin are not imported
+	for _, name := range []string{"keepass.kdbx", "keepass.xml"} {
+		t.Run(name, func(t *testing.T) {
+			result := parseFixture(t, FormatKeePass, name, "test password")
+
+			require.Equal(t, want, secrets(result))
+			require.Equal(t, []int{1, 2, 3}, []int{result.Items[0].Index, result.Items[1].Index, result.Items[2].Index})
+			require.Empty(t, result.Errors)
+		})
+	}
+}
+
+func TestParseKeePassInvalid(t *testing.T) {
+	data, err := os.ReadFile("testdata/keepass.kdbx")
+	require.NoError(t, err)
+
+	_, err = Parse(FormatKeePass, data, "")
+	require.Error(t, err, "master password is required")
+
+	_, err = Parse(FormatKeePass, data, "wrong password")
+	require.ErrorIs(t, err, kdbx.ErrWrongPassword)
+
+	_, err = Parse(FormatKeePass, []byte(`{"items":[]}`), "")
+	require.ErrorIs(t, err, kdbx.ErrInvalidFile)
+}
@@ -0,0 +1,308 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+const (
+	onePasswordData     = "export.data"
+	onePasswordFilesDir = "files/"
+	onePasswordArchived = "archived"
+	// maxOnePasswordEntrySize - maximum size of a single unpacked file of 1PUX archive
+	maxOnePasswordEntrySize = 64 * 1024 * 1024
+)
+
+// Categories of 1Password items which need special handling. Logins, passwords and secure notes
+// are recognized by their content, items of other categories, for instance identities, become notes.
+const (
+	onePasswordCategoryCard     = "002"
+	onePasswordCategoryDocument = "006"
+)
+
+type onePasswordExport struct {
+	Accounts []struct {
+		Vaults []struct {
+			Items []onePasswordItem `json:"items"`
+		} `json:"vaults"`
+	} `json:"accounts"`
+}
+
+type onePasswordItem struct {
+	FavIndex     int    `json:"favIndex"`
+	CreatedAt    int64  `json:"createdAt"`
+	UpdatedAt    int64  `json:"updatedAt"`
+	State        string `json:"state"`
+	CategoryUUID string `json:"categoryUuid"`
+	Details      struct {
+		LoginFields []struct {
+			Value       string `json:"value"`
+			Name        string `json:"name"`
+			Designation string `json:"designation"`
+		} `json:"loginFields"`
+		NotesPlain string `json:"notesPlain"`
+		Password   string `json:"password"`
+		Sections   []struct {
+			Title  string `json:"title"`
+			Fields []struct {
+				Title string                     `json:"title"`
+				ID    string                     `json:"id"`
+				Value map[string]json.RawMessage `json:"value"`
+			} `json:"fields"`
+		} `json:"sections"`
+		DocumentAttributes *onePasswordDocument `json:"documentAttributes"`
+	} `json:"details"`
+	Overview struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+		URLs  []struct {
+			URL string `json:"url"`
+		} `json:"urls"`
+	} `json:"overview"`
+}
+
+type onePasswordDocument struct {
+	FileName   string `json:"fileName"`
+	DocumentID string `json:"documentId"`
+}
+
+// path - location of the document inside 1PUX archive
+func (d onePasswordDocument) path() string {
+	return fmt.Sprintf("%s%s__%s", onePasswordFilesDir, d.DocumentID, d.FileName)
+}
+
+// parseOnePassword - reads 1PUX export, which is a zip archive with items in "export.data"
+// and their attachments in "files/" directory. Archived items are not imported.
+func parseOnePassword(data []byte, _ string) (*Result, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrInvalidFile
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	dataFile, ok := files[onePasswordData]
+	if !ok {
+		return nil, ErrInvalidFile
+	}
+
+	content, err := readZipEntry(dataFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var export onePasswordExport
+	if err = json.Unmarshal(content, &export); err != nil {
+		return nil, ErrInvalidFile
+	}
+
+	result := &Result{}
+	index := 0
+	for _, account := range export.Accounts {
+		for _, vault := range account.Vaults {
+			for _, item := range vault.Items {
+				index++
+				if item.State == onePasswordArchived {
+					continue
+				}
+
+				secret, documents := item.secret()
+
+				attachments := make([]*model.Secret, 0, len(documents))
+				for _, document := range documents {
+					var file []byte
+					if file, err = readOnePasswordDocument(files, document); err != nil {
+						break
+					}
+
+					attachments = append(attachments, newFile(secret.Title, document.FileName, file))
+				}
+
+				if err != nil {
+					result.fail(index, secret.Title, err)
+					continue
+				}
+
+				result.addEntry(index, secret, attachments)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// secret - converts the item into a secret and returns documents which are attached to it
+func (i onePasswordItem) secret() (*model.Secret, []onePasswordDocument) {
+	secret := &model.Secret{
+		Title:    i.Overview.Title,
+		URL:      i.Overview.URL,
+		Password: i.Details.Password,
+		Favorite: i.FavIndex > 0,
+	}
+
+	if i.CreatedAt > 0 {
+		secret.CreatedAt = timePtr(time.Unix(i.CreatedAt, 0))
+	}
+
+	if i.UpdatedAt > 0 {
+		secret.UpdatedAt = timePtr(time.Unix(i.UpdatedAt, 0))
+	}
+
+	for _, f := range i.Details.LoginFields {
+		switch f.Designation {
+		case "username":
+			secret.Login = f.Value
+		case "password":
+			secret.Password = f.Value
+		}
+	}
+
+	if secret.URL == "" && len(i.Overview.URLs) > 0 {
+		secret.URL = i.Overview.URLs[0].URL
+	}
+
+	fields := make([]field, 0)
+	for _, u := range i.Overview.URLs {
+		if u.URL != secret.URL {
+			fields = append(fields, field{name: "URL", value: u.URL})
+		}
+	}
+
+	documents := make([]onePasswordDocument, 0)
+	if i.Details.DocumentAttributes != nil {
+		documents = append(documents, *i.Details.DocumentAttributes)
+	}
+
+	isCard := i.CategoryUUID == onePasswordCategoryCard
+	for _, section := range i.Details.Sections {
+		for _, f := range section.Fields {
+			if document, ok := onePasswordFile(f.Value); ok {
+				documents = append(documents, document)
+				continue
+			}
+
+			value := onePasswordValue(f.Value)
+			switch {
+			case isCard && f.ID == "cardholder":
+				secret.CardholderName = value
+			case isCard && f.ID == "ccnum":
+				secret.CardNumber = value
+			case isCard && f.ID == "cvv":
+				secret.SecurityCode = value
+			case isCard && f.ID == "expiry":
+				secret.Expiration = value
+			default:
+				fields = append(fields, field{name: f.Title, value: value})
+			}
+		}
+	}
+
+	secret.Note = appendFields(i.Details.NotesPlain, fields)
+
+	switch {
+	case isCard:
+		secret.Type = model.SecretTypeCard
+	case i.CategoryUUID == onePasswordCategoryDocument && secret.Note == "":
+		// Documents without notes are imported as files only
+	default:
+		classify(secret)
+	}
+
+	return secret, documents
+}
+
+// onePasswordValue - converts a value of a section field to a string. The value is an object
+// with a single key, which defines the type of the value.
+func onePasswordValue(value map[string]json.RawMessage) string {
+	for kind, raw := range value {
+		switch kind {
+		case "monthYear":
+			// Card expiration is stored as a number: 202712
+			var monthYear int
+			if json.Unmarshal(raw, &monthYear) == nil {
+				return cardExpiration(monthYear%100, monthYear/100)
+			}
+		case "date":
+			var date int64
+			if json.Unmarshal(raw, &date) == nil {
+				return time.Unix(date, 0).UTC().Format("2006-01-02")
+			}
+		case "email":
+			var email struct {
+				Address string `json:"email_address"`
+			}
+			if json.Unmarshal(raw, &email) == nil {
+				return email.Address
+			}
+		}
+
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			return s
+		}
+
+		var n json.Number
+		if json.Unmarshal(raw, &n) == nil {
+			return n.String()
+		}
+
+		var b bool
+		if json.Unmarshal(raw, &b) == nil {
+			return strconv.FormatBool(b)
+		}
+
+		// Complex values, for instance addresses, are kept as they are
+		return string(raw)
+	}
+
+	return ""
+}
+
+func onePasswordFile(value map[string]json.RawMessage) (onePasswordDocument, bool) {
+	document := onePasswordDocument{}
+
+	raw, ok := value["file"]
+	if !ok || json.Unmarshal(raw, &document) != nil {
+		return document, false
+	}
+
+	return document, true
+}
+
+func readOnePasswordDocument(files map[string]*zip.File, document onePasswordDocument) ([]byte, error) {
+	f, ok := files[document.path()]
+	if !ok {
+		return nil, fmt.Errorf("attachment %q is missing in the archive", document.FileName)
+	}
+
+	return readZipEntry(f)
+}
+
+func readZipEntry(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > maxOnePasswordEntrySize {
+		return nil, ErrInvalidFile
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, ErrInvalidFile
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxOnePasswordEntrySize+1))
+	if err != nil || len(data) > maxOnePasswordEntrySize {
+		return nil, ErrInvalidFile
+	}
+
+	return data, nil
+}
@@ -0,0 +1,77 @@
+package importer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+func TestParseOnePassword(t *testing.T) {
+	result := parseFixture(t, FormatOnePassword, "1password.1pux", "")
+	created := time.Date(2023, 5, 14, 10, 30, 0, 0, time.UTC)
+	updated := time.Date(2023, 6, 1, 8, 0, 0, 0, time.UTC)
+
+	require.Equal(t, []*model.Secret{
+		{
+			Type:      model.SecretTypePassword,
+			Title:     "Mail",
+			Login:     "tony",
+			Password:  "mail password",
+			URL:       "https://mail.example.com",
+			Note:      "personal mailbox\nURL: https://webmail.example.com\nPIN: 1234",
+			Favorite:  true,
+			CreatedAt: &created,
+			UpdatedAt: &updated,
+		},
+		{
+			Type:     model.SecretTypeFile,
+			Title:    "Mail - codes.txt",
+			FileName: "codes.txt",
+			File:     []byte("1111 2222 3333\n"),
+		},
+		{
+			Type:           model.SecretTypeCard,
+			Title:          "Visa",
+			Note:           "type: visa\nphone (toll free): +1 800 123 4567",
+			CardholderName: "TONY TESTER",
+			CardNumber:     "4111111111111111",
+			Expiration:     "07/2027",
+			SecurityCode:   "123",
+			CreatedAt:      &created,
+			UpdatedAt:      &created,
+		},
+		{
+			Type:      model.SecretTypeNote,
+			Title:     "Wi-Fi",
+			Note:      "network: home\npassword: qwerty",
+			CreatedAt: &created,
+			UpdatedAt: &created,
+		},
+		{
+			Type:     model.SecretTypeFile,
+			Title:    "Passport",
+			FileName: "passport.txt",
+			File:     []byte("passport scan\n"),
+		},
+	}, secrets(result))
+
+	// The attachment belongs to the same item as the login, the archived item is skipped
+	indexes := make([]int, 0, len(result.Items))
+	for _, item := range result.Items {
+		indexes = append(indexes, item.Index)
+	}
+	require.Equal(t, []int{1, 1, 2, 3, 4}, indexes)
+
+	require.Len(t, result.Errors, 1)
+	require.Equal(t, 6, result.Errors[0].Item)
+	require.Equal(t, "Missing document", result.Errors[0].Title)
+	require.Contains(t, result.Errors[0].Error, "missing.txt")
+}
+
+func TestParseOnePasswordInvalid(t *testing.T) {
+	_, err := Parse(FormatOnePassword, []byte("export.data"), "")
+	require.ErrorIs(t, err, ErrInvalidFile)
+}
@@ -0,0 +1,283 @@
+// Package kdbx reads and writes KeePass databases: KDBX 4 files and unencrypted KeePass XML exports.
+//
+// KDBX 4 file consists of a plain text header, its SHA-256 hash and HMAC, and a sequence of blocks
+// protected with HMAC-SHA-256. Blocks contain the database encrypted with AES-256-CBC or ChaCha20
+// and optionally compressed with gzip. The decrypted database starts with an inner header, which
+// holds file attachments and the key of the stream cipher which additionally protects passwords
+// inside the XML document. The encryption key is derived from the master password with AES-KDF
+// or Argon2id. Argon2d, Twofish and key files are not supported.
+//
+// The XML document has the same structure in both KDBX files and XML exports, only values which are
+// protected in a KDBX file are stored in plain text in an export.
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Standard fields of an entry
+const (
+	FieldTitle    = "Title"
+	FieldUserName = "UserName"
+	FieldPassword = "Password"
+	FieldURL      = "URL"
+	FieldNotes    = "Notes"
+)
+
+// maxAttachmentSize - maximum size of a decompressed attachment of XML export
+const maxAttachmentSize = 64 * 1024 * 1024
+
+var (
+	ErrInvalidFile     = errors.New("invalid KeePass database")
+	ErrUnsupported     = errors.New("unsupported KeePass database format")
+	ErrWrongPassword   = errors.New("wrong master password or damaged database")
+	ErrInvalidBinaryID = errors.New("attachment not found")
+)
+
+// Database - KeePass database document
+type Database struct {
+	XMLName xml.Name `xml:"KeePassFile"`
+	Meta    Meta     `xml:"Meta"`
+	Root    Root     `xml:"Root"`
+	// Binaries - attachments from the inner header of a KDBX 4 file, which are referenced by index
+	Binaries [][]byte `xml:"-"`
+}
+
+// Meta - database metadata
+type Meta struct {
+	Generator         string       `xml:"Generator"`
+	DatabaseName      string       `xml:"DatabaseName"`
+	RecycleBinEnabled Bool         `xml:"RecycleBinEnabled"`
+	RecycleBinUUID    string       `xml:"RecycleBinUUID"`
+	Binaries          []MetaBinary `xml:"Binaries>Binary"`
+}
+
+// MetaBinary - attachment of an XML export
+type MetaBinary struct {
+	ID         string `xml:"ID,attr"`
+	Compressed Bool   `xml:"Compressed,attr"`
+	Content    string `xml:",chardata"`
+}
+
+// Root - container of top-level groups
+type Root struct {
+	Groups []*Group `xml:"Group"`
+}
+
+// Group - folder which contains entries and other groups
+type Group struct {
+	UUID    string   `xml:"UUID"`
+	Name    string   `xml:"Name"`
+	Entries []*Entry `xml:"Entry"`
+	Groups  []*Group `xml:"Group"`
+}
+
+// Entry - a database record. Entry history is not read.
+type Entry struct {
+	UUID     string      `xml:"UUID"`
+	Times    Times       `xml:"Times"`
+	Strings  []String    `xml:"String"`
+	Binaries []BinaryRef `xml:"Binary"`
+}
+
+// String - a named text field of an entry
+type String struct {
+	Key   string      `xml:"Key"`
+	Value StringValue `xml:"Value"`
+}
+
+// StringValue - value of a text field, protected values are encrypted in KDBX files
+type StringValue struct {
+	Protected Bool   `xml:"Protected,attr,omitempty"`
+	Content   string `xml:",chardata"`
+}
+
+// BinaryRef - a named attachment of an entry, which refers to an attachment of the database
+type BinaryRef struct {
+	Key   string `xml:"Key"`
+	Value struct {
+		Ref string `xml:"Ref,attr"`
+	} `xml:"Value"`
+}
+
+// Times - timestamps of an entry. KDBX 4 files store base64 encoded number of seconds since year 1,
+// XML exports store time in ISO 8601 format.
+type Times struct {
+	CreationTime         string `xml:"CreationTime"`
+	LastModificationTime string `xml:"LastModificationTime"`
+	ExpiryTime           string `xml:"ExpiryTime"`
+	Expires              Bool   `xml:"Expires"`
+}
+
+// Bool - boolean value, which KeePass writes as "True" or "False"
+type Bool bool
+
+// MarshalText - implements encoding.TextMarshaler
+func (b Bool) MarshalText() ([]byte, error) {
+	if b {
+		return []byte("True"), nil
+	}
+
+	return []byte("False"), nil
+}
+
+// UnmarshalText - implements encoding.TextUnmarshaler
+func (b *Bool) UnmarshalText(text []byte) error {
+	*b = Bool(strings.EqualFold(strings.TrimSpace(string(text)), "true"))
+
+	return nil
+}
+
+// secondsToUnixEpoch - number of seconds between 0001-01-01 and 1970-01-01
+const secondsToUnixEpoch = 62135596800
+
+// FormatTime - formats time as KDBX 4 files store it
+func FormatTime(t time.Time) string {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, uint64(t.Unix()+secondsToUnixEpoch))
+
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// ParseTime - parses time value of a KDBX file or an XML export
+func ParseTime(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), true
+	}
+
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(data) != 8 {
+		return time.Time{}, false
+	}
+
+	seconds := int64(binary.LittleEndian.Uint64(data))
+
+	return time.Unix(seconds-secondsToUnixEpoch, 0).UTC(), true
+}
+
+// NewUUID - returns a random identifier of a group or an entry
+func NewUUID() (string, error) {
+	uuid, err := randomBytes(16)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(uuid), nil
+}
+
+// Get - returns value of a text field of the entry
+func (e *Entry) Get(key string) string {
+	for _, s := range e.Strings {
+		if s.Key == key {
+			return s.Value.Content
+		}
+	}
+
+	return ""
+}
+
+// CustomFields - returns text fields of the entry which are not standard KeePass fields
+func (e *Entry) CustomFields() []String {
+	result := make([]String, 0)
+	for _, s := range e.Strings {
+		switch s.Key {
+		case FieldTitle, FieldUserName, FieldPassword, FieldURL, FieldNotes:
+			continue
+		}
+
+		result = append(result, s)
+	}
+
+	return result
+}
+
+// ParseXML - parses KeePass XML export
+func ParseXML(data []byte) (*Database, error) {
+	db := Database{}
+	if err := xml.Unmarshal(data, &db); err != nil {
+		return nil, ErrInvalidFile
+	}
+
+	return &db, nil
+}
+
+// Entries - returns all entries of the database except entries in the recycle bin
+func (db *Database) Entries() []*Entry {
+	result := make([]*Entry, 0)
+
+	var walk func(groups []*Group)
+	walk = func(groups []*Group) {
+		for _, group := range groups {
+			if db.isRecycleBin(group) {
+				continue
+			}
+
+			result = append(result, group.Entries...)
+			walk(group.Groups)
+		}
+	}
+	walk(db.Root.Groups)
+
+	return result
+}
+
+func (db *Database) isRecycleBin(group *Group) bool {
+	return bool(db.Meta.RecycleBinEnabled) && group.UUID != "" && group.UUID == db.Meta.RecycleBinUUID
+}
+
+// Attachment - returns content of an attachment which the entry refers to
+func (db *Database) Attachment(ref BinaryRef) ([]byte, error) {
+	if len(db.Binaries) > 0 {
+		index, err := strconv.Atoi(ref.Value.Ref)
+		if err != nil || index < 0 || index >= len(db.Binaries) {
+			return nil, ErrInvalidBinaryID
+		}
+
+		return db.Binaries[index], nil
+	}
+
+	for _, binary := range db.Meta.Binaries {
+		if binary.ID == ref.Value.Ref {
+			return binary.content()
+		}
+	}
+
+	return nil, ErrInvalidBinaryID
+}
+
+func (b MetaBinary) content() ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(b.Content)
+	if err != nil || !bool(b.Compressed) {
+		return data, err
+	}
+
+	return gunzip(data, maxAttachmentSize)
+}
+
+func gunzip(data []byte, limit int64) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	result, err := io.ReadAll(io.LimitReader(zr, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(result)) > limit {
+		return nil, ErrUnsupported
+	}
+
+	return result, nil
+}
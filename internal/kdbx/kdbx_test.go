@@ -0,0 +1,117 @@
+package kdbx
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// requireFixtureDatabase - checks the content of testdata databases, which is the same in all formats
+func requireFixtureDatabase(t *testing.T, db *Database) {
+	t.Helper()
+
+	entries := db.Entries()
+	require.Len(t, entries, 3, "entries of the recycle bin must be skipped")
+
+	mail := entries[0]
+	require.Equal(t, "Mail", mail.Get(FieldTitle))
+	require.Equal(t, "tony", mail.Get(FieldUserName))
+	require.Equal(t, "mail password", mail.Get(FieldPassword))
+	require.Equal(t, "https://mail.example.com", mail.Get(FieldURL))
+	require.Equal(t, "personal mailbox", mail.Get(FieldNotes))
+	require.Equal(t, "", mail.Get("Missing"))
+
+	custom := mail.CustomFields()
+	require.Len(t, custom, 1)
+	require.Equal(t, "PIN", custom[0].Key)
+	require.Equal(t, "1234", custom[0].Value.Content)
+
+	created, ok := ParseTime(mail.Times.CreationTime)
+	require.True(t, ok)
+	require.Equal(t, time.Date(2023, 5, 14, 10, 30, 0, 0, time.UTC), created)
+
+	passport := entries[1]
+	require.Len(t, passport.Binaries, 1)
+	require.Equal(t, "hello.txt", passport.Binaries[0].Key)
+
+	content, err := db.Attachment(passport.Binaries[0])
+	require.NoError(t, err)
+	require.Equal(t, []byte("Hello, KeePass!"), content)
+
+	// Values of nested groups are decrypted in the document order after the values of the parent group
+	require.Equal(t, "VPN", entries[2].Get(FieldTitle))
+	require.Equal(t, "vpn <password> & more", entries[2].Get(FieldPassword))
+}
+
+func TestParseXML(t *testing.T) {
+	data, err := os.ReadFile("testdata/export.xml")
+	require.NoError(t, err)
+
+	db, err := ParseXML(data)
+	require.NoError(t, err)
+	require.Equal(t, "Fixture", db.Meta.DatabaseName)
+	requireFixtureDatabase(t, db)
+}
+
+func TestParseXMLInvalid(t *testing.T) {
+	_, err := ParseXML([]byte("<KeePassFile><Root>"))
+	require.ErrorIs(t, err, ErrInvalidFile)
+}
+
+func TestAttachmentNotFound(t *testing.T) {
+	ref := BinaryRef{Key: "missing.txt"}
+	ref.Value.Ref = "1"
+
+	db := &Database{Binaries: [][]byte{[]byte("content")}}
+	_, err := db.Attachment(ref)
+	require.ErrorIs(t, err, ErrInvalidBinaryID)
+
+	db = &Database{Meta: Meta{Binaries: []MetaBinary{{ID: "0", Content: "Y29udGVudA=="}}}}
+	_, err = db.Attachment(ref)
+	require.ErrorIs(t, err, ErrInvalidBinaryID)
+
+	ref.Value.Ref = "0"
+	content, err := db.Attachment(ref)
+	require.NoError(t, err)
+	require.Equal(t, []byte("content"), content)
+}
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(2023, 5, 14, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{name: "binary", value: FormatTime(want), ok: true},
+		{name: "ISO 8601", value: "2023-05-14T10:30:00Z", ok: true},
+		{name: "ISO 8601 with offset", value: "2023-05-14T12:30:00+02:00", ok: true},
+		{name: "invalid", value: "yesterday", ok: false},
+		{name: "empty", value: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseTime(tt.value)
+			require.Equal(t, tt.ok, ok)
+			if tt.ok {
+				require.Equal(t, want, got)
+			}
+		})
+	}
+}
+
+func TestBool(t *testing.T) {
+	text, err := Bool(true).MarshalText()
+	require.NoError(t, err)
+	require.Equal(t, "True", string(text))
+
+	var b Bool
+	require.NoError(t, b.UnmarshalText([]byte("true")))
+	require.True(t, bool(b))
+	require.NoError(t, b.UnmarshalText([]byte("False")))
+	require.False(t, bool(b))
+}
@@ -0,0 +1,489 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20"
+)
+
+const (
+	signature1   = 0x9AA2D903
+	signature2   = 0xB54BFB67
+	majorVersion = 4
+
+	// maxDatabaseSize - maximum size of the decrypted and decompressed database
+	maxDatabaseSize = 256 * 1024 * 1024
+	// maxAESRounds, maxArgon2Memory, maxArgon2Iterations and maxArgon2Parallelism protect the server
+	// from databases which would take too much time or memory to open. Any user can upload a database,
+	// so opening it should take about a second at most.
+	maxAESRounds         = 10_000_000
+	maxArgon2Memory      = 64 * 1024 * 1024 // in bytes
+	maxArgon2Iterations  = 10
+	maxArgon2Parallelism = 16
+
+	// headerBlockIndex - the header HMAC is calculated as for a block with the maximum index
+	headerBlockIndex    = ^uint64(0)
+	compressionGzip     = 1
+	innerStreamChaCha20 = 3
+)
+
+// Outer header fields
+const (
+	headerEnd         = 0
+	headerCipherID    = 2
+	headerCompression = 3
+	headerMasterSeed  = 4
+	headerIV          = 7
+	headerKDF         = 11
+)
+
+// Inner header fields
+const (
+	innerHeaderEnd      = 0
+	innerHeaderStreamID = 1
+	innerHeaderKey      = 2
+	innerHeaderBinary   = 3
+)
+
+// Identifiers of ciphers and key derivation functions
+var (
+	cipherAES256   = mustDecodeUUID("31C1F2E6BF714350BE5805216AFC5AFF")
+	cipherChaCha20 = mustDecodeUUID("D6038A2B8B6F4CB5A524339A31DBB59A")
+	kdfAES         = mustDecodeUUID("C9D9F39A628A4460BF740D08C18A4FEA")
+	kdfAESKDBX4    = mustDecodeUUID("7C02BB8279A74AC0927D114A00648238")
+	kdfArgon2id    = mustDecodeUUID("9E298B1956DB4773B23DFC3EC6F0A1E6")
+)
+
+// filePrefix - signatures and version which start a KDBX file
+type filePrefix struct {
+	Signature1   uint32
+	Signature2   uint32
+	MinorVersion uint16
+	MajorVersion uint16
+}
+
+type header struct {
+	cipherID   []byte
+	compressed bool
+	masterSeed []byte
+	iv         []byte
+	kdf        variantDictionary
+}
+
+// IsKDBX - reports whether the data looks like a KDBX file of any version
+func IsKDBX(data []byte) bool {
+	return len(data) >= 8 &&
+		binary.LittleEndian.Uint32(data) == signature1 &&
+		binary.LittleEndian.Uint32(data[4:]) == signature2
+}
+
+// Open - decrypts a KDBX 4 file protected with the master password
+func Open(data []byte, password string) (*Database, error) {
+	if !IsKDBX(data) {
+		return nil, ErrInvalidFile
+	}
+
+	r := bytes.NewReader(data)
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	headerData := data[:len(data)-r.Len()]
+	storedHash := make([]byte, sha256.Size)
+	storedHMAC := make([]byte, sha256.Size)
+	if _, err = io.ReadFull(r, storedHash); err != nil {
+		return nil, ErrInvalidFile
+	}
+
+	if _, err = io.ReadFull(r, storedHMAC); err != nil {
+		return nil, ErrInvalidFile
+	}
+
+	headerHash := sha256.Sum256(headerData)
+	if !hmac.Equal(headerHash[:], storedHash) {
+		return nil, ErrInvalidFile
+	}
+
+	transformedKey, err := transformKey(compositeKey(password), h.kdf)
+	if err != nil {
+		return nil, err
+	}
+
+	hmacKey := hmacBaseKey(h.masterSeed, transformedKey)
+	if !hmac.Equal(blockHMAC(hmacKey, headerBlockIndex, headerData), storedHMAC) {
+		return nil, ErrWrongPassword
+	}
+
+	payload, err := readBlocks(r, hmacKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := decrypt(h, encryptionKey(h.masterSeed, transformedKey), payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.compressed {
+		if plain, err = gunzip(plain, maxDatabaseSize); err != nil {
+			return nil, ErrInvalidFile
+		}
+	}
+
+	return readContent(plain)
+}
+
+func readHeader(r *bytes.Reader) (header, error) {
+	h := header{}
+
+	var prefix filePrefix
+	if err := binary.Read(r, binary.LittleEndian, &prefix); err != nil {
+		return h, ErrInvalidFile
+	}
+
+	if prefix.MajorVersion != majorVersion {
+		return h, ErrUnsupported
+	}
+
+	for {
+		id, err := r.ReadByte()
+		if err != nil {
+			return h, ErrInvalidFile
+		}
+
+		var value []byte
+		if value, err = readSized(r); err != nil {
+			return h, err
+		}
+
+		switch id {
+		case headerEnd:
+			if h.cipherID == nil || h.masterSeed == nil || h.iv == nil || h.kdf == nil {
+				return h, ErrInvalidFile
+			}
+
+			return h, nil
+		case headerCipherID:
+			h.cipherID = value
+		case headerCompression:
+			h.compressed = len(value) == 4 && binary.LittleEndian.Uint32(value) == compressionGzip
+		case headerMasterSeed:
+			h.masterSeed = value
+		case headerIV:
+			h.iv = value
+		case headerKDF:
+			if h.kdf, err = readVariantDictionary(value); err != nil {
+				return h, err
+			}
+		}
+	}
+}
+
+// compositeKey - the key which is derived from the master password only, key files are not supported
+func compositeKey(password string) []byte {
+	passwordHash := sha256.Sum256([]byte(password))
+	key := sha256.Sum256(passwordHash[:])
+
+	return key[:]
+}
+
+func transformKey(key []byte, params variantDictionary) ([]byte, error) {
+	uuid, _ := params.bytes("$UUID")
+	salt, ok := params.bytes("S")
+	if !ok {
+		return nil, ErrInvalidFile
+	}
+
+	switch {
+	case bytes.Equal(uuid, kdfAES) || bytes.Equal(uuid, kdfAESKDBX4):
+		rounds, found := params.uint64("R")
+		if !found || rounds > maxAESRounds || len(salt) != 32 {
+			return nil, ErrUnsupported
+		}
+
+		return transformKeyAES(key, salt, rounds)
+	case bytes.Equal(uuid, kdfArgon2id):
+		memory, _ := params.uint64("M")
+		iterations, _ := params.uint64("I")
+		parallelism, _ := params.uint64("P")
+		version, _ := params.uint64("V")
+		secret, _ := params.bytes("K")
+		associated, _ := params.bytes("A")
+		if version != argon2.Version || len(secret) > 0 || len(associated) > 0 ||
+			memory < 8*1024 || memory > maxArgon2Memory ||
+			iterations == 0 || iterations > maxArgon2Iterations ||
+			parallelism == 0 || parallelism > maxArgon2Parallelism {
+			return nil, ErrUnsupported
+		}
+
+		return argon2.IDKey(key, salt, uint32(iterations), uint32(memory/1024), uint8(parallelism), 32), nil
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+func transformKeyAES(key, salt []byte, rounds uint64) ([]byte, error) {
+	block, err := aes.NewCipher(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	transformed := append([]byte{}, key...)
+	for i := uint64(0); i < rounds; i++ {
+		block.Encrypt(transformed[:16], transformed[:16])
+		block.Encrypt(transformed[16:], transformed[16:])
+	}
+
+	result := sha256.Sum256(transformed)
+
+	return result[:], nil
+}
+
+func encryptionKey(masterSeed, transformedKey []byte) []byte {
+	key := sha256.Sum256(append(append([]byte{}, masterSeed...), transformedKey...))
+
+	return key[:]
+}
+
+func hmacBaseKey(masterSeed, transformedKey []byte) []byte {
+	key := sha512.Sum512(append(append(append([]byte{}, masterSeed...), transformedKey...), 1))
+
+	return key[:]
+}
+
+// blockHMAC - every block of the file is authenticated with its own key derived from the block index
+func blockHMAC(hmacKey []byte, index uint64, data []byte) []byte {
+	indexBytes := make([]byte, 8)
+	binary.LittleEndian.PutUint64(indexBytes, index)
+	blockKey := sha512.Sum512(append(indexBytes, hmacKey...))
+
+	mac := hmac.New(sha256.New, blockKey[:])
+	if index != headerBlockIndex {
+		mac.Write(indexBytes)
+		_ = binary.Write(mac, binary.LittleEndian, int32(len(data)))
+	}
+	mac.Write(data)
+
+	return mac.Sum(nil)
+}
+
+func readBlocks(r *bytes.Reader, hmacKey []byte) ([]byte, error) {
+	payload := bytes.Buffer{}
+
+	for index := uint64(0); ; index++ {
+		storedHMAC := make([]byte, sha256.Size)
+		if _, err := io.ReadFull(r, storedHMAC); err != nil {
+			return nil, ErrInvalidFile
+		}
+
+		block, err := readSized(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if !hmac.Equal(blockHMAC(hmacKey, index, block), storedHMAC) {
+			return nil, ErrInvalidFile
+		}
+
+		if len(block) == 0 {
+			return payload.Bytes(), nil
+		}
+
+		payload.Write(block)
+	}
+}
+
+func decrypt(h header, key, payload []byte) ([]byte, error) {
+	switch {
+	case bytes.Equal(h.cipherID, cipherAES256):
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(h.iv) != aes.BlockSize || len(payload) == 0 || len(payload)%aes.BlockSize != 0 {
+			return nil, ErrInvalidFile
+		}
+
+		plain := make([]byte, len(payload))
+		cipher.NewCBCDecrypter(block, h.iv).CryptBlocks(plain, payload)
+
+		padding := int(plain[len(plain)-1])
+		if padding == 0 || padding > aes.BlockSize {
+			return nil, ErrInvalidFile
+		}
+
+		return plain[:len(plain)-padding], nil
+	case bytes.Equal(h.cipherID, cipherChaCha20):
+		stream, err := chacha20.NewUnauthenticatedCipher(key, h.iv)
+		if err != nil {
+			return nil, ErrInvalidFile
+		}
+
+		plain := make([]byte, len(payload))
+		stream.XORKeyStream(plain, payload)
+
+		return plain, nil
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+// readContent - reads the inner header and the XML document which follows it
+func readContent(data []byte) (*Database, error) {
+	r := bytes.NewReader(data)
+	binaries := make([][]byte, 0)
+
+	var streamID uint32
+	var streamKey []byte
+	for done := false; !done; {
+		id, err := r.ReadByte()
+		if err != nil {
+			return nil, ErrInvalidFile
+		}
+
+		var value []byte
+		if value, err = readSized(r); err != nil {
+			return nil, err
+		}
+
+		switch id {
+		case innerHeaderEnd:
+			done = true
+		case innerHeaderStreamID:
+			if len(value) != 4 {
+				return nil, ErrInvalidFile
+			}
+			streamID = binary.LittleEndian.Uint32(value)
+		case innerHeaderKey:
+			streamKey = value
+		case innerHeaderBinary:
+			if len(value) == 0 {
+				return nil, ErrInvalidFile
+			}
+			// The first byte holds flags of the attachment
+			binaries = append(binaries, value[1:])
+		}
+	}
+
+	if streamID != innerStreamChaCha20 {
+		return nil, ErrUnsupported
+	}
+
+	stream, err := innerStream(streamKey)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := unprotect(data[len(data)-r.Len():], stream)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := ParseXML(document)
+	if err != nil {
+		return nil, err
+	}
+	db.Binaries = binaries
+
+	return db, nil
+}
+
+// innerStream - ChaCha20 stream which protects values inside the XML document
+func innerStream(key []byte) (cipher.Stream, error) {
+	hash := sha512.Sum512(key)
+
+	return chacha20.NewUnauthenticatedCipher(hash[:32], hash[32:44])
+}
+
+// unprotect - replaces protected values of the XML document with plain text
+func unprotect(document []byte, stream cipher.Stream) ([]byte, error) {
+	return rewriteProtected(document, func(value []byte) ([]byte, error) {
+		plain, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(value)))
+		if err != nil {
+			return nil, ErrInvalidFile
+		}
+
+		stream.XORKeyStream(plain, plain)
+
+		return plain, nil
+	})
+}
+
+// rewriteProtected - replaces protected values of the XML document with the result of rewrite function.
+// The values are encrypted with a single stream, so they must be processed in the document order.
+func rewriteProtected(document []byte, rewrite func(value []byte) ([]byte, error)) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+	result := bytes.Buffer{}
+	encoder := xml.NewEncoder(&result)
+
+	protected := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, ErrInvalidFile
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			protected = t.Name.Local == "Value" && isProtected(t.Attr)
+		case xml.EndElement:
+			protected = false
+		case xml.CharData:
+			if protected {
+				var value []byte
+				if value, err = rewrite(t); err != nil {
+					return nil, err
+				}
+
+				token = xml.CharData(value)
+			}
+		}
+
+		if err = encoder.EncodeToken(token); err != nil {
+			return nil, ErrInvalidFile
+		}
+	}
+
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+
+	return result.Bytes(), nil
+}
+
+func isProtected(attrs []xml.Attr) bool {
+	for _, attr := range attrs {
+		if attr.Name.Local == "Protected" && strings.EqualFold(attr.Value, "true") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mustDecodeUUID(s string) []byte {
+	uuid, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return uuid
+}
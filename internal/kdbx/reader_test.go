@@ -0,0 +1,107 @@
+package kdbx
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPassword = "test password"
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+
+	return data
+}
+
+func TestOpen(t *testing.T) {
+	// aes.kdbx uses AES-KDF and AES-256, argon2.kdbx uses Argon2id and ChaCha20
+	for _, name := range []string{"aes.kdbx", "argon2.kdbx"} {
+		t.Run(name, func(t *testing.T) {
+			data := readFixture(t, name)
+			require.True(t, IsKDBX(data))
+
+			db, err := Open(data, testPassword)
+			require.NoError(t, err)
+			require.Equal(t, "Fixture", db.Meta.DatabaseName)
+			requireFixtureDatabase(t, db)
+		})
+	}
+}
+
+func TestOpenWrongPassword(t *testing.T) {
+	_, err := Open(readFixture(t, "argon2.kdbx"), "wrong password")
+	require.ErrorIs(t, err, ErrWrongPassword)
+}
+
+func TestOpenInvalidFile(t *testing.T) {
+	data := readFixture(t, "aes.kdbx")
+
+	unsupportedVersion := append([]byte{}, data...)
+	unsupportedVersion[10] = 3
+
+	modifiedHeader := append([]byte{}, data...)
+	modifiedHeader[20] ^= 0xFF
+
+	modifiedBody := append([]byte{}, data...)
+	modifiedBody[len(modifiedBody)-100] ^= 0xFF
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{name: "empty", data: []byte{}, wantErr: ErrInvalidFile},
+		{name: "XML export", data: readFixture(t, "export.xml"), wantErr: ErrInvalidFile},
+		{name: "KDBX 3", data: unsupportedVersion, wantErr: ErrUnsupported},
+		{name: "modified header", data: modifiedHeader, wantErr: ErrInvalidFile},
+		{name: "modified body", data: modifiedBody, wantErr: ErrInvalidFile},
+		{name: "truncated", data: data[:len(data)-10], wantErr: ErrInvalidFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Open(tt.data, testPassword)
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestTransformKeyLimits(t *testing.T) {
+	salt := make([]byte, 32)
+	argon2Params := func(iterations, memory uint64, parallelism uint32) variantDictionary {
+		return variantDictionary{
+			"$UUID": bytesVariant(kdfArgon2id),
+			"S":     bytesVariant(salt),
+			"I":     uint64Variant(iterations),
+			"M":     uint64Variant(memory),
+			"P":     uint32Variant(parallelism),
+			"V":     uint32Variant(0x13),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		params variantDictionary
+	}{
+		{name: "too many AES rounds", params: variantDictionary{
+			"$UUID": bytesVariant(kdfAESKDBX4),
+			"S":     bytesVariant(salt),
+			"R":     uint64Variant(maxAESRounds + 1),
+		}},
+		{name: "too many iterations", params: argon2Params(maxArgon2Iterations+1, 64*1024, 1)},
+		{name: "too much memory", params: argon2Params(1, maxArgon2Memory+1024, 1)},
+		{name: "too many lanes", params: argon2Params(1, 64*1024, maxArgon2Parallelism+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := transformKey(make([]byte, 32), tt.params)
+			require.ErrorIs(t, err, ErrUnsupported)
+		})
+	}
+}
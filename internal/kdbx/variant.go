@@ -0,0 +1,150 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// Types of VariantDictionary values
+const (
+	variantEnd    = 0x00
+	variantUInt32 = 0x04
+	variantUInt64 = 0x05
+	variantBool   = 0x08
+	variantInt32  = 0x0C
+	variantInt64  = 0x0D
+	variantString = 0x18
+	variantBytes  = 0x42
+)
+
+// variantDictionaryVersion - only the major version byte is checked
+const variantDictionaryVersion = 0x0100
+
+type variant struct {
+	kind  byte
+	value []byte
+}
+
+// variantDictionary - a typed key-value container which stores key derivation parameters
+type variantDictionary map[string]variant
+
+func readVariantDictionary(data []byte) (variantDictionary, error) {
+	r := bytes.NewReader(data)
+
+	var version uint16
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, ErrInvalidFile
+	}
+
+	if version&0xFF00 != variantDictionaryVersion {
+		return nil, ErrUnsupported
+	}
+
+	dict := make(variantDictionary)
+	for {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, ErrInvalidFile
+		}
+
+		if kind == variantEnd {
+			return dict, nil
+		}
+
+		var key, value []byte
+		if key, err = readSized(r); err != nil {
+			return nil, err
+		}
+
+		if value, err = readSized(r); err != nil {
+			return nil, err
+		}
+
+		dict[string(key)] = variant{kind: kind, value: value}
+	}
+}
+
+// readSized - reads a value which is preceded by its length as a little-endian int32
+func readSized(r *bytes.Reader) ([]byte, error) {
+	var size int32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil || size < 0 || int(size) > r.Len() {
+		return nil, ErrInvalidFile
+	}
+
+	value := make([]byte, size)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return nil, ErrInvalidFile
+	}
+
+	return value, nil
+}
+
+func (d variantDictionary) bytes(key string) ([]byte, bool) {
+	v, ok := d[key]
+	if !ok || v.kind != variantBytes {
+		return nil, false
+	}
+
+	return v.value, true
+}
+
+func (d variantDictionary) uint64(key string) (uint64, bool) {
+	v, ok := d[key]
+	if !ok {
+		return 0, false
+	}
+
+	switch {
+	case v.kind == variantUInt64 && len(v.value) == 8:
+		return binary.LittleEndian.Uint64(v.value), true
+	case v.kind == variantUInt32 && len(v.value) == 4:
+		return uint64(binary.LittleEndian.Uint32(v.value)), true
+	}
+
+	return 0, false
+}
+
+func uint32Variant(value uint32) variant {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, value)
+
+	return variant{kind: variantUInt32, value: data}
+}
+
+func uint64Variant(value uint64) variant {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, value)
+
+	return variant{kind: variantUInt64, value: data}
+}
+
+func bytesVariant(value []byte) variant {
+	return variant{kind: variantBytes, value: value}
+}
+
+// write - writes the dictionary with keys in alphabetical order, so the output is deterministic
+func (d variantDictionary) write(w *bytes.Buffer) {
+	_ = binary.Write(w, binary.LittleEndian, uint16(variantDictionaryVersion))
+
+	keys := make([]string, 0, len(d))
+	for key := range d {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		w.WriteByte(d[key].kind)
+		writeSized(w, []byte(key))
+		writeSized(w, d[key].value)
+	}
+
+	w.WriteByte(variantEnd)
+}
+
+// writeSized - writes a value preceded by its length as a little-endian int32
+func writeSized(w *bytes.Buffer, value []byte) {
+	_ = binary.Write(w, binary.LittleEndian, int32(len(value)))
+	w.Write(value)
+}
@@ -0,0 +1,252 @@
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20"
+)
+
+const (
+	// minorVersion - KDBX 4.0, which is supported by KeePass 2.35+ and KeePassXC 2.3+
+	minorVersion   = 0
+	masterSeedSize = 32
+	saltSize       = 32
+	streamKeySize  = 64
+)
+
+var ErrInvalidParams = errors.New("invalid key derivation parameters")
+
+// Params - parameters of Argon2id key derivation function
+type Params struct {
+	Iterations  uint64
+	Memory      uint64 // in bytes
+	Parallelism uint32
+}
+
+// DefaultParams - key derivation parameters which are used if the user doesn't choose them
+var DefaultParams = Params{Iterations: 3, Memory: 64 * 1024 * 1024, Parallelism: 2}
+
+// Validate - checks that the parameters are within the limits, which are also applied when a file is opened
+func (p Params) Validate() error {
+	if p.Iterations == 0 || p.Iterations > maxArgon2Iterations ||
+		p.Memory < 8*1024 || p.Memory > maxArgon2Memory ||
+		p.Parallelism == 0 || p.Parallelism > maxArgon2Parallelism {
+		return ErrInvalidParams
+	}
+
+	return nil
+}
+
+func (p Params) kdf() (variantDictionary, error) {
+	salt, err := randomBytes(saltSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return variantDictionary{
+		"$UUID": bytesVariant(kdfArgon2id),
+		"S":     bytesVariant(salt),
+		"I":     uint64Variant(p.Iterations),
+		"M":     uint64Variant(p.Memory),
+		"P":     uint32Variant(p.Parallelism),
+		"V":     uint32Variant(argon2.Version),
+	}, nil
+}
+
+// Write - writes the database as a KDBX 4 file encrypted with AES-256, the key is derived from the password
+// with Argon2id. Attachments are taken from db.Binaries, values marked as protected are encrypted with
+// the inner stream cipher.
+func Write(w io.Writer, db *Database, password string, params Params) error {
+	if password == "" {
+		return errors.New("master password is required")
+	}
+
+	if err := params.Validate(); err != nil {
+		return err
+	}
+
+	kdf, err := params.kdf()
+	if err != nil {
+		return err
+	}
+
+	return write(w, db, password, cipherAES256, kdf)
+}
+
+func write(w io.Writer, db *Database, password string, cipherID []byte, kdf variantDictionary) error {
+	masterSeed, err := randomBytes(masterSeedSize)
+	if err != nil {
+		return err
+	}
+
+	ivSize := aes.BlockSize
+	if bytes.Equal(cipherID, cipherChaCha20) {
+		ivSize = chacha20.NonceSize
+	}
+
+	iv, err := randomBytes(ivSize)
+	if err != nil {
+		return err
+	}
+
+	headerData := writeHeader(cipherID, masterSeed, iv, kdf)
+	transformedKey, err := transformKey(compositeKey(password), kdf)
+	if err != nil {
+		return err
+	}
+
+	plain, err := writeContent(db)
+	if err != nil {
+		return err
+	}
+
+	payload, err := encrypt(cipherID, encryptionKey(masterSeed, transformedKey), iv, plain)
+	if err != nil {
+		return err
+	}
+
+	hmacKey := hmacBaseKey(masterSeed, transformedKey)
+	headerHash := sha256.Sum256(headerData)
+
+	out := bytes.Buffer{}
+	out.Write(headerData)
+	out.Write(headerHash[:])
+	out.Write(blockHMAC(hmacKey, headerBlockIndex, headerData))
+
+	// The payload is written as a single block followed by the empty block, which marks the end of the file
+	for index, block := range [][]byte{payload, nil} {
+		out.Write(blockHMAC(hmacKey, uint64(index), block))
+		writeSized(&out, block)
+	}
+
+	_, err = w.Write(out.Bytes())
+
+	return err
+}
+
+func writeHeader(cipherID, masterSeed, iv []byte, kdf variantDictionary) []byte {
+	h := bytes.Buffer{}
+	_ = binary.Write(&h, binary.LittleEndian, filePrefix{signature1, signature2, minorVersion, majorVersion})
+
+	field := func(id byte, value []byte) {
+		h.WriteByte(id)
+		writeSized(&h, value)
+	}
+
+	kdfData := bytes.Buffer{}
+	kdf.write(&kdfData)
+
+	field(headerCipherID, cipherID)
+	field(headerCompression, uint32Variant(compressionGzip).value)
+	field(headerMasterSeed, masterSeed)
+	field(headerIV, iv)
+	field(headerKDF, kdfData.Bytes())
+	field(headerEnd, []byte("\r\n\r\n"))
+
+	return h.Bytes()
+}
+
+// writeContent - writes the inner header and the XML document and compresses them
+func writeContent(db *Database) ([]byte, error) {
+	streamKey, err := randomBytes(streamKeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	content := bytes.Buffer{}
+	content.WriteByte(innerHeaderStreamID)
+	writeSized(&content, uint32Variant(innerStreamChaCha20).value)
+	content.WriteByte(innerHeaderKey)
+	writeSized(&content, streamKey)
+
+	for _, attachment := range db.Binaries {
+		content.WriteByte(innerHeaderBinary)
+		// The first byte holds flags of the attachment, none of them are set
+		writeSized(&content, append([]byte{0}, attachment...))
+	}
+
+	content.WriteByte(innerHeaderEnd)
+	writeSized(&content, nil)
+
+	stream, err := innerStream(streamKey)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := xml.MarshalIndent(db, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	document, err = rewriteProtected(document, func(value []byte) ([]byte, error) {
+		encrypted := make([]byte, len(value))
+		stream.XORKeyStream(encrypted, value)
+
+		return []byte(base64.StdEncoding.EncodeToString(encrypted)), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	content.WriteString(xml.Header)
+	content.Write(document)
+
+	compressed := bytes.Buffer{}
+	zw := gzip.NewWriter(&compressed)
+	if _, err = zw.Write(content.Bytes()); err != nil {
+		return nil, err
+	}
+
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return compressed.Bytes(), nil
+}
+
+func encrypt(cipherID, key, iv, plain []byte) ([]byte, error) {
+	if bytes.Equal(cipherID, cipherChaCha20) {
+		stream, err := chacha20.NewUnauthenticatedCipher(key, iv)
+		if err != nil {
+			return nil, err
+		}
+
+		payload := make([]byte, len(plain))
+		stream.XORKeyStream(payload, plain)
+
+		return payload, nil
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	padded := append(append([]byte{}, plain...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	payload := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(payload, padded)
+
+	return payload, nil
+}
+
+func randomBytes(size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
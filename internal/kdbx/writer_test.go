@@ -0,0 +1,104 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testParams - weak key derivation parameters, which keep the tests fast
+var testParams = Params{Iterations: 1, Memory: 64 * 1024, Parallelism: 1}
+
+func testDatabase() *Database {
+	created := FormatTime(time.Date(2023, 5, 14, 10, 30, 0, 0, time.UTC))
+	attachment := BinaryRef{Key: "hello.txt"}
+	attachment.Value.Ref = "0"
+
+	return &Database{
+		Meta: Meta{Generator: "test", DatabaseName: "Written"},
+		Root: Root{Groups: []*Group{{
+			UUID: base64.StdEncoding.EncodeToString(make([]byte, 16)),
+			Name: "Written",
+			Entries: []*Entry{
+				{
+					Times: Times{CreationTime: created, LastModificationTime: created},
+					Strings: []String{
+						{Key: FieldTitle, Value: StringValue{Content: "Mail"}},
+						{Key: FieldPassword, Value: StringValue{Protected: true, Content: "secret <&> value"}},
+						{Key: "Card number", Value: StringValue{Protected: true, Content: "4111111111111111"}},
+						{Key: "Empty", Value: StringValue{Protected: true}},
+					},
+					Binaries: []BinaryRef{attachment},
+				},
+			},
+		}}},
+		Binaries: [][]byte{{0, 1, 2, 3}},
+	}
+}
+
+func requireWrittenDatabase(t *testing.T, db *Database) {
+	t.Helper()
+
+	require.Equal(t, "Written", db.Meta.DatabaseName)
+
+	entries := db.Entries()
+	require.Len(t, entries, 1)
+	require.Equal(t, "Mail", entries[0].Get(FieldTitle))
+	require.Equal(t, "secret <&> value", entries[0].Get(FieldPassword))
+	require.Equal(t, "4111111111111111", entries[0].Get("Card number"))
+	require.Equal(t, "", entries[0].Get("Empty"))
+
+	content, err := db.Attachment(entries[0].Binaries[0])
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 1, 2, 3}, content)
+}
+
+func TestWriteOpen(t *testing.T) {
+	buf := bytes.Buffer{}
+	require.NoError(t, Write(&buf, testDatabase(), "master password", testParams))
+	require.True(t, IsKDBX(buf.Bytes()))
+
+	db, err := Open(buf.Bytes(), "master password")
+	require.NoError(t, err)
+	requireWrittenDatabase(t, db)
+
+	_, err = Open(buf.Bytes(), "wrong password")
+	require.ErrorIs(t, err, ErrWrongPassword)
+}
+
+func TestWriteChaCha20(t *testing.T) {
+	kdf, err := testParams.kdf()
+	require.NoError(t, err)
+
+	buf := bytes.Buffer{}
+	require.NoError(t, write(&buf, testDatabase(), "master password", cipherChaCha20, kdf))
+
+	db, err := Open(buf.Bytes(), "master password")
+	require.NoError(t, err)
+	requireWrittenDatabase(t, db)
+}
+
+func TestWriteInvalidParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		params   Params
+	}{
+		{name: "empty password", password: "", params: testParams},
+		{name: "no iterations", password: "password", params: Params{Memory: 64 * 1024, Parallelism: 1}},
+		{name: "too much memory", password: "password", params: Params{Iterations: 1, Memory: 1 << 40, Parallelism: 1}},
+		{name: "no parallelism", password: "password", params: Params{Iterations: 1, Memory: 64 * 1024}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Write(&bytes.Buffer{}, testDatabase(), tt.password, tt.params)
+			require.Error(t, err)
+		})
+	}
+
+	require.NoError(t, DefaultParams.Validate())
+}
@@ -49,3 +49,10 @@ func (u *dataKeyCache) Get(login string) (string, error) {
 
 	return key, nil
 }
+
+// Delete - removes encryption key of a login name, the user has to log in again to access the secrets
+func (u *dataKeyCache) Delete(login string) {
+	log.Printf("Delete data key for user %s\n", login)
+
+	delete(u.keymap, login)
+}
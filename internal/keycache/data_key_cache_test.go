@@ -33,4 +33,12 @@ func TestSingletonDataKeyCache(t *testing.T) {
 	if !errors.Is(err, constant.ErrNotFound) {
 		t.Errorf("Expected ErrNotFound, but got %v", err)
 	}
+
+	// Test deleting a data key
+	cache.Delete(login)
+	_, err = cache.Get(login)
+
+	if !errors.Is(err, constant.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, but got %v", err)
+	}
 }
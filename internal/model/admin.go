@@ -0,0 +1,39 @@
+package model
+
+// UserSummary - account of a user as administrators see it. It contains only metadata, secrets of the user
+// are never decrypted for administrators.
+type UserSummary struct {
+	ID       int64  `json:"id"`
+	Login    string `json:"login"`
+	Role     string `json:"role"`
+	Disabled bool   `json:"disabled"`
+	// External - the user signs in with an identity provider
+	External bool `json:"external"`
+	Secrets  int  `json:"secrets"`
+	// Size - approximate size of encrypted secrets of the user in bytes
+	Size int64 `json:"size"`
+}
+
+// StorageUsage - totals of the whole database
+type StorageUsage struct {
+	Users         int   `json:"users"`
+	DisabledUsers int   `json:"disabled_users"`
+	Secrets       int   `json:"secrets"`
+	VaultSecrets  int   `json:"vault_secrets"`
+	Teams         int   `json:"teams"`
+	Sends         int   `json:"sends"`
+	SecretsSize   int64 `json:"secrets_size"`
+	DatabaseSize  int64 `json:"database_size"`
+}
+
+// ServerSettings - settings which administrators change while the server is running
+type ServerSettings struct {
+	// RegistrationOpen - anyone can register, otherwise new users can't sign up, including users
+	// of identity providers
+	RegistrationOpen bool `json:"registration_open"`
+}
+
+// DefaultServerSettings - settings of a new server
+func DefaultServerSettings() ServerSettings {
+	return ServerSettings{RegistrationOpen: true}
+}
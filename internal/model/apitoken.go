@@ -0,0 +1,128 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// Permissions of personal API tokens
+const (
+	APITokenRead      = "read"
+	APITokenReadWrite = "read_write"
+)
+
+// APITokenPrefix - makes tokens recognizable in the Authorization header and by secret scanners
+const APITokenPrefix = "kms_"
+
+const (
+	// apiTokenLength - number of random bytes in a token, the token must not be guessable
+	apiTokenLength = 32
+	// apiTokenKeyInfo - binds the key which is derived from the token to its purpose
+	apiTokenKeyInfo = "keep-my-secret api token data key"
+)
+
+// ErrInvalidAPIToken - the token is malformed, or it doesn't match the stored one
+var ErrInvalidAPIToken = errors.New("invalid API token")
+
+// APIToken - personal API token, which lets scripts access secrets without the password. The token
+// carries its own copy of the data key, which is encrypted with a key derived from the token, so the server
+// can decrypt secrets only while the token is presented.
+type APIToken struct {
+	ID         int64  `json:"id"`
+	Login      string `json:"-"`
+	Name       string `json:"name"`
+	Permission string `json:"permission"`
+	// SecretIDs and VaultIDs limit the token to particular secrets and vaults of teams.
+	// If both are empty, the token can access all secrets of the user.
+	SecretIDs []int64 `json:"secret_ids"`
+	VaultIDs  []int64 `json:"vault_ids"`
+	// Hash - SHA-256 of the token, the token itself is shown to the user only once
+	Hash string `json:"-"`
+	// DataKey - the data key, which is encrypted with a key derived from the token
+	DataKey    string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// IsValidAPITokenPermission - checks if permission is supported
+func IsValidAPITokenPermission(permission string) bool {
+	return permission == APITokenRead || permission == APITokenReadWrite
+}
+
+// HashAPIToken - tokens are random, so a fast hash is enough to find the token without storing it
+func HashAPIToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// GenerateToken - creates a random token and wraps the data key with it. Returns the token, which is
+// not kept by the server.
+func (t *APIToken) GenerateToken(dataKey string) (string, error) {
+	random := make([]byte, apiTokenLength)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	token := APITokenPrefix + base64.RawURLEncoding.EncodeToString(random)
+	hash := HashAPIToken(token)
+
+	wrapped, err := wrapKey(random, apiTokenKeyInfo, dataKey, []byte(hash))
+	if err != nil {
+		return "", err
+	}
+
+	t.Hash = hash
+	t.DataKey = wrapped
+
+	return token, nil
+}
+
+// UnwrapDataKey - decrypts the data key with the token
+func (t *APIToken) UnwrapDataKey(token string) (string, error) {
+	random, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, APITokenPrefix))
+	if err != nil || !strings.HasPrefix(token, APITokenPrefix) || HashAPIToken(token) != t.Hash {
+		return "", ErrInvalidAPIToken
+	}
+
+	dataKey, err := unwrapKey(random, apiTokenKeyInfo, t.DataKey, []byte(t.Hash))
+	if errors.Is(err, errWrongWrappingKey) {
+		return "", ErrInvalidAPIToken
+	}
+
+	return dataKey, err
+}
+
+// IsExpired - checks if the token can't be used anymore
+func (t *APIToken) IsExpired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
+
+// CanWrite - checks if the token can change secrets
+func (t *APIToken) CanWrite() bool {
+	return t.Permission == APITokenReadWrite
+}
+
+// IsLimited - checks if the token can access only particular secrets and vaults
+func (t *APIToken) IsLimited() bool {
+	return len(t.SecretIDs) > 0 || len(t.VaultIDs) > 0
+}
+
+// AllowsSecret - checks if the token can access the secret. A token which is limited to particular
+// secrets can't create new ones.
+func (t *APIToken) AllowsSecret(secretID int64) bool {
+	return !t.IsLimited() || lo.Contains(t.SecretIDs, secretID)
+}
+
+// AllowsVault - checks if the token can access all secrets of the vault
+func (t *APIToken) AllowsVault(vaultID int64) bool {
+	return !t.IsLimited() || lo.Contains(t.VaultIDs, vaultID)
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPITokenDataKey(t *testing.T) {
+	apiToken := APIToken{}
+	token, err := apiToken.GenerateToken("data key")
+	require.NoError(t, err)
+
+	require.True(t, strings.HasPrefix(token, APITokenPrefix))
+	require.Equal(t, HashAPIToken(token), apiToken.Hash)
+	require.NotContains(t, apiToken.DataKey, "data key")
+
+	dataKey, err := apiToken.UnwrapDataKey(token)
+	require.NoError(t, err)
+	require.Equal(t, "data key", dataKey)
+
+	another := APIToken{}
+	anotherToken, err := another.GenerateToken("data key")
+	require.NoError(t, err)
+	require.NotEqual(t, token, anotherToken)
+
+	for _, wrong := range []string{anotherToken, strings.TrimPrefix(token, APITokenPrefix), token + "A", "kms_!"} {
+		_, err = apiToken.UnwrapDataKey(wrong)
+		require.ErrorIs(t, err, ErrInvalidAPIToken, wrong)
+	}
+
+	// The wrapped key belongs to the token, it can't be moved to another one
+	another.DataKey = apiToken.DataKey
+	_, err = another.UnwrapDataKey(anotherToken)
+	require.ErrorIs(t, err, ErrInvalidAPIToken)
+}
+
+func TestAPITokenScope(t *testing.T) {
+	now := time.Now()
+	apiToken := APIToken{Permission: APITokenRead, ExpiresAt: now.Add(time.Hour)}
+
+	require.False(t, apiToken.IsExpired(now))
+	require.True(t, apiToken.IsExpired(now.Add(time.Hour)))
+	require.False(t, apiToken.CanWrite())
+
+	// A token which is not limited can access everything, including new secrets
+	require.True(t, apiToken.AllowsSecret(0))
+	require.True(t, apiToken.AllowsSecret(7))
+	require.True(t, apiToken.AllowsVault(3))
+
+	apiToken.SecretIDs = []int64{7}
+	require.False(t, apiToken.AllowsSecret(0))
+	require.True(t, apiToken.AllowsSecret(7))
+	require.False(t, apiToken.AllowsSecret(8))
+	require.False(t, apiToken.AllowsVault(3))
+
+	apiToken.SecretIDs = nil
+	apiToken.VaultIDs = []int64{3}
+	require.False(t, apiToken.AllowsSecret(7))
+	require.True(t, apiToken.AllowsVault(3))
+
+	require.True(t, IsValidAPITokenPermission(APITokenReadWrite))
+	require.False(t, IsValidAPITokenPermission("admin"))
+}
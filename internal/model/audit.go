@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// AuditEvent - a security event, for instance a login or access to a secret. Events form a hash chain:
+// every event contains the hash of the previous one, so a modified or removed event breaks the chain.
+type AuditEvent struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+	// Login - the user who caused the event. For failed logins it's the login which was used
+	Login      string    `json:"login"`
+	SecretID   string    `json:"secret_id,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	PrevHash   string    `json:"-"`
+	Hash       string    `json:"-"`
+}
+
+// AuditFilter - selects events of a user, newest events go first
+type AuditFilter struct {
+	// Type - if set, only events of this type are returned
+	Type string
+	// Before - if set, only events with smaller ID are returned, it's used for pagination
+	Before int64
+	Limit  int
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// EmergencyAccess - a trusted contact (grantee) who can request read access to the grantor's secrets.
+// The grantor's data key is sealed with the grantee's public key when the contact is invited,
+// but the server opens it only after the request is approved.
+type EmergencyAccess struct {
+	ID      int64  `json:"id"`
+	Grantor string `json:"grantor"`
+	Grantee string `json:"grantee"`
+	State   string `json:"state"`
+	// WaitDays - how long the grantor can reject a request before it's approved automatically
+	WaitDays    int        `json:"wait_days"`
+	SealedKey   string     `json:"-"`
+	RequestedAt *time.Time `json:"requested_at,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
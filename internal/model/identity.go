@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// Identity - links a user to the subject of an external OpenID Connect identity provider
+type Identity struct {
+	// Issuer - URL of the identity provider
+	Issuer string
+	// Subject - identifier of the user at the identity provider, it never changes unlike e-mail or username
+	Subject   string
+	Login     string
+	CreatedAt time.Time
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// errWrongWrappingKey - the wrapped key can't be decrypted, because the secret is wrong or the key is damaged
+var errWrongWrappingKey = errors.New("wrong wrapping key")
+
+// wrapKey - encrypts the key with a key derived from a high-entropy secret, such as PRF output of an
+// authenticator or a personal API token. The additional data binds the wrapped key to its owner.
+func wrapKey(secret []byte, info string, key string, additionalData []byte) (string, error) {
+	gcm, err := wrappingCipher(secret, info)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(key), additionalData)
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// unwrapKey - decrypts the key which was encrypted by wrapKey. Unlike the password, a wrong secret
+// is detected, because the key is encrypted with authenticated encryption.
+func unwrapKey(secret []byte, info string, wrapped string, additionalData []byte) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := wrappingCipher(secret, info)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return "", errWrongWrappingKey
+	}
+
+	key, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], additionalData)
+	if err != nil {
+		return "", errWrongWrappingKey
+	}
+
+	return string(key), nil
+}
+
+func wrappingCipher(secret []byte, info string) (cipher.AEAD, error) {
+	if len(secret) < sha256.Size {
+		return nil, errWrongWrappingKey
+	}
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte(info)), key); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// ReminderKindExpiration - secret has explicit expiration date, or it's a card which expires
+	ReminderKindExpiration = "expiration"
+	// ReminderKindRotation - secret should be changed, because it was not updated for too long
+	ReminderKindRotation = "rotation"
+)
+
+// Reminder is a notification that a secret should be renewed by its owner
+type Reminder struct {
+	Login    string    `json:"login,omitempty"`
+	SecretID int64     `json:"secret_id"`
+	Kind     string    `json:"kind"`
+	DueAt    time.Time `json:"due_at"`
+}
+
+// cardExpirationLayouts - formats of card expiration which are understood by the application
+var cardExpirationLayouts = []string{"2006-01-02", "01/06", "01/2006", "2006-01"}
+
+// ParseCardExpiration - parses card expiration value. Card is valid through the last day of month,
+// so if day is not set, the function returns the first day of the next month.
+func ParseCardExpiration(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range cardExpirationLayouts {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+
+		if !strings.Contains(layout, "02") {
+			t = t.AddDate(0, 1, 0)
+		}
+
+		return t, true
+	}
+
+	return time.Time{}, false
+}
+
+// SetCardExpiresAt - sets expiration date of a card secret from the card's expiration value. Card expiration
+// is encrypted, so its copy is kept in plain text to make expiry reminders possible without user's data key.
+func (s *Secret) SetCardExpiresAt() {
+	if s.Type != SecretTypeCard {
+		return
+	}
+
+	if expiresAt, ok := ParseCardExpiration(s.Expiration); ok {
+		s.ExpiresAt = &expiresAt
+	}
+}
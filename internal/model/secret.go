@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"reflect"
+	"time"
 
 	"github.com/samber/lo"
 
@@ -11,7 +12,18 @@ import (
 )
 
 // var shouldNotEncrypt = []string{"ID", "Type", "Title"}
-var shouldNotEncrypt = []string{"ID", "Encryptor"}
+var shouldNotEncrypt = []string{
+	"ID", "Encryptor", "Favorite", "CreatedAt", "UpdatedAt", "LastAccessedAt", "ExpiresAt", "RotateEvery",
+	"Compromised", "WrappedKey",
+}
+
+// Secret types which are supported by the client application
+const (
+	SecretTypeCard     = "card"
+	SecretTypeFile     = "file"
+	SecretTypeNote     = "note"
+	SecretTypePassword = "pass"
+)
 
 // Encryptor is used for setting encrypting method for Secret model. This interface is used mainly for mocking
 type Encryptor interface {
@@ -21,19 +33,104 @@ type Encryptor interface {
 
 // Secret is a model of secret object which the application receives from the client
 type Secret struct {
-	ID             int64     `json:"id"`
-	Type           string    `json:"type"`
-	Title          string    `json:"title"`
-	Login          string    `json:"login"`
-	Password       string    `json:"password"`
-	Note           string    `json:"note"`
-	File           []byte    `json:"-"`
-	FileName       string    `json:"file_name"`
-	CardholderName string    `json:"cardholder_name"`
-	CardNumber     string    `json:"card_number"`
-	Expiration     string    `json:"expiration"`
-	SecurityCode   string    `json:"security_code"`
-	Encryptor      Encryptor `json:"-"`
+	ID             int64      `json:"id"`
+	Type           string     `json:"type"`
+	Title          string     `json:"title"`
+	Login          string     `json:"login"`
+	Password       string     `json:"password"`
+	Note           string     `json:"note"`
+	File           []byte     `json:"-"`
+	FileName       string     `json:"file_name"`
+	CardholderName string     `json:"cardholder_name"`
+	CardNumber     string     `json:"card_number"`
+	Expiration     string     `json:"expiration"`
+	SecurityCode   string     `json:"security_code"`
+	URL            string     `json:"url"`
+	Favorite       bool       `json:"favorite"`
+	CreatedAt      *time.Time `json:"created_at,omitempty"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	RotateEvery    int        `json:"rotate_every"` // in days, zero means that rotation is not required
+	Compromised    bool       `json:"compromised"`  // password was found in breached password corpus
+	WrappedKey     string     `json:"-"`            // secret's own key encrypted with the owner's data key
+	Encryptor      Encryptor  `json:"-"`
+}
+
+// Key - returns the key which encrypts the secret fields. Every secret is encrypted with its own key,
+// which is wrapped with the owner's data key. Secrets which were created before per-secret keys
+// were introduced don't have their own key and are encrypted with the data key directly.
+func (s *Secret) Key(dataKey string) (string, error) {
+	if len(s.WrappedKey) == 0 {
+		return dataKey, nil
+	}
+
+	key, err := utils.Decrypt([]byte(s.WrappedKey), dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return string(key), nil
+}
+
+// GenerateKey - creates a new random key for the secret and wraps it with the owner's data key.
+// The secret must be re-encrypted with the returned key.
+func (s *Secret) GenerateKey(dataKey string) (string, error) {
+	key := utils.GenerateRandomPassword()
+	wrappedKey, err := utils.Encrypt([]byte(key), dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	s.WrappedKey = string(wrappedKey)
+
+	return key, nil
+}
+
+// RewrapKey - wraps the secret's own key with another key. The secret itself is not re-encrypted.
+func (s *Secret) RewrapKey(oldKey, newKey string) error {
+	key, err := s.Key(oldKey)
+	if err != nil {
+		return err
+	}
+
+	wrappedKey, err := utils.Encrypt([]byte(key), newKey)
+	if err != nil {
+		return err
+	}
+
+	s.WrappedKey = string(wrappedKey)
+
+	return nil
+}
+
+// DecryptWithDataKey - unwraps the secret's own key with the owner's data key and decrypts the secret
+func (s *Secret) DecryptWithDataKey(dataKey, salt string) error {
+	key, err := s.Key(dataKey)
+	if err != nil {
+		return err
+	}
+
+	return s.Decrypt(key, salt)
+}
+
+// Rekey - re-encrypts an encrypted secret with a new random key. Returns the new key,
+// which is also wrapped with the owner's data key and stored in the secret.
+func (s *Secret) Rekey(dataKey, salt string) (string, error) {
+	if err := s.DecryptWithDataKey(dataKey, salt); err != nil {
+		return "", err
+	}
+
+	key, err := s.GenerateKey(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	if err = s.Encrypt(key, salt); err != nil {
+		return "", err
+	}
+
+	return key, nil
 }
 
 // SetEncryptor should be used for setting concrete encryptor implementation. Currently used in unit tests
@@ -131,6 +228,11 @@ func (s *Secret) Decrypt(key, salt string) error {
 			continue
 		}
 
+		// Fields which were added to the model later, are empty for the secrets created before
+		if len(toDecrypt) == 0 {
+			continue
+		}
+
 		decrypted, err := utils.Decrypt(toDecrypt, key)
 		if err != nil {
 			return fmt.Errorf("secret encrypt: %s", err.Error())
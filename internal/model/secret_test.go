@@ -0,0 +1,71 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretKey(t *testing.T) {
+	secret := Secret{Title: "title"}
+
+	key, err := secret.Key("data key")
+	require.NoError(t, err)
+	require.Equal(t, "data key", key, "secrets without own key are encrypted with the data key")
+
+	generated, err := secret.GenerateKey("data key")
+	require.NoError(t, err)
+	require.NotEmpty(t, secret.WrappedKey)
+
+	key, err = secret.Key("data key")
+	require.NoError(t, err)
+	require.Equal(t, generated, key)
+
+	require.NoError(t, secret.Encrypt(key, "owner"))
+	require.NotEqual(t, "title", secret.Title)
+	require.NoError(t, secret.Decrypt(key, "owner"))
+	require.Equal(t, "title", secret.Title)
+}
+
+func TestSecretRekey(t *testing.T) {
+	secret := Secret{Title: "title", File: []byte("file")}
+
+	oldKey, err := secret.GenerateKey("data key")
+	require.NoError(t, err)
+	require.NoError(t, secret.Encrypt(oldKey, "owner"))
+
+	newKey, err := secret.Rekey("data key", "owner")
+	require.NoError(t, err)
+	require.NotEqual(t, oldKey, newKey)
+
+	require.NoError(t, secret.DecryptWithDataKey("data key", "owner"))
+	require.Equal(t, "title", secret.Title)
+	require.Equal(t, []byte("file"), secret.File)
+
+	// Secrets which were encrypted with the data key directly can be re-encrypted with their own key
+	legacy := Secret{Title: "title"}
+	require.NoError(t, legacy.Encrypt("data key", "owner"))
+
+	_, err = legacy.Rekey("data key", "owner")
+	require.NoError(t, err)
+	require.NotEmpty(t, legacy.WrappedKey)
+	require.NoError(t, legacy.DecryptWithDataKey("data key", "owner"))
+	require.Equal(t, "title", legacy.Title)
+}
+
+func TestSecretRewrapKey(t *testing.T) {
+	secret := Secret{Title: "title"}
+
+	key, err := secret.GenerateKey("old vault key")
+	require.NoError(t, err)
+	require.NoError(t, secret.Encrypt(key, "vault-1"))
+
+	require.NoError(t, secret.RewrapKey("old vault key", "new vault key"))
+
+	rewrapped, err := secret.Key("new vault key")
+	require.NoError(t, err)
+	require.Equal(t, key, rewrapped)
+
+	require.NoError(t, secret.DecryptWithDataKey("new vault key", "vault-1"))
+	require.Equal(t, "title", secret.Title)
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Send types
+const (
+	SendTypeText = "text"
+	SendTypeFile = "file"
+)
+
+// sendIDLength - number of random bytes in a send identifier, the identifier must not be guessable
+const sendIDLength = 16
+
+// Send - an ephemeral payload which can be received by anyone who knows the link, even without an account.
+// The payload is encrypted by the client, and the key is kept in the URL fragment, so it never reaches the server.
+type Send struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Payload and FileName are base64 encoded ciphertexts
+	Payload   string `json:"payload,omitempty"`
+	FileName  string `json:"file_name,omitempty"`
+	MaxViews  int    `json:"max_views"`
+	ViewCount int    `json:"view_count"`
+	// PasswordHash is a bcrypt hash of an optional passphrase which protects the send
+	PasswordHash string     `json:"-"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+}
+
+// IsValidSendType - checks if send type is supported
+func IsValidSendType(sendType string) bool {
+	return sendType == SendTypeText || sendType == SendTypeFile
+}
+
+// GenerateID - sets a random URL-safe identifier
+func (s *Send) GenerateID() error {
+	id := make([]byte, sendIDLength)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	s.ID = base64.RawURLEncoding.EncodeToString(id)
+
+	return nil
+}
+
+// SetPassword - protects the send with a passphrase, empty passphrase removes the protection
+func (s *Send) SetPassword(password string) error {
+	if password == "" {
+		s.PasswordHash = ""
+		return nil
+	}
+
+	hash, err := hashString(password)
+	if err != nil {
+		return err
+	}
+
+	s.PasswordHash = hash
+
+	return nil
+}
+
+// IsPasswordProtected - checks if a passphrase is required to receive the send
+func (s *Send) IsPasswordProtected() bool {
+	return s.PasswordHash != ""
+}
+
+// PasswordMatches - checks the passphrase, sends without passphrase accept any value
+func (s *Send) PasswordMatches(password string) (bool, error) {
+	if !s.IsPasswordProtected() {
+		return true, nil
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(s.PasswordHash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// IsAvailable - checks that the send is not expired and can be viewed at least once more
+func (s *Send) IsAvailable(now time.Time) bool {
+	return now.Before(s.ExpiresAt) && s.ViewCount < s.MaxViews
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendID(t *testing.T) {
+	var first, second Send
+	require.NoError(t, first.GenerateID())
+	require.NoError(t, second.GenerateID())
+
+	require.Len(t, first.ID, 22)
+	require.NotEqual(t, first.ID, second.ID)
+}
+
+func TestSendPassword(t *testing.T) {
+	send := Send{}
+
+	matches, err := send.PasswordMatches("anything")
+	require.NoError(t, err)
+	require.True(t, matches, "send without passphrase is not protected")
+
+	require.NoError(t, send.SetPassword("passphrase"))
+	require.True(t, send.IsPasswordProtected())
+
+	matches, err = send.PasswordMatches("passphrase")
+	require.NoError(t, err)
+	require.True(t, matches)
+
+	matches, err = send.PasswordMatches("wrong")
+	require.NoError(t, err)
+	require.False(t, matches)
+
+	require.NoError(t, send.SetPassword(""))
+	require.False(t, send.IsPasswordProtected())
+}
+
+func TestSendIsAvailable(t *testing.T) {
+	now := time.Now()
+	send := Send{MaxViews: 2, ViewCount: 1, ExpiresAt: now.Add(time.Hour)}
+
+	require.True(t, send.IsAvailable(now))
+	require.False(t, send.IsAvailable(now.Add(time.Hour)), "expired send")
+
+	send.ViewCount = 2
+	require.False(t, send.IsAvailable(now), "all views are used")
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// Share permissions
+const (
+	PermissionRead = "read"
+	PermissionEdit = "edit"
+)
+
+var errInvalidPublicKey = errors.New("invalid public key")
+
+// Share - access to a secret which is granted by its owner to another user. The key of the secret
+// is sealed with the recipient's public key, so only the recipient can use it.
+type Share struct {
+	SecretID   int64      `json:"secret_id"`
+	Owner      string     `json:"owner"`
+	Recipient  string     `json:"recipient"`
+	Permission string     `json:"permission"`
+	SealedKey  string     `json:"-"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	// Secret is set only when the share is returned to the recipient
+	Secret *Secret `json:"secret,omitempty"`
+}
+
+// IsValidPermission - checks if permission is supported
+func IsValidPermission(permission string) bool {
+	return permission == PermissionRead || permission == PermissionEdit
+}
+
+// CanEdit - checks if the recipient is allowed to update or delete the shared secret
+func (s *Share) CanEdit() bool {
+	return s.Permission == PermissionEdit
+}
+
+// SealKey - encrypts a secret key with the recipient's public key and stores it in the share
+func (s *Share) SealKey(secretKey, publicKey string) error {
+	sealed, err := SealKey(secretKey, publicKey)
+	if err != nil {
+		return err
+	}
+
+	s.SealedKey = sealed
+
+	return nil
+}
+
+// OpenKey - decrypts the secret key with the recipient's key pair
+func (s *Share) OpenKey(publicKey string, privateKey *[32]byte) (string, error) {
+	return OpenSealedKey(s.SealedKey, publicKey, privateKey)
+}
+
+// SealKey - encrypts a key with the recipient's public key, so only the recipient can decrypt it
+func SealKey(key, publicKey string) (string, error) {
+	recipientKey, err := decodePublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := box.SealAnonymous(nil, []byte(key), recipientKey, rand.Reader)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenSealedKey - decrypts a key which was encrypted with SealKey using the recipient's key pair
+func OpenSealedKey(sealedKey, publicKey string, privateKey *[32]byte) (string, error) {
+	recipientKey, err := decodePublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(sealedKey)
+	if err != nil {
+		return "", err
+	}
+
+	key, ok := box.OpenAnonymous(nil, sealed, recipientKey, privateKey)
+	if !ok {
+		return "", errors.New("cannot open sealed key")
+	}
+
+	return string(key), nil
+}
+
+func decodePublicKey(publicKey string) (*[32]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(decoded) != 32 {
+		return nil, errInvalidPublicKey
+	}
+
+	var key [32]byte
+	copy(key[:], decoded)
+
+	return &key, nil
+}
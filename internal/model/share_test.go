@@ -0,0 +1,40 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShareKeyRoundTrip(t *testing.T) {
+	recipient, err := NewUser("recipient", "password")
+	require.NoError(t, err)
+
+	dataKey, err := recipient.GetDataKey("password")
+	require.NoError(t, err)
+
+	privateKey, err := recipient.GetPrivateKey(dataKey)
+	require.NoError(t, err)
+
+	share := Share{Recipient: recipient.Login, Permission: PermissionRead}
+	require.NoError(t, share.SealKey("secret key", recipient.PublicKey))
+	require.NotContains(t, share.SealedKey, "secret key")
+
+	key, err := share.OpenKey(recipient.PublicKey, privateKey)
+	require.NoError(t, err)
+	require.Equal(t, "secret key", key)
+
+	other, err := NewUser("other", "password")
+	require.NoError(t, err)
+
+	otherDataKey, err := other.GetDataKey("password")
+	require.NoError(t, err)
+
+	otherPrivateKey, err := other.GetPrivateKey(otherDataKey)
+	require.NoError(t, err)
+
+	_, err = share.OpenKey(other.PublicKey, otherPrivateKey)
+	require.Error(t, err)
+
+	require.Error(t, share.SealKey("secret key", "invalid"))
+}
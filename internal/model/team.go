@@ -0,0 +1,87 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Team roles
+const (
+	RoleOwner    = "owner"
+	RoleAdmin    = "admin"
+	RoleMember   = "member"
+	RoleReadOnly = "read-only"
+)
+
+// Team - a group of users which share vaults
+type Team struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// Role of the current user in the team
+	Role      string     `json:"role,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// TeamMember - a user which belongs to a team
+type TeamMember struct {
+	TeamID int64  `json:"team_id"`
+	Login  string `json:"login"`
+	Role   string `json:"role"`
+}
+
+// Vault - a set of secrets which belongs to a team. Secrets of a vault are encrypted with their own keys,
+// which are wrapped with the vault key. The vault key is sealed for every team member with their public key.
+type Vault struct {
+	ID        int64      `json:"id"`
+	TeamID    int64      `json:"team_id"`
+	Name      string     `json:"name"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// VaultKey - vault key sealed for a team member
+type VaultKey struct {
+	VaultID   int64
+	Login     string
+	SealedKey string
+}
+
+// VaultAccess - a vault which the user can access, the user's role in the team, and the vault key
+// sealed for the user
+type VaultAccess struct {
+	Vault
+	Role      string
+	SealedKey string
+}
+
+// VaultRotation - a new vault key sealed for the team members, and vault secrets
+// whose keys are wrapped with the new vault key
+type VaultRotation struct {
+	VaultID int64
+	Keys    []*VaultKey
+	Secrets []*Secret
+}
+
+// IsValidRole - checks if team role is supported
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleOwner, RoleAdmin, RoleMember, RoleReadOnly:
+		return true
+	default:
+		return false
+	}
+}
+
+// CanManageTeam - checks if the role allows to manage team members and vaults
+func CanManageTeam(role string) bool {
+	return role == RoleOwner || role == RoleAdmin
+}
+
+// CanWriteVault - checks if the role allows to create, update and delete vault secrets
+func CanWriteVault(role string) bool {
+	return role == RoleOwner || role == RoleAdmin || role == RoleMember
+}
+
+// VaultSalt - vault secrets are shared by all team members, so the salt doesn't depend on a user login
+func VaultSalt(vaultID int64) string {
+	return fmt.Sprintf("vault-%d", vaultID)
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/nacl/box"
+)
+
+func TestTeamRoles(t *testing.T) {
+	require.True(t, IsValidRole(RoleOwner))
+	require.True(t, IsValidRole(RoleReadOnly))
+	require.False(t, IsValidRole("guest"))
+
+	require.True(t, CanManageTeam(RoleAdmin))
+	require.False(t, CanManageTeam(RoleMember))
+
+	require.True(t, CanWriteVault(RoleMember))
+	require.False(t, CanWriteVault(RoleReadOnly))
+}
+
+func TestSealVaultKey(t *testing.T) {
+	publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	encodedKey := base64.StdEncoding.EncodeToString(publicKey[:])
+
+	sealed, err := SealKey("vault key", encodedKey)
+	require.NoError(t, err)
+
+	key, err := OpenSealedKey(sealed, encodedKey, privateKey)
+	require.NoError(t, err)
+	require.Equal(t, "vault key", key)
+
+	_, otherPrivateKey, err := box.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	_, err = OpenSealedKey(sealed, encodedKey, otherPrivateKey)
+	require.Error(t, err)
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// LoginAttempts - failed login attempts of a login or a client IP address
+type LoginAttempts struct {
+	// Key - login or IP address prefixed with its kind, for instance "ip:192.0.2.1"
+	Key           string
+	Failures      int
+	LastAttemptAt time.Time
+	// LockedUntil - zero if the key is not locked
+	LockedUntil time.Time
+}
@@ -1,9 +1,15 @@
 package model
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"errors"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
 
 	"github.com/grafviktor/keep-my-secret/internal/api/utils"
 )
@@ -14,6 +20,18 @@ func hashString(s string) (string, error) {
 	return string(bytes), err
 }
 
+// Roles of users on the server. Administrators manage accounts, but they don't get access to secrets
+// of other users.
+const (
+	UserRoleUser  = "user"
+	UserRoleAdmin = "admin"
+)
+
+// IsValidUserRole - checks if role is supported
+func IsValidUserRole(role string) bool {
+	return role == UserRoleUser || role == UserRoleAdmin
+}
+
 type User struct {
 	ID             int64  `json:"id"`
 	Login          string `json:"login,omitempty"`
@@ -21,6 +39,15 @@ type User struct {
 	// RestorePassword was not implemented and not used anywhere
 	RestorePassword string `json:"-"`
 	DataKey         string `json:"-"`
+	// PublicKey is used by other users to share secrets with this user. Base64 encoded X25519 key.
+	PublicKey string `json:"-"`
+	// PrivateKey is encrypted with the data key, so it's available only when the user is logged in
+	PrivateKey string `json:"-"`
+	Role       string `json:"role"`
+	// Disabled users can't sign in, and their tokens are rejected
+	Disabled bool `json:"disabled"`
+	// SessionsRevokedAt - tokens which were issued before this time are rejected
+	SessionsRevokedAt *time.Time `json:"-"`
 }
 
 // NewUser creates a new New User model with a random data key. The key should never be given to a user.
@@ -48,13 +75,99 @@ func NewUser(login, password string) (*User, error) {
 		HashedPassword:  hashedPassword,
 		RestorePassword: hashedPassword,
 		DataKey:         string(encryptedKey),
+		Role:            UserRoleUser,
+	}
+
+	if err = u.GenerateKeyPair(key); err != nil {
+		return nil, err
 	}
 
 	return &u, nil
 }
 
+var (
+	// ErrMasterPasswordSet - the user already has a data key, which is encrypted with another password
+	ErrMasterPasswordSet = errors.New("master password is already set")
+	// ErrWrongMasterPassword - the data key cannot be decrypted with the password
+	ErrWrongMasterPassword = errors.New("wrong master password")
+)
+
+// NewExternalUser creates a user who signs in with an external identity provider. Such user has no login
+// password, and has no data key until they set a master password, see SetMasterPassword.
+func NewExternalUser(login string) *User {
+	return &User{Login: login, Role: UserRoleUser}
+}
+
+// SetMasterPassword - creates the data key and the key pair of a user who doesn't have them yet.
+// The data key is encrypted with the master password, which is never stored. Returns the data key.
+func (u *User) SetMasterPassword(password string) (string, error) {
+	if u.DataKey != "" {
+		return "", ErrMasterPasswordSet
+	}
+
+	if len(password) == 0 {
+		return "", errors.New("cannot encrypt data key - no password set")
+	}
+
+	key := utils.GenerateRandomPassword()
+	encryptedKey, err := utils.Encrypt([]byte(key), password)
+	if err != nil {
+		return "", err
+	}
+
+	if err = u.GenerateKeyPair(key); err != nil {
+		return "", err
+	}
+
+	u.DataKey = string(encryptedKey)
+
+	return key, nil
+}
+
+// UnlockDataKey - decrypts the data key with the master password. Decryption doesn't detect a wrong key,
+// so the password is verified with the key pair: the decrypted private key must match the public key.
+func (u *User) UnlockDataKey(password string) (string, error) {
+	dataKey, err := u.GetDataKey(password)
+	if err != nil {
+		return "", err
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(u.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	privateKey, err := u.GetPrivateKey(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	derived, err := curve25519.X25519(privateKey[:], curve25519.Basepoint)
+	if err != nil || subtle.ConstantTimeCompare(derived, publicKey) != 1 {
+		return "", ErrWrongMasterPassword
+	}
+
+	return dataKey, nil
+}
+
+// IsAdmin - checks if the user manages the server
+func (u *User) IsAdmin() bool {
+	return u.Role == UserRoleAdmin
+}
+
+// SessionRevoked - checks if a token which was issued at the given time is revoked. Tokens store the time
+// in seconds, so tokens which were issued in the same second as the revocation are revoked as well.
+func (u *User) SessionRevoked(issuedAt time.Time) bool {
+	return u.SessionsRevokedAt != nil && !issuedAt.After(u.SessionsRevokedAt.Truncate(time.Second))
+}
+
 // PasswordMatches check if password which was provided by the user during login process is correct
 func (u *User) PasswordMatches(plainText string) (bool, error) {
+	// Users of external identity providers can't sign in with a password
+	if u.HashedPassword == "" {
+		return false, nil
+	}
+
 	err := bcrypt.CompareHashAndPassword([]byte(u.HashedPassword), []byte(plainText))
 	if err != nil {
 		switch {
@@ -69,6 +182,48 @@ func (u *User) PasswordMatches(plainText string) (bool, error) {
 	return true, nil
 }
 
+// ConfirmPassword - checks the password which confirms a sensitive operation of a signed-in user. It's the login
+// password, or the master password of a user of an external identity provider, who has no login password.
+func (u *User) ConfirmPassword(password string) (bool, error) {
+	if u.HashedPassword != "" {
+		return u.PasswordMatches(password)
+	}
+
+	if u.DataKey == "" || password == "" {
+		return false, nil
+	}
+
+	// The master password is never stored, it's correct if it unlocks the data key
+	_, err := u.UnlockDataKey(password)
+
+	return err == nil, nil
+}
+
+// ChangePassword - replaces the password of the user. The data key stays the same, it is only
+// re-encrypted with the new password, so secrets don't have to be re-encrypted.
+func (u *User) ChangePassword(currentPassword, newPassword string) error {
+	dataKey, err := u.GetDataKey(currentPassword)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := hashString(newPassword)
+	if err != nil {
+		return err
+	}
+
+	encryptedKey, err := utils.Encrypt([]byte(dataKey), newPassword)
+	if err != nil {
+		return err
+	}
+
+	u.HashedPassword = hashedPassword
+	u.RestorePassword = hashedPassword
+	u.DataKey = string(encryptedKey)
+
+	return nil
+}
+
 func (u *User) GetDataKey(password string) (string, error) {
 	if len(password) == 0 {
 		return "", errors.New("cannot decrypt data key - no password set")
@@ -81,3 +236,43 @@ func (u *User) GetDataKey(password string) (string, error) {
 
 	return string(key), nil
 }
+
+// GenerateKeyPair - creates a new key pair which allows other users to share their secrets with this user.
+// The private key is encrypted with the user's data key.
+func (u *User) GenerateKeyPair(dataKey string) error {
+	publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	encryptedKey, err := utils.Encrypt(privateKey[:], dataKey)
+	if err != nil {
+		return err
+	}
+
+	u.PublicKey = base64.StdEncoding.EncodeToString(publicKey[:])
+	u.PrivateKey = string(encryptedKey)
+
+	return nil
+}
+
+// GetPrivateKey - decrypts user's private key with the data key
+func (u *User) GetPrivateKey(dataKey string) (*[32]byte, error) {
+	if len(u.PrivateKey) == 0 {
+		return nil, errors.New("user has no key pair")
+	}
+
+	decrypted, err := utils.Decrypt([]byte(u.PrivateKey), dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(decrypted) != 32 {
+		return nil, errors.New("cannot decrypt private key - invalid key length")
+	}
+
+	var privateKey [32]byte
+	copy(privateKey[:], decrypted)
+
+	return &privateKey, nil
+}
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserChangePassword(t *testing.T) {
+	user, err := NewUser("tony.tester@example.com", "old password")
+	require.NoError(t, err)
+
+	dataKey, err := user.GetDataKey("old password")
+	require.NoError(t, err)
+
+	require.NoError(t, user.ChangePassword("old password", "new password"))
+
+	matches, err := user.PasswordMatches("new password")
+	require.NoError(t, err)
+	require.True(t, matches)
+
+	matches, err = user.PasswordMatches("old password")
+	require.NoError(t, err)
+	require.False(t, matches)
+
+	// The data key is the same, so secrets don't have to be re-encrypted
+	newDataKey, err := user.GetDataKey("new password")
+	require.NoError(t, err)
+	require.Equal(t, dataKey, newDataKey)
+}
+
+func TestExternalUserMasterPassword(t *testing.T) {
+	user := NewExternalUser("tony.tester@example.com")
+
+	// There is no password, so there is nothing to match
+	matches, err := user.PasswordMatches("")
+	require.NoError(t, err)
+	require.False(t, matches)
+
+	dataKey, err := user.SetMasterPassword("master password")
+	require.NoError(t, err)
+	require.NotEmpty(t, user.PublicKey)
+
+	decryptedKey, err := user.UnlockDataKey("master password")
+	require.NoError(t, err)
+	require.Equal(t, dataKey, decryptedKey)
+
+	_, err = user.UnlockDataKey("wrong password")
+	require.ErrorIs(t, err, ErrWrongMasterPassword)
+
+	// The data key is never replaced, otherwise existing secrets would be lost
+	_, err = user.SetMasterPassword("another password")
+	require.ErrorIs(t, err, ErrMasterPasswordSet)
+}
+
+func TestUserConfirmPassword(t *testing.T) {
+	user, err := NewUser("tony.tester@example.com", "password")
+	require.NoError(t, err)
+
+	external := NewExternalUser("jane.doe@example.com")
+	confirmed, err := external.ConfirmPassword("")
+	require.NoError(t, err)
+	require.False(t, confirmed)
+
+	_, err = external.SetMasterPassword("master password")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		user     *User
+		password string
+		want     bool
+	}{
+		{name: "login password", user: user, password: "password", want: true},
+		{name: "wrong login password", user: user, password: "wrong password", want: false},
+		{name: "master password", user: external, password: "master password", want: true},
+		{name: "wrong master password", user: external, password: "wrong password", want: false},
+		{name: "empty master password", user: external, password: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			confirmed, err := tt.user.ConfirmPassword(tt.password)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, confirmed)
+		})
+	}
+}
+
+func TestUserSessionRevoked(t *testing.T) {
+	user, err := NewUser("tony.tester@example.com", "password")
+	require.NoError(t, err)
+	require.Equal(t, UserRoleUser, user.Role)
+	require.False(t, user.IsAdmin())
+
+	issuedAt := time.Now().Truncate(time.Second)
+	require.False(t, user.SessionRevoked(issuedAt))
+
+	revokedAt := issuedAt.Add(500 * time.Millisecond)
+	user.SessionsRevokedAt = &revokedAt
+	require.True(t, user.SessionRevoked(issuedAt))
+	require.True(t, user.SessionRevoked(issuedAt.Add(-time.Hour)))
+	require.False(t, user.SessionRevoked(issuedAt.Add(time.Second)))
+
+	require.True(t, IsValidUserRole(UserRoleAdmin))
+	require.False(t, IsValidUserRole(RoleOwner))
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// prfKeyInfo - binds the key which is derived from PRF output to its purpose
+const prfKeyInfo = "keep-my-secret webauthn data key"
+
+var (
+	// ErrNoWrappedKey - the authenticator doesn't support PRF, so the credential can't unlock the vault
+	ErrNoWrappedKey = errors.New("credential has no wrapped data key")
+	// ErrWrongPRF - the data key cannot be unwrapped with the PRF output
+	ErrWrongPRF = errors.New("wrong PRF output")
+)
+
+// WebAuthnCredential - a passkey or a security key of a user
+type WebAuthnCredential struct {
+	// ID - base64url encoded credential ID
+	ID    string `json:"id"`
+	Login string `json:"-"`
+	Name  string `json:"name"`
+	// UserHandle - random identifier of the user, which is the same for all credentials of the user
+	UserHandle []byte `json:"-"`
+	// PublicKey - COSE_Key which verifies signatures of the authenticator
+	PublicKey []byte `json:"-"`
+	SignCount uint32 `json:"-"`
+	// AAGUID - identifies the model of the authenticator, all zeros if the authenticator doesn't tell it
+	AAGUID string `json:"aaguid"`
+	// DataKey - the data key, which is encrypted with a key derived from PRF output of the authenticator.
+	// Empty if the authenticator doesn't support PRF, such credential is only a second factor.
+	DataKey string `json:"-"`
+	// Passwordless - the credential can be used without the password, because it unlocks the data key
+	Passwordless bool       `json:"passwordless"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+}
+
+// WrapDataKey - encrypts the data key with PRF output of the authenticator. The output never leaves
+// the client except during login, so the server can't unwrap the key on its own.
+func (c *WebAuthnCredential) WrapDataKey(prf []byte, dataKey string) error {
+	wrapped, err := wrapKey(prf, prfKeyInfo, dataKey, []byte(c.ID))
+	if errors.Is(err, errWrongWrappingKey) {
+		return ErrWrongPRF
+	} else if err != nil {
+		return err
+	}
+
+	c.DataKey = wrapped
+	c.Passwordless = true
+
+	return nil
+}
+
+// UnwrapDataKey - decrypts the data key with PRF output
+func (c *WebAuthnCredential) UnwrapDataKey(prf []byte) (string, error) {
+	if c.DataKey == "" {
+		return "", ErrNoWrappedKey
+	}
+
+	dataKey, err := unwrapKey(prf, prfKeyInfo, c.DataKey, []byte(c.ID))
+	if errors.Is(err, errWrongWrappingKey) {
+		return "", ErrWrongPRF
+	}
+
+	return dataKey, err
+}
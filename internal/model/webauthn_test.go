@@ -0,0 +1,32 @@
+package model
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebAuthnCredentialDataKey(t *testing.T) {
+	credential := WebAuthnCredential{ID: "credential"}
+	prf := bytes.Repeat([]byte{1}, 32)
+
+	_, err := credential.UnwrapDataKey(prf)
+	require.ErrorIs(t, err, ErrNoWrappedKey)
+
+	require.NoError(t, credential.WrapDataKey(prf, "data key"))
+	require.True(t, credential.Passwordless)
+	require.NotContains(t, credential.DataKey, "data key")
+
+	dataKey, err := credential.UnwrapDataKey(prf)
+	require.NoError(t, err)
+	require.Equal(t, "data key", dataKey)
+
+	_, err = credential.UnwrapDataKey(bytes.Repeat([]byte{2}, 32))
+	require.ErrorIs(t, err, ErrWrongPRF)
+
+	// The wrapped key belongs to the credential, it can't be moved to another one
+	another := WebAuthnCredential{ID: "another credential", DataKey: credential.DataKey}
+	_, err = another.UnwrapDataKey(prf)
+	require.ErrorIs(t, err, ErrWrongPRF)
+}
@@ -0,0 +1,164 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"github.com/samber/lo"
+)
+
+// minRSAKeySize - tokens signed with shorter RSA keys are rejected
+const minRSAKeySize = 2048
+
+// supportedAlgorithms - algorithms of ID token signatures. HMAC is not supported,
+// because the provider would sign tokens with the client secret.
+var supportedAlgorithms = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "EdDSA"}
+
+// jwk - public key in JSON Web Key format, see RFC 7517
+type jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// verificationKey - a key of the provider and algorithms which may be used with it
+type verificationKey struct {
+	id         string
+	algorithms []string
+	public     crypto.PublicKey
+}
+
+// parseJWKS - reads signing keys of the provider. Encryption keys, invalid keys and keys of unsupported types
+// are skipped, so a single bad key doesn't prevent users from signing in.
+func parseJWKS(data []byte) ([]*verificationKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make([]*verificationKey, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		if key, err := k.verificationKey(); err == nil && key != nil {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// verificationKey - returns nil if the key type is not supported
+func (k jwk) verificationKey() (*verificationKey, error) {
+	key := &verificationKey{id: k.Kid}
+
+	switch {
+	case k.Kty == "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if n.BitLen() < minRSAKeySize || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("weak or invalid RSA key")
+		}
+
+		key.public = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		key.algorithms = []string{"RS256", "RS384", "RS512"}
+	case k.Kty == "EC" && (k.Crv == "P-256" || k.Crv == "P-384"):
+		curve, alg := elliptic.P256(), "ES256"
+		if k.Crv == "P-384" {
+			curve, alg = elliptic.P384(), "ES384"
+		}
+
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+
+		key.public = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		key.algorithms = []string{alg}
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+
+		key.public = ed25519.PublicKey(x)
+		key.algorithms = []string{"EdDSA"}
+	default:
+		return nil, nil
+	}
+
+	// If the provider has restricted the key to a single algorithm, others are not accepted
+	if k.Alg != "" {
+		if !lo.Contains(key.algorithms, k.Alg) {
+			return nil, nil
+		}
+
+		key.algorithms = []string{k.Alg}
+	}
+
+	return key, nil
+}
+
+// findKey - the key is selected by "kid" header of the token. If the token doesn't have the header,
+// the first key which supports the algorithm is used.
+func findKey(keys []*verificationKey, kid, alg string) *verificationKey {
+	for _, key := range keys {
+		if (kid == "" || key.id == kid) && lo.Contains(key.algorithms, alg) {
+			return key
+		}
+	}
+
+	return nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, errors.New("empty integer")
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,346 @@
+// Package oidc - signs users in with an external OpenID Connect identity provider.
+//
+// Authorization code flow with PKCE is used: the user is redirected to the provider, and the provider
+// redirects them back with a one-time code, which is exchanged for an ID token. The token is verified
+// with the keys which are published by the provider, its subject identifies the user.
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/grafviktor/keep-my-secret/internal/config"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+	// maxResponseSize - responses of the provider are small, larger ones are not read
+	maxResponseSize = 1 << 20
+	httpTimeout     = 10 * time.Second
+	// keysRefreshInterval - keys are reloaded when a token is signed with an unknown key,
+	// but not more often than that
+	keysRefreshInterval = time.Minute
+)
+
+// Claims which may become the login of a new user
+const (
+	ClaimEmail             = "email"
+	ClaimPreferredUsername = "preferred_username"
+	ClaimSubject           = "sub"
+)
+
+var (
+	ErrNotConfigured = errors.New("OpenID Connect provider is not configured")
+	ErrInvalidToken  = errors.New("invalid ID token")
+	ErrUnknownKey    = errors.New("ID token is signed with unknown key")
+)
+
+// Metadata - endpoints of the provider from its discovery document
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims - claims of ID token which are used by the application
+type Claims struct {
+	jwt.RegisteredClaims
+	Nonce string `json:"nonce"`
+	// AuthorizedParty - the client which the token was issued to, required if there are several audiences
+	AuthorizedParty   string `json:"azp,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     bool   `json:"email_verified,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+}
+
+// Username - returns the value of the claim which becomes the login of a new user. E-mail address is used
+// only if the provider has verified it, otherwise anyone could take the login of another person.
+func (c *Claims) Username(claim string) string {
+	switch claim {
+	case ClaimEmail:
+		if c.EmailVerified {
+			return c.Email
+		}
+	case ClaimPreferredUsername:
+		return c.PreferredUsername
+	case ClaimSubject:
+		return c.Subject
+	}
+
+	return ""
+}
+
+// Provider - client of the identity provider. Discovery document and keys are loaded on first use.
+type Provider struct {
+	issuerURL    string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       string
+	client       *http.Client
+
+	mu           sync.Mutex
+	metadata     *Metadata
+	keys         []*verificationKey
+	keysLoadedAt time.Time
+}
+
+// New - creates the client of the provider from the application configuration. Returns ErrNotConfigured
+// if the issuer is not set.
+func New(appConfig config.AppConfig) (*Provider, error) {
+	if appConfig.OIDCIssuerURL == "" {
+		return nil, ErrNotConfigured
+	}
+
+	if appConfig.OIDCClientID == "" || appConfig.OIDCRedirectURL == "" {
+		return nil, errors.New("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required for OpenID Connect sign in")
+	}
+
+	switch appConfig.OIDCUsernameClaim {
+	case ClaimEmail, ClaimPreferredUsername, ClaimSubject:
+	default:
+		return nil, fmt.Errorf("unsupported OIDC_USERNAME_CLAIM %q", appConfig.OIDCUsernameClaim)
+	}
+
+	scopes := strings.Fields(appConfig.OIDCScopes)
+	if len(scopes) == 0 || scopes[0] != "openid" {
+		// Without "openid" scope the provider doesn't return ID token
+		scopes = append([]string{"openid"}, scopes...)
+	}
+
+	return &Provider{
+		issuerURL:    appConfig.OIDCIssuerURL,
+		clientID:     appConfig.OIDCClientID,
+		clientSecret: appConfig.OIDCClientSecret,
+		redirectURL:  appConfig.OIDCRedirectURL,
+		scopes:       strings.Join(scopes, " "),
+		client:       &http.Client{Timeout: httpTimeout},
+	}, nil
+}
+
+// Issuer - the issuer of ID tokens, which is also the first part of user identities
+func (p *Provider) Issuer() string {
+	return p.issuerURL
+}
+
+// discover - loads the discovery document. If it cannot be loaded, the next call tries again.
+func (p *Provider) discover(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	metadata := p.metadata
+	p.mu.Unlock()
+
+	if metadata != nil {
+		return metadata, nil
+	}
+
+	metadata = &Metadata{}
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.issuerURL, "/")+discoveryPath, metadata); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+
+	// Otherwise a provider could issue tokens on behalf of another one
+	if metadata.Issuer != p.issuerURL {
+		return nil, fmt.Errorf("discovery: issuer %q doesn't match %q", metadata.Issuer, p.issuerURL)
+	}
+
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("discovery: required endpoints are missing")
+	}
+
+	p.mu.Lock()
+	p.metadata = metadata
+	p.mu.Unlock()
+
+	return metadata, nil
+}
+
+// AuthCodeURL - returns the address of the provider where the user should be redirected to sign in
+func (p *Provider) AuthCodeURL(ctx context.Context, request *AuthRequest) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.clientID)
+	query.Set("redirect_uri", p.redirectURL)
+	query.Set("scope", p.scopes)
+	query.Set("state", request.State)
+	query.Set("nonce", request.Nonce)
+	query.Set("code_challenge", codeChallenge(request.Verifier))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange - exchanges the authorization code for ID token and returns its verified claims
+func (p *Provider) Exchange(ctx context.Context, code string, request *AuthRequest) (*Claims, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURL)
+	form.Set("client_id", p.clientID)
+	form.Set("code_verifier", request.Verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.clientSecret != "" {
+		// RFC 6749 requires to encode the credentials before they are put into the header
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var token tokenResponse
+	if err = json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(&token); err != nil {
+		return nil, fmt.Errorf("token endpoint: %s: %w", res.Status, err)
+	}
+
+	if res.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("token endpoint: %s: %s %s", res.Status, token.Error, token.ErrorDescription)
+	}
+
+	if token.IDToken == "" {
+		return nil, errors.New("token endpoint: ID token is missing")
+	}
+
+	return p.verify(ctx, metadata, token.IDToken, request.Nonce)
+}
+
+// verify - checks the signature and claims of ID token, see OpenID Connect Core 1.0, section 3.1.3.7
+func (p *Provider) verify(ctx context.Context, metadata *Metadata, rawToken, nonce string) (*Claims, error) {
+	claims := &Claims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(supportedAlgorithms))
+	_, err := parser.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (any, error) {
+		return p.key(ctx, metadata, token)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err.Error())
+	}
+
+	switch {
+	case claims.ExpiresAt == nil || claims.IssuedAt == nil:
+		err = errors.New("expiration and issue time are required")
+	case claims.Subject == "":
+		err = errors.New("subject is missing")
+	case !claims.VerifyIssuer(metadata.Issuer, true):
+		err = errors.New("invalid issuer")
+	case !claims.VerifyAudience(p.clientID, true):
+		err = errors.New("invalid audience")
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.clientID:
+		err = errors.New("invalid authorized party")
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		// The token was issued for another authorization request, it could be replayed
+		err = errors.New("invalid nonce")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err.Error())
+	}
+
+	return claims, nil
+}
+
+// key - returns the key which has signed the token. Providers rotate their keys, so if the key
+// is unknown, the keys are loaded again.
+func (p *Provider) key(ctx context.Context, metadata *Metadata, token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	alg := token.Method.Alg()
+
+	p.mu.Lock()
+	key := findKey(p.keys, kid, alg)
+	reload := key == nil && time.Since(p.keysLoadedAt) > keysRefreshInterval
+	p.mu.Unlock()
+
+	if reload {
+		data, err := p.get(ctx, metadata.JWKSURI)
+		if err != nil {
+			return nil, fmt.Errorf("jwks: %w", err)
+		}
+
+		keys, err := parseJWKS(data)
+		if err != nil {
+			return nil, fmt.Errorf("jwks: %w", err)
+		}
+
+		p.mu.Lock()
+		p.keys, p.keysLoadedAt = keys, time.Now()
+		p.mu.Unlock()
+
+		key = findKey(keys, kid, alg)
+	}
+
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+
+	return key.public, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, address string, v any) error {
+	data, err := p.get(ctx, address)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func (p *Provider) get(ctx context.Context, address string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", address, res.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+}
@@ -0,0 +1,217 @@
+package oidc
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/oidc/oidctest"
+)
+
+func newTestProvider(t *testing.T, clientSecret string) (*Provider, *oidctest.Provider) {
+	t.Helper()
+
+	idp := oidctest.NewProvider("kms", clientSecret)
+	t.Cleanup(idp.Close)
+
+	p, err := New(config.AppConfig{
+		OIDCIssuerURL:     idp.Issuer(),
+		OIDCClientID:      "kms",
+		OIDCClientSecret:  clientSecret,
+		OIDCRedirectURL:   "https://kms.example.com/api/v1/user/oidc/callback",
+		OIDCScopes:        "email",
+		OIDCUsernameClaim: ClaimEmail,
+	})
+	require.NoError(t, err)
+
+	return p, idp
+}
+
+// signIn - follows the authorization URL and returns the code from the callback
+func signIn(t *testing.T, p *Provider, idp *oidctest.Provider, request *AuthRequest) string {
+	t.Helper()
+
+	authURL, err := p.AuthCodeURL(context.Background(), request)
+	require.NoError(t, err)
+
+	query, err := url.Parse(authURL)
+	require.NoError(t, err)
+	require.Equal(t, "openid email", query.Query().Get("scope"))
+	require.Equal(t, "S256", query.Query().Get("code_challenge_method"))
+	require.NotContains(t, authURL, request.Verifier)
+
+	callback, err := idp.Authorize(authURL)
+	require.NoError(t, err)
+
+	callbackURL, err := url.Parse(callback)
+	require.NoError(t, err)
+	require.Equal(t, request.State, callbackURL.Query().Get("state"))
+
+	return callbackURL.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	for _, clientSecret := range []string{"", "s3cret:+/"} {
+		p, idp := newTestProvider(t, clientSecret)
+
+		request, err := NewAuthRequest(time.Minute)
+		require.NoError(t, err)
+
+		code := signIn(t, p, idp, request)
+		claims, err := p.Exchange(context.Background(), code, request)
+		require.NoError(t, err)
+		require.Equal(t, idp.User.Subject, claims.Subject)
+		require.Equal(t, idp.User.Email, claims.Username(ClaimEmail))
+
+		// The code is exchanged only once
+		_, err = p.Exchange(context.Background(), code, request)
+		require.Error(t, err)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	p, idp := newTestProvider(t, "")
+
+	request, err := NewAuthRequest(time.Minute)
+	require.NoError(t, err)
+
+	code := signIn(t, p, idp, request)
+	stolen := *request
+	stolen.Verifier = "intercepted code is useless without the verifier"
+
+	_, err = p.Exchange(context.Background(), code, &stolen)
+	require.Error(t, err)
+}
+
+func TestExchangeVerifiesIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims func(claims jwt.MapClaims)
+	}{
+		{
+			name:   "Wrong audience",
+			claims: func(claims jwt.MapClaims) { claims["aud"] = "another client" },
+		},
+		{
+			name:   "Several audiences without authorized party",
+			claims: func(claims jwt.MapClaims) { claims["aud"] = []string{"kms", "another client"} },
+		},
+		{
+			name:   "Wrong issuer",
+			claims: func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" },
+		},
+		{
+			name:   "Expired token",
+			claims: func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() },
+		},
+		{
+			name:   "Missing expiration",
+			claims: func(claims jwt.MapClaims) { delete(claims, "exp") },
+		},
+		{
+			name:   "Wrong nonce",
+			claims: func(claims jwt.MapClaims) { claims["nonce"] = "replayed" },
+		},
+		{
+			name:   "Missing subject",
+			claims: func(claims jwt.MapClaims) { delete(claims, "sub") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, idp := newTestProvider(t, "")
+			idp.Claims = tt.claims
+
+			request, err := NewAuthRequest(time.Minute)
+			require.NoError(t, err)
+
+			_, err = p.Exchange(context.Background(), signIn(t, p, idp, request), request)
+			require.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+}
+
+func TestUsername(t *testing.T) {
+	claims := Claims{
+		RegisteredClaims:  jwt.RegisteredClaims{Subject: "248289761001"},
+		Email:             "jane.doe@example.com",
+		PreferredUsername: "jane",
+	}
+
+	// Unverified e-mail could belong to anyone
+	require.Empty(t, claims.Username(ClaimEmail))
+	require.Equal(t, "jane", claims.Username(ClaimPreferredUsername))
+	require.Equal(t, "248289761001", claims.Username(ClaimSubject))
+
+	claims.EmailVerified = true
+	require.Equal(t, "jane.doe@example.com", claims.Username(ClaimEmail))
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(config.AppConfig{})
+	require.ErrorIs(t, err, ErrNotConfigured)
+
+	_, err = New(config.AppConfig{OIDCIssuerURL: "https://idp.example.com"})
+	require.Error(t, err)
+
+	_, err = New(config.AppConfig{
+		OIDCIssuerURL:     "https://idp.example.com",
+		OIDCClientID:      "kms",
+		OIDCRedirectURL:   "https://kms.example.com/api/v1/user/oidc/callback",
+		OIDCUsernameClaim: "name",
+	})
+	require.Error(t, err)
+}
+
+func TestRequestStore(t *testing.T) {
+	store := NewRequestStore()
+
+	request, err := NewAuthRequest(time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, store.Save(request))
+
+	taken, ok := store.Take(request.State)
+	require.True(t, ok)
+	require.Equal(t, request, taken)
+
+	// Every request is taken only once
+	_, ok = store.Take(request.State)
+	require.False(t, ok)
+
+	expired, err := NewAuthRequest(-time.Second)
+	require.NoError(t, err)
+	require.NoError(t, store.Save(expired))
+
+	_, ok = store.Take(expired.State)
+	require.False(t, ok)
+}
+
+func TestParseJWKS(t *testing.T) {
+	keys, err := parseJWKS([]byte(`{"keys": [
+		{"kty": "EC", "crv": "P-256", "kid": "ec", "use": "sig",
+			"x": "f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU", "y": "x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0"},
+		{"kty": "OKP", "crv": "Ed25519", "kid": "ed", "alg": "EdDSA",
+			"x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"}
+	]}`))
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+
+	require.NotNil(t, findKey(keys, "ec", "ES256"))
+	require.NotNil(t, findKey(keys, "", "EdDSA"))
+	// The algorithm must match the key, otherwise a public key could be used as HMAC secret
+	require.Nil(t, findKey(keys, "ec", "HS256"))
+	require.Nil(t, findKey(keys, "ed", "ES256"))
+
+	// Short RSA keys are skipped
+	keys, err = parseJWKS([]byte(`{"keys": [{"kty": "RSA", "kid": "weak", "n": "AQAB", "e": "AQAB"}]}`))
+	require.NoError(t, err)
+	require.Empty(t, keys)
+}
@@ -0,0 +1,109 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+)
+
+// maxPendingRequests - sign in can be started by anyone, so the number of requests
+// which are waiting for the provider is limited
+const maxPendingRequests = 10000
+
+var ErrTooManyRequests = errors.New("too many pending authorization requests")
+
+// AuthRequest - secrets of an authorization request, which are checked when the provider
+// redirects the user back. They are never stored outside the memory of the server.
+type AuthRequest struct {
+	// State - binds the callback to the browser which has started the sign in
+	State string
+	// Nonce - binds ID token to the request, so a token which was issued earlier cannot be replayed
+	Nonce string
+	// Verifier - PKCE code verifier, only its hash is sent with the authorization request,
+	// so an intercepted code is useless without it
+	Verifier  string
+	ExpiresAt time.Time
+}
+
+// NewAuthRequest - creates a request with random secrets
+func NewAuthRequest(lifetime time.Duration) (*AuthRequest, error) {
+	values := make([]string, 3)
+	for i := range values {
+		data := make([]byte, 32)
+		if _, err := rand.Read(data); err != nil {
+			return nil, err
+		}
+
+		values[i] = base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	return &AuthRequest{
+		State:     values[0],
+		Nonce:     values[1],
+		Verifier:  values[2],
+		ExpiresAt: time.Now().Add(lifetime),
+	}, nil
+}
+
+// codeChallenge - S256 code challenge of the verifier, see RFC 7636
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// RequestStore - keeps authorization requests until the provider redirects the user back.
+// Every request can be taken only once.
+type RequestStore struct {
+	mu       sync.Mutex
+	requests map[string]*AuthRequest
+}
+
+func NewRequestStore() *RequestStore {
+	return &RequestStore{requests: make(map[string]*AuthRequest)}
+}
+
+// Save - adds the request. Expired requests are removed when the store is full.
+func (s *RequestStore) Save(request *AuthRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.requests) >= maxPendingRequests {
+		now := time.Now()
+		for state, r := range s.requests {
+			if now.After(r.ExpiresAt) {
+				delete(s.requests, state)
+			}
+		}
+	}
+
+	if len(s.requests) >= maxPendingRequests {
+		return ErrTooManyRequests
+	}
+
+	s.requests[request.State] = request
+
+	return nil
+}
+
+// Take - removes the request and returns it, if it's not expired
+func (s *RequestStore) Take(state string) (*AuthRequest, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, ok := s.requests[state]
+	if !ok {
+		return nil, false
+	}
+
+	delete(s.requests, state)
+
+	if time.Now().After(request.ExpiresAt) {
+		return nil, false
+	}
+
+	return request, true
+}
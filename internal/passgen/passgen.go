@@ -0,0 +1,201 @@
+// Package passgen generates random passwords and diceware passphrases using cryptographically secure
+// random number generator. It doesn't depend on the rest of the application and can be used by any client.
+package passgen
+
+import (
+	"crypto/rand"
+	"errors"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/grafviktor/keep-my-secret/internal/wordlist"
+)
+
+const (
+	lowercase = "abcdefghijklmnopqrstuvwxyz"
+	uppercase = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digits    = "0123456789"
+	symbols   = "!@#$%^&*()-_=+[]{}|;:,.<>?~"
+	// ambiguous characters are hard to distinguish when a password is read by a human
+	ambiguous = "Il1O0o|`'\";:,."
+
+	// maxAttempts limits number of attempts to generate a password which contains every requested character class
+	maxAttempts = 1000
+)
+
+// Limits of password length and passphrase words count
+const (
+	MinLength = 4
+	MaxLength = 128
+	MinWords  = 3
+	MaxWords  = 20
+)
+
+// Errors which are returned when options are not valid
+var (
+	ErrInvalidLength = errors.New("password length is out of range")
+	ErrInvalidWords  = errors.New("number of words is out of range")
+	ErrNoCharacters  = errors.New("no character classes selected")
+)
+
+// Options - password generation settings. If Words is greater than zero, a diceware passphrase
+// is generated and character options are ignored.
+type Options struct {
+	Length           int    `json:"length"`
+	Lowercase        bool   `json:"lowercase"`
+	Uppercase        bool   `json:"uppercase"`
+	Digits           bool   `json:"digits"`
+	Symbols          bool   `json:"symbols"`
+	ExcludeAmbiguous bool   `json:"exclude_ambiguous"`
+	Words            int    `json:"words"`
+	Separator        string `json:"separator"`
+}
+
+// Result - generated password and its entropy estimate in bits
+type Result struct {
+	Password string  `json:"password"`
+	Entropy  float64 `json:"entropy"`
+}
+
+// DefaultOptions - 20 characters long password which contains all character classes
+func DefaultOptions() Options {
+	return Options{
+		Length:    20,
+		Lowercase: true,
+		Uppercase: true,
+		Digits:    true,
+		Symbols:   true,
+		Separator: "-",
+	}
+}
+
+// Generate - generates a password or a passphrase according to the options
+func Generate(opts Options) (Result, error) {
+	if opts.Words > 0 {
+		return generatePassphrase(opts)
+	}
+
+	return generatePassword(opts)
+}
+
+func generatePassword(opts Options) (Result, error) {
+	if opts.Length < MinLength || opts.Length > MaxLength {
+		return Result{}, ErrInvalidLength
+	}
+
+	classes := make([]string, 0, 4)
+	for _, class := range []struct {
+		enabled bool
+		chars   string
+	}{
+		{opts.Lowercase, lowercase},
+		{opts.Uppercase, uppercase},
+		{opts.Digits, digits},
+		{opts.Symbols, symbols},
+	} {
+		if !class.enabled {
+			continue
+		}
+
+		chars := class.chars
+		if opts.ExcludeAmbiguous {
+			chars = removeChars(chars, ambiguous)
+		}
+		classes = append(classes, chars)
+	}
+
+	if len(classes) == 0 {
+		return Result{}, ErrNoCharacters
+	}
+
+	if len(classes) > opts.Length {
+		return Result{}, ErrInvalidLength
+	}
+
+	pool := strings.Join(classes, "")
+
+	// Passwords which don't contain all requested character classes are rejected. This keeps distribution
+	// uniform among the acceptable passwords, unlike inserting the missing characters into fixed positions.
+	for i := 0; i < maxAttempts; i++ {
+		password := make([]byte, opts.Length)
+		for j := range password {
+			n, err := randomInt(len(pool))
+			if err != nil {
+				return Result{}, err
+			}
+
+			password[j] = pool[n]
+		}
+
+		if containsAllClasses(string(password), classes) {
+			return Result{
+				Password: string(password),
+				Entropy:  Entropy(opts.Length, len(pool)),
+			}, nil
+		}
+	}
+
+	return Result{}, errors.New("cannot generate password, try to increase its length")
+}
+
+func generatePassphrase(opts Options) (Result, error) {
+	if opts.Words < MinWords || opts.Words > MaxWords {
+		return Result{}, ErrInvalidWords
+	}
+
+	words := wordlist.Diceware()
+	passphrase := make([]string, opts.Words)
+	for i := range passphrase {
+		n, err := randomInt(len(words))
+		if err != nil {
+			return Result{}, err
+		}
+
+		passphrase[i] = words[n]
+	}
+
+	return Result{
+		Password: strings.Join(passphrase, opts.Separator),
+		Entropy:  Entropy(opts.Words, len(words)),
+	}, nil
+}
+
+// Entropy - returns entropy in bits of a sequence of 'count' elements, randomly chosen from a set of 'poolSize'
+func Entropy(count, poolSize int) float64 {
+	if count <= 0 || poolSize <= 1 {
+		return 0
+	}
+
+	return math.Round(float64(count)*math.Log2(float64(poolSize))*100) / 100
+}
+
+// randomInt - returns uniform random number in [0, n) using crypto/rand
+func randomInt(n int) (int, error) {
+	value, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+
+	return int(value.Int64()), nil
+}
+
+func removeChars(s, chars string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(chars, r) {
+			return -1
+		}
+
+		return r
+	}, s)
+}
+
+func containsAllClasses(password string, classes []string) bool {
+	for _, class := range classes {
+		if !strings.ContainsAny(password, class) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,64 @@
+package passgen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneratePassword(t *testing.T) {
+	opts := DefaultOptions()
+	result, err := Generate(opts)
+	require.NoError(t, err)
+	require.Len(t, result.Password, opts.Length)
+	require.True(t, strings.ContainsAny(result.Password, lowercase))
+	require.True(t, strings.ContainsAny(result.Password, uppercase))
+	require.True(t, strings.ContainsAny(result.Password, digits))
+	require.True(t, strings.ContainsAny(result.Password, symbols))
+	require.Equal(t, Entropy(opts.Length, len(lowercase+uppercase+digits+symbols)), result.Entropy)
+
+	another, err := Generate(opts)
+	require.NoError(t, err)
+	require.NotEqual(t, result.Password, another.Password)
+}
+
+func TestGeneratePasswordCharacterClasses(t *testing.T) {
+	result, err := Generate(Options{Length: 32, Digits: true})
+	require.NoError(t, err)
+	require.Empty(t, strings.Trim(result.Password, digits))
+
+	result, err = Generate(Options{Length: 64, Lowercase: true, Uppercase: true, Digits: true, ExcludeAmbiguous: true})
+	require.NoError(t, err)
+	require.False(t, strings.ContainsAny(result.Password, ambiguous))
+}
+
+func TestGeneratePasswordErrors(t *testing.T) {
+	_, err := Generate(Options{Length: 20})
+	require.ErrorIs(t, err, ErrNoCharacters)
+
+	_, err = Generate(Options{Length: MinLength - 1, Lowercase: true})
+	require.ErrorIs(t, err, ErrInvalidLength)
+
+	_, err = Generate(Options{Length: MaxLength + 1, Lowercase: true})
+	require.ErrorIs(t, err, ErrInvalidLength)
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	result, err := Generate(Options{Words: 6, Separator: " "})
+	require.NoError(t, err)
+	require.Len(t, strings.Split(result.Password, " "), 6)
+	require.InDelta(t, 77.55, result.Entropy, 0.01)
+
+	_, err = Generate(Options{Words: MinWords - 1})
+	require.ErrorIs(t, err, ErrInvalidWords)
+
+	_, err = Generate(Options{Words: MaxWords + 1})
+	require.ErrorIs(t, err, ErrInvalidWords)
+}
+
+func TestEntropy(t *testing.T) {
+	require.Equal(t, float64(0), Entropy(0, 10))
+	require.Equal(t, float64(0), Entropy(10, 1))
+	require.Equal(t, float64(8), Entropy(8, 2))
+}
@@ -0,0 +1,268 @@
+// Package policy - checks usernames and passwords against the credentials policy of the application.
+//
+// Violations are reported per field, so the client can show them next to the inputs of a form.
+// Zero value of Policy only requires non-empty credentials which fit into bcrypt limits.
+package policy
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/grafviktor/keep-my-secret/internal/config"
+)
+
+const (
+	// MaxPasswordLength - bcrypt doesn't accept passwords longer than 72 bytes
+	MaxPasswordLength = 72
+	// usernameSymbols - characters which are allowed in usernames in addition to letters and digits,
+	// so e-mail addresses can be used as usernames
+	usernameSymbols = ".-_@+"
+	// minUsernameMatch - shorter usernames are not looked for in passwords, they match too often
+	minUsernameMatch = 3
+)
+
+// Violation codes
+const (
+	CodeRequired          = "required"
+	CodeTooShort          = "too_short"
+	CodeTooLong           = "too_long"
+	CodeInvalidCharacters = "invalid_characters"
+	CodeCharacterClasses  = "character_classes"
+	CodeCommonPassword    = "common_password"
+	CodeContainsUsername  = "contains_username"
+	CodeSameAsCurrent     = "same_as_current"
+)
+
+const charClassesDescription = "lowercase letters, uppercase letters, digits and symbols"
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// Violation - describes why a field doesn't conform to the policy
+type Violation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Policy - requirements to usernames and passwords
+type Policy struct {
+	// MinLength - minimum number of characters in a password
+	MinLength int
+	// MinCharClasses - how many of the character classes a password must contain:
+	// lowercase letters, uppercase letters, digits and symbols
+	MinCharClasses int
+	// Blocklist - lowercase passwords which are rejected. Nil disables the check
+	Blocklist map[string]struct{}
+	// RejectUsername - rejects passwords which contain the username
+	RejectUsername bool
+	// UsernameMaxLength - maximum number of characters in a username. Zero means unlimited
+	UsernameMaxLength int
+}
+
+// New - creates the policy from the application configuration. The blocklist file extends
+// the built-in list of common passwords, it is used even if the built-in list is disabled.
+// An error is returned only if the blocklist file cannot be read.
+func New(appConfig config.AppConfig) (*Policy, error) {
+	p := &Policy{
+		MinLength:         appConfig.PasswordMinLength,
+		MinCharClasses:    appConfig.PasswordCharClasses,
+		RejectUsername:    appConfig.PasswordRejectUsername,
+		UsernameMaxLength: appConfig.UsernameMaxLength,
+	}
+
+	if appConfig.PasswordBlocklist {
+		p.Blocklist = make(map[string]struct{})
+		// The built-in list is read from memory, so it cannot fail
+		_ = addToBlocklist(p.Blocklist, strings.NewReader(commonPasswords))
+	}
+
+	if appConfig.PasswordBlocklistPath != "" {
+		file, err := os.Open(appConfig.PasswordBlocklistPath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		if p.Blocklist == nil {
+			p.Blocklist = make(map[string]struct{})
+		}
+
+		if err = addToBlocklist(p.Blocklist, file); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// addToBlocklist - reads passwords, one per line. Empty lines and lines starting with '#' are skipped.
+func addToBlocklist(blocklist map[string]struct{}, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		blocklist[strings.ToLower(line)] = struct{}{}
+	}
+
+	return scanner.Err()
+}
+
+// Check - checks both username and password, the password is checked against the username as well
+func (p *Policy) Check(username, password string) []Violation {
+	violations := p.CheckUsername("username", username)
+
+	return append(violations, p.CheckPassword("password", password, username)...)
+}
+
+// CheckUsername - username must not be empty, may contain only letters, digits and ".-_@+" characters
+func (p *Policy) CheckUsername(field, username string) []Violation {
+	if username == "" {
+		return []Violation{{Field: field, Code: CodeRequired, Message: "username is required"}}
+	}
+
+	violations := make([]Violation, 0)
+	if p.UsernameMaxLength > 0 && utf8.RuneCountInString(username) > p.UsernameMaxLength {
+		violations = append(violations, Violation{
+			Field:   field,
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("username must not be longer than %d characters", p.UsernameMaxLength),
+		})
+	}
+
+	for _, r := range username {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(usernameSymbols, r) {
+			violations = append(violations, Violation{
+				Field:   field,
+				Code:    CodeInvalidCharacters,
+				Message: fmt.Sprintf("username may contain only letters, digits and %q characters", usernameSymbols),
+			})
+
+			break
+		}
+	}
+
+	return violations
+}
+
+// CheckPassword - checks the password. The username may be empty, when it is unknown.
+func (p *Policy) CheckPassword(field, password, username string) []Violation {
+	if password == "" {
+		return []Violation{{Field: field, Code: CodeRequired, Message: "password is required"}}
+	}
+
+	violations := make([]Violation, 0)
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, Violation{
+			Field:   field,
+			Code:    CodeTooShort,
+			Message: fmt.Sprintf("password must be at least %d characters long", p.MinLength),
+		})
+	}
+
+	if len(password) > MaxPasswordLength {
+		violations = append(violations, Violation{
+			Field:   field,
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("password must not be longer than %d bytes", MaxPasswordLength),
+		})
+	}
+
+	if charClasses(password) < p.MinCharClasses {
+		violations = append(violations, Violation{
+			Field: field,
+			Code:  CodeCharacterClasses,
+			Message: fmt.Sprintf("password must contain at least %d of the following: %s",
+				p.MinCharClasses, charClassesDescription),
+		})
+	}
+
+	if p.isBlocked(password) {
+		violations = append(violations, Violation{
+			Field:   field,
+			Code:    CodeCommonPassword,
+			Message: "password is too common",
+		})
+	}
+
+	if p.RejectUsername && containsUsername(password, username) {
+		violations = append(violations, Violation{
+			Field:   field,
+			Code:    CodeContainsUsername,
+			Message: "password must not contain the username",
+		})
+	}
+
+	return violations
+}
+
+// charClasses - returns the number of character classes which are used in the password
+func charClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+
+	return lower + upper + digit + symbol
+}
+
+// isBlocked - common passwords are often decorated with digits and symbols, for instance "Password123!",
+// so the password is looked up both as it is and without leading and trailing non-letters
+func (p *Policy) isBlocked(password string) bool {
+	if p.Blocklist == nil {
+		return false
+	}
+
+	lower := strings.ToLower(password)
+	if _, ok := p.Blocklist[lower]; ok {
+		return true
+	}
+
+	stripped := strings.TrimFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if stripped == "" || stripped == lower {
+		return false
+	}
+
+	_, ok := p.Blocklist[stripped]
+
+	return ok
+}
+
+// containsUsername - the local part of e-mail address is checked too, because it is what people usually reuse
+func containsUsername(password, username string) bool {
+	password = strings.ToLower(password)
+	username = strings.ToLower(username)
+
+	candidates := []string{username}
+	if localPart, _, found := strings.Cut(username, "@"); found {
+		candidates = append(candidates, localPart)
+	}
+
+	for _, candidate := range candidates {
+		if utf8.RuneCountInString(candidate) >= minUsernameMatch && strings.Contains(password, candidate) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,125 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/config"
+)
+
+var strictConfig = config.AppConfig{
+	PasswordMinLength:      10,
+	PasswordCharClasses:    3,
+	PasswordBlocklist:      true,
+	PasswordRejectUsername: true,
+	UsernameMaxLength:      16,
+}
+
+func codes(violations []Violation) []string {
+	result := make([]string, 0, len(violations))
+	for _, v := range violations {
+		result = append(result, v.Field+":"+v.Code)
+	}
+
+	return result
+}
+
+func TestCheck(t *testing.T) {
+	p, err := New(strictConfig)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     []string
+	}{
+		{
+			name:     "Conforming credentials",
+			username: "tony.tester@x.io",
+			password: "Correct-Horse-7",
+			want:     []string{},
+		},
+		{
+			name:     "Empty credentials",
+			username: "",
+			password: "",
+			want:     []string{"username:required", "password:required"},
+		},
+		{
+			name:     "Long username with invalid characters",
+			username: "tony tester from example",
+			password: "Correct-Horse-7",
+			want:     []string{"username:too_long", "username:invalid_characters"},
+		},
+		{
+			name:     "Short password with a single character class",
+			username: "tony",
+			password: "horse",
+			want:     []string{"password:too_short", "password:character_classes"},
+		},
+		{
+			name:     "Password longer than bcrypt accepts",
+			username: "tony",
+			password: "Aa1" + strings.Repeat("x", MaxPasswordLength),
+			want:     []string{"password:too_long"},
+		},
+		{
+			name:     "Common password",
+			username: "tony",
+			password: "Qwertyuiop1",
+			want:     []string{"password:common_password"},
+		},
+		{
+			name:     "Common password decorated with digits and symbols",
+			username: "tony",
+			password: "!!Password2023",
+			want:     []string{"password:common_password"},
+		},
+		{
+			name:     "Password contains the username",
+			username: "Tony",
+			password: "Horse-tony-7",
+			want:     []string{"password:contains_username"},
+		},
+		{
+			name:     "Password contains the local part of the e-mail",
+			username: "tester@x.io",
+			password: "Horse-Tester-7",
+			want:     []string{"password:contains_username"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, codes(p.Check(tt.username, tt.password)))
+		})
+	}
+}
+
+func TestZeroPolicy(t *testing.T) {
+	p := Policy{}
+
+	require.Empty(t, p.Check("tony", "1"))
+	require.Empty(t, p.Check("tony", "password"))
+	require.Equal(t, []string{"password:required"}, codes(p.Check("tony", "")))
+}
+
+func TestBlocklistFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# company passwords\n\nKeepMySecretRocks\n"), 0o600))
+
+	p, err := New(config.AppConfig{PasswordBlocklistPath: path})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"password:common_password"}, codes(p.Check("tony", "keepmysecretrocks")))
+	// The built-in list is disabled
+	require.Empty(t, p.Check("tony", "password"))
+
+	_, err = New(config.AppConfig{PasswordBlocklistPath: filepath.Join(t.TempDir(), "missing.txt")})
+	require.Error(t, err)
+}
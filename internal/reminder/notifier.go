@@ -0,0 +1,81 @@
+package reminder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// Notifier delivers reminders to users
+type Notifier interface {
+	Notify(ctx context.Context, reminders []model.Reminder) error
+}
+
+// NewNotifier - creates a notifier according to the application configuration.
+// If webhook URL is not set, reminders are only written to the application log.
+func NewNotifier(appConfig config.AppConfig) Notifier {
+	if appConfig.ReminderWebhookURL == "" {
+		return LogNotifier{}
+	}
+
+	return WebhookNotifier{
+		URL:    appConfig.ReminderWebhookURL,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// LogNotifier - writes reminders to the application log
+type LogNotifier struct{}
+
+// Notify - see Notifier interface
+func (n LogNotifier) Notify(_ context.Context, reminders []model.Reminder) error {
+	for _, r := range reminders {
+		log.Printf("Reminder: secret %d of user '%s' is due for %s at %s\n",
+			r.SecretID, r.Login, r.Kind, r.DueAt.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// WebhookNotifier - sends reminders to an external service as a JSON document
+type WebhookNotifier struct {
+	Client *http.Client
+	URL    string
+}
+
+type webhookPayload struct {
+	Reminders []model.Reminder `json:"reminders"`
+}
+
+// Notify - see Notifier interface
+func (n WebhookNotifier) Notify(ctx context.Context, reminders []model.Reminder) error {
+	body, err := json.Marshal(webhookPayload{Reminders: reminders})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
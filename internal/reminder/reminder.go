@@ -0,0 +1,128 @@
+// Package reminder finds secrets which are expired or should be rotated and notifies their owners
+package reminder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// Due - returns a reminder if the secret expires or should be rotated before 'until'.
+// If both dates are set, the earliest one is used.
+func Due(secret *model.Secret, login string, until time.Time) (model.Reminder, bool) {
+	reminder := model.Reminder{Login: login, SecretID: secret.ID}
+
+	if secret.ExpiresAt != nil {
+		reminder.Kind = model.ReminderKindExpiration
+		reminder.DueAt = secret.ExpiresAt.UTC()
+	}
+
+	if secret.RotateEvery > 0 {
+		changedAt := secret.UpdatedAt
+		if changedAt == nil {
+			changedAt = secret.CreatedAt
+		}
+
+		if changedAt != nil {
+			rotateAt := changedAt.UTC().AddDate(0, 0, secret.RotateEvery)
+			if reminder.Kind == "" || rotateAt.Before(reminder.DueAt) {
+				reminder.Kind = model.ReminderKindRotation
+				reminder.DueAt = rotateAt
+			}
+		}
+	}
+
+	if reminder.Kind == "" || reminder.DueAt.After(until) {
+		return model.Reminder{}, false
+	}
+
+	return reminder, true
+}
+
+// Collect - returns reminders for all secrets which are due before 'until', the earliest go first
+func Collect(secrets []*model.Secret, login string, until time.Time) []model.Reminder {
+	reminders := make([]model.Reminder, 0)
+	for _, secret := range secrets {
+		if reminder, ok := Due(secret, login, until); ok {
+			reminders = append(reminders, reminder)
+		}
+	}
+
+	sort.Slice(reminders, func(i, j int) bool {
+		return reminders[i].DueAt.Before(reminders[j].DueAt)
+	})
+
+	return reminders
+}
+
+type secretStorage interface {
+	GetSecretsWithReminders(ctx context.Context) (map[string][]*model.Secret, error)
+}
+
+// Checker - periodically looks for due secrets of all users and sends them to the notifier.
+// Every reminder is sent only once while the application is running.
+type Checker struct {
+	storage  secretStorage
+	notifier Notifier
+	leadTime time.Duration
+	mu       sync.Mutex
+	notified map[string]struct{}
+}
+
+// NewChecker - creates a new Checker. leadTime defines how long before the due date a user should be notified
+func NewChecker(storage secretStorage, notifier Notifier, leadTime time.Duration) *Checker {
+	return &Checker{
+		storage:  storage,
+		notifier: notifier,
+		leadTime: leadTime,
+		notified: make(map[string]struct{}),
+	}
+}
+
+// Check - finds due secrets and notifies about the ones which were not reported before.
+// Its signature matches scheduler.Job
+func (c *Checker) Check(ctx context.Context) error {
+	secretsByUser, err := c.storage.GetSecretsWithReminders(ctx)
+	if err != nil {
+		return err
+	}
+
+	until := time.Now().UTC().Add(c.leadTime)
+	due := make(map[string]struct{})
+	reminders := make([]model.Reminder, 0)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for login, secrets := range secretsByUser {
+		for _, reminder := range Collect(secrets, login, until) {
+			key := fmt.Sprintf("%d:%s:%d", reminder.SecretID, reminder.Kind, reminder.DueAt.Unix())
+			due[key] = struct{}{}
+
+			if _, ok := c.notified[key]; !ok {
+				reminders = append(reminders, reminder)
+			}
+		}
+	}
+
+	if len(reminders) == 0 {
+		c.notified = due
+		return nil
+	}
+
+	if err = c.notifier.Notify(ctx, reminders); err != nil {
+		// Reminders will be sent again next time
+		return err
+	}
+
+	// Forget reminders for the secrets which were renewed or deleted
+	c.notified = due
+	log.Printf("Reminder: %d notification(s) sent\n", len(reminders))
+
+	return nil
+}
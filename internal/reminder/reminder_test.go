@@ -0,0 +1,192 @@
+package reminder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestDue(t *testing.T) {
+	now := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		secret   model.Secret
+		wantKind string
+		wantOK   bool
+	}{
+		{
+			name:   "no reminders",
+			secret: model.Secret{ID: 1},
+			wantOK: false,
+		},
+		{
+			name:     "expired",
+			secret:   model.Secret{ID: 1, ExpiresAt: timePtr(now.AddDate(0, 0, -1))},
+			wantKind: model.ReminderKindExpiration,
+			wantOK:   true,
+		},
+		{
+			name:   "expires later",
+			secret: model.Secret{ID: 1, ExpiresAt: timePtr(now.AddDate(0, 1, 0))},
+			wantOK: false,
+		},
+		{
+			name:     "should be rotated",
+			secret:   model.Secret{ID: 1, RotateEvery: 30, UpdatedAt: timePtr(now.AddDate(0, 0, -31))},
+			wantKind: model.ReminderKindRotation,
+			wantOK:   true,
+		},
+		{
+			name:     "rotation is based on creation date when there were no updates",
+			secret:   model.Secret{ID: 1, RotateEvery: 30, CreatedAt: timePtr(now.AddDate(0, 0, -31))},
+			wantKind: model.ReminderKindRotation,
+			wantOK:   true,
+		},
+		{
+			name:   "rotated recently",
+			secret: model.Secret{ID: 1, RotateEvery: 30, UpdatedAt: timePtr(now.AddDate(0, 0, -1))},
+			wantOK: false,
+		},
+		{
+			name: "earliest date wins",
+			secret: model.Secret{
+				ID:          1,
+				ExpiresAt:   timePtr(now.AddDate(0, 0, -1)),
+				RotateEvery: 30,
+				UpdatedAt:   timePtr(now.AddDate(0, -3, 0)),
+			},
+			wantKind: model.ReminderKindRotation,
+			wantOK:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := tt.secret
+			reminder, ok := Due(&secret, "tony", now)
+			require.Equal(t, tt.wantOK, ok)
+			require.Equal(t, tt.wantKind, reminder.Kind)
+		})
+	}
+}
+
+func TestCollectSortsByDueDate(t *testing.T) {
+	now := time.Now().UTC()
+	secrets := []*model.Secret{
+		{ID: 1, ExpiresAt: timePtr(now.AddDate(0, 0, -1))},
+		{ID: 2, ExpiresAt: timePtr(now.AddDate(0, 0, -10))},
+		{ID: 3},
+	}
+
+	reminders := Collect(secrets, "tony", now)
+	require.Len(t, reminders, 2)
+	require.Equal(t, int64(2), reminders[0].SecretID)
+	require.Equal(t, int64(1), reminders[1].SecretID)
+}
+
+type mockStorage struct {
+	secrets map[string][]*model.Secret
+	err     error
+}
+
+func (m mockStorage) GetSecretsWithReminders(ctx context.Context) (map[string][]*model.Secret, error) {
+	return m.secrets, m.err
+}
+
+type mockNotifier struct {
+	reminders [][]model.Reminder
+	err       error
+}
+
+func (m *mockNotifier) Notify(ctx context.Context, reminders []model.Reminder) error {
+	if m.err != nil {
+		return m.err
+	}
+
+	m.reminders = append(m.reminders, reminders)
+
+	return nil
+}
+
+func TestCheckerNotifiesOnce(t *testing.T) {
+	storage := mockStorage{secrets: map[string][]*model.Secret{
+		"tony": {{ID: 1, ExpiresAt: timePtr(time.Now().AddDate(0, 0, -1))}},
+	}}
+	notifier := &mockNotifier{err: errors.New("webhook is down")}
+	checker := NewChecker(storage, notifier, time.Hour)
+
+	// Failed notifications are sent again
+	require.Error(t, checker.Check(context.Background()))
+
+	notifier.err = nil
+	require.NoError(t, checker.Check(context.Background()))
+	require.NoError(t, checker.Check(context.Background()))
+	require.Len(t, notifier.reminders, 1)
+	require.Equal(t, "tony", notifier.reminders[0][0].Login)
+
+	storage.err = errors.New("storage error")
+	checker.storage = storage
+	require.Error(t, checker.Check(context.Background()))
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	notifier := NewNotifier(config.AppConfig{ReminderWebhookURL: server.URL})
+	err := notifier.Notify(context.Background(), []model.Reminder{{Login: "tony", SecretID: 1}})
+	require.NoError(t, err)
+	require.Len(t, received.Reminders, 1)
+	require.Equal(t, int64(1), received.Reminders[0].SecretID)
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	err = notifier.Notify(context.Background(), []model.Reminder{{Login: "tony", SecretID: 1}})
+	require.Error(t, err)
+}
+
+func TestNewNotifier(t *testing.T) {
+	require.IsType(t, LogNotifier{}, NewNotifier(config.AppConfig{}))
+	require.NoError(t, LogNotifier{}.Notify(context.Background(), []model.Reminder{{SecretID: 1}}))
+}
+
+func TestParseCardExpiration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+		ok    bool
+	}{
+		{value: "2023-09-03", want: time.Date(2023, 9, 3, 0, 0, 0, 0, time.UTC), ok: true},
+		{value: "09/23", want: time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC), ok: true},
+		{value: "12/2023", want: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), ok: true},
+		{value: "never", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := model.ParseCardExpiration(tt.value)
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,35 @@
+// Package scheduler runs periodic background jobs of the application
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Job is a function which is executed by the scheduler
+type Job func(ctx context.Context) error
+
+// Run - executes the job immediately and then every interval until the context is cancelled.
+// Job errors are logged and don't stop the scheduler. If interval is not positive, the job is never executed.
+func Run(ctx context.Context, name string, interval time.Duration, job Job) error {
+	if interval <= 0 {
+		log.Printf("Scheduler: job '%s' is disabled\n", name)
+		return nil
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(ctx); err != nil {
+			log.Printf("Scheduler: job '%s' error: %s\n", name, err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
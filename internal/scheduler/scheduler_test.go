@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int32
+
+	done := make(chan error)
+	go func() {
+		done <- Run(ctx, "test", time.Millisecond, func(ctx context.Context) error {
+			if atomic.AddInt32(&calls, 1) == 3 {
+				cancel()
+			}
+
+			// Errors should not stop the scheduler
+			return errors.New("job error")
+		})
+	}()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("scheduler was not stopped")
+	}
+
+	require.GreaterOrEqual(t, atomic.LoadInt32(&calls), int32(3))
+}
+
+func TestRunDisabled(t *testing.T) {
+	called := false
+	err := Run(context.Background(), "test", 0, func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+
+	require.NoError(t, err)
+	require.False(t, called)
+}
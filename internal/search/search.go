@@ -0,0 +1,98 @@
+// Package search contains a blind index implementation which allows the server to find user secrets
+// by their titles and URLs without knowing the plain text values of these fields
+package search
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	keyLength = 32
+	// tokenLength is the number of bytes of HMAC which are kept in the index. 16 bytes is more than enough
+	// to avoid collisions within a single user vault.
+	tokenLength = 16
+	keyInfo     = "kms search index v1"
+)
+
+// DeriveKey - derives a search index key from the user's data key. The derived key is never stored
+// anywhere, it is re-created from the data key every time when it's required.
+func DeriveKey(dataKey string) ([]byte, error) {
+	key := make([]byte, keyLength)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(dataKey), nil, []byte(keyInfo)), key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Tokens - builds blind index tokens for the values which should be searchable.
+// Every word of a value is split into bigrams and trigrams, so the secret can be found by a part of a word.
+func Tokens(key []byte, values ...string) []string {
+	grams := make(map[string]struct{})
+	for _, value := range values {
+		for _, word := range words(value) {
+			if len(word) == 1 {
+				grams[string(word)] = struct{}{}
+			}
+
+			for n := 2; n <= 3; n++ {
+				for i := 0; i+n <= len(word); i++ {
+					grams[string(word[i:i+n])] = struct{}{}
+				}
+			}
+		}
+	}
+
+	return hashGrams(key, grams)
+}
+
+// QueryTokens - builds blind index tokens for a search query. A secret matches the query
+// when it has all tokens of the query in the index. Single letter words of a query are ignored,
+// so the function returns an empty slice when the query is too short.
+func QueryTokens(key []byte, query string) []string {
+	grams := make(map[string]struct{})
+	for _, word := range words(query) {
+		if len(word) == 2 {
+			grams[string(word)] = struct{}{}
+		}
+
+		for i := 0; i+3 <= len(word); i++ {
+			grams[string(word[i:i+3])] = struct{}{}
+		}
+	}
+
+	return hashGrams(key, grams)
+}
+
+// words - normalizes a value and splits it into words. Any character which is not a letter
+// or a digit is treated as a separator, so "https://example.com" becomes "https", "example", "com"
+func words(value string) [][]rune {
+	fields := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	result := make([][]rune, 0, len(fields))
+	for _, field := range fields {
+		result = append(result, []rune(field))
+	}
+
+	return result
+}
+
+func hashGrams(key []byte, grams map[string]struct{}) []string {
+	tokens := make([]string, 0, len(grams))
+	for gram := range grams {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(gram))
+		tokens = append(tokens, hex.EncodeToString(mac.Sum(nil)[:tokenLength]))
+	}
+
+	return tokens
+}
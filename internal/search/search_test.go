@@ -0,0 +1,81 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func containsAll(index, query []string) bool {
+	set := make(map[string]struct{}, len(index))
+	for _, token := range index {
+		set[token] = struct{}{}
+	}
+
+	for _, token := range query {
+		if _, ok := set[token]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestDeriveKey(t *testing.T) {
+	key1, err := DeriveKey("data key 1")
+	require.NoError(t, err)
+	require.Len(t, key1, keyLength)
+
+	key1Again, err := DeriveKey("data key 1")
+	require.NoError(t, err)
+	require.Equal(t, key1, key1Again)
+
+	key2, err := DeriveKey("data key 2")
+	require.NoError(t, err)
+	require.NotEqual(t, key1, key2)
+}
+
+func TestTokensMatchQuery(t *testing.T) {
+	key, err := DeriveKey("secret")
+	require.NoError(t, err)
+
+	index := Tokens(key, "My GitHub account", "https://github.com/login")
+
+	tests := []struct {
+		query string
+		match bool
+	}{
+		{query: "github", match: true},
+		{query: "GITHUB", match: true},
+		{query: "hub", match: true},
+		{query: "acc", match: true},
+		{query: "git login", match: true},
+		{query: "gitlab", match: false},
+		{query: "bank", match: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query := QueryTokens(key, tt.query)
+			require.NotEmpty(t, query)
+			require.Equal(t, tt.match, containsAll(index, query))
+		})
+	}
+}
+
+func TestTokensAreKeyed(t *testing.T) {
+	key1, _ := DeriveKey("key 1")
+	key2, _ := DeriveKey("key 2")
+
+	index := Tokens(key1, "github")
+	require.False(t, containsAll(index, QueryTokens(key2, "github")))
+	require.NotContains(t, index, "github")
+}
+
+func TestQueryTokensTooShort(t *testing.T) {
+	key, _ := DeriveKey("key")
+
+	require.Empty(t, QueryTokens(key, "a"))
+	require.Empty(t, QueryTokens(key, " / "))
+	require.Len(t, QueryTokens(key, "ab"), 1)
+}
@@ -31,16 +31,265 @@ CREATE TABLE IF NOT EXISTS secret (
 );
 `
 
+const sqlCreateSearchIndexTable = `
+CREATE TABLE IF NOT EXISTS secret_search_index (
+	secret_id BIGINT NOT NULL,
+	token VARCHAR(32) NOT NULL,
+	PRIMARY KEY (secret_id, token)
+);
+CREATE INDEX IF NOT EXISTS idx_secret_search_index_token ON secret_search_index(token);
+`
+
+const sqlCreateShareTable = `
+CREATE TABLE IF NOT EXISTS secret_share (
+	secret_id BIGINT NOT NULL,
+	user_id BIGINT NOT NULL,    -- recipient
+	sealed_key TEXT NOT NULL,   -- secret key encrypted with recipient's public key
+	permission VARCHAR(10) NOT NULL,
+	created_at TIMESTAMP,
+	PRIMARY KEY (secret_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_secret_share_user_id ON secret_share(user_id);
+`
+
+// sqlCreateTeamTables - vault secrets belong to a vault instead of a user, so their user_id is NULL
+const sqlCreateTeamTables = `
+CREATE TABLE IF NOT EXISTS team (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	created_at TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS team_member (
+	team_id BIGINT NOT NULL,
+	user_id BIGINT NOT NULL,
+	role VARCHAR(10) NOT NULL,  -- owner, admin, member, read-only
+	PRIMARY KEY (team_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_team_member_user_id ON team_member(user_id);
+CREATE TABLE IF NOT EXISTS vault (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	team_id BIGINT NOT NULL,
+	name TEXT NOT NULL,
+	created_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_vault_team_id ON vault(team_id);
+CREATE TABLE IF NOT EXISTS vault_key (
+	vault_id BIGINT NOT NULL,
+	user_id BIGINT NOT NULL,
+	sealed_key TEXT NOT NULL,   -- vault key encrypted with member's public key
+	PRIMARY KEY (vault_id, user_id)
+);
+ALTER TABLE secret ADD COLUMN vault_id BIGINT;
+CREATE INDEX IF NOT EXISTS idx_secret_vault_id ON secret(vault_id);
+`
+
+const sqlCreateSendTable = `
+CREATE TABLE IF NOT EXISTS send (
+	id VARCHAR(32) PRIMARY KEY,  -- random identifier, which is a part of the link
+	user_id BIGINT NOT NULL,
+	send_type VARCHAR(10) NOT NULL, -- text, file
+	payload TEXT NOT NULL,       -- encrypted by the client, the key is never sent to the server
+	file_name TEXT NOT NULL DEFAULT '',
+	password TEXT NOT NULL DEFAULT '',
+	max_views INTEGER NOT NULL,
+	view_count INTEGER NOT NULL DEFAULT 0,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_send_user_id ON send(user_id);
+CREATE INDEX IF NOT EXISTS idx_send_expires_at ON send(expires_at);
+`
+
+const sqlCreateEmergencyAccessTable = `
+CREATE TABLE IF NOT EXISTS emergency_access (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	grantor_id BIGINT NOT NULL,
+	grantee_id BIGINT NOT NULL,
+	state VARCHAR(20) NOT NULL,  -- invited, accepted, recovery_requested, recovery_approved
+	wait_days INTEGER NOT NULL,
+	sealed_key TEXT NOT NULL,    -- data key of the grantor encrypted with the public key of the grantee
+	requested_at TIMESTAMP,
+	created_at TIMESTAMP,
+	updated_at TIMESTAMP,
+	UNIQUE (grantor_id, grantee_id)
+);
+CREATE INDEX IF NOT EXISTS idx_emergency_access_grantee_id ON emergency_access(grantee_id);
+CREATE INDEX IF NOT EXISTS idx_emergency_access_state ON emergency_access(state);
+`
+
+// sqlCreateAuditEventTable - the audit log is append-only, triggers reject changes of recorded events.
+// Every event refers to the hash of the previous one, so the chain cannot fork.
+const sqlCreateAuditEventTable = `
+CREATE TABLE IF NOT EXISTS audit_event (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	type VARCHAR(30) NOT NULL,
+	login TEXT NOT NULL,         -- not a reference to user table, because failed logins are recorded as well
+	secret_id TEXT NOT NULL DEFAULT '',
+	remote_addr TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	prev_hash TEXT NOT NULL UNIQUE,
+	hash TEXT NOT NULL UNIQUE
+);
+CREATE INDEX IF NOT EXISTS idx_audit_event_login ON audit_event(login, id);
+CREATE TRIGGER IF NOT EXISTS audit_event_no_update BEFORE UPDATE ON audit_event
+BEGIN
+	SELECT RAISE(ABORT, 'audit log is append-only');
+END;
+CREATE TRIGGER IF NOT EXISTS audit_event_no_delete BEFORE DELETE ON audit_event
+BEGIN
+	SELECT RAISE(ABORT, 'audit log is append-only');
+END;
+`
+
+const sqlCreateLoginAttemptTable = `
+CREATE TABLE IF NOT EXISTS login_attempt (
+	key TEXT PRIMARY KEY,        -- login or IP address prefixed with its kind
+	failures INTEGER NOT NULL,
+	last_attempt_at TIMESTAMP NOT NULL,
+	locked_until TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_login_attempt_last_attempt_at ON login_attempt(last_attempt_at);
+`
+
+// sqlCreateUserIdentityTable - links users to subjects of external identity providers. The subject
+// is unique only within its issuer, so both are the key
+const sqlCreateUserIdentityTable = `
+CREATE TABLE IF NOT EXISTS user_identity (
+	issuer TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	user_id BIGINT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (issuer, subject),
+	CONSTRAINT fk_user_identity_user_id FOREIGN KEY(user_id)
+		REFERENCES user(id)
+		ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_user_identity_user_id ON user_identity(user_id);
+`
+
+// sqlCreateWebAuthnCredentialTable - passkeys and security keys of users. Signature counter
+// of a credential must grow with every login, otherwise the authenticator might have been cloned
+const sqlCreateWebAuthnCredentialTable = `
+CREATE TABLE IF NOT EXISTS webauthn_credential (
+	id TEXT PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	user_handle BLOB NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	public_key BLOB NOT NULL,
+	sign_count BIGINT NOT NULL DEFAULT 0,
+	aaguid TEXT NOT NULL DEFAULT '',
+	data_key TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	last_used_at TIMESTAMP,
+	CONSTRAINT fk_webauthn_credential_user_id FOREIGN KEY(user_id)
+		REFERENCES user(id)
+		ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_webauthn_credential_user_id ON webauthn_credential(user_id);
+`
+
+// sqlCreateAPITokenTable - personal API tokens. Only hashes of the tokens are stored, secret_ids and
+// vault_ids are comma-separated identifiers which the token is limited to
+const sqlCreateAPITokenTable = `
+CREATE TABLE IF NOT EXISTS api_token (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id BIGINT NOT NULL,
+	name TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	data_key TEXT NOT NULL,
+	permission TEXT NOT NULL,
+	secret_ids TEXT NOT NULL DEFAULT '',
+	vault_ids TEXT NOT NULL DEFAULT '',
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	last_used_at TIMESTAMP,
+	CONSTRAINT fk_api_token_user_id FOREIGN KEY(user_id)
+		REFERENCES user(id)
+		ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_api_token_user_id ON api_token(user_id);
+`
+
+// sqlCreateServerSettingTable - settings which administrators change while the server is running,
+// a setting which is not stored has its default value
+const sqlCreateServerSettingTable = `
+CREATE TABLE IF NOT EXISTS server_setting (
+	name VARCHAR(50) PRIMARY KEY,
+	value TEXT NOT NULL
+);
+`
+
+// sqlMigrations - schema changes which were introduced after the initial version of the database.
+// Migrations are applied in order and must never be modified or removed once released,
+// new changes should be appended to the end of the list.
+var sqlMigrations = []string{
+	`ALTER TABLE secret ADD COLUMN url TEXT NOT NULL DEFAULT '';`,
+	sqlCreateSearchIndexTable,
+	`
+ALTER TABLE secret ADD COLUMN favorite BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE secret ADD COLUMN created_at TIMESTAMP;
+ALTER TABLE secret ADD COLUMN updated_at TIMESTAMP;
+ALTER TABLE secret ADD COLUMN last_accessed_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_secret_last_accessed_at ON secret(user_id, last_accessed_at);
+`,
+	`
+ALTER TABLE secret ADD COLUMN expires_at TIMESTAMP;
+ALTER TABLE secret ADD COLUMN rotate_every INTEGER NOT NULL DEFAULT 0;
+`,
+	`ALTER TABLE secret ADD COLUMN compromised BOOLEAN NOT NULL DEFAULT FALSE;`,
+	`
+ALTER TABLE user ADD COLUMN public_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE user ADD COLUMN private_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE secret ADD COLUMN wrapped_key TEXT NOT NULL DEFAULT '';
+` + sqlCreateShareTable,
+	sqlCreateTeamTables,
+	sqlCreateSendTable,
+	sqlCreateEmergencyAccessTable,
+	sqlCreateAuditEventTable,
+	sqlCreateLoginAttemptTable,
+	sqlCreateUserIdentityTable,
+	sqlCreateWebAuthnCredentialTable,
+	sqlCreateAPITokenTable,
+	`
+ALTER TABLE user ADD COLUMN role VARCHAR(10) NOT NULL DEFAULT 'user';
+ALTER TABLE user ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE user ADD COLUMN sessions_revoked_at TIMESTAMP;
+` + sqlCreateServerSettingTable,
+	`ALTER TABLE send ADD COLUMN password_failures INTEGER NOT NULL DEFAULT 0;`,
+}
+
 var sqlInsertUser = `
 INSERT INTO user
-		(login, password, restore_password, data_key)
+		(login, password, restore_password, data_key, public_key, private_key)
 	VALUES
-		($1, $2, $3, $4)
+		($1, $2, $3, $4, $5, $6)
 	RETURNING id;
 `
 
+// sqlUserColumns - columns which are read by scanUser
+var sqlUserColumns = `
+	user.id, user.login, user.password, user.restore_password, user.data_key, user.public_key, user.private_key,
+	user.role, user.disabled, user.sessions_revoked_at
+`
+
 var sqlSelectUser = `
-SELECT id, login, password, restore_password, data_key FROM user WHERE login = $1;
+SELECT` + sqlUserColumns + `FROM user WHERE login = $1;
+`
+
+var sqlUpdateUserKeyPair = `
+UPDATE user SET
+		public_key = $1,
+		private_key = $2
+	WHERE login = $3;
+`
+
+var sqlUpdateUserPassword = `
+UPDATE user SET
+		password = $1,
+		restore_password = $2,
+		data_key = $3
+	WHERE login = $4;
 `
 
 var sqlInsertSecret = `
@@ -56,10 +305,19 @@ INSERT INTO secret (
 		card_number,
 		expiration,
 		cvv,
+		url,
+		favorite,
+		expires_at,
+		rotate_every,
+		compromised,
+		wrapped_key,
+		created_at,
+		updated_at,
 		user_id
 	)
 	VALUES
-		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, (SELECT id FROM user WHERE login = $12))
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $18,
+		(SELECT id FROM user WHERE login = $19))
 	RETURNING id;
 `
 
@@ -74,26 +332,65 @@ UPDATE secret SET
 		cardholder_name = $7,
 		card_number = $8,
 		expiration = $9,
-		cvv = $10
-	WHERE id = $11
-	AND user_id = (SELECT id FROM user WHERE login = $12);
+		cvv = $10,
+		url = $11,
+		favorite = $12,
+		expires_at = $13,
+		rotate_every = $14,
+		compromised = $15,
+		updated_at = $16
+	WHERE id = $17
+	AND user_id = (SELECT id FROM user WHERE login = $18);
+`
+
+// sqlSecretColumns - list of secret table columns which is shared by all queries returning secrets.
+// Column order must match the order of fields in scanSecret function.
+const sqlSecretColumns = `
+	secret.id,
+	secret.secret_type,
+	secret.title,
+	secret.login,
+	secret.password,
+	secret.note,
+	secret.file,
+	secret.file_name,
+	secret.cardholder_name,
+	secret.card_number,
+	secret.expiration,
+	secret.cvv,
+	secret.url,
+	secret.favorite,
+	secret.created_at,
+	secret.updated_at,
+	secret.last_accessed_at,
+	secret.expires_at,
+	secret.rotate_every,
+	secret.compromised,
+	secret.wrapped_key
+`
+
+// sqlUpdateSecretKey - replaces all encrypted values of a secret when it's re-encrypted with another key
+var sqlUpdateSecretKey = `
+UPDATE secret SET
+		secret_type = $1,
+		title = $2,
+		login = $3,
+		password = $4,
+		note = $5,
+		file = $6,
+		file_name = $7,
+		cardholder_name = $8,
+		card_number = $9,
+		expiration = $10,
+		cvv = $11,
+		url = $12,
+		wrapped_key = $13
+	WHERE id = $14
+	AND user_id = (SELECT id FROM user WHERE login = $15);
 `
 
 var sqlGetSecretByID = `
-SELECT
-    id,
-    secret_type,
-	title,
-	login,
-	password,
-	note,
-	file,
-	file_name,
-	cardholder_name,
-	card_number,
-	expiration,
-	cvv
-FROM secret
+SELECT` + sqlSecretColumns + `FROM secret
 		WHERE id = $1
 		  AND user_id = (
 	SELECT id FROM user WHERE login = $2
@@ -101,22 +398,66 @@ FROM secret
 `
 
 var sqlFindSecretsByUser = `
+SELECT` + sqlSecretColumns + `FROM secret
+	WHERE user_id = (
+		SELECT id FROM user WHERE login = $1
+);
+`
+
+var sqlFindRecentSecretsByUser = `
+SELECT` + sqlSecretColumns + `FROM secret
+	WHERE user_id = (
+		SELECT id FROM user WHERE login = $1
+	)
+	AND last_accessed_at IS NOT NULL
+	ORDER BY last_accessed_at DESC
+	LIMIT $2;
+`
+
+// sqlFindSecretsWithReminders - returns only metadata of secrets, encrypted fields are not selected
+var sqlFindSecretsWithReminders = `
 SELECT
-    id,
-    secret_type,
-	title,
-	login,
-	password,
-	note,
-	file,
-	file_name,
-	cardholder_name,
-	card_number,
-	expiration,
-	cvv
+	user.login,
+	secret.id,
+	secret.secret_type,
+	secret.created_at,
+	secret.updated_at,
+	secret.expires_at,
+	secret.rotate_every
 FROM secret
+	JOIN user ON user.id = secret.user_id
+	WHERE secret.expires_at IS NOT NULL
+	OR secret.rotate_every > 0;
+`
+
+var sqlTouchSecret = `
+UPDATE secret SET
+		last_accessed_at = $1
+	WHERE id = $2
+	AND user_id = (SELECT id FROM user WHERE login = $3);
+`
+
+// sqlSetSecretCompromised - only the flag is updated, because the health report refreshes it without
+// re-encrypting the secret
+var sqlSetSecretCompromised = `
+UPDATE secret SET
+		compromised = $1
+	WHERE id = $2
+	AND user_id = (SELECT id FROM user WHERE login = $3);
+`
+
+// sqlSearchSecrets - the statement is completed with a list of token placeholders and a number of tokens
+// which a secret must have in the search index
+var sqlSearchSecrets = `
+SELECT` + sqlSecretColumns + `FROM secret
 	WHERE user_id = (
 		SELECT id FROM user WHERE login = $1
+	)
+	AND id IN (
+		SELECT secret_id FROM secret_search_index
+		WHERE token IN (%s)
+		GROUP BY secret_id
+		HAVING COUNT(DISTINCT token) = %d
 );
 `
 
@@ -129,3 +470,677 @@ AND
         SELECT id FROM user WHERE login = $2
     );
 `
+
+var sqlDeleteSearchIndex = `
+DELETE FROM secret_search_index
+WHERE
+    secret_id = $1
+AND
+    secret_id IN (
+        SELECT id FROM secret WHERE user_id = (
+            SELECT id FROM user WHERE login = $2
+        )
+    );
+`
+
+var sqlInsertSearchToken = `
+INSERT INTO secret_search_index
+		(secret_id, token)
+	VALUES
+		($1, $2);
+`
+
+var sqlDeleteSecretShares = `
+DELETE FROM secret_share
+WHERE
+    secret_id = $1
+AND
+    secret_id IN (
+        SELECT id FROM secret WHERE user_id = (
+            SELECT id FROM user WHERE login = $2
+        )
+    );
+`
+
+// sqlUpsertShare - the share is created only if the secret belongs to the owner
+var sqlUpsertShare = `
+INSERT INTO secret_share
+		(secret_id, user_id, sealed_key, permission, created_at)
+	SELECT secret.id, (SELECT id FROM user WHERE login = $1), $2, $3, $4
+	FROM secret
+	WHERE secret.id = $5
+	AND secret.user_id = (SELECT id FROM user WHERE login = $6)
+	ON CONFLICT (secret_id, user_id) DO UPDATE SET
+		sealed_key = excluded.sealed_key,
+		permission = excluded.permission;
+`
+
+var sqlUpdateSealedKey = `
+UPDATE secret_share SET
+		sealed_key = $1
+	WHERE secret_id = $2
+	AND user_id = (SELECT id FROM user WHERE login = $3);
+`
+
+var sqlDeleteShare = `
+DELETE FROM secret_share
+WHERE
+    secret_id = $1
+AND
+    user_id = (SELECT id FROM user WHERE login = $2)
+AND
+    secret_id IN (
+        SELECT id FROM secret WHERE user_id = (
+            SELECT id FROM user WHERE login = $3
+        )
+    );
+`
+
+const sqlShareColumns = `
+	secret_share.secret_id,
+	owner.login,
+	recipient.login,
+	secret_share.permission,
+	secret_share.sealed_key,
+	secret_share.created_at
+`
+
+const sqlShareJoins = `
+	JOIN secret ON secret.id = secret_share.secret_id
+	JOIN user AS owner ON owner.id = secret.user_id
+	JOIN user AS recipient ON recipient.id = secret_share.user_id
+`
+
+// sqlGetShare - returns a share of a secret for the recipient
+var sqlGetShare = `
+SELECT` + sqlShareColumns + `FROM secret_share` + sqlShareJoins + `
+	WHERE secret_share.secret_id = $1
+	AND recipient.login = $2;
+`
+
+// sqlFindSharesBySecret - returns all shares of a secret for its owner
+var sqlFindSharesBySecret = `
+SELECT` + sqlShareColumns + `FROM secret_share` + sqlShareJoins + `
+	WHERE secret_share.secret_id = $1
+	AND owner.login = $2
+	ORDER BY recipient.login;
+`
+
+// sqlFindSharedSecrets - returns all secrets which were shared with the recipient
+var sqlFindSharedSecrets = `
+SELECT` + sqlShareColumns + `,` + sqlSecretColumns + `FROM secret_share` + sqlShareJoins + `
+	WHERE recipient.login = $1
+	ORDER BY secret_share.secret_id;
+`
+
+var sqlInsertTeam = `
+INSERT INTO team
+		(name, created_at)
+	VALUES
+		($1, $2)
+	RETURNING id;
+`
+
+var sqlInsertTeamMember = `
+INSERT INTO team_member
+		(team_id, user_id, role)
+	VALUES
+		($1, (SELECT id FROM user WHERE login = $2), $3);
+`
+
+var sqlUpdateTeamMember = `
+UPDATE team_member SET
+		role = $1
+	WHERE team_id = $2
+	AND user_id = (SELECT id FROM user WHERE login = $3);
+`
+
+var sqlDeleteTeamMember = `
+DELETE FROM team_member
+WHERE
+    team_id = $1
+AND
+    user_id = (SELECT id FROM user WHERE login = $2);
+`
+
+// sqlFindTeamsByUser - returns teams of the user along with the user's role in every team
+var sqlFindTeamsByUser = `
+SELECT team.id, team.name, team_member.role, team.created_at
+FROM team
+	JOIN team_member ON team_member.team_id = team.id
+	WHERE team_member.user_id = (SELECT id FROM user WHERE login = $1)
+	ORDER BY team.name;
+`
+
+const sqlTeamMemberColumns = `
+	team_member.team_id,
+	user.login,
+	team_member.role
+`
+
+var sqlGetTeamMember = `
+SELECT` + sqlTeamMemberColumns + `FROM team_member
+	JOIN user ON user.id = team_member.user_id
+	WHERE team_member.team_id = $1
+	AND user.login = $2;
+`
+
+var sqlFindTeamMembers = `
+SELECT` + sqlTeamMemberColumns + `FROM team_member
+	JOIN user ON user.id = team_member.user_id
+	WHERE team_member.team_id = $1
+	ORDER BY user.login;
+`
+
+var sqlInsertVault = `
+INSERT INTO vault
+		(team_id, name, created_at)
+	VALUES
+		($1, $2, $3)
+	RETURNING id;
+`
+
+var sqlFindVaultsByTeam = `
+SELECT id, team_id, name, created_at FROM vault WHERE team_id = $1 ORDER BY name;
+`
+
+var sqlUpsertVaultKey = `
+INSERT INTO vault_key
+		(vault_id, user_id, sealed_key)
+	VALUES
+		($1, (SELECT id FROM user WHERE login = $2), $3)
+	ON CONFLICT (vault_id, user_id) DO UPDATE SET
+		sealed_key = excluded.sealed_key;
+`
+
+// sqlDeleteMemberVaultKeys - removes keys of all team vaults which were sealed for the member
+var sqlDeleteMemberVaultKeys = `
+DELETE FROM vault_key
+WHERE
+    vault_id IN (SELECT id FROM vault WHERE team_id = $1)
+AND
+    user_id = (SELECT id FROM user WHERE login = $2);
+`
+
+// sqlGetVaultAccess - returns a vault only if the user is a member of the team which owns the vault
+var sqlGetVaultAccess = `
+SELECT vault.id, vault.team_id, vault.name, vault.created_at, team_member.role, vault_key.sealed_key
+FROM vault
+	JOIN team_member ON team_member.team_id = vault.team_id
+	JOIN vault_key ON vault_key.vault_id = vault.id AND vault_key.user_id = team_member.user_id
+	WHERE vault.id = $1
+	AND team_member.user_id = (SELECT id FROM user WHERE login = $2);
+`
+
+var sqlInsertVaultSecret = `
+INSERT INTO secret (
+		secret_type,
+		title,
+		login,
+		password,
+		note,
+		file,
+		file_name,
+		cardholder_name,
+		card_number,
+		expiration,
+		cvv,
+		url,
+		favorite,
+		expires_at,
+		rotate_every,
+		compromised,
+		wrapped_key,
+		created_at,
+		updated_at,
+		vault_id
+	)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $18, $19)
+	RETURNING id;
+`
+
+var sqlUpdateVaultSecret = `
+UPDATE secret SET
+		secret_type = $1,
+		title = $2,
+		login = $3,
+		password = $4,
+		note = $5,
+		file_name = $6,
+		cardholder_name = $7,
+		card_number = $8,
+		expiration = $9,
+		cvv = $10,
+		url = $11,
+		favorite = $12,
+		expires_at = $13,
+		rotate_every = $14,
+		compromised = $15,
+		updated_at = $16
+	WHERE id = $17
+	AND vault_id = $18;
+`
+
+// sqlUpdateVaultSecretKey - replaces the secret key wrapped with the vault key when the vault key is rotated
+var sqlUpdateVaultSecretKey = `
+UPDATE secret SET
+		wrapped_key = $1
+	WHERE id = $2
+	AND vault_id = $3;
+`
+
+// sqlCountVaultSecrets, sqlCountVaultKeys, sqlCountTeamVaults and sqlCountTeamMembers - used to check that
+// the team was not changed while the vault keys were rotated
+var sqlCountVaultSecrets = `
+SELECT COUNT(*) FROM secret WHERE vault_id = $1;
+`
+
+var sqlCountVaultKeys = `
+SELECT COUNT(*) FROM vault_key WHERE vault_id = $1;
+`
+
+var sqlCountTeamVaults = `
+SELECT COUNT(*) FROM vault WHERE team_id = $1;
+`
+
+var sqlCountTeamMembers = `
+SELECT COUNT(*) FROM team_member WHERE team_id = $1;
+`
+
+var sqlGetVaultSecretByID = `
+SELECT` + sqlSecretColumns + `FROM secret
+	WHERE id = $1
+	AND vault_id = $2;
+`
+
+var sqlFindSecretsByVault = `
+SELECT` + sqlSecretColumns + `FROM secret
+	WHERE vault_id = $1;
+`
+
+var sqlDeleteVaultSecret = `
+DELETE FROM secret
+WHERE
+    id = $1
+AND
+    vault_id = $2;
+`
+
+var sqlInsertSend = `
+INSERT INTO send
+		(id, send_type, payload, file_name, password, max_views, expires_at, created_at, user_id)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, (SELECT id FROM user WHERE login = $9));
+`
+
+// sqlFindSendsByUser - payload is not selected, the owner cannot decrypt it anyway
+var sqlFindSendsByUser = `
+SELECT id, send_type, '', file_name, password, max_views, view_count, expires_at, created_at
+FROM send
+	WHERE user_id = (SELECT id FROM user WHERE login = $1)
+	ORDER BY created_at DESC;
+`
+
+var sqlGetSend = `
+SELECT id, send_type, payload, file_name, password, max_views, view_count, expires_at, created_at
+FROM send
+	WHERE id = $1;
+`
+
+// sqlIncrementSendViews - a view is counted only if the send is still available. The passphrase attempt
+// which was counted before the view is forgiven.
+var sqlIncrementSendViews = `
+UPDATE send SET
+		view_count = view_count + 1,
+		password_failures = MAX(password_failures - 1, 0)
+	WHERE id = $1
+	AND view_count < max_views
+	AND expires_at > $2;
+`
+
+// sqlIncrementSendPasswordFailures - an attempt is counted only if the send has attempts left
+var sqlIncrementSendPasswordFailures = `
+UPDATE send SET
+		password_failures = password_failures + 1
+	WHERE id = $1
+	AND password_failures < $2
+	RETURNING password_failures;
+`
+
+var sqlDestroySend = `
+DELETE FROM send WHERE id = $1;
+`
+
+var sqlDeleteSend = `
+DELETE FROM send
+WHERE
+    id = $1
+AND
+    user_id = (SELECT id FROM user WHERE login = $2);
+`
+
+// sqlDeleteUsedSend - removes a send if it's expired or all views are used
+var sqlDeleteUsedSend = `
+DELETE FROM send
+WHERE
+    id = $1
+AND
+    (expires_at <= $2 OR view_count >= max_views);
+`
+
+var sqlDeleteExpiredSends = `
+DELETE FROM send
+WHERE
+    expires_at <= $1
+OR
+    view_count >= max_views;
+`
+
+var sqlInsertEmergencyAccess = `
+INSERT INTO emergency_access
+		(grantor_id, grantee_id, state, wait_days, sealed_key, created_at, updated_at)
+	VALUES
+		((SELECT id FROM user WHERE login = $1), (SELECT id FROM user WHERE login = $2), $3, $4, $5, $6, $6)
+	RETURNING id;
+`
+
+const sqlEmergencyAccessColumns = `
+	emergency_access.id,
+	grantor.login,
+	grantee.login,
+	emergency_access.state,
+	emergency_access.wait_days,
+	emergency_access.sealed_key,
+	emergency_access.requested_at,
+	emergency_access.created_at,
+	emergency_access.updated_at
+`
+
+const sqlEmergencyAccessJoins = `
+	JOIN user AS grantor ON grantor.id = emergency_access.grantor_id
+	JOIN user AS grantee ON grantee.id = emergency_access.grantee_id
+`
+
+// sqlGetEmergencyAccess - returns emergency access only to the grantor or to the grantee
+var sqlGetEmergencyAccess = `
+SELECT` + sqlEmergencyAccessColumns + `FROM emergency_access` + sqlEmergencyAccessJoins + `
+	WHERE emergency_access.id = $1
+	AND (grantor.login = $2 OR grantee.login = $2);
+`
+
+// sqlFindEmergencyAccessByUser - returns emergency contacts of the user and users who trust the user
+var sqlFindEmergencyAccessByUser = `
+SELECT` + sqlEmergencyAccessColumns + `FROM emergency_access` + sqlEmergencyAccessJoins + `
+	WHERE grantor.login = $1
+	OR grantee.login = $1
+	ORDER BY emergency_access.id;
+`
+
+var sqlFindEmergencyAccessByState = `
+SELECT` + sqlEmergencyAccessColumns + `FROM emergency_access` + sqlEmergencyAccessJoins + `
+	WHERE emergency_access.state = $1;
+`
+
+// sqlUpdateEmergencyAccessState - the state is changed only if it wasn't changed by someone else in the meantime
+var sqlUpdateEmergencyAccessState = `
+UPDATE emergency_access SET
+		state = $1,
+		requested_at = $2,
+		updated_at = $3
+	WHERE id = $4
+	AND state = $5;
+`
+
+var sqlDeleteEmergencyAccess = `
+DELETE FROM emergency_access
+WHERE
+    id = $1
+AND
+    (
+        grantor_id = (SELECT id FROM user WHERE login = $2)
+    OR
+        grantee_id = (SELECT id FROM user WHERE login = $2)
+    );
+`
+
+const sqlAuditEventColumns = `
+	id, type, login, secret_id, remote_addr, user_agent, created_at, prev_hash, hash
+`
+
+var sqlInsertAuditEvent = `
+INSERT INTO audit_event
+		(type, login, secret_id, remote_addr, user_agent, created_at, prev_hash, hash)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id;
+`
+
+var sqlGetLastAuditEvent = `
+SELECT` + sqlAuditEventColumns + `FROM audit_event ORDER BY id DESC LIMIT 1;
+`
+
+// sqlFindAuditEventsByUser - empty type matches events of all types, zero 'before' matches all events
+var sqlFindAuditEventsByUser = `
+SELECT` + sqlAuditEventColumns + `FROM audit_event
+	WHERE login = $1
+	AND ($2 = '' OR type = $2)
+	AND ($3 = 0 OR id < $3)
+	ORDER BY id DESC
+	LIMIT $4;
+`
+
+var sqlFindAllAuditEvents = `
+SELECT` + sqlAuditEventColumns + `FROM audit_event ORDER BY id;
+`
+
+var sqlInsertUserIdentity = `
+INSERT INTO user_identity
+		(issuer, subject, user_id, created_at)
+	VALUES
+		($1, $2, (SELECT id FROM user WHERE login = $3), $4);
+`
+
+// sqlUpdateUserDataKey - the data key is set only once, otherwise secrets encrypted with the previous key would be lost
+var sqlUpdateUserDataKey = `
+UPDATE user SET
+		data_key = $1,
+		public_key = $2,
+		private_key = $3
+	WHERE login = $4
+	AND data_key = '';
+`
+
+var sqlSelectUserByIdentity = `
+SELECT` + sqlUserColumns + `FROM user_identity
+	JOIN user ON user.id = user_identity.user_id
+	WHERE user_identity.issuer = $1
+	AND user_identity.subject = $2;
+`
+
+var sqlInsertWebAuthnCredential = `
+INSERT INTO webauthn_credential
+		(id, user_id, user_handle, name, public_key, sign_count, aaguid, data_key, created_at)
+	VALUES
+		($1, (SELECT id FROM user WHERE login = $2), $3, $4, $5, $6, $7, $8, $9);
+`
+
+const sqlWebAuthnCredentialColumns = `
+	webauthn_credential.id,
+	user.login,
+	webauthn_credential.user_handle,
+	webauthn_credential.name,
+	webauthn_credential.public_key,
+	webauthn_credential.sign_count,
+	webauthn_credential.aaguid,
+	webauthn_credential.data_key,
+	webauthn_credential.created_at,
+	webauthn_credential.last_used_at
+`
+
+var sqlFindWebAuthnCredentialsByUser = `
+SELECT` + sqlWebAuthnCredentialColumns + `FROM webauthn_credential
+	JOIN user ON user.id = webauthn_credential.user_id
+	WHERE user.login = $1
+	ORDER BY webauthn_credential.created_at;
+`
+
+var sqlGetWebAuthnCredential = `
+SELECT` + sqlWebAuthnCredentialColumns + `FROM webauthn_credential
+	JOIN user ON user.id = webauthn_credential.user_id
+	WHERE webauthn_credential.id = $1;
+`
+
+// sqlUpdateWebAuthnCredential - the counter is changed only if it wasn't changed by a concurrent login,
+// otherwise a cloned authenticator could pass the check
+var sqlUpdateWebAuthnCredential = `
+UPDATE webauthn_credential SET
+		sign_count = $1,
+		data_key = $2,
+		last_used_at = $3
+	WHERE id = $4
+	AND sign_count = $5;
+`
+
+var sqlDeleteWebAuthnCredential = `
+DELETE FROM webauthn_credential
+	WHERE id = $1
+	AND user_id = (SELECT id FROM user WHERE login = $2);
+`
+
+var sqlInsertAPIToken = `
+INSERT INTO api_token
+		(user_id, name, token_hash, data_key, permission, secret_ids, vault_ids, expires_at, created_at)
+	VALUES
+		((SELECT id FROM user WHERE login = $1), $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id;
+`
+
+const sqlAPITokenColumns = `
+	api_token.id,
+	user.login,
+	api_token.name,
+	api_token.token_hash,
+	api_token.data_key,
+	api_token.permission,
+	api_token.secret_ids,
+	api_token.vault_ids,
+	api_token.expires_at,
+	api_token.created_at,
+	api_token.last_used_at
+`
+
+var sqlFindAPITokensByUser = `
+SELECT` + sqlAPITokenColumns + `FROM api_token
+	JOIN user ON user.id = api_token.user_id
+	WHERE user.login = $1
+	ORDER BY api_token.id;
+`
+
+var sqlGetAPITokenByHash = `
+SELECT` + sqlAPITokenColumns + `FROM api_token
+	JOIN user ON user.id = api_token.user_id
+	WHERE api_token.token_hash = $1;
+`
+
+var sqlTouchAPIToken = `
+UPDATE api_token SET last_used_at = $1 WHERE id = $2;
+`
+
+var sqlDeleteAPIToken = `
+DELETE FROM api_token
+	WHERE id = $1
+	AND user_id = (SELECT id FROM user WHERE login = $2);
+`
+
+var sqlGetLoginAttempts = `
+SELECT key, failures, last_attempt_at, locked_until FROM login_attempt WHERE key = $1;
+`
+
+var sqlSaveLoginAttempts = `
+INSERT INTO login_attempt
+		(key, failures, last_attempt_at, locked_until)
+	VALUES
+		($1, $2, $3, $4)
+	ON CONFLICT (key) DO UPDATE SET
+		failures = excluded.failures,
+		last_attempt_at = excluded.last_attempt_at,
+		locked_until = excluded.locked_until;
+`
+
+var sqlDeleteLoginAttempts = `
+DELETE FROM login_attempt WHERE key = $1;
+`
+
+var sqlDeleteStaleLoginAttempts = `
+DELETE FROM login_attempt WHERE last_attempt_at < $1 AND locked_until <= $2;
+`
+
+// sqlSecretSize - approximate size of a secret, all fields except the title are encrypted
+var sqlSecretSize = `
+	LENGTH(COALESCE(secret.title, '')) + LENGTH(COALESCE(secret.login, '')) +
+	LENGTH(COALESCE(secret.password, '')) + LENGTH(COALESCE(secret.note, '')) +
+	LENGTH(COALESCE(secret.file_name, '')) + LENGTH(COALESCE(secret.file, '')) +
+	LENGTH(COALESCE(secret.cardholder_name, '')) + LENGTH(COALESCE(secret.card_number, '')) +
+	LENGTH(COALESCE(secret.expiration, '')) + LENGTH(COALESCE(secret.cvv, '')) +
+	LENGTH(secret.url) + LENGTH(secret.wrapped_key)
+`
+
+// sqlFindUsers - users with the number and the size of their personal secrets
+var sqlFindUsers = `
+SELECT user.id, user.login, user.role, user.disabled, user.password = '',
+		COUNT(secret.id), COALESCE(SUM(` + sqlSecretSize + `), 0)
+	FROM user
+	LEFT JOIN secret ON secret.user_id = user.id
+	GROUP BY user.id
+	ORDER BY user.login;
+`
+
+var sqlUpdateUserRole = `
+UPDATE user SET role = $1 WHERE login = $2;
+`
+
+var sqlUpdateUserDisabled = `
+UPDATE user SET disabled = $1 WHERE login = $2;
+`
+
+var sqlRevokeUserSessions = `
+UPDATE user SET sessions_revoked_at = $1 WHERE login = $2;
+`
+
+var sqlDeleteUserAPITokens = `
+DELETE FROM api_token WHERE user_id = (SELECT id FROM user WHERE login = $1);
+`
+
+// sqlGetStorageUsage - the size of the database is the number of pages, including free ones
+var sqlGetStorageUsage = `
+SELECT
+	(SELECT COUNT(*) FROM user),
+	(SELECT COUNT(*) FROM user WHERE disabled),
+	(SELECT COUNT(*) FROM secret WHERE vault_id IS NULL),
+	(SELECT COUNT(*) FROM secret WHERE vault_id IS NOT NULL),
+	(SELECT COUNT(*) FROM team),
+	(SELECT COUNT(*) FROM send),
+	(SELECT COALESCE(SUM(` + sqlSecretSize + `), 0) FROM secret),
+	(SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size());
+`
+
+var sqlGetServerSettings = `
+SELECT name, value FROM server_setting;
+`
+
+var sqlSaveServerSetting = `
+INSERT INTO server_setting
+		(name, value)
+	VALUES
+		($1, $2)
+	ON CONFLICT (name) DO UPDATE SET
+		value = excluded.value;
+`
+
+// sqlBackup - VACUUM INTO writes a consistent copy of the database while it's being used
+var sqlBackup = `VACUUM INTO $1;`
+
+var sqlIntegrityCheck = `PRAGMA integrity_check;`
+
+var sqlSchemaVersion = `PRAGMA user_version;`
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/mattn/go-sqlite3"
 
@@ -17,7 +19,7 @@ type sqlStorage struct {
 }
 
 func (ss sqlStorage) AddUser(ctx context.Context, u *model.User) (*model.User, error) {
-	_, err := ss.ExecContext(ctx, sqlInsertUser, u.Login, u.HashedPassword, "", u.DataKey)
+	_, err := ss.ExecContext(ctx, sqlInsertUser, u.Login, u.HashedPassword, "", u.DataKey, u.PublicKey, u.PrivateKey)
 	if err != nil {
 		var sqliteErr sqlite3.Error
 		if errors.As(err, &sqliteErr) {
@@ -32,9 +34,7 @@ func (ss sqlStorage) AddUser(ctx context.Context, u *model.User) (*model.User, e
 }
 
 func (ss sqlStorage) GetUser(ctx context.Context, login string) (*model.User, error) {
-	u := model.User{}
-	err := ss.QueryRowContext(ctx, sqlSelectUser, login).
-		Scan(&u.ID, &u.Login, &u.HashedPassword, &u.RestorePassword, &u.DataKey)
+	u, err := scanUser(ss.QueryRowContext(ctx, sqlSelectUser, login))
 
 	switch {
 	case errors.Is(err, sql.ErrNoRows):
@@ -43,15 +43,71 @@ func (ss sqlStorage) GetUser(ctx context.Context, login string) (*model.User, er
 		return nil, err
 	}
 
+	return u, nil
+}
+
+// scanUser - reads a user from a row which was selected with sqlUserColumns
+func scanUser(row rowScanner) (*model.User, error) {
+	u := model.User{}
+	err := row.Scan(
+		&u.ID,
+		&u.Login,
+		&u.HashedPassword,
+		&u.RestorePassword,
+		&u.DataKey,
+		&u.PublicKey,
+		&u.PrivateKey,
+		&u.Role,
+		&u.Disabled,
+		&u.SessionsRevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	return &u, nil
 }
 
-func (ss sqlStorage) SaveSecret(ctx context.Context, s *model.Secret, login string) (*model.Secret, error) {
+func (ss sqlStorage) SetUserKeyPair(ctx context.Context, u *model.User) error {
+	_, err := ss.ExecContext(ctx, sqlUpdateUserKeyPair, u.PublicKey, u.PrivateKey, u.Login)
+
+	return err
+}
+
+func (ss sqlStorage) UpdateUserPassword(ctx context.Context, u *model.User) error {
+	result, err := ss.ExecContext(ctx, sqlUpdateUserPassword, u.HashedPassword, u.RestorePassword, u.DataKey, u.Login)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return constant.ErrNotFound
+	}
+
+	return nil
+}
+
+// SaveSecret - saves the secret and replaces its search index with the tokens in the same transaction,
+// so the index never refers to the previous title. The index is kept when the tokens are nil.
+//
+//nolint:lll
+func (ss sqlStorage) SaveSecret(ctx context.Context, s *model.Secret, searchTokens []string, login string) (*model.Secret, error) {
+	tx, err := ss.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
 	var result sql.Result
-	var err error
+	now := time.Now().UTC()
 
 	if s.ID != 0 {
-		result, err = ss.ExecContext(
+		result, err = tx.ExecContext(
 			ctx,
 			sqlUpdateSecret,
 			s.Type,
@@ -64,11 +120,17 @@ func (ss sqlStorage) SaveSecret(ctx context.Context, s *model.Secret, login stri
 			s.CardNumber,
 			s.Expiration,
 			s.SecurityCode,
+			s.URL,
+			s.Favorite,
+			s.ExpiresAt,
+			s.RotateEvery,
+			s.Compromised,
+			now,
 			s.ID,
 			login,
 		)
 	} else {
-		result, err = ss.ExecContext(
+		result, err = tx.ExecContext(
 			ctx,
 			sqlInsertSecret,
 			s.Type,
@@ -82,6 +144,13 @@ func (ss sqlStorage) SaveSecret(ctx context.Context, s *model.Secret, login stri
 			s.CardNumber,
 			s.Expiration,
 			s.SecurityCode,
+			s.URL,
+			s.Favorite,
+			s.ExpiresAt,
+			s.RotateEvery,
+			s.Compromised,
+			s.WrappedKey,
+			now,
 			login,
 		)
 	}
@@ -90,12 +159,41 @@ func (ss sqlStorage) SaveSecret(ctx context.Context, s *model.Secret, login stri
 		return nil, err
 	}
 
-	insertedID, err := result.LastInsertId()
-	if err != nil {
+	createdAt := s.CreatedAt
+	if s.ID != 0 {
+		// LastInsertId is not updated by UPDATE statement, check that the secret belongs to the user instead
+		var rows int64
+		rows, err = result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rows == 0 {
+			return nil, constant.ErrNotFound
+		}
+	} else {
+		var insertedID int64
+		insertedID, err = result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+
+		s.ID = insertedID
+		createdAt = &now
+	}
+
+	if searchTokens != nil {
+		if err = replaceSearchIndex(ctx, tx, s.ID, searchTokens, login); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
 
-	s.ID = insertedID
+	s.CreatedAt = createdAt
+	s.UpdatedAt = &now
 
 	return s, nil
 }
@@ -112,27 +210,73 @@ func (ss sqlStorage) GetSecretsByUser(ctx context.Context, login string) (map[in
 	defer rows.Close()
 
 	for rows.Next() {
+		var secret *model.Secret
+		secret, err = scanSecret(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result[int(secret.ID)] = secret
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (ss sqlStorage) GetRecentSecrets(ctx context.Context, login string, limit int) ([]*model.Secret, error) {
+	rows, err := ss.QueryContext(ctx, sqlFindRecentSecretsByUser, login, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*model.Secret, 0, limit)
+	for rows.Next() {
+		var secret *model.Secret
+		secret, err = scanSecret(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, secret)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (ss sqlStorage) GetSecretsWithReminders(ctx context.Context) (map[string][]*model.Secret, error) {
+	rows, err := ss.QueryContext(ctx, sqlFindSecretsWithReminders)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string][]*model.Secret)
+	for rows.Next() {
+		var login string
 		var secret model.Secret
 
 		err = rows.Scan(
+			&login,
 			&secret.ID,
 			&secret.Type,
-			&secret.Title,
-			&secret.Login,
-			&secret.Password,
-			&secret.Note,
-			&secret.File,
-			&secret.FileName,
-			&secret.CardholderName,
-			&secret.CardNumber,
-			&secret.Expiration,
-			&secret.SecurityCode,
+			&secret.CreatedAt,
+			&secret.UpdatedAt,
+			&secret.ExpiresAt,
+			&secret.RotateEvery,
 		)
 		if err != nil {
 			return nil, err
 		}
 
-		result[int(secret.ID)] = &secret
+		result[login] = append(result[login], &secret)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -142,8 +286,35 @@ func (ss sqlStorage) GetSecretsByUser(ctx context.Context, login string) (map[in
 	return result, nil
 }
 
+func (ss sqlStorage) TouchSecret(ctx context.Context, secretID, login string) error {
+	_, err := ss.ExecContext(ctx, sqlTouchSecret, time.Now().UTC(), secretID, login)
+
+	return err
+}
+
+func (ss sqlStorage) SetSecretCompromised(ctx context.Context, secretID int64, compromised bool, login string) error {
+	_, err := ss.ExecContext(ctx, sqlSetSecretCompromised, compromised, secretID, login)
+
+	return err
+}
+
 func (ss sqlStorage) DeleteSecret(ctx context.Context, id, login string) error {
-	result, err := ss.ExecContext(ctx, sqlDeleteSecret, id, login)
+	tx, err := ss.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	// Search index and shares should be removed first, because they're looked up by the secret owner
+	if _, err = tx.ExecContext(ctx, sqlDeleteSearchIndex, id, login); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, sqlDeleteSecretShares, id, login); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, sqlDeleteSecret, id, login)
 	if err != nil {
 		return err
 	}
@@ -153,17 +324,261 @@ func (ss sqlStorage) DeleteSecret(ctx context.Context, id, login string) error {
 		return err
 	}
 
+	if rows == 0 {
+		return constant.ErrNotFound
+	}
+
 	if rows != 1 {
 		return fmt.Errorf("expected to affect 1 row, affected %d", rows)
 	}
 
+	return tx.Commit()
+}
+
+func (ss sqlStorage) UpdateSecretKey(ctx context.Context, s *model.Secret, shares []*model.Share, login string) error {
+	tx, err := ss.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	result, err := tx.ExecContext(
+		ctx,
+		sqlUpdateSecretKey,
+		s.Type,
+		s.Title,
+		s.Login,
+		s.Password,
+		s.Note,
+		s.File,
+		s.FileName,
+		s.CardholderName,
+		s.CardNumber,
+		s.Expiration,
+		s.SecurityCode,
+		s.URL,
+		s.WrappedKey,
+		s.ID,
+		login,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return constant.ErrNotFound
+	}
+
+	// Shares must be updated in the same transaction, otherwise recipients would get a key which
+	// doesn't decrypt the secret anymore
+	for _, share := range shares {
+		if _, err = tx.ExecContext(ctx, sqlUpdateSealedKey, share.SealedKey, s.ID, share.Recipient); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (ss sqlStorage) SaveShare(ctx context.Context, share *model.Share, login string) error {
+	now := time.Now().UTC()
+	result, err := ss.ExecContext(
+		ctx,
+		sqlUpsertShare,
+		share.Recipient,
+		share.SealedKey,
+		share.Permission,
+		now,
+		share.SecretID,
+		login,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return constant.ErrNotFound
+	}
+
+	share.Owner = login
+	share.CreatedAt = &now
+
 	return nil
 }
 
+func (ss sqlStorage) GetShare(ctx context.Context, secretID, login string) (*model.Share, error) {
+	share, err := scanShare(ss.QueryRowContext(ctx, sqlGetShare, secretID, login))
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, constant.ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	return share, nil
+}
+
+func (ss sqlStorage) GetSecretShares(ctx context.Context, secretID, login string) ([]*model.Share, error) {
+	rows, err := ss.QueryContext(ctx, sqlFindSharesBySecret, secretID, login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*model.Share, 0)
+	for rows.Next() {
+		var share *model.Share
+		share, err = scanShare(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, share)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (ss sqlStorage) GetSharedSecrets(ctx context.Context, login string) ([]*model.Share, error) {
+	rows, err := ss.QueryContext(ctx, sqlFindSharedSecrets, login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*model.Share, 0)
+	for rows.Next() {
+		var share *model.Share
+		share, err = scanSharedSecret(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, share)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (ss sqlStorage) DeleteShare(ctx context.Context, secretID, recipient, login string) error {
+	result, err := ss.ExecContext(ctx, sqlDeleteShare, secretID, recipient, login)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return constant.ErrNotFound
+	}
+
+	return nil
+}
+
+// replaceSearchIndex - replaces search tokens of the secret, the secret must be already checked to belong
+// to the user
+func replaceSearchIndex(ctx context.Context, db execer, secretID int64, tokens []string, login string) error {
+	if _, err := db.ExecContext(ctx, sqlDeleteSearchIndex, secretID, login); err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		if _, err := db.ExecContext(ctx, sqlInsertSearchToken, secretID, token); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ss sqlStorage) SearchSecrets(ctx context.Context, tokens []string, login string) (map[int]*model.Secret, error) {
+	result := make(map[int]*model.Secret)
+	if len(tokens) == 0 {
+		return result, nil
+	}
+
+	args := make([]any, 0, len(tokens)+1)
+	placeholders := make([]string, 0, len(tokens))
+	args = append(args, login)
+	for i, token := range tokens {
+		args = append(args, token)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", i+2))
+	}
+
+	query := fmt.Sprintf(sqlSearchSecrets, strings.Join(placeholders, ", "), len(tokens))
+	rows, err := ss.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var secret *model.Secret
+		secret, err = scanSecret(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result[int(secret.ID)] = secret
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 func (ss sqlStorage) GetSecret(ctx context.Context, secretID, login string) (*model.Secret, error) {
+	secret, err := scanSecret(ss.QueryRowContext(ctx, sqlGetSecretByID, secretID, login))
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, constant.ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// rowScanner - common interface of sql.Row and sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// execer - common interface of sql.DB and sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// scanSecret - reads a secret from a row which was selected using sqlSecretColumns
+func scanSecret(row rowScanner) (*model.Secret, error) {
 	secret := model.Secret{}
 
-	err := ss.QueryRowContext(ctx, sqlGetSecretByID, secretID, login).Scan(
+	err := row.Scan(
 		&secret.ID,
 		&secret.Type,
 		&secret.Title,
@@ -176,24 +591,74 @@ func (ss sqlStorage) GetSecret(ctx context.Context, secretID, login string) (*mo
 		&secret.CardNumber,
 		&secret.Expiration,
 		&secret.SecurityCode,
+		&secret.URL,
+		&secret.Favorite,
+		&secret.CreatedAt,
+		&secret.UpdatedAt,
+		&secret.LastAccessedAt,
+		&secret.ExpiresAt,
+		&secret.RotateEvery,
+		&secret.Compromised,
+		&secret.WrappedKey,
 	)
-
-	switch {
-	case errors.Is(err, sql.ErrNoRows):
-		return nil, constant.ErrNotFound
-	case err != nil:
+	if err != nil {
 		return nil, err
 	}
 
 	return &secret, nil
 }
 
+// shareFields - returns pointers to share fields in the order of sqlShareColumns
+func shareFields(share *model.Share) []any {
+	return []any{
+		&share.SecretID,
+		&share.Owner,
+		&share.Recipient,
+		&share.Permission,
+		&share.SealedKey,
+		&share.CreatedAt,
+	}
+}
+
+// scanShare - reads a share from a row which was selected using sqlShareColumns
+func scanShare(row rowScanner) (*model.Share, error) {
+	share := model.Share{}
+	if err := row.Scan(shareFields(&share)...); err != nil {
+		return nil, err
+	}
+
+	return &share, nil
+}
+
+// scanSharedSecret - reads a share and a secret from a row which was selected
+// using sqlShareColumns followed by sqlSecretColumns
+func scanSharedSecret(row rowScanner) (*model.Share, error) {
+	share := &model.Share{}
+	secret, err := scanSecret(rowScannerFunc(func(secretFields ...any) error {
+		return row.Scan(append(shareFields(share), secretFields...)...)
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	share.Secret = secret
+
+	return share, nil
+}
+
+// rowScannerFunc - allows to combine several scanners which read the same row
+type rowScannerFunc func(dest ...any) error
+
+func (f rowScannerFunc) Scan(dest ...any) error {
+	return f(dest...)
+}
+
 func (ss sqlStorage) Close() error {
 	return ss.DB.Close()
 }
 
 func NewSQLStorage(ctx context.Context, dsn string) sqlStorage {
-	db, err := sql.Open("sqlite3", "./kms.db")
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		panic(err)
 	}
@@ -208,7 +673,45 @@ func NewSQLStorage(ctx context.Context, dsn string) sqlStorage {
 		panic(err)
 	}
 
+	err = migrate(db)
+	if err != nil {
+		panic(err)
+	}
+
 	return sqlStorage{
 		DB: db,
 	}
 }
+
+// migrate - brings the database schema up to date. Number of applied migrations
+// is tracked using SQLite 'user_version' pragma.
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(sqlSchemaVersion).Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(sqlMigrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.Exec(sqlMigrations[i]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+
+		// PRAGMA statement does not support placeholders
+		if _, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d;", i+1)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
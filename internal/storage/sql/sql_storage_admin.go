@@ -0,0 +1,145 @@
+package sql
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// settingRegistrationOpen - name of the setting in server_setting table
+const settingRegistrationOpen = "registration_open"
+
+// GetUsers - returns all users of the server with the number and the size of their secrets
+func (ss sqlStorage) GetUsers(ctx context.Context) ([]*model.UserSummary, error) {
+	rows, err := ss.QueryContext(ctx, sqlFindUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*model.UserSummary, 0)
+	for rows.Next() {
+		user := model.UserSummary{}
+		err = rows.Scan(&user.ID, &user.Login, &user.Role, &user.Disabled, &user.External, &user.Secrets, &user.Size)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (ss sqlStorage) SetUserRole(ctx context.Context, login, role string) error {
+	return updateUser(ctx, ss, sqlUpdateUserRole, role, login)
+}
+
+func (ss sqlStorage) SetUserDisabled(ctx context.Context, login string, disabled bool) error {
+	return updateUser(ctx, ss, sqlUpdateUserDisabled, disabled, login)
+}
+
+// RevokeUserSessions - tokens of the user which were issued before revokedAt are not accepted anymore,
+// personal API tokens of the user are deleted
+func (ss sqlStorage) RevokeUserSessions(ctx context.Context, login string, revokedAt time.Time) error {
+	tx, err := ss.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if err = updateUser(ctx, tx, sqlRevokeUserSessions, revokedAt.UTC(), login); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, sqlDeleteUserAPITokens, login); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateUser - runs an update of a single user, returns constant.ErrNotFound if there is no such user
+func updateUser(ctx context.Context, db execer, query string, args ...any) error {
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return constant.ErrNotFound
+	}
+
+	return nil
+}
+
+func (ss sqlStorage) GetStorageUsage(ctx context.Context) (*model.StorageUsage, error) {
+	usage := model.StorageUsage{}
+	err := ss.QueryRowContext(ctx, sqlGetStorageUsage).Scan(
+		&usage.Users,
+		&usage.DisabledUsers,
+		&usage.Secrets,
+		&usage.VaultSecrets,
+		&usage.Teams,
+		&usage.Sends,
+		&usage.SecretsSize,
+		&usage.DatabaseSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &usage, nil
+}
+
+// GetServerSettings - returns stored settings, settings which are not stored have default values
+func (ss sqlStorage) GetServerSettings(ctx context.Context) (*model.ServerSettings, error) {
+	rows, err := ss.QueryContext(ctx, sqlGetServerSettings)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := model.DefaultServerSettings()
+	for rows.Next() {
+		var name, value string
+		if err = rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+
+		if name == settingRegistrationOpen {
+			if settings.RegistrationOpen, err = strconv.ParseBool(value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+func (ss sqlStorage) SaveServerSettings(ctx context.Context, settings *model.ServerSettings) error {
+	_, err := ss.ExecContext(
+		ctx,
+		sqlSaveServerSetting,
+		settingRegistrationOpen,
+		strconv.FormatBool(settings.RegistrationOpen),
+	)
+
+	return err
+}
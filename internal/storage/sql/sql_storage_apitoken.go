@@ -0,0 +1,164 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// AddAPIToken - saves a new personal API token of the user
+func (ss sqlStorage) AddAPIToken(ctx context.Context, token *model.APIToken) error {
+	now := time.Now().UTC()
+	err := ss.QueryRowContext(
+		ctx,
+		sqlInsertAPIToken,
+		token.Login,
+		token.Name,
+		token.Hash,
+		token.DataKey,
+		token.Permission,
+		formatIDs(token.SecretIDs),
+		formatIDs(token.VaultIDs),
+		token.ExpiresAt,
+		now,
+	).Scan(&token.ID)
+	if err != nil {
+		return err
+	}
+
+	token.CreatedAt = now
+
+	return nil
+}
+
+func (ss sqlStorage) GetAPITokens(ctx context.Context, login string) ([]*model.APIToken, error) {
+	rows, err := ss.QueryContext(ctx, sqlFindAPITokensByUser, login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*model.APIToken, 0)
+	for rows.Next() {
+		var token *model.APIToken
+		token, err = scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetAPITokenByHash - returns a token of any user, the owner is identified by the login
+func (ss sqlStorage) GetAPITokenByHash(ctx context.Context, hash string) (*model.APIToken, error) {
+	token, err := scanAPIToken(ss.QueryRowContext(ctx, sqlGetAPITokenByHash, hash))
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, constant.ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// TouchAPIToken - saves the time when the token was used
+func (ss sqlStorage) TouchAPIToken(ctx context.Context, id int64) error {
+	_, err := ss.ExecContext(ctx, sqlTouchAPIToken, time.Now().UTC(), id)
+
+	return err
+}
+
+func (ss sqlStorage) DeleteAPIToken(ctx context.Context, id int64, login string) error {
+	result, err := ss.ExecContext(ctx, sqlDeleteAPIToken, id, login)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return constant.ErrNotFound
+	}
+
+	return nil
+}
+
+// scanAPIToken - reads a token from a row which was selected with sqlAPITokenColumns
+func scanAPIToken(row rowScanner) (*model.APIToken, error) {
+	token := model.APIToken{}
+
+	var secretIDs, vaultIDs string
+	err := row.Scan(
+		&token.ID,
+		&token.Login,
+		&token.Name,
+		&token.Hash,
+		&token.DataKey,
+		&token.Permission,
+		&secretIDs,
+		&vaultIDs,
+		&token.ExpiresAt,
+		&token.CreatedAt,
+		&token.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.SecretIDs, err = parseIDs(secretIDs); err != nil {
+		return nil, err
+	}
+
+	if token.VaultIDs, err = parseIDs(vaultIDs); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// formatIDs - joins identifiers with commas
+func formatIDs(ids []int64) string {
+	values := make([]string, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, strconv.FormatInt(id, 10))
+	}
+
+	return strings.Join(values, ",")
+}
+
+// parseIDs - splits comma-separated identifiers
+func parseIDs(value string) ([]int64, error) {
+	ids := make([]int64, 0)
+	if value == "" {
+		return ids, nil
+	}
+
+	for _, s := range strings.Split(value, ",") {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
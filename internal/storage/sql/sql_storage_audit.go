@@ -0,0 +1,113 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// AddAuditEvent - appends the event to the audit log. constant.ErrDuplicateRecord is returned if another
+// event already refers to the same previous hash.
+func (ss sqlStorage) AddAuditEvent(ctx context.Context, event *model.AuditEvent) error {
+	err := ss.QueryRowContext(
+		ctx,
+		sqlInsertAuditEvent,
+		event.Type,
+		event.Login,
+		event.SecretID,
+		event.RemoteAddr,
+		event.UserAgent,
+		event.CreatedAt,
+		event.PrevHash,
+		event.Hash,
+	).Scan(&event.ID)
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		return constant.ErrDuplicateRecord
+	}
+
+	return err
+}
+
+// GetLastAuditEvent - returns the most recent event, constant.ErrNotFound is returned if the log is empty
+func (ss sqlStorage) GetLastAuditEvent(ctx context.Context) (*model.AuditEvent, error) {
+	event, err := scanAuditEvent(ss.QueryRowContext(ctx, sqlGetLastAuditEvent))
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, constant.ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	return event, nil
+}
+
+//nolint:lll
+func (ss sqlStorage) GetAuditEvents(ctx context.Context, login string, filter model.AuditFilter) ([]*model.AuditEvent, error) {
+	rows, err := ss.QueryContext(ctx, sqlFindAuditEventsByUser, login, filter.Type, filter.Before, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]*model.AuditEvent, 0)
+	for rows.Next() {
+		var event *model.AuditEvent
+		if event, err = scanAuditEvent(rows); err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// WalkAuditEvents - calls fn for every event in the order they were recorded, stops on the first error
+func (ss sqlStorage) WalkAuditEvents(ctx context.Context, fn func(event *model.AuditEvent) error) error {
+	rows, err := ss.QueryContext(ctx, sqlFindAllAuditEvents)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event *model.AuditEvent
+		if event, err = scanAuditEvent(rows); err != nil {
+			return err
+		}
+
+		if err = fn(event); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func scanAuditEvent(row rowScanner) (*model.AuditEvent, error) {
+	event := model.AuditEvent{}
+	err := row.Scan(
+		&event.ID,
+		&event.Type,
+		&event.Login,
+		&event.SecretID,
+		&event.RemoteAddr,
+		&event.UserAgent,
+		&event.CreatedAt,
+		&event.PrevHash,
+		&event.Hash,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
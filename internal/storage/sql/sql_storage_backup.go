@@ -0,0 +1,46 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrCorrupted - the database file didn't pass the integrity check
+var ErrCorrupted = errors.New("database integrity check failed")
+
+// SchemaVersion - the schema version of databases which are created by this version of the application
+func SchemaVersion() int {
+	return len(sqlMigrations)
+}
+
+// Backup - writes a copy of the database into a new file. The database remains available during the backup.
+func (ss sqlStorage) Backup(ctx context.Context, path string) error {
+	_, err := ss.ExecContext(ctx, sqlBackup, path)
+
+	return err
+}
+
+// InspectDatabase - opens a database file in read-only mode, checks its integrity and returns its schema version
+func InspectDatabase(ctx context.Context, path string) (int, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var result string
+	if err = db.QueryRowContext(ctx, sqlIntegrityCheck).Scan(&result); err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrCorrupted, err)
+	}
+
+	if result != "ok" {
+		return 0, fmt.Errorf("%w: %s", ErrCorrupted, result)
+	}
+
+	var version int
+	err = db.QueryRowContext(ctx, sqlSchemaVersion).Scan(&version)
+
+	return version, err
+}
@@ -0,0 +1,162 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// SaveEmergencyAccess - creates emergency access, a grantor can have only one record per grantee
+func (ss sqlStorage) SaveEmergencyAccess(ctx context.Context, access *model.EmergencyAccess) error {
+	now := time.Now().UTC()
+	var id int64
+	err := ss.QueryRowContext(
+		ctx,
+		sqlInsertEmergencyAccess,
+		access.Grantor,
+		access.Grantee,
+		access.State,
+		access.WaitDays,
+		access.SealedKey,
+		now,
+	).Scan(&id)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+			return constant.ErrDuplicateRecord
+		}
+
+		return err
+	}
+
+	access.ID = id
+	access.CreatedAt = &now
+	access.UpdatedAt = &now
+
+	return nil
+}
+
+//nolint:lll
+func (ss sqlStorage) GetEmergencyAccess(ctx context.Context, id int64, login string) (*model.EmergencyAccess, error) {
+	access, err := scanEmergencyAccess(ss.QueryRowContext(ctx, sqlGetEmergencyAccess, id, login))
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, constant.ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	return access, nil
+}
+
+// GetEmergencyAccessList - returns records where the user is either the grantor or the grantee
+func (ss sqlStorage) GetEmergencyAccessList(ctx context.Context, login string) ([]*model.EmergencyAccess, error) {
+	return ss.findEmergencyAccess(ctx, sqlFindEmergencyAccessByUser, login)
+}
+
+//nolint:lll
+func (ss sqlStorage) GetEmergencyAccessByState(ctx context.Context, state string) ([]*model.EmergencyAccess, error) {
+	return ss.findEmergencyAccess(ctx, sqlFindEmergencyAccessByState, state)
+}
+
+// UpdateEmergencyAccess - saves the new state of emergency access. constant.ErrNotFound is returned
+// if the record was removed or its state is not fromState anymore.
+//
+//nolint:lll
+func (ss sqlStorage) UpdateEmergencyAccess(ctx context.Context, access *model.EmergencyAccess, fromState string) error {
+	result, err := ss.ExecContext(
+		ctx,
+		sqlUpdateEmergencyAccessState,
+		access.State,
+		access.RequestedAt,
+		access.UpdatedAt,
+		access.ID,
+		fromState,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return constant.ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteEmergencyAccess - removes emergency access, both the grantor and the grantee can do that
+func (ss sqlStorage) DeleteEmergencyAccess(ctx context.Context, id int64, login string) error {
+	result, err := ss.ExecContext(ctx, sqlDeleteEmergencyAccess, id, login)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return constant.ErrNotFound
+	}
+
+	return nil
+}
+
+//nolint:lll
+func (ss sqlStorage) findEmergencyAccess(ctx context.Context, query string, args ...any) ([]*model.EmergencyAccess, error) {
+	rows, err := ss.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*model.EmergencyAccess, 0)
+	for rows.Next() {
+		var access *model.EmergencyAccess
+		access, err = scanEmergencyAccess(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, access)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func scanEmergencyAccess(row rowScanner) (*model.EmergencyAccess, error) {
+	access := model.EmergencyAccess{}
+	err := row.Scan(
+		&access.ID,
+		&access.Grantor,
+		&access.Grantee,
+		&access.State,
+		&access.WaitDays,
+		&access.SealedKey,
+		&access.RequestedAt,
+		&access.CreatedAt,
+		&access.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &access, nil
+}
@@ -0,0 +1,76 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// AddExternalUser - creates the user and links it to the identity in the same transaction,
+// so a user who signs in with an identity provider never exists without the identity
+func (ss sqlStorage) AddExternalUser(ctx context.Context, u *model.User, identity *model.Identity) error {
+	tx, err := ss.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	_, err = tx.ExecContext(ctx, sqlInsertUser, u.Login, u.HashedPassword, "", u.DataKey, u.PublicKey, u.PrivateKey)
+	if err == nil {
+		now := time.Now().UTC()
+		_, err = tx.ExecContext(ctx, sqlInsertUserIdentity, identity.Issuer, identity.Subject, u.Login, now)
+		identity.CreatedAt = now
+	}
+
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+			return constant.ErrDuplicateRecord
+		}
+
+		return err
+	}
+
+	identity.Login = u.Login
+
+	return tx.Commit()
+}
+
+func (ss sqlStorage) GetUserByIdentity(ctx context.Context, issuer, subject string) (*model.User, error) {
+	u, err := scanUser(ss.QueryRowContext(ctx, sqlSelectUserByIdentity, issuer, subject))
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, constant.ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// SetUserDataKey - sets the data key and the key pair of a user who doesn't have a data key yet.
+// Returns constant.ErrDuplicateRecord if the user already has one.
+func (ss sqlStorage) SetUserDataKey(ctx context.Context, u *model.User) error {
+	result, err := ss.ExecContext(ctx, sqlUpdateUserDataKey, u.DataKey, u.PublicKey, u.PrivateKey, u.Login)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return constant.ErrDuplicateRecord
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+func (ss sqlStorage) SaveSend(ctx context.Context, send *model.Send, login string) error {
+	now := time.Now().UTC()
+	_, err := ss.ExecContext(
+		ctx,
+		sqlInsertSend,
+		send.ID,
+		send.Type,
+		send.Payload,
+		send.FileName,
+		send.PasswordHash,
+		send.MaxViews,
+		send.ExpiresAt.UTC(),
+		now,
+		login,
+	)
+	if err != nil {
+		return err
+	}
+
+	send.CreatedAt = &now
+
+	return nil
+}
+
+func (ss sqlStorage) GetSends(ctx context.Context, login string) ([]*model.Send, error) {
+	rows, err := ss.QueryContext(ctx, sqlFindSendsByUser, login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*model.Send, 0)
+	for rows.Next() {
+		var send *model.Send
+		send, err = scanSend(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, send)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetSend - returns a send by its identifier, the send is not counted as viewed
+func (ss sqlStorage) GetSend(ctx context.Context, id string) (*model.Send, error) {
+	send, err := scanSend(ss.QueryRowContext(ctx, sqlGetSend, id))
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, constant.ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	return send, nil
+}
+
+// ConsumeSend - counts a view of the send and returns it. The send is removed after the last view,
+// and expired sends are removed instead of being returned.
+func (ss sqlStorage) ConsumeSend(ctx context.Context, id string) (*model.Send, error) {
+	tx, err := ss.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	now := time.Now().UTC()
+	result, err := tx.ExecContext(ctx, sqlIncrementSendViews, id, now)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rows == 0 {
+		// The send either doesn't exist or is not available anymore
+		if _, err = tx.ExecContext(ctx, sqlDeleteUsedSend, id, now); err != nil {
+			return nil, err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return nil, err
+		}
+
+		return nil, constant.ErrNotFound
+	}
+
+	send, err := scanSend(tx.QueryRowContext(ctx, sqlGetSend, id))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.ExecContext(ctx, sqlDeleteUsedSend, id, now); err != nil {
+		return nil, err
+	}
+
+	return send, tx.Commit()
+}
+
+// AttemptSendPassword - counts an attempt to enter the passphrase of the send as failed before the passphrase
+// is checked, so parallel requests can't bypass the limit. A view of the send forgives the attempt.
+// Returns the number of failed attempts. The send is removed and constant.ErrNotFound is returned,
+// if maxFailures attempts have already failed.
+func (ss sqlStorage) AttemptSendPassword(ctx context.Context, id string, maxFailures int) (int, error) {
+	tx, err := ss.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var failures int
+	err = tx.QueryRowContext(ctx, sqlIncrementSendPasswordFailures, id, maxFailures).Scan(&failures)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The send either doesn't exist or is out of attempts
+		if _, err = tx.ExecContext(ctx, sqlDestroySend, id); err != nil {
+			return 0, err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return 0, err
+		}
+
+		return 0, constant.ErrNotFound
+	} else if err != nil {
+		return 0, err
+	}
+
+	return failures, tx.Commit()
+}
+
+// DestroySend - removes the send regardless of its owner, when its passphrase is not entered correctly
+func (ss sqlStorage) DestroySend(ctx context.Context, id string) error {
+	_, err := ss.ExecContext(ctx, sqlDestroySend, id)
+
+	return err
+}
+
+func (ss sqlStorage) DeleteSend(ctx context.Context, id, login string) error {
+	result, err := ss.ExecContext(ctx, sqlDeleteSend, id, login)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return constant.ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteExpiredSends - removes sends which are expired or were viewed maximum number of times
+func (ss sqlStorage) DeleteExpiredSends(ctx context.Context, now time.Time) (int64, error) {
+	result, err := ss.ExecContext(ctx, sqlDeleteExpiredSends, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// scanSend - reads a send from a row which was selected with sqlGetSend or sqlFindSendsByUser
+func scanSend(row rowScanner) (*model.Send, error) {
+	send := model.Send{}
+
+	err := row.Scan(
+		&send.ID,
+		&send.Type,
+		&send.Payload,
+		&send.FileName,
+		&send.PasswordHash,
+		&send.MaxViews,
+		&send.ViewCount,
+		&send.ExpiresAt,
+		&send.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &send, nil
+}
@@ -0,0 +1,457 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// CreateTeam - creates a team, the user who creates the team becomes its owner
+func (ss sqlStorage) CreateTeam(ctx context.Context, team *model.Team, login string) error {
+	tx, err := ss.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	now := time.Now().UTC()
+	var teamID int64
+	if err = tx.QueryRowContext(ctx, sqlInsertTeam, team.Name, now).Scan(&teamID); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, sqlInsertTeamMember, teamID, login, model.RoleOwner); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	team.ID = teamID
+	team.Role = model.RoleOwner
+	team.CreatedAt = &now
+
+	return nil
+}
+
+func (ss sqlStorage) GetTeams(ctx context.Context, login string) ([]*model.Team, error) {
+	rows, err := ss.QueryContext(ctx, sqlFindTeamsByUser, login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*model.Team, 0)
+	for rows.Next() {
+		team := model.Team{}
+		if err = rows.Scan(&team.ID, &team.Name, &team.Role, &team.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		result = append(result, &team)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (ss sqlStorage) GetTeamMember(ctx context.Context, teamID int64, login string) (*model.TeamMember, error) {
+	member := model.TeamMember{}
+	err := ss.QueryRowContext(ctx, sqlGetTeamMember, teamID, login).Scan(&member.TeamID, &member.Login, &member.Role)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, constant.ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+func (ss sqlStorage) GetTeamMembers(ctx context.Context, teamID int64) ([]*model.TeamMember, error) {
+	rows, err := ss.QueryContext(ctx, sqlFindTeamMembers, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*model.TeamMember, 0)
+	for rows.Next() {
+		member := model.TeamMember{}
+		if err = rows.Scan(&member.TeamID, &member.Login, &member.Role); err != nil {
+			return nil, err
+		}
+
+		result = append(result, &member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// AddTeamMember - adds a user to the team along with the keys of all team vaults sealed for the user
+func (ss sqlStorage) AddTeamMember(ctx context.Context, member *model.TeamMember, keys []*model.VaultKey) error {
+	tx, err := ss.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	_, err = tx.ExecContext(ctx, sqlInsertTeamMember, member.TeamID, member.Login, member.Role)
+	if err != nil {
+		return err
+	}
+
+	if err = upsertVaultKeys(ctx, tx, keys); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ss sqlStorage) UpdateTeamMember(ctx context.Context, member *model.TeamMember) error {
+	result, err := ss.ExecContext(ctx, sqlUpdateTeamMember, member.Role, member.TeamID, member.Login)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return constant.ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveTeamMember - removes a user from the team. Vault keys are rotated in the same transaction,
+// so the removed user can't decrypt vault secrets with a key which they might have kept.
+// Rotations are prepared before the transaction, so constant.ErrConflict is returned if vaults, vault secrets
+// or members were added or removed meanwhile, otherwise they would keep the previous vault key.
+//
+//nolint:lll
+func (ss sqlStorage) RemoveTeamMember(ctx context.Context, member *model.TeamMember, rotations []*model.VaultRotation) error {
+	tx, err := ss.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	result, err := tx.ExecContext(ctx, sqlDeleteTeamMember, member.TeamID, member.Login)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return constant.ErrNotFound
+	}
+
+	if _, err = tx.ExecContext(ctx, sqlDeleteMemberVaultKeys, member.TeamID, member.Login); err != nil {
+		return err
+	}
+
+	members, err := countRows(ctx, tx, sqlCountTeamMembers, member.TeamID)
+	if err != nil {
+		return err
+	}
+
+	vaults, err := countRows(ctx, tx, sqlCountTeamVaults, member.TeamID)
+	if err != nil {
+		return err
+	}
+
+	if vaults != int64(len(rotations)) {
+		return constant.ErrConflict
+	}
+
+	for _, rotation := range rotations {
+		var rewrapped int64
+		for _, secret := range rotation.Secrets {
+			result, err = tx.ExecContext(ctx, sqlUpdateVaultSecretKey, secret.WrappedKey, secret.ID, rotation.VaultID)
+			if err != nil {
+				return err
+			}
+
+			if rows, err = result.RowsAffected(); err != nil {
+				return err
+			}
+
+			rewrapped += rows
+		}
+
+		if err = upsertVaultKeys(ctx, tx, rotation.Keys); err != nil {
+			return err
+		}
+
+		// Every secret of the vault must be rewrapped, and every member must get the new vault key only
+		var secrets, keys int64
+		if secrets, err = countRows(ctx, tx, sqlCountVaultSecrets, rotation.VaultID); err != nil {
+			return err
+		}
+
+		if keys, err = countRows(ctx, tx, sqlCountVaultKeys, rotation.VaultID); err != nil {
+			return err
+		}
+
+		if secrets != rewrapped || keys != int64(len(rotation.Keys)) || keys != members {
+			return constant.ErrConflict
+		}
+	}
+
+	return tx.Commit()
+}
+
+// CreateVault - creates a team vault along with the vault key sealed for every team member
+func (ss sqlStorage) CreateVault(ctx context.Context, vault *model.Vault, keys []*model.VaultKey) error {
+	tx, err := ss.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	now := time.Now().UTC()
+	var vaultID int64
+	if err = tx.QueryRowContext(ctx, sqlInsertVault, vault.TeamID, vault.Name, now).Scan(&vaultID); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		key.VaultID = vaultID
+	}
+
+	if err = upsertVaultKeys(ctx, tx, keys); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	vault.ID = vaultID
+	vault.CreatedAt = &now
+
+	return nil
+}
+
+func (ss sqlStorage) GetVaults(ctx context.Context, teamID int64) ([]*model.Vault, error) {
+	rows, err := ss.QueryContext(ctx, sqlFindVaultsByTeam, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*model.Vault, 0)
+	for rows.Next() {
+		vault := model.Vault{}
+		if err = rows.Scan(&vault.ID, &vault.TeamID, &vault.Name, &vault.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		result = append(result, &vault)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetVaultAccess - returns the vault, the user's role and the vault key sealed for the user.
+// constant.ErrNotFound is returned if the user is not a member of the team which owns the vault.
+func (ss sqlStorage) GetVaultAccess(ctx context.Context, vaultID int64, login string) (*model.VaultAccess, error) {
+	access := model.VaultAccess{}
+	err := ss.QueryRowContext(ctx, sqlGetVaultAccess, vaultID, login).Scan(
+		&access.ID,
+		&access.TeamID,
+		&access.Name,
+		&access.CreatedAt,
+		&access.Role,
+		&access.SealedKey,
+	)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, constant.ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	return &access, nil
+}
+
+func (ss sqlStorage) SaveVaultSecret(ctx context.Context, s *model.Secret, vaultID int64) (*model.Secret, error) {
+	now := time.Now().UTC()
+
+	if s.ID != 0 {
+		result, err := ss.ExecContext(
+			ctx,
+			sqlUpdateVaultSecret,
+			s.Type,
+			s.Title,
+			s.Login,
+			s.Password,
+			s.Note,
+			s.FileName,
+			s.CardholderName,
+			s.CardNumber,
+			s.Expiration,
+			s.SecurityCode,
+			s.URL,
+			s.Favorite,
+			s.ExpiresAt,
+			s.RotateEvery,
+			s.Compromised,
+			now,
+			s.ID,
+			vaultID,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rows == 0 {
+			return nil, constant.ErrNotFound
+		}
+
+		s.UpdatedAt = &now
+
+		return s, nil
+	}
+
+	result, err := ss.ExecContext(
+		ctx,
+		sqlInsertVaultSecret,
+		s.Type,
+		s.Title,
+		s.Login,
+		s.Password,
+		s.Note,
+		s.File,
+		s.FileName,
+		s.CardholderName,
+		s.CardNumber,
+		s.Expiration,
+		s.SecurityCode,
+		s.URL,
+		s.Favorite,
+		s.ExpiresAt,
+		s.RotateEvery,
+		s.Compromised,
+		s.WrappedKey,
+		now,
+		vaultID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	insertedID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	s.ID = insertedID
+	s.CreatedAt = &now
+	s.UpdatedAt = &now
+
+	return s, nil
+}
+
+func (ss sqlStorage) GetVaultSecrets(ctx context.Context, vaultID int64) (map[int]*model.Secret, error) {
+	rows, err := ss.QueryContext(ctx, sqlFindSecretsByVault, vaultID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int]*model.Secret)
+	for rows.Next() {
+		var secret *model.Secret
+		secret, err = scanSecret(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result[int(secret.ID)] = secret
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (ss sqlStorage) GetVaultSecret(ctx context.Context, vaultID int64, secretID string) (*model.Secret, error) {
+	secret, err := scanSecret(ss.QueryRowContext(ctx, sqlGetVaultSecretByID, secretID, vaultID))
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, constant.ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+func (ss sqlStorage) DeleteVaultSecret(ctx context.Context, vaultID int64, secretID string) error {
+	result, err := ss.ExecContext(ctx, sqlDeleteVaultSecret, secretID, vaultID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return constant.ErrNotFound
+	}
+
+	return nil
+}
+
+func upsertVaultKeys(ctx context.Context, tx *sql.Tx, keys []*model.VaultKey) error {
+	for _, key := range keys {
+		if _, err := tx.ExecContext(ctx, sqlUpsertVaultKey, key.VaultID, key.Login, key.SealedKey); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func countRows(ctx context.Context, tx *sql.Tx, query string, args ...any) (int64, error) {
+	var count int64
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&count)
+
+	return count, err
+}
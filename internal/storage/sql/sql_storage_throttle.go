@@ -0,0 +1,44 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+func (ss sqlStorage) GetLoginAttempts(ctx context.Context, key string) (*model.LoginAttempts, error) {
+	a := model.LoginAttempts{}
+	err := ss.QueryRowContext(ctx, sqlGetLoginAttempts, key).Scan(&a.Key, &a.Failures, &a.LastAttemptAt, &a.LockedUntil)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, constant.ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func (ss sqlStorage) SaveLoginAttempts(ctx context.Context, a *model.LoginAttempts) error {
+	_, err := ss.ExecContext(ctx, sqlSaveLoginAttempts, a.Key, a.Failures, a.LastAttemptAt.UTC(), a.LockedUntil.UTC())
+
+	return err
+}
+
+func (ss sqlStorage) DeleteLoginAttempts(ctx context.Context, key string) error {
+	_, err := ss.ExecContext(ctx, sqlDeleteLoginAttempts, key)
+
+	return err
+}
+
+// DeleteStaleLoginAttempts - removes attempts which were made before the time and are not locked anymore
+func (ss sqlStorage) DeleteStaleLoginAttempts(ctx context.Context, before, now time.Time) error {
+	_, err := ss.ExecContext(ctx, sqlDeleteStaleLoginAttempts, before.UTC(), now.UTC())
+
+	return err
+}
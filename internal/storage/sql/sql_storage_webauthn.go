@@ -0,0 +1,161 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// AddWebAuthnCredential - saves a new credential of the user. Returns constant.ErrDuplicateRecord
+// if the credential is already registered.
+func (ss sqlStorage) AddWebAuthnCredential(ctx context.Context, credential *model.WebAuthnCredential) error {
+	now := time.Now().UTC()
+	_, err := ss.ExecContext(
+		ctx,
+		sqlInsertWebAuthnCredential,
+		credential.ID,
+		credential.Login,
+		credential.UserHandle,
+		credential.Name,
+		credential.PublicKey,
+		credential.SignCount,
+		credential.AAGUID,
+		credential.DataKey,
+		now,
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+			return constant.ErrDuplicateRecord
+		}
+
+		return err
+	}
+
+	credential.CreatedAt = now
+
+	return nil
+}
+
+func (ss sqlStorage) GetWebAuthnCredentials(ctx context.Context, login string) ([]*model.WebAuthnCredential, error) {
+	rows, err := ss.QueryContext(ctx, sqlFindWebAuthnCredentialsByUser, login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*model.WebAuthnCredential, 0)
+	for rows.Next() {
+		var credential *model.WebAuthnCredential
+		credential, err = scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, credential)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetWebAuthnCredential - returns a credential of any user, the owner is identified by the login
+func (ss sqlStorage) GetWebAuthnCredential(ctx context.Context, id string) (*model.WebAuthnCredential, error) {
+	credential, err := scanWebAuthnCredential(ss.QueryRowContext(ctx, sqlGetWebAuthnCredential, id))
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, constant.ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	return credential, nil
+}
+
+// UpdateWebAuthnCredential - saves the signature counter and the wrapped data key after login.
+// Returns constant.ErrNotFound if the credential was removed or its counter is not previousSignCount anymore.
+func (ss sqlStorage) UpdateWebAuthnCredential(
+	ctx context.Context,
+	credential *model.WebAuthnCredential,
+	previousSignCount uint32,
+) error {
+	now := time.Now().UTC()
+	result, err := ss.ExecContext(
+		ctx,
+		sqlUpdateWebAuthnCredential,
+		credential.SignCount,
+		credential.DataKey,
+		now,
+		credential.ID,
+		previousSignCount,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return constant.ErrNotFound
+	}
+
+	credential.LastUsedAt = &now
+
+	return nil
+}
+
+func (ss sqlStorage) DeleteWebAuthnCredential(ctx context.Context, id, login string) error {
+	result, err := ss.ExecContext(ctx, sqlDeleteWebAuthnCredential, id, login)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return constant.ErrNotFound
+	}
+
+	return nil
+}
+
+// scanWebAuthnCredential - reads a credential from a row which was selected with sqlWebAuthnCredentialColumns
+func scanWebAuthnCredential(row rowScanner) (*model.WebAuthnCredential, error) {
+	credential := model.WebAuthnCredential{}
+
+	err := row.Scan(
+		&credential.ID,
+		&credential.Login,
+		&credential.UserHandle,
+		&credential.Name,
+		&credential.PublicKey,
+		&credential.SignCount,
+		&credential.AAGUID,
+		&credential.DataKey,
+		&credential.CreatedAt,
+		&credential.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	credential.Passwordless = credential.DataKey != ""
+
+	return &credential, nil
+}
@@ -4,6 +4,7 @@ package storage
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/grafviktor/keep-my-secret/internal/model"
 	"github.com/grafviktor/keep-my-secret/internal/storage/sql"
@@ -12,10 +13,80 @@ import (
 type Storage interface {
 	AddUser(ctx context.Context, user *model.User) (*model.User, error)
 	GetUser(ctx context.Context, login string) (*model.User, error)
-	SaveSecret(ctx context.Context, secret *model.Secret, login string) (*model.Secret, error)
+	SetUserKeyPair(ctx context.Context, user *model.User) error
+	UpdateUserPassword(ctx context.Context, user *model.User) error
+	AddExternalUser(ctx context.Context, user *model.User, identity *model.Identity) error
+	GetUserByIdentity(ctx context.Context, issuer, subject string) (*model.User, error)
+	SetUserDataKey(ctx context.Context, user *model.User) error
+	GetUsers(ctx context.Context) ([]*model.UserSummary, error)
+	SetUserRole(ctx context.Context, login, role string) error
+	SetUserDisabled(ctx context.Context, login string, disabled bool) error
+	RevokeUserSessions(ctx context.Context, login string, revokedAt time.Time) error
+	GetStorageUsage(ctx context.Context) (*model.StorageUsage, error)
+	GetServerSettings(ctx context.Context) (*model.ServerSettings, error)
+	SaveServerSettings(ctx context.Context, settings *model.ServerSettings) error
+	AddWebAuthnCredential(ctx context.Context, credential *model.WebAuthnCredential) error
+	GetWebAuthnCredentials(ctx context.Context, login string) ([]*model.WebAuthnCredential, error)
+	GetWebAuthnCredential(ctx context.Context, id string) (*model.WebAuthnCredential, error)
+	UpdateWebAuthnCredential(ctx context.Context, credential *model.WebAuthnCredential, previousSignCount uint32) error
+	DeleteWebAuthnCredential(ctx context.Context, id, login string) error
+	AddAPIToken(ctx context.Context, token *model.APIToken) error
+	GetAPITokens(ctx context.Context, login string) ([]*model.APIToken, error)
+	GetAPITokenByHash(ctx context.Context, hash string) (*model.APIToken, error)
+	TouchAPIToken(ctx context.Context, id int64) error
+	DeleteAPIToken(ctx context.Context, id int64, login string) error
+	SaveSecret(ctx context.Context, secret *model.Secret, searchTokens []string, login string) (*model.Secret, error)
 	GetSecretsByUser(ctx context.Context, login string) (map[int]*model.Secret, error)
 	DeleteSecret(ctx context.Context, secretID, login string) error
 	GetSecret(ctx context.Context, secretID, login string) (*model.Secret, error)
+	GetRecentSecrets(ctx context.Context, login string, limit int) ([]*model.Secret, error)
+	TouchSecret(ctx context.Context, secretID, login string) error
+	SetSecretCompromised(ctx context.Context, secretID int64, compromised bool, login string) error
+	GetSecretsWithReminders(ctx context.Context) (map[string][]*model.Secret, error)
+	SearchSecrets(ctx context.Context, tokens []string, login string) (map[int]*model.Secret, error)
+	UpdateSecretKey(ctx context.Context, secret *model.Secret, shares []*model.Share, login string) error
+	SaveShare(ctx context.Context, share *model.Share, login string) error
+	GetShare(ctx context.Context, secretID, login string) (*model.Share, error)
+	GetSecretShares(ctx context.Context, secretID, login string) ([]*model.Share, error)
+	GetSharedSecrets(ctx context.Context, login string) ([]*model.Share, error)
+	DeleteShare(ctx context.Context, secretID, recipient, login string) error
+	CreateTeam(ctx context.Context, team *model.Team, login string) error
+	GetTeams(ctx context.Context, login string) ([]*model.Team, error)
+	GetTeamMember(ctx context.Context, teamID int64, login string) (*model.TeamMember, error)
+	GetTeamMembers(ctx context.Context, teamID int64) ([]*model.TeamMember, error)
+	AddTeamMember(ctx context.Context, member *model.TeamMember, keys []*model.VaultKey) error
+	UpdateTeamMember(ctx context.Context, member *model.TeamMember) error
+	RemoveTeamMember(ctx context.Context, member *model.TeamMember, rotations []*model.VaultRotation) error
+	CreateVault(ctx context.Context, vault *model.Vault, keys []*model.VaultKey) error
+	GetVaults(ctx context.Context, teamID int64) ([]*model.Vault, error)
+	GetVaultAccess(ctx context.Context, vaultID int64, login string) (*model.VaultAccess, error)
+	SaveVaultSecret(ctx context.Context, secret *model.Secret, vaultID int64) (*model.Secret, error)
+	GetVaultSecrets(ctx context.Context, vaultID int64) (map[int]*model.Secret, error)
+	GetVaultSecret(ctx context.Context, vaultID int64, secretID string) (*model.Secret, error)
+	DeleteVaultSecret(ctx context.Context, vaultID int64, secretID string) error
+	SaveSend(ctx context.Context, send *model.Send, login string) error
+	GetSends(ctx context.Context, login string) ([]*model.Send, error)
+	GetSend(ctx context.Context, id string) (*model.Send, error)
+	ConsumeSend(ctx context.Context, id string) (*model.Send, error)
+	AttemptSendPassword(ctx context.Context, id string, maxFailures int) (int, error)
+	DestroySend(ctx context.Context, id string) error
+	DeleteSend(ctx context.Context, id, login string) error
+	DeleteExpiredSends(ctx context.Context, now time.Time) (int64, error)
+	SaveEmergencyAccess(ctx context.Context, access *model.EmergencyAccess) error
+	GetEmergencyAccess(ctx context.Context, id int64, login string) (*model.EmergencyAccess, error)
+	GetEmergencyAccessList(ctx context.Context, login string) ([]*model.EmergencyAccess, error)
+	GetEmergencyAccessByState(ctx context.Context, state string) ([]*model.EmergencyAccess, error)
+	UpdateEmergencyAccess(ctx context.Context, access *model.EmergencyAccess, fromState string) error
+	DeleteEmergencyAccess(ctx context.Context, id int64, login string) error
+	AddAuditEvent(ctx context.Context, event *model.AuditEvent) error
+	GetLastAuditEvent(ctx context.Context) (*model.AuditEvent, error)
+	GetAuditEvents(ctx context.Context, login string, filter model.AuditFilter) ([]*model.AuditEvent, error)
+	WalkAuditEvents(ctx context.Context, fn func(event *model.AuditEvent) error) error
+	GetLoginAttempts(ctx context.Context, key string) (*model.LoginAttempts, error)
+	SaveLoginAttempts(ctx context.Context, attempts *model.LoginAttempts) error
+	DeleteLoginAttempts(ctx context.Context, key string) error
+	DeleteStaleLoginAttempts(ctx context.Context, before, now time.Time) error
+	Backup(ctx context.Context, path string) error
 	Close() error
 }
 
@@ -0,0 +1,292 @@
+// Package throttle slows down password guessing. Failed login attempts are counted per login and per client IP.
+// After a few free attempts every next attempt is delayed exponentially, and when the number of failures reaches
+// the threshold the login or the IP address is locked for a while.
+//
+// An attempt is counted as failed before the password is checked and is forgiven if the password is correct,
+// so parallel requests cannot bypass the limits.
+package throttle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/constant"
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+const (
+	keyPrefixLogin = "login:"
+	keyPrefixIP    = "ip:"
+	// cleanupInterval - how often attempts, which are not relevant anymore, are removed from the store
+	cleanupInterval = 10 * time.Minute
+)
+
+// ErrThrottled - the attempt is rejected, the client must wait before trying again
+var ErrThrottled = errors.New("too many failed login attempts")
+
+// Policy - limits of failed attempts for a single key
+type Policy struct {
+	// FreeAttempts - number of failed attempts which are not delayed
+	FreeAttempts int
+	// BaseDelay - delay after the first delayed attempt, it doubles after every next failure
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutThreshold - number of failed attempts which lock the key, zero disables the lockout
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// ResetAfter - failed attempts are forgotten if there were no attempts during this time
+	ResetAfter time.Duration
+}
+
+// Default policies. Many users can share an IP address, so the IP policy is less strict.
+var (
+	DefaultLoginPolicy = Policy{
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+		ResetAfter:       time.Hour,
+	}
+	DefaultIPPolicy = Policy{
+		FreeAttempts:     10,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutThreshold: 100,
+		LockoutDuration:  15 * time.Minute,
+		ResetAfter:       time.Hour,
+	}
+)
+
+// delay - how long the key must wait after the last attempt
+func (p Policy) delay(failures int) time.Duration {
+	if failures < p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	return delay
+}
+
+// Store - keeps failed attempts. constant.ErrNotFound is returned if the key doesn't have attempts.
+type Store interface {
+	GetLoginAttempts(ctx context.Context, key string) (*model.LoginAttempts, error)
+	SaveLoginAttempts(ctx context.Context, attempts *model.LoginAttempts) error
+	DeleteLoginAttempts(ctx context.Context, key string) error
+	// DeleteStaleLoginAttempts - removes attempts which were made before the time and are not locked anymore
+	DeleteStaleLoginAttempts(ctx context.Context, before, now time.Time) error
+}
+
+// Throttler - decides whether a login attempt is allowed. Updates of the counters are serialized,
+// so the store must not be shared by several application instances.
+type Throttler struct {
+	mu          sync.Mutex
+	store       Store
+	loginPolicy Policy
+	ipPolicy    Policy
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+func NewThrottler(store Store, loginPolicy, ipPolicy Policy) *Throttler {
+	return &Throttler{
+		store:       store,
+		loginPolicy: loginPolicy,
+		ipPolicy:    ipPolicy,
+		now:         time.Now,
+	}
+}
+
+type throttledKey struct {
+	key    string
+	policy Policy
+}
+
+func (t *Throttler) keys(login, ip string) []throttledKey {
+	return []throttledKey{
+		{key: keyPrefixLogin + login, policy: t.loginPolicy},
+		{key: keyPrefixIP + ip, policy: t.ipPolicy},
+	}
+}
+
+// Attempt - checks that the user may try to log in from the IP address. If the attempt is allowed, it's counted
+// as failed until Succeed is called. Otherwise, ErrThrottled is returned together with the time to wait.
+func (t *Throttler) Attempt(ctx context.Context, login, ip string) (time.Duration, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.cleanup(ctx, now)
+
+	keys := t.keys(login, ip)
+	attempts := make([]*model.LoginAttempts, 0, len(keys))
+	var wait time.Duration
+	for _, k := range keys {
+		a, err := t.load(ctx, k, now)
+		if err != nil {
+			return 0, err
+		}
+
+		if w := k.policy.wait(a, now); w > wait {
+			wait = w
+		}
+
+		attempts = append(attempts, a)
+	}
+
+	if wait > 0 {
+		return wait, ErrThrottled
+	}
+
+	for i, k := range keys {
+		a := attempts[i]
+		a.Failures++
+		a.LastAttemptAt = now
+		if k.policy.LockoutThreshold > 0 && a.Failures >= k.policy.LockoutThreshold {
+			a.LockedUntil = now.Add(k.policy.LockoutDuration)
+		}
+
+		if err := t.store.SaveLoginAttempts(ctx, a); err != nil {
+			return 0, err
+		}
+	}
+
+	return 0, nil
+}
+
+// Succeed - forgives the attempt which was counted by Attempt. Failures of the login are reset, but failures
+// of the IP address are not, otherwise an attacker who owns an account could reset them by logging in.
+func (t *Throttler) Succeed(ctx context.Context, login, ip string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keys := t.keys(login, ip)
+	if err := t.store.DeleteLoginAttempts(ctx, keys[0].key); err != nil {
+		return err
+	}
+
+	k := keys[1]
+	a, err := t.load(ctx, k, t.now())
+	if err != nil || a.Failures == 0 {
+		return err
+	}
+
+	a.Failures--
+	if a.Failures < k.policy.LockoutThreshold {
+		a.LockedUntil = time.Time{}
+	}
+
+	return t.store.SaveLoginAttempts(ctx, a)
+}
+
+// load - returns attempts of the key. Attempts are reset if the key was quiet long enough,
+// or its lockout is over, so a locked key gets the full set of attempts after the lockout.
+func (t *Throttler) load(ctx context.Context, k throttledKey, now time.Time) (*model.LoginAttempts, error) {
+	a, err := t.store.GetLoginAttempts(ctx, k.key)
+	switch {
+	case errors.Is(err, constant.ErrNotFound):
+		return &model.LoginAttempts{Key: k.key}, nil
+	case err != nil:
+		return nil, err
+	}
+
+	lockoutIsOver := !a.LockedUntil.IsZero() && !now.Before(a.LockedUntil)
+	if lockoutIsOver || now.Sub(a.LastAttemptAt) >= k.policy.ResetAfter {
+		return &model.LoginAttempts{Key: k.key}, nil
+	}
+
+	return a, nil
+}
+
+// wait - how long the key must wait before the next attempt
+func (p Policy) wait(a *model.LoginAttempts, now time.Time) time.Duration {
+	if now.Before(a.LockedUntil) {
+		return a.LockedUntil.Sub(now)
+	}
+
+	if next := a.LastAttemptAt.Add(p.delay(a.Failures)); now.Before(next) {
+		return next.Sub(now)
+	}
+
+	return 0
+}
+
+// cleanup - removes attempts which would be reset anyway, so the store doesn't grow when logins are guessed
+func (t *Throttler) cleanup(ctx context.Context, now time.Time) {
+	if now.Sub(t.lastCleanup) < cleanupInterval {
+		return
+	}
+
+	resetAfter := t.loginPolicy.ResetAfter
+	if t.ipPolicy.ResetAfter > resetAfter {
+		resetAfter = t.ipPolicy.ResetAfter
+	}
+
+	// A failed cleanup is not critical, it will be repeated later
+	if err := t.store.DeleteStaleLoginAttempts(ctx, now.Add(-resetAfter), now); err == nil {
+		t.lastCleanup = now
+	}
+}
+
+// MemoryStore - keeps attempts in memory, they are lost when the application restarts
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]model.LoginAttempts
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: make(map[string]model.LoginAttempts)}
+}
+
+func (s *MemoryStore) GetLoginAttempts(_ context.Context, key string) (*model.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.attempts[key]
+	if !ok {
+		return nil, constant.ErrNotFound
+	}
+
+	return &a, nil
+}
+
+func (s *MemoryStore) SaveLoginAttempts(_ context.Context, attempts *model.LoginAttempts) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts[attempts.Key] = *attempts
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteLoginAttempts(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteStaleLoginAttempts(_ context.Context, before, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, a := range s.attempts {
+		if a.LastAttemptAt.Before(before) && !now.Before(a.LockedUntil) {
+			delete(s.attempts, key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+var testPolicy = Policy{
+	FreeAttempts:     2,
+	BaseDelay:        time.Second,
+	MaxDelay:         5 * time.Second,
+	LockoutThreshold: 5,
+	LockoutDuration:  time.Minute,
+	ResetAfter:       time.Hour,
+}
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestThrottler(store Store) (*Throttler, *clock) {
+	c := &clock{now: time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)}
+	throttler := NewThrottler(store, testPolicy, testPolicy)
+	throttler.now = func() time.Time {
+		return c.now
+	}
+
+	return throttler, c
+}
+
+func TestPolicyDelay(t *testing.T) {
+	delays := make([]time.Duration, 0)
+	for failures := 0; failures < 7; failures++ {
+		delays = append(delays, testPolicy.delay(failures))
+	}
+
+	want := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	require.Equal(t, want, delays)
+}
+
+func TestAttemptBackoffAndLockout(t *testing.T) {
+	ctx := context.Background()
+	throttler, c := newTestThrottler(NewMemoryStore())
+
+	// Free attempts
+	for i := 0; i < testPolicy.FreeAttempts; i++ {
+		_, err := throttler.Attempt(ctx, "user", "192.0.2.1")
+		require.NoError(t, err)
+	}
+
+	wait, err := throttler.Attempt(ctx, "user", "192.0.2.1")
+	require.ErrorIs(t, err, ErrThrottled)
+	require.Equal(t, time.Second, wait)
+
+	// Rejected attempts are not counted, so the delay doesn't grow while the client waits
+	c.advance(time.Second)
+	_, err = throttler.Attempt(ctx, "user", "192.0.2.1")
+	require.NoError(t, err)
+
+	wait, err = throttler.Attempt(ctx, "user", "192.0.2.1")
+	require.ErrorIs(t, err, ErrThrottled)
+	require.Equal(t, 2*time.Second, wait)
+
+	c.advance(2 * time.Second)
+	_, err = throttler.Attempt(ctx, "user", "192.0.2.1")
+	require.NoError(t, err)
+
+	c.advance(4 * time.Second)
+	_, err = throttler.Attempt(ctx, "user", "192.0.2.1")
+	require.NoError(t, err)
+
+	// The fifth failure has locked the login
+	c.advance(5 * time.Second)
+	wait, err = throttler.Attempt(ctx, "user", "198.51.100.1")
+	require.ErrorIs(t, err, ErrThrottled)
+	require.Equal(t, testPolicy.LockoutDuration-5*time.Second, wait)
+
+	// When the lockout is over, the login gets all attempts again
+	c.advance(wait)
+	_, err = throttler.Attempt(ctx, "user", "198.51.100.1")
+	require.NoError(t, err)
+}
+
+func TestAttemptPerIP(t *testing.T) {
+	ctx := context.Background()
+	throttler, _ := newTestThrottler(NewMemoryStore())
+
+	// Different logins are guessed from the same address
+	for _, login := range []string{"alice", "bob"} {
+		_, err := throttler.Attempt(ctx, login, "192.0.2.1")
+		require.NoError(t, err)
+	}
+
+	_, err := throttler.Attempt(ctx, "carol", "192.0.2.1")
+	require.ErrorIs(t, err, ErrThrottled)
+
+	_, err = throttler.Attempt(ctx, "carol", "198.51.100.1")
+	require.NoError(t, err)
+}
+
+func TestSucceed(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	throttler, _ := newTestThrottler(store)
+
+	for i := 0; i < testPolicy.FreeAttempts; i++ {
+		_, err := throttler.Attempt(ctx, "user", "192.0.2.1")
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, throttler.Succeed(ctx, "user", "192.0.2.1"))
+
+	_, err := store.GetLoginAttempts(ctx, keyPrefixLogin+"user")
+	require.Error(t, err)
+
+	ipAttempts, err := store.GetLoginAttempts(ctx, keyPrefixIP+"192.0.2.1")
+	require.NoError(t, err)
+	require.Equal(t, testPolicy.FreeAttempts-1, ipAttempts.Failures)
+}
+
+func TestAttemptsAreForgotten(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	throttler, c := newTestThrottler(store)
+
+	for i := 0; i < testPolicy.FreeAttempts; i++ {
+		_, err := throttler.Attempt(ctx, "user", "192.0.2.1")
+		require.NoError(t, err)
+	}
+
+	c.advance(testPolicy.ResetAfter + time.Second)
+	_, err := throttler.Attempt(ctx, "other", "198.51.100.1")
+	require.NoError(t, err)
+
+	// Stale attempts are removed by the cleanup
+	_, err = store.GetLoginAttempts(ctx, keyPrefixLogin+"user")
+	require.Error(t, err)
+
+	attempts, err := store.GetLoginAttempts(ctx, keyPrefixLogin+"other")
+	require.NoError(t, err)
+	require.Equal(t, 1, attempts.Failures)
+}
+
+type failingStore struct {
+	*MemoryStore
+}
+
+func (failingStore) SaveLoginAttempts(ctx context.Context, attempts *model.LoginAttempts) error {
+	return errors.New("database is locked")
+}
+
+func TestAttemptStoreError(t *testing.T) {
+	throttler, _ := newTestThrottler(failingStore{NewMemoryStore()})
+
+	_, err := throttler.Attempt(context.Background(), "user", "192.0.2.1")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrThrottled)
+}
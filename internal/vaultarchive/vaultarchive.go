@@ -0,0 +1,368 @@
+// Package vaultarchive reads and writes password-protected vault archives.
+//
+// An archive consists of a plain text header and an encrypted body:
+//
+//	magic "KMSX" | version (1 byte) | header length (big endian uint32) | header JSON | ciphertext
+//
+// The header describes how the archive key is derived from the archive password:
+//
+//	{"kdf":"argon2id","salt":"<base64>","time":3,"memory":65536,"threads":4,"nonce":"<base64>"}
+//
+// The body is a zip file encrypted with AES-256-GCM. Everything which precedes the ciphertext is used
+// as additional authenticated data, so the header cannot be modified without breaking decryption.
+// The zip file contains "manifest.json" with secrets and their metadata, file attachments are stored
+// as separate entries under "files/" and referenced from the manifest by their path.
+package vaultarchive
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+const (
+	magic   = "KMSX"
+	version = 1
+	kdfName = "argon2id"
+
+	manifestName = "manifest.json"
+	filesDir     = "files/"
+
+	keyLength  = 32 // AES-256
+	saltLength = 16
+	// maxHeaderLength, maxTime, maxMemory and maxThreads protect the server from archives
+	// which would take too much time or memory to open
+	maxHeaderLength = 4096
+	maxTime         = 10
+	maxMemory       = 256 * 1024 // in KiB
+	maxThreads      = 16
+	// maxEntrySize - maximum size of a single unpacked zip entry
+	maxEntrySize = 64 * 1024 * 1024
+)
+
+var (
+	ErrInvalidArchive     = errors.New("invalid vault archive")
+	ErrUnsupportedVersion = errors.New("unsupported vault archive version")
+	// ErrWrongPassword - the archive cannot be decrypted, either the password is wrong or the archive is damaged
+	ErrWrongPassword = errors.New("wrong archive password or damaged archive")
+)
+
+// Params - parameters of argon2id key derivation function
+type Params struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"` // in KiB
+	Threads uint8  `json:"threads"`
+}
+
+// DefaultParams - key derivation parameters which are used for new archives
+var DefaultParams = Params{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+type header struct {
+	KDF   string `json:"kdf"`
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Params
+}
+
+// manifest - list of archived secrets
+type manifest struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Items      []*item   `json:"items"`
+}
+
+// item - an archived secret. All values are stored in plain text, the archive is encrypted as a whole.
+type item struct {
+	Type           string     `json:"type"`
+	Title          string     `json:"title"`
+	Login          string     `json:"login,omitempty"`
+	Password       string     `json:"password,omitempty"`
+	Note           string     `json:"note,omitempty"`
+	FileName       string     `json:"file_name,omitempty"`
+	CardholderName string     `json:"cardholder_name,omitempty"`
+	CardNumber     string     `json:"card_number,omitempty"`
+	Expiration     string     `json:"expiration,omitempty"`
+	SecurityCode   string     `json:"security_code,omitempty"`
+	URL            string     `json:"url,omitempty"`
+	Favorite       bool       `json:"favorite,omitempty"`
+	CreatedAt      *time.Time `json:"created_at,omitempty"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	RotateEvery    int        `json:"rotate_every,omitempty"`
+	// File - path of the attachment inside the archive
+	File string `json:"file,omitempty"`
+}
+
+func newItem(secret *model.Secret) *item {
+	return &item{
+		Type:           secret.Type,
+		Title:          secret.Title,
+		Login:          secret.Login,
+		Password:       secret.Password,
+		Note:           secret.Note,
+		FileName:       secret.FileName,
+		CardholderName: secret.CardholderName,
+		CardNumber:     secret.CardNumber,
+		Expiration:     secret.Expiration,
+		SecurityCode:   secret.SecurityCode,
+		URL:            secret.URL,
+		Favorite:       secret.Favorite,
+		CreatedAt:      secret.CreatedAt,
+		UpdatedAt:      secret.UpdatedAt,
+		ExpiresAt:      secret.ExpiresAt,
+		RotateEvery:    secret.RotateEvery,
+	}
+}
+
+// secret - converts the item to a new secret, which doesn't have an identifier yet
+func (i *item) secret(file []byte) *model.Secret {
+	return &model.Secret{
+		Type:           i.Type,
+		Title:          i.Title,
+		Login:          i.Login,
+		Password:       i.Password,
+		Note:           i.Note,
+		File:           file,
+		FileName:       i.FileName,
+		CardholderName: i.CardholderName,
+		CardNumber:     i.CardNumber,
+		Expiration:     i.Expiration,
+		SecurityCode:   i.SecurityCode,
+		URL:            i.URL,
+		Favorite:       i.Favorite,
+		CreatedAt:      i.CreatedAt,
+		UpdatedAt:      i.UpdatedAt,
+		ExpiresAt:      i.ExpiresAt,
+		RotateEvery:    i.RotateEvery,
+	}
+}
+
+func deriveKey(password string, h header) []byte {
+	return argon2.IDKey([]byte(password), h.Salt, h.Time, h.Memory, h.Threads, keyLength)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Write - writes decrypted secrets into an archive protected with the password
+func Write(w io.Writer, secrets []*model.Secret, password string, params Params) error {
+	if password == "" {
+		return errors.New("archive password is required")
+	}
+
+	body, err := pack(secrets)
+	if err != nil {
+		return err
+	}
+
+	h := header{KDF: kdfName, Salt: make([]byte, saltLength), Params: params}
+	if _, err = rand.Read(h.Salt); err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(deriveKey(password, h))
+	if err != nil {
+		return err
+	}
+
+	h.Nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(h.Nonce); err != nil {
+		return err
+	}
+
+	headerJSON, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	prefix := bytes.NewBufferString(magic)
+	prefix.WriteByte(version)
+	_ = binary.Write(prefix, binary.BigEndian, uint32(len(headerJSON)))
+	prefix.Write(headerJSON)
+
+	if _, err = w.Write(prefix.Bytes()); err != nil {
+		return err
+	}
+
+	_, err = w.Write(gcm.Seal(nil, h.Nonce, body, prefix.Bytes()))
+
+	return err
+}
+
+// pack - creates a zip file with the manifest and file attachments
+func pack(secrets []*model.Secret) ([]byte, error) {
+	archived := manifest{Version: version, ExportedAt: time.Now().UTC(), Items: make([]*item, 0, len(secrets))}
+	buf := bytes.Buffer{}
+	zw := zip.NewWriter(&buf)
+
+	for i, secret := range secrets {
+		archivedItem := newItem(secret)
+		if len(secret.File) > 0 {
+			archivedItem.File = fmt.Sprintf("%s%d", filesDir, i+1)
+
+			fw, err := zw.Create(archivedItem.File)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, err = fw.Write(secret.File); err != nil {
+				return nil, err
+			}
+		}
+
+		archived.Items = append(archived.Items, archivedItem)
+	}
+
+	fw, err := zw.Create(manifestName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.NewEncoder(fw).Encode(archived); err != nil {
+		return nil, err
+	}
+
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Read - decrypts an archive and returns the secrets which it contains
+func Read(r io.Reader, password string) ([]*model.Secret, error) {
+	prefix := make([]byte, len(magic)+1+4)
+	if _, err := io.ReadFull(r, prefix); err != nil || string(prefix[:len(magic)]) != magic {
+		return nil, ErrInvalidArchive
+	}
+
+	if prefix[len(magic)] != version {
+		return nil, ErrUnsupportedVersion
+	}
+
+	headerLength := binary.BigEndian.Uint32(prefix[len(magic)+1:])
+	if headerLength > maxHeaderLength {
+		return nil, ErrInvalidArchive
+	}
+
+	headerJSON := make([]byte, headerLength)
+	if _, err := io.ReadFull(r, headerJSON); err != nil {
+		return nil, ErrInvalidArchive
+	}
+
+	var h header
+	if err := json.Unmarshal(headerJSON, &h); err != nil || !h.isValid() {
+		return nil, ErrInvalidArchive
+	}
+
+	ciphertext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(deriveKey(password, h))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(h.Nonce) != gcm.NonceSize() {
+		return nil, ErrInvalidArchive
+	}
+
+	body, err := gcm.Open(nil, h.Nonce, ciphertext, append(prefix, headerJSON...))
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+
+	return unpack(body)
+}
+
+func (h header) isValid() bool {
+	return h.KDF == kdfName && len(h.Salt) > 0 &&
+		h.Time > 0 && h.Time <= maxTime &&
+		h.Memory > 0 && h.Memory <= maxMemory &&
+		h.Threads > 0 && h.Threads <= maxThreads
+}
+
+func unpack(body []byte) ([]*model.Secret, error) {
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+
+	entries := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+
+	manifestFile, ok := entries[manifestName]
+	if !ok {
+		return nil, ErrInvalidArchive
+	}
+
+	manifestJSON, err := readEntry(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var archived manifest
+	if err = json.Unmarshal(manifestJSON, &archived); err != nil {
+		return nil, ErrInvalidArchive
+	}
+
+	secrets := make([]*model.Secret, 0, len(archived.Items))
+	for _, archivedItem := range archived.Items {
+		var file []byte
+		if archivedItem.File != "" {
+			entry, found := entries[archivedItem.File]
+			if !found {
+				return nil, ErrInvalidArchive
+			}
+
+			if file, err = readEntry(entry); err != nil {
+				return nil, err
+			}
+		}
+
+		secrets = append(secrets, archivedItem.secret(file))
+	}
+
+	return secrets, nil
+}
+
+func readEntry(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > maxEntrySize {
+		return nil, ErrInvalidArchive
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxEntrySize+1))
+	if err != nil || len(data) > maxEntrySize {
+		return nil, ErrInvalidArchive
+	}
+
+	return data, nil
+}
@@ -0,0 +1,128 @@
+package vaultarchive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/model"
+)
+
+// testParams - weak key derivation parameters, which keep the tests fast
+var testParams = Params{Time: 1, Memory: 1024, Threads: 1}
+
+func testSecrets() []*model.Secret {
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return []*model.Secret{
+		{
+			ID:          10,
+			Type:        model.SecretTypePassword,
+			Title:       "mail",
+			Login:       "tony",
+			Password:    "secret",
+			URL:         "https://mail.example.com",
+			Favorite:    true,
+			ExpiresAt:   &expiresAt,
+			RotateEvery: 90,
+		},
+		{
+			ID:       11,
+			Type:     model.SecretTypeFile,
+			Title:    "passport",
+			File:     []byte{0, 1, 2, 3},
+			FileName: "passport.jpg",
+		},
+		{
+			ID:             12,
+			Type:           model.SecretTypeCard,
+			Title:          "visa",
+			CardholderName: "TONY TESTER",
+			CardNumber:     "4111111111111111",
+			Expiration:     "12/30",
+			SecurityCode:   "123",
+		},
+	}
+}
+
+func writeArchive(t *testing.T, password string) []byte {
+	t.Helper()
+
+	buf := bytes.Buffer{}
+	require.NoError(t, Write(&buf, testSecrets(), password, testParams))
+
+	return buf.Bytes()
+}
+
+func TestWriteRead(t *testing.T) {
+	archive := writeArchive(t, "archive password")
+	require.Equal(t, magic, string(archive[:len(magic)]))
+	require.NotContains(t, string(archive), "4111111111111111")
+
+	secrets, err := Read(bytes.NewReader(archive), "archive password")
+	require.NoError(t, err)
+	require.Len(t, secrets, 3)
+
+	for i, want := range testSecrets() {
+		// Identifiers are not archived, imported secrets get new ones
+		want.ID = 0
+		require.Equal(t, want, secrets[i])
+	}
+}
+
+func TestReadWrongPassword(t *testing.T) {
+	archive := writeArchive(t, "archive password")
+
+	_, err := Read(bytes.NewReader(archive), "wrong password")
+	require.ErrorIs(t, err, ErrWrongPassword)
+}
+
+func TestReadModifiedHeader(t *testing.T) {
+	archive := writeArchive(t, "archive password")
+
+	// Header is authenticated, so even a change which keeps it valid breaks decryption
+	modified := bytes.Replace(archive, []byte(`"time":1`), []byte(`"time":2`), 1)
+	require.NotEqual(t, archive, modified)
+
+	_, err := Read(bytes.NewReader(modified), "archive password")
+	require.ErrorIs(t, err, ErrWrongPassword)
+}
+
+func TestReadInvalidArchive(t *testing.T) {
+	archive := writeArchive(t, "archive password")
+
+	unsupported := append([]byte{}, archive...)
+	unsupported[len(magic)] = version + 1
+
+	expensive := bytes.Replace(archive, []byte(`"memory":1024`), []byte(`"memory":9999999`), 1)
+	headerLength := binary.BigEndian.Uint32(archive[len(magic)+1:])
+	binary.BigEndian.PutUint32(expensive[len(magic)+1:], headerLength+3)
+
+	tests := []struct {
+		name    string
+		archive []byte
+		wantErr error
+	}{
+		{name: "empty", archive: []byte{}, wantErr: ErrInvalidArchive},
+		{name: "wrong magic", archive: []byte("KMSB\x01\x00\x00\x00\x00"), wantErr: ErrInvalidArchive},
+		{name: "unsupported version", archive: unsupported, wantErr: ErrUnsupportedVersion},
+		{name: "truncated header", archive: archive[:len(magic)+10], wantErr: ErrInvalidArchive},
+		{name: "too expensive key derivation", archive: expensive, wantErr: ErrInvalidArchive},
+		{name: "truncated body", archive: archive[:len(archive)-1], wantErr: ErrWrongPassword},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(bytes.NewReader(tt.archive), "archive password")
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestWriteRequiresPassword(t *testing.T) {
+	err := Write(&bytes.Buffer{}, testSecrets(), "", testParams)
+	require.Error(t, err)
+}
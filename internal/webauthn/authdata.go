@@ -0,0 +1,100 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Flags of authenticator data
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+	flagExtensionData          = 0x80
+)
+
+const (
+	rpIDHashLength = 32
+	aaguidLength   = 16
+	// maxCredentialIDLength - longer identifiers are rejected, see WebAuthn Level 3, 5.1
+	maxCredentialIDLength = 1023
+	// minAuthenticatorDataLength - RP ID hash, flags and signature counter
+	minAuthenticatorDataLength = rpIDHashLength + 1 + 4
+)
+
+var errInvalidAuthenticatorData = errors.New("invalid authenticator data")
+
+// authenticatorData - data which is signed by the authenticator, see WebAuthn Level 3, 6.1
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	// Attested credential data, which is present only when a credential is created
+	aaguid       []byte
+	credentialID []byte
+	publicKey    *publicKey
+	// rawPublicKey - the public key in COSE_Key format, as it's stored
+	rawPublicKey []byte
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < minAuthenticatorDataLength {
+		return nil, errInvalidAuthenticatorData
+	}
+
+	authData := &authenticatorData{
+		rpIDHash:  data[:rpIDHashLength],
+		flags:     data[rpIDHashLength],
+		signCount: binary.BigEndian.Uint32(data[rpIDHashLength+1:]),
+	}
+	rest := data[minAuthenticatorDataLength:]
+
+	if authData.hasFlag(flagAttestedCredentialData) {
+		if len(rest) < aaguidLength+2 {
+			return nil, errInvalidAuthenticatorData
+		}
+
+		authData.aaguid = rest[:aaguidLength]
+		idLength := int(binary.BigEndian.Uint16(rest[aaguidLength:]))
+		rest = rest[aaguidLength+2:]
+		if idLength == 0 || idLength > maxCredentialIDLength || idLength > len(rest) {
+			return nil, errInvalidAuthenticatorData
+		}
+
+		authData.credentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		key, keyRest, err := parsePublicKey(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		authData.publicKey = key
+		authData.rawPublicKey = rest[:len(rest)-len(keyRest)]
+		rest = keyRest
+	}
+
+	// Extensions are not used, but they must be well-formed
+	if authData.hasFlag(flagExtensionData) {
+		extensions, extensionsRest, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := extensions.(map[any]any); !ok {
+			return nil, errInvalidAuthenticatorData
+		}
+
+		rest = extensionsRest
+	}
+
+	if len(rest) > 0 {
+		return nil, errInvalidAuthenticatorData
+	}
+
+	return authData, nil
+}
+
+func (a *authenticatorData) hasFlag(flag byte) bool {
+	return a.flags&flag != 0
+}
@@ -0,0 +1,148 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// CBOR major types, see RFC 8949
+const (
+	cborUnsigned = 0
+	cborNegative = 1
+	cborBytes    = 2
+	cborText     = 3
+	cborArray    = 4
+	cborMap      = 5
+	cborSimple   = 7
+)
+
+// maxCBORDepth - authenticator data contains only a few levels of nesting, deeper data is rejected
+// so a client can't exhaust the stack of the server
+const maxCBORDepth = 8
+
+var errInvalidCBOR = errors.New("invalid CBOR")
+
+// decodeCBOR - decodes a single CBOR item and returns the remaining data. This is the subset of CBOR
+// which is used by authenticators: integers, byte and text strings, arrays, maps, booleans and null.
+// Integers are returned as int64, maps as map[any]any with int64 or string keys.
+func decodeCBOR(data []byte) (any, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (any, []byte, error) {
+	if depth > maxCBORDepth || len(data) == 0 {
+		return nil, nil, errInvalidCBOR
+	}
+
+	major, info := data[0]>>5, data[0]&0x1f
+	if major == cborSimple {
+		switch info {
+		case 20:
+			return false, data[1:], nil
+		case 21:
+			return true, data[1:], nil
+		case 22:
+			return nil, data[1:], nil
+		default:
+			return nil, nil, errInvalidCBOR
+		}
+	}
+
+	value, data, err := decodeCBORArgument(info, data[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case cborUnsigned:
+		if value > 1<<63-1 {
+			return nil, nil, errInvalidCBOR
+		}
+
+		return int64(value), data, nil
+	case cborNegative:
+		if value > 1<<63-1 {
+			return nil, nil, errInvalidCBOR
+		}
+
+		return -1 - int64(value), data, nil
+	case cborBytes, cborText:
+		if value > uint64(len(data)) {
+			return nil, nil, errInvalidCBOR
+		}
+
+		if major == cborText {
+			return string(data[:value]), data[value:], nil
+		}
+
+		return append([]byte{}, data[:value]...), data[value:], nil
+	case cborArray:
+		// Every item takes at least one byte, this check doesn't let a short input allocate a huge array
+		if value > uint64(len(data)) {
+			return nil, nil, errInvalidCBOR
+		}
+
+		items := make([]any, 0, value)
+		for i := uint64(0); i < value; i++ {
+			var item any
+			if item, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+
+			items = append(items, item)
+		}
+
+		return items, data, nil
+	case cborMap:
+		if value > uint64(len(data))/2 {
+			return nil, nil, errInvalidCBOR
+		}
+
+		items := make(map[any]any, value)
+		for i := uint64(0); i < value; i++ {
+			var key, item any
+			if key, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errInvalidCBOR
+			}
+
+			if _, ok := items[key]; ok {
+				return nil, nil, errInvalidCBOR
+			}
+
+			if item, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+
+			items[key] = item
+		}
+
+		return items, data, nil
+	default:
+		// Tags and floating point numbers are not used by authenticators
+		return nil, nil, errInvalidCBOR
+	}
+}
+
+// decodeCBORArgument - reads the argument of an item, indefinite lengths are not supported
+func decodeCBORArgument(info byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24 && len(data) >= 1:
+		return uint64(data[0]), data[1:], nil
+	case info == 25 && len(data) >= 2:
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26 && len(data) >= 4:
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27 && len(data) >= 8:
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	default:
+		return 0, nil, errInvalidCBOR
+	}
+}
@@ -0,0 +1,129 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// COSE algorithms of credential keys, see https://www.iana.org/assignments/cose
+const (
+	AlgorithmES256 = -7
+	AlgorithmEdDSA = -8
+	AlgorithmRS256 = -257
+)
+
+// supportedAlgorithms - algorithms in the order of preference, they are offered to authenticators
+// when a credential is created
+var supportedAlgorithms = []int64{AlgorithmES256, AlgorithmEdDSA, AlgorithmRS256}
+
+// COSE key parameters, see RFC 9053
+const (
+	coseKeyType   = 1
+	coseAlgorithm = 3
+	coseCurve     = -1
+	coseX         = -2
+	coseY         = -3
+	coseRSAN      = -1
+	coseRSAE      = -2
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+// minRSAKeySize - credentials with shorter RSA keys are rejected
+const minRSAKeySize = 2048
+
+var errInvalidKey = errors.New("invalid or unsupported credential public key")
+
+// publicKey - public key of a credential, which verifies signatures of assertions
+type publicKey struct {
+	algorithm int64
+	key       crypto.PublicKey
+}
+
+// parsePublicKey - reads a public key in COSE_Key format. Returns the key and the remaining data,
+// because in authenticator data the key is followed by extensions.
+func parsePublicKey(data []byte) (*publicKey, []byte, error) {
+	item, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params, ok := item.(map[any]any)
+	if !ok {
+		return nil, nil, errInvalidKey
+	}
+
+	keyType, _ := params[int64(coseKeyType)].(int64)
+	algorithm, _ := params[int64(coseAlgorithm)].(int64)
+	key := &publicKey{algorithm: algorithm}
+
+	switch {
+	case keyType == coseKeyTypeEC2 && algorithm == AlgorithmES256:
+		curve, _ := params[int64(coseCurve)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		y, _ := params[int64(coseY)].([]byte)
+		if curve != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, nil, errInvalidKey
+		}
+
+		ecKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !ecKey.Curve.IsOnCurve(ecKey.X, ecKey.Y) {
+			return nil, nil, errInvalidKey
+		}
+
+		key.key = ecKey
+	case keyType == coseKeyTypeOKP && algorithm == AlgorithmEdDSA:
+		curve, _ := params[int64(coseCurve)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		if curve != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, nil, errInvalidKey
+		}
+
+		key.key = ed25519.PublicKey(x)
+	case keyType == coseKeyTypeRSA && algorithm == AlgorithmRS256:
+		n, _ := params[int64(coseRSAN)].([]byte)
+		e, _ := params[int64(coseRSAE)].([]byte)
+		rsaKey := &rsa.PublicKey{N: new(big.Int).SetBytes(n)}
+		exponent := new(big.Int).SetBytes(e)
+		if rsaKey.N.BitLen() < minRSAKeySize || !exponent.IsInt64() || exponent.Int64() < 3 ||
+			exponent.Int64() > 1<<31-1 {
+			return nil, nil, errInvalidKey
+		}
+
+		rsaKey.E = int(exponent.Int64())
+		key.key = rsaKey
+	default:
+		return nil, nil, errInvalidKey
+	}
+
+	return key, rest, nil
+}
+
+// verify - checks the signature of the data with the algorithm of the key
+func (k *publicKey) verify(data, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	default:
+		return false
+	}
+}
@@ -0,0 +1,106 @@
+package webauthn
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+)
+
+// maxPendingSessions - ceremonies can be started by anyone, so the number of sessions
+// which are waiting for the authenticator is limited
+const maxPendingSessions = 10000
+
+var ErrTooManySessions = errors.New("too many pending WebAuthn ceremonies")
+
+// Session - state of a ceremony between the options and the response of the authenticator.
+// Sessions are never stored outside the memory of the server.
+type Session struct {
+	// ID - identifies the session, the client sends it back with the response of the authenticator
+	ID        string
+	Challenge []byte
+	// Login - the user who has started the ceremony, empty when the user is identified by the credential
+	Login      string
+	UserHandle []byte
+	// UserVerification - "required" if the authenticator must verify the user, for instance with PIN or biometrics
+	UserVerification string
+	// AllowedCredentials - the response must be signed with one of these credentials, any credential
+	// is accepted if the list is empty
+	AllowedCredentials [][]byte
+	// DataKey - the data key of a user who has passed the password check, it's kept until the user
+	// confirms the login with the second factor
+	DataKey   string
+	ExpiresAt time.Time
+}
+
+func newSession(lifetime time.Duration) (*Session, error) {
+	id := make([]byte, 32)
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		Challenge: challenge,
+		ExpiresAt: time.Now().Add(lifetime),
+	}, nil
+}
+
+// SessionStore - keeps sessions until the client sends the response of the authenticator.
+// Every session can be taken only once, so a response cannot be replayed.
+type SessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+func NewSessionStore() *SessionStore {
+	return &SessionStore{sessions: make(map[string]*Session)}
+}
+
+// Save - adds the session. Expired sessions are removed when the store is full.
+func (s *SessionStore) Save(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.sessions) >= maxPendingSessions {
+		now := time.Now()
+		for id, saved := range s.sessions {
+			if now.After(saved.ExpiresAt) {
+				delete(s.sessions, id)
+			}
+		}
+	}
+
+	if len(s.sessions) >= maxPendingSessions {
+		return ErrTooManySessions
+	}
+
+	s.sessions[session.ID] = session
+
+	return nil
+}
+
+// Take - removes the session and returns it, if it's not expired
+func (s *SessionStore) Take(id string) (*Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, false
+	}
+
+	delete(s.sessions, id)
+
+	if time.Now().After(session.ExpiresAt) {
+		return nil, false
+	}
+
+	return session, true
+}
@@ -0,0 +1,471 @@
+// Package webauthn implements the relying party of W3C Web Authentication: registration of passkeys
+// and security keys, and authentication with them. Options and responses use JSON serialization of
+// the browser API, where binary values are base64url encoded, see PublicKeyCredential.parseCreationOptionsFromJSON
+// and PublicKeyCredential.toJSON. Attestation is neither requested nor verified, because the server
+// doesn't restrict which authenticators may be used.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/grafviktor/keep-my-secret/internal/config"
+)
+
+// User verification requirements
+const (
+	UserVerificationRequired    = "required"
+	UserVerificationPreferred   = "preferred"
+	UserVerificationDiscouraged = "discouraged"
+)
+
+// CeremonyTimeout - how long the user may take to confirm the ceremony with the authenticator
+const CeremonyTimeout = 5 * time.Minute
+
+const (
+	credentialType = "public-key"
+
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+)
+
+// prfSalt - input of PRF extension. The output is unique for every credential anyway,
+// so the same salt is used for all of them, which allows to evaluate PRF when the user is not known yet.
+var prfSalt = sha256.Sum256([]byte("keep-my-secret data key"))
+
+var (
+	ErrNotConfigured = errors.New("WebAuthn is not configured")
+	// ErrVerificationFailed - the response of the authenticator is invalid, or doesn't match the session
+	ErrVerificationFailed = errors.New("WebAuthn verification failed")
+	// ErrClonedAuthenticator - the signature counter didn't increase, so the credential might have been
+	// copied from the authenticator
+	ErrClonedAuthenticator = errors.New("signature counter of the authenticator didn't increase")
+)
+
+// Bytes - binary value which is base64url encoded in JSON. Padding is accepted, but never produced.
+type Bytes []byte
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return err
+	}
+
+	*b = decoded
+
+	return nil
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          Bytes  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type      string `json:"type"`
+	Algorithm int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   Bytes  `json:"id"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// Extensions - only PRF extension is used. Its output is a secret of the credential, which unwraps
+// the data key during passwordless login.
+type Extensions struct {
+	PRF *PRFInputs `json:"prf,omitempty"`
+}
+
+type PRFInputs struct {
+	Eval PRFValues `json:"eval"`
+}
+
+type PRFValues struct {
+	First Bytes `json:"first"`
+}
+
+// CreationOptions - options of navigator.credentials.create()
+type CreationOptions struct {
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              Bytes                  `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+	Extensions             Extensions             `json:"extensions"`
+}
+
+// RequestOptions - options of navigator.credentials.get()
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+	Extensions       Extensions             `json:"extensions"`
+}
+
+// Response - PublicKeyCredential which is returned by the authenticator, either from create() or get()
+type Response struct {
+	ID                     string                `json:"id"`
+	RawID                  Bytes                 `json:"rawId"`
+	Type                   string                `json:"type"`
+	Response               AuthenticatorResponse `json:"response"`
+	ClientExtensionResults ExtensionResults      `json:"clientExtensionResults"`
+}
+
+type AuthenticatorResponse struct {
+	ClientDataJSON Bytes `json:"clientDataJSON"`
+	// AttestationObject - set only when a credential is created
+	AttestationObject Bytes `json:"attestationObject,omitempty"`
+	// AuthenticatorData, Signature and UserHandle - set only by authentication
+	AuthenticatorData Bytes `json:"authenticatorData,omitempty"`
+	Signature         Bytes `json:"signature,omitempty"`
+	UserHandle        Bytes `json:"userHandle,omitempty"`
+}
+
+type ExtensionResults struct {
+	PRF *PRFOutputs `json:"prf,omitempty"`
+}
+
+type PRFOutputs struct {
+	Enabled bool       `json:"enabled,omitempty"`
+	Results *PRFValues `json:"results,omitempty"`
+}
+
+// prf - output of PRF extension, nil if the authenticator hasn't evaluated it. Authenticators
+// return different output when they don't verify the user (see hmac-secret extension of CTAP2), so only
+// the output which is evaluated with user verification is used, otherwise it would change from login to login.
+func (r *Response) prf(authData *authenticatorData) []byte {
+	if !authData.hasFlag(flagUserVerified) {
+		return nil
+	}
+
+	if r.ClientExtensionResults.PRF == nil || r.ClientExtensionResults.PRF.Results == nil {
+		return nil
+	}
+
+	return r.ClientExtensionResults.PRF.Results.First
+}
+
+// Credential - a registered credential of a user
+type Credential struct {
+	ID []byte
+	// PublicKey - COSE_Key which verifies signatures of the authenticator
+	PublicKey  []byte
+	SignCount  uint32
+	AAGUID     []byte
+	UserHandle []byte
+	// PRF - output of PRF extension, if the authenticator has evaluated it with user verification during
+	// registration
+	PRF []byte
+}
+
+// Assertion - result of successful authentication
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+	// PRF - output of PRF extension, if the authenticator has evaluated it with user verification
+	PRF []byte
+}
+
+// RelyingParty - the server which registers credentials and verifies authentication
+type RelyingParty struct {
+	id     string
+	name   string
+	origin string
+}
+
+// New - creates the relying party. Returns ErrNotConfigured if WebAuthn is disabled.
+func New(appConfig config.AppConfig) (*RelyingParty, error) {
+	if appConfig.WebAuthnRPID == "" {
+		return nil, ErrNotConfigured
+	}
+
+	origin := appConfig.WebAuthnOrigin
+	if origin == "" {
+		origin = "https://" + appConfig.WebAuthnRPID
+	}
+
+	// Browsers accept the RP ID only if it's the domain of the origin or its parent domain
+	originURL, err := url.Parse(origin)
+	if err != nil || originURL.Host == "" || originURL.Path != "" {
+		return nil, fmt.Errorf("invalid WebAuthn origin '%s'", origin)
+	}
+
+	host := originURL.Hostname()
+	if host != appConfig.WebAuthnRPID && !strings.HasSuffix(host, "."+appConfig.WebAuthnRPID) {
+		return nil, fmt.Errorf("WebAuthn RP ID '%s' is not a domain of origin '%s'", appConfig.WebAuthnRPID, origin)
+	}
+
+	if originURL.Scheme != "https" && !(originURL.Scheme == "http" && host == "localhost") {
+		return nil, fmt.Errorf("WebAuthn origin '%s' must use https", origin)
+	}
+
+	return &RelyingParty{
+		id:     appConfig.WebAuthnRPID,
+		name:   appConfig.WebAuthnRPName,
+		origin: originURL.Scheme + "://" + originURL.Host,
+	}, nil
+}
+
+// BeginRegistration - returns options which create a new credential of the user. The user handle must be
+// the same for all credentials of the user, existing credentials are excluded, so an authenticator
+// is never registered twice.
+func (rp *RelyingParty) BeginRegistration(
+	login string,
+	userHandle []byte,
+	exclude [][]byte,
+) (*CreationOptions, *Session, error) {
+	session, err := newSession(CeremonyTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session.Login = login
+	session.UserHandle = userHandle
+	session.UserVerification = UserVerificationPreferred
+
+	parameters := make([]CredentialParameter, 0, len(supportedAlgorithms))
+	for _, algorithm := range supportedAlgorithms {
+		parameters = append(parameters, CredentialParameter{Type: credentialType, Algorithm: algorithm})
+	}
+
+	return &CreationOptions{
+		RP:                 RelyingPartyEntity{ID: rp.id, Name: rp.name},
+		User:               UserEntity{ID: userHandle, Name: login, DisplayName: login},
+		Challenge:          session.Challenge,
+		PubKeyCredParams:   parameters,
+		Timeout:            CeremonyTimeout.Milliseconds(),
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: AuthenticatorSelection{
+			// Discoverable credentials allow to sign in without entering the login
+			ResidentKey:      "preferred",
+			UserVerification: session.UserVerification,
+		},
+		Attestation: "none",
+		Extensions:  Extensions{PRF: &PRFInputs{Eval: PRFValues{First: prfSalt[:]}}},
+	}, session, nil
+}
+
+// FinishRegistration - verifies the response of the authenticator and returns the new credential
+func (rp *RelyingParty) FinishRegistration(session *Session, response *Response) (*Credential, error) {
+	if err := rp.verifyClientData(session, response, ceremonyCreate); err != nil {
+		return nil, err
+	}
+
+	attestation, _, err := decodeCBOR(response.Response.AttestationObject)
+	if err != nil {
+		return nil, verificationError("invalid attestation object")
+	}
+
+	attestationObject, _ := attestation.(map[any]any)
+	rawAuthData, _ := attestationObject["authData"].([]byte)
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, verificationError(err.Error())
+	}
+
+	if err = rp.verifyAuthenticatorData(session, authData); err != nil {
+		return nil, err
+	}
+
+	if !authData.hasFlag(flagAttestedCredentialData) || !bytes.Equal(authData.credentialID, response.RawID) {
+		return nil, verificationError("credential is missing")
+	}
+
+	return &Credential{
+		ID:         authData.credentialID,
+		PublicKey:  authData.rawPublicKey,
+		SignCount:  authData.signCount,
+		AAGUID:     authData.aaguid,
+		UserHandle: session.UserHandle,
+		PRF:        response.prf(authData),
+	}, nil
+}
+
+// BeginLogin - returns options which authenticate with one of the allowed credentials. If the list is empty,
+// the user chooses one of discoverable credentials, which identifies the user.
+func (rp *RelyingParty) BeginLogin(
+	login string,
+	allowed [][]byte,
+	userVerification string,
+) (*RequestOptions, *Session, error) {
+	session, err := newSession(CeremonyTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session.Login = login
+	session.AllowedCredentials = allowed
+	session.UserVerification = userVerification
+
+	return &RequestOptions{
+		Challenge:        session.Challenge,
+		Timeout:          CeremonyTimeout.Milliseconds(),
+		RPID:             rp.id,
+		AllowCredentials: descriptors(allowed),
+		UserVerification: userVerification,
+		Extensions:       Extensions{PRF: &PRFInputs{Eval: PRFValues{First: prfSalt[:]}}},
+	}, session, nil
+}
+
+// FinishLogin - verifies the signature of the credential, which was found by the identifier of the response.
+// The returned signature counter must be saved.
+func (rp *RelyingParty) FinishLogin(session *Session, credential *Credential, response *Response) (*Assertion, error) {
+	if !bytes.Equal(credential.ID, response.RawID) {
+		return nil, verificationError("unknown credential")
+	}
+
+	if len(session.AllowedCredentials) > 0 && !containsID(session.AllowedCredentials, credential.ID) {
+		return nil, verificationError("credential is not allowed")
+	}
+
+	// Discoverable credentials always return the user handle, it must belong to the owner of the credential
+	userHandle := response.Response.UserHandle
+	if (len(session.AllowedCredentials) == 0 && len(userHandle) == 0) ||
+		(len(userHandle) > 0 && !bytes.Equal(userHandle, credential.UserHandle)) {
+		return nil, verificationError("user handle doesn't match the credential")
+	}
+
+	if err := rp.verifyClientData(session, response, ceremonyGet); err != nil {
+		return nil, err
+	}
+
+	authData, err := parseAuthenticatorData(response.Response.AuthenticatorData)
+	if err != nil {
+		return nil, verificationError(err.Error())
+	}
+
+	if err = rp.verifyAuthenticatorData(session, authData); err != nil {
+		return nil, err
+	}
+
+	key, _, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(response.Response.ClientDataJSON)
+	signed := append(append([]byte{}, response.Response.AuthenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, response.Response.Signature) {
+		return nil, verificationError("invalid signature")
+	}
+
+	// Authenticators which don't count signatures always return zero
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return nil, ErrClonedAuthenticator
+	}
+
+	return &Assertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.hasFlag(flagUserVerified),
+		PRF:          response.prf(authData),
+	}, nil
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// verifyClientData - the browser signs the challenge only for the origin of the page,
+// so a phishing site can't get a valid response
+func (rp *RelyingParty) verifyClientData(session *Session, response *Response, ceremony string) error {
+	if response.Type != credentialType || len(response.RawID) == 0 {
+		return verificationError("invalid credential")
+	}
+
+	var data clientData
+	if err := json.Unmarshal(response.Response.ClientDataJSON, &data); err != nil {
+		return verificationError("invalid client data")
+	}
+
+	challenge, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(data.Challenge, "="))
+	if err != nil || subtle.ConstantTimeCompare(challenge, session.Challenge) != 1 {
+		return verificationError("challenge doesn't match")
+	}
+
+	if data.Type != ceremony {
+		return verificationError("wrong ceremony type")
+	}
+
+	if data.Origin != rp.origin || data.CrossOrigin {
+		return verificationError(fmt.Sprintf("unexpected origin '%s'", data.Origin))
+	}
+
+	return nil
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(session *Session, authData *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.id))
+	if !bytes.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return verificationError("RP ID doesn't match")
+	}
+
+	if !authData.hasFlag(flagUserPresent) {
+		return verificationError("user is not present")
+	}
+
+	if session.UserVerification == UserVerificationRequired && !authData.hasFlag(flagUserVerified) {
+		return verificationError("user is not verified")
+	}
+
+	return nil
+}
+
+func verificationError(reason string) error {
+	return fmt.Errorf("%w: %s", ErrVerificationFailed, reason)
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	result := make([]CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, CredentialDescriptor{Type: credentialType, ID: id})
+	}
+
+	return result
+}
+
+func containsID(ids [][]byte, id []byte) bool {
+	for _, candidate := range ids {
+		if bytes.Equal(candidate, id) {
+			return true
+		}
+	}
+
+	return false
+}
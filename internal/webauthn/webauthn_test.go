@@ -0,0 +1,298 @@
+package webauthn
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafviktor/keep-my-secret/internal/config"
+	"github.com/grafviktor/keep-my-secret/internal/webauthn/webauthntest"
+)
+
+const testOrigin = "https://kms.example.com"
+
+func newTestRelyingParty(t *testing.T) *RelyingParty {
+	t.Helper()
+
+	rp, err := New(config.AppConfig{WebAuthnRPID: "kms.example.com", WebAuthnRPName: "Keep My Secret"})
+	require.NoError(t, err)
+
+	return rp
+}
+
+// ceremony - passes the options to the authenticator and decodes its response
+func ceremony(t *testing.T, options any, authenticate func([]byte) ([]byte, error)) *Response {
+	t.Helper()
+
+	optionsJSON, err := json.Marshal(options)
+	require.NoError(t, err)
+
+	responseJSON, err := authenticate(optionsJSON)
+	require.NoError(t, err)
+
+	var response Response
+	require.NoError(t, json.Unmarshal(responseJSON, &response))
+
+	return &response
+}
+
+func register(t *testing.T, rp *RelyingParty, authenticator *webauthntest.Authenticator) *Credential {
+	t.Helper()
+
+	options, session, err := rp.BeginRegistration("jane.doe@example.com", []byte("user handle"), nil)
+	require.NoError(t, err)
+
+	credential, err := rp.FinishRegistration(session, ceremony(t, options, authenticator.Create))
+	require.NoError(t, err)
+
+	return credential
+}
+
+func login(rp *RelyingParty, credential *Credential, response *Response, session *Session) (*Assertion, error) {
+	assertion, err := rp.FinishLogin(session, credential, response)
+	if err == nil {
+		credential.SignCount = assertion.SignCount
+	}
+
+	return assertion, err
+}
+
+func TestRegistrationAndLogin(t *testing.T) {
+	for _, algorithm := range []int{webauthntest.AlgorithmES256, webauthntest.AlgorithmEdDSA} {
+		rp := newTestRelyingParty(t)
+		authenticator := webauthntest.New(testOrigin)
+		authenticator.Algorithm = algorithm
+
+		credential := register(t, rp, authenticator)
+		require.Equal(t, []byte("user handle"), credential.UserHandle)
+		// PRF is evaluated only during authentication
+		require.Nil(t, credential.PRF)
+
+		var prf []byte
+		for i := 0; i < 2; i++ {
+			// The first time the credential is allowed explicitly, then it is discovered by the authenticator
+			allowed := [][]byte{credential.ID}
+			if i > 0 {
+				allowed = nil
+			}
+
+			options, session, err := rp.BeginLogin("", allowed, UserVerificationRequired)
+			require.NoError(t, err)
+
+			assertion, err := login(rp, credential, ceremony(t, options, authenticator.Get), session)
+			require.NoError(t, err)
+			require.True(t, assertion.UserVerified)
+			require.EqualValues(t, i+1, assertion.SignCount)
+			require.Len(t, assertion.PRF, 32)
+
+			// PRF output doesn't change, so it can be used as a key
+			if prf != nil {
+				require.Equal(t, prf, assertion.PRF)
+			}
+
+			prf = assertion.PRF
+		}
+
+		// Without user verification the authenticator returns another output, which is ignored
+		options, session, err := rp.BeginLogin("", nil, UserVerificationDiscouraged)
+		require.NoError(t, err)
+
+		assertion, err := login(rp, credential, ceremony(t, options, authenticator.Get), session)
+		require.NoError(t, err)
+		require.False(t, assertion.UserVerified)
+		require.Nil(t, assertion.PRF)
+	}
+}
+
+func TestRegistrationExcludesExistingCredentials(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := webauthntest.New(testOrigin)
+	credential := register(t, rp, authenticator)
+
+	options, _, err := rp.BeginRegistration("jane.doe@example.com", credential.UserHandle, [][]byte{credential.ID})
+	require.NoError(t, err)
+
+	optionsJSON, err := json.Marshal(options)
+	require.NoError(t, err)
+
+	_, err = authenticator.Create(optionsJSON)
+	require.ErrorIs(t, err, webauthntest.ErrExcluded)
+}
+
+func TestFinishRegistrationRejectsInvalidResponse(t *testing.T) {
+	rp := newTestRelyingParty(t)
+
+	t.Run("Another origin", func(t *testing.T) {
+		options, session, err := rp.BeginRegistration("jane.doe@example.com", []byte("user handle"), nil)
+		require.NoError(t, err)
+
+		// The subdomain may use the RP ID, but the server doesn't trust it
+		authenticator := webauthntest.New("https://evil.kms.example.com")
+		_, err = rp.FinishRegistration(session, ceremony(t, options, authenticator.Create))
+		require.ErrorIs(t, err, ErrVerificationFailed)
+	})
+
+	t.Run("Challenge of another session", func(t *testing.T) {
+		options, _, err := rp.BeginRegistration("jane.doe@example.com", []byte("user handle"), nil)
+		require.NoError(t, err)
+
+		_, session, err := rp.BeginRegistration("jane.doe@example.com", []byte("user handle"), nil)
+		require.NoError(t, err)
+
+		authenticator := webauthntest.New(testOrigin)
+		_, err = rp.FinishRegistration(session, ceremony(t, options, authenticator.Create))
+		require.ErrorIs(t, err, ErrVerificationFailed)
+	})
+
+	t.Run("Attestation object is damaged", func(t *testing.T) {
+		options, session, err := rp.BeginRegistration("jane.doe@example.com", []byte("user handle"), nil)
+		require.NoError(t, err)
+
+		response := ceremony(t, options, webauthntest.New(testOrigin).Create)
+		response.Response.AttestationObject = response.Response.AttestationObject[:40]
+		_, err = rp.FinishRegistration(session, response)
+		require.ErrorIs(t, err, ErrVerificationFailed)
+	})
+}
+
+func TestFinishLoginRejectsInvalidResponse(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := webauthntest.New(testOrigin)
+	credential := register(t, rp, authenticator)
+
+	t.Run("User is not verified", func(t *testing.T) {
+		authenticator.UserVerification = false
+		defer func() { authenticator.UserVerification = true }()
+
+		options, session, err := rp.BeginLogin("", nil, UserVerificationRequired)
+		require.NoError(t, err)
+
+		_, err = login(rp, credential, ceremony(t, options, authenticator.Get), session)
+		require.ErrorIs(t, err, ErrVerificationFailed)
+	})
+
+	t.Run("Signature doesn't match", func(t *testing.T) {
+		options, session, err := rp.BeginLogin("", [][]byte{credential.ID}, UserVerificationDiscouraged)
+		require.NoError(t, err)
+
+		response := ceremony(t, options, authenticator.Get)
+		response.Response.AuthenticatorData[len(response.Response.AuthenticatorData)-1]++
+		_, err = login(rp, credential, response, session)
+		require.ErrorIs(t, err, ErrVerificationFailed)
+	})
+
+	t.Run("Credential of another user", func(t *testing.T) {
+		options, session, err := rp.BeginLogin("", nil, UserVerificationRequired)
+		require.NoError(t, err)
+
+		response := ceremony(t, options, authenticator.Get)
+		response.Response.UserHandle = []byte("another user")
+		_, err = login(rp, credential, response, session)
+		require.ErrorIs(t, err, ErrVerificationFailed)
+	})
+
+	t.Run("Credential is not allowed", func(t *testing.T) {
+		options, _, err := rp.BeginLogin("", nil, UserVerificationRequired)
+		require.NoError(t, err)
+
+		_, session, err := rp.BeginLogin("", [][]byte{[]byte("another credential")}, UserVerificationRequired)
+		require.NoError(t, err)
+
+		session.Challenge = options.Challenge
+		_, err = login(rp, credential, ceremony(t, options, authenticator.Get), session)
+		require.ErrorIs(t, err, ErrVerificationFailed)
+	})
+}
+
+func TestFinishLoginDetectsClonedAuthenticator(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := webauthntest.New(testOrigin)
+	credential := register(t, rp, authenticator)
+	clone := authenticator.Clone()
+
+	options, session, err := rp.BeginLogin("", nil, UserVerificationRequired)
+	require.NoError(t, err)
+
+	_, err = login(rp, credential, ceremony(t, options, authenticator.Get), session)
+	require.NoError(t, err)
+
+	// The clone has the same counter, which is not greater than the stored one anymore
+	options, session, err = rp.BeginLogin("", nil, UserVerificationRequired)
+	require.NoError(t, err)
+
+	_, err = login(rp, credential, ceremony(t, options, clone.Get), session)
+	require.ErrorIs(t, err, ErrClonedAuthenticator)
+
+	// Synced passkeys don't count signatures at all
+	passkey := webauthntest.New(testOrigin)
+	passkey.StaticSignCount = true
+	credential = register(t, rp, passkey)
+
+	for i := 0; i < 2; i++ {
+		options, session, err = rp.BeginLogin("", nil, UserVerificationRequired)
+		require.NoError(t, err)
+
+		_, err = login(rp, credential, ceremony(t, options, passkey.Get), session)
+		require.NoError(t, err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(config.AppConfig{})
+	require.ErrorIs(t, err, ErrNotConfigured)
+
+	for _, origin := range []string{"https://example.com", "http://kms.example.com", "https://kms.example.com/app"} {
+		_, err = New(config.AppConfig{WebAuthnRPID: "kms.example.com", WebAuthnOrigin: origin})
+		require.Error(t, err, origin)
+	}
+
+	_, err = New(config.AppConfig{WebAuthnRPID: "example.com", WebAuthnOrigin: "https://kms.example.com"})
+	require.NoError(t, err)
+
+	_, err = New(config.AppConfig{WebAuthnRPID: "localhost", WebAuthnOrigin: "http://localhost:8080"})
+	require.NoError(t, err)
+}
+
+func TestSessionStore(t *testing.T) {
+	store := NewSessionStore()
+
+	session, err := newSession(time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, store.Save(session))
+
+	taken, ok := store.Take(session.ID)
+	require.True(t, ok)
+	require.Equal(t, session, taken)
+
+	// A response cannot be replayed
+	_, ok = store.Take(session.ID)
+	require.False(t, ok)
+
+	expired, err := newSession(-time.Second)
+	require.NoError(t, err)
+	require.NoError(t, store.Save(expired))
+
+	_, ok = store.Take(expired.ID)
+	require.False(t, ok)
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	item, rest, err := decodeCBOR([]byte{0xa2, 0x01, 0x02, 0x20, 0x43, 0x01, 0x02, 0x03, 0xff})
+	require.NoError(t, err)
+	require.Equal(t, map[any]any{int64(1): int64(2), int64(-1): []byte{1, 2, 3}}, item)
+	require.Equal(t, []byte{0xff}, rest)
+
+	for name, data := range map[string][]byte{
+		"Truncated byte string":  {0x5a, 0xff, 0xff, 0xff, 0xff, 0x01},
+		"Huge array":             {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"Duplicate key":          {0xa2, 0x01, 0x02, 0x01, 0x03},
+		"Indefinite length":      {0x5f, 0x41, 0x01, 0xff},
+		"Too deep":               {0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x00},
+		"Floating point numbers": {0xf9, 0x3c, 0x00},
+	} {
+		_, _, err = decodeCBOR(data)
+		require.Error(t, err, name)
+	}
+}
@@ -0,0 +1,416 @@
+// Package webauthntest - a software authenticator for tests. It plays the role of both the browser and
+// the authenticator: takes options of the relying party in JSON and returns PublicKeyCredential in JSON,
+// the same way as PublicKeyCredential.parseCreationOptionsFromJSON and PublicKeyCredential.toJSON do.
+package webauthntest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// COSE algorithms which the authenticator supports
+const (
+	AlgorithmES256 = -7
+	AlgorithmEdDSA = -8
+)
+
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+)
+
+var (
+	ErrNoCredentials = errors.New("authenticator has no matching credentials")
+	ErrExcluded      = errors.New("authenticator is already registered")
+)
+
+// credential - a discoverable credential which is kept in the authenticator
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	algorithm  int
+	ecKey      *ecdsa.PrivateKey
+	edKey      ed25519.PrivateKey
+	signCount  uint32
+	// secrets - keys of PRF extension, which are unique for every credential. Like hmac-secret
+	// of CTAP2, the authenticator uses a different key when it doesn't verify the user.
+	secretWithUV    []byte
+	secretWithoutUV []byte
+}
+
+// Authenticator - creates credentials and signs challenges for the origin
+type Authenticator struct {
+	Origin string
+	// UserVerification - whether the authenticator verifies the user, for instance with PIN or biometrics
+	UserVerification bool
+	// PRF - whether the authenticator supports PRF extension
+	PRF bool
+	// PRFOnCreate - whether PRF is evaluated when a credential is created. Many authenticators
+	// evaluate it only during authentication.
+	PRFOnCreate bool
+	// StaticSignCount - the signature counter stays zero, like in synced passkeys
+	StaticSignCount bool
+	// Algorithm - algorithm of new credentials
+	Algorithm int
+
+	credentials []*credential
+}
+
+// New - creates an authenticator which verifies users and supports PRF extension
+func New(origin string) *Authenticator {
+	return &Authenticator{
+		Origin:           origin,
+		UserVerification: true,
+		PRF:              true,
+		Algorithm:        AlgorithmES256,
+	}
+}
+
+// Clone - returns a copy of the authenticator with the same credentials and signature counters,
+// as if the keys were extracted from it
+func (a *Authenticator) Clone() *Authenticator {
+	clone := *a
+	clone.credentials = make([]*credential, 0, len(a.credentials))
+	for _, c := range a.credentials {
+		copied := *c
+		clone.credentials = append(clone.credentials, &copied)
+	}
+
+	return &clone
+}
+
+type descriptor struct {
+	ID string `json:"id"`
+}
+
+type extensions struct {
+	PRF *struct {
+		Eval *struct {
+			First string `json:"first"`
+		} `json:"eval"`
+	} `json:"prf"`
+}
+
+// prfSalt - input of PRF extension, empty if it's not requested
+func (e extensions) prfSalt() string {
+	if e.PRF == nil || e.PRF.Eval == nil {
+		return ""
+	}
+
+	return e.PRF.Eval.First
+}
+
+type creationOptions struct {
+	RP struct {
+		ID string `json:"id"`
+	} `json:"rp"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Challenge        string `json:"challenge"`
+	PubKeyCredParams []struct {
+		Algorithm int `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	ExcludeCredentials     []descriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Extensions extensions `json:"extensions"`
+}
+
+type requestOptions struct {
+	Challenge        string       `json:"challenge"`
+	RPID             string       `json:"rpId"`
+	AllowCredentials []descriptor `json:"allowCredentials"`
+	UserVerification string       `json:"userVerification"`
+	Extensions       extensions   `json:"extensions"`
+}
+
+// Create - creates a new credential, like navigator.credentials.create()
+func (a *Authenticator) Create(optionsJSON []byte) ([]byte, error) {
+	var options creationOptions
+	if err := json.Unmarshal(optionsJSON, &options); err != nil {
+		return nil, err
+	}
+
+	if err := a.checkRPID(options.RP.ID); err != nil {
+		return nil, err
+	}
+
+	for _, excluded := range options.ExcludeCredentials {
+		if a.find(options.RP.ID, []descriptor{excluded}) != nil {
+			return nil, ErrExcluded
+		}
+	}
+
+	supported := false
+	for _, param := range options.PubKeyCredParams {
+		supported = supported || param.Algorithm == a.Algorithm
+	}
+
+	if !supported {
+		return nil, errors.New("algorithm is not supported by the relying party")
+	}
+
+	userHandle, err := decode(options.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &credential{
+		id:              randomBytes(16),
+		rpID:            options.RP.ID,
+		userHandle:      userHandle,
+		algorithm:       a.Algorithm,
+		secretWithUV:    randomBytes(32),
+		secretWithoutUV: randomBytes(32),
+	}
+
+	if c.algorithm == AlgorithmEdDSA {
+		_, c.edKey, err = ed25519.GenerateKey(rand.Reader)
+	} else {
+		c.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	authData := a.authenticatorData(c, options.AuthenticatorSelection.UserVerification, flagAttestedCredentialData)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(c.id)))
+	authData = append(authData, c.id...)
+	authData = append(authData, c.publicKey()...)
+
+	attestationObject := encodeCBOR(cborMap{
+		{"fmt", "none"},
+		{"attStmt", cborMap{}},
+		{"authData", authData},
+	})
+
+	clientData, err := a.clientData("webauthn.create", options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	a.credentials = append(a.credentials, c)
+
+	prf := map[string]any{"enabled": a.PRF}
+	if salt := options.Extensions.prfSalt(); a.PRF && a.PRFOnCreate && salt != "" {
+		if prf["results"], err = c.prf(salt, userVerified(authData)); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(map[string]any{
+		"id":    encode(c.id),
+		"rawId": encode(c.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    encode(clientData),
+			"attestationObject": encode(attestationObject),
+		},
+		"clientExtensionResults": map[string]any{"prf": prf},
+	})
+}
+
+// Get - signs the challenge with one of the allowed credentials, or with any credential of the relying
+// party if the list is empty, like navigator.credentials.get()
+func (a *Authenticator) Get(optionsJSON []byte) ([]byte, error) {
+	var options requestOptions
+	if err := json.Unmarshal(optionsJSON, &options); err != nil {
+		return nil, err
+	}
+
+	if err := a.checkRPID(options.RPID); err != nil {
+		return nil, err
+	}
+
+	c := a.find(options.RPID, options.AllowCredentials)
+	if c == nil {
+		return nil, ErrNoCredentials
+	}
+
+	if !a.StaticSignCount {
+		c.signCount++
+	}
+
+	authData := a.authenticatorData(c, options.UserVerification, 0)
+	clientData, err := a.clientData("webauthn.get", options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientData)
+	signature, err := c.sign(append(append([]byte{}, authData...), clientDataHash[:]...))
+	if err != nil {
+		return nil, err
+	}
+
+	extensionResults := map[string]any{}
+	if salt := options.Extensions.prfSalt(); a.PRF && salt != "" {
+		var results map[string]string
+		if results, err = c.prf(salt, userVerified(authData)); err != nil {
+			return nil, err
+		}
+
+		extensionResults["prf"] = map[string]any{"results": results}
+	}
+
+	return json.Marshal(map[string]any{
+		"id":    encode(c.id),
+		"rawId": encode(c.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    encode(clientData),
+			"authenticatorData": encode(authData),
+			"signature":         encode(signature),
+			"userHandle":        encode(c.userHandle),
+		},
+		"clientExtensionResults": extensionResults,
+	})
+}
+
+// checkRPID - browsers accept RP ID only if it's the domain of the origin or its parent domain
+func (a *Authenticator) checkRPID(rpID string) error {
+	origin, err := url.Parse(a.Origin)
+	if err != nil {
+		return err
+	}
+
+	if host := origin.Hostname(); rpID == "" || (host != rpID && !strings.HasSuffix(host, "."+rpID)) {
+		return errors.New("RP ID is not valid for the origin")
+	}
+
+	return nil
+}
+
+func (a *Authenticator) find(rpID string, allowed []descriptor) *credential {
+	for _, c := range a.credentials {
+		if c.rpID != rpID {
+			continue
+		}
+
+		if len(allowed) == 0 {
+			return c
+		}
+
+		for _, d := range allowed {
+			if id, err := decode(d.ID); err == nil && bytes.Equal(id, c.id) {
+				return c
+			}
+		}
+	}
+
+	return nil
+}
+
+func (a *Authenticator) authenticatorData(c *credential, userVerification string, flags byte) []byte {
+	flags |= flagUserPresent
+	if a.UserVerification && userVerification != "discouraged" {
+		flags |= flagUserVerified
+	}
+
+	rpIDHash := sha256.Sum256([]byte(c.rpID))
+	data := append(rpIDHash[:], flags)
+
+	return binary.BigEndian.AppendUint32(data, c.signCount)
+}
+
+// userVerified - flags of the authenticator data follow the hash of the RP ID
+func userVerified(authData []byte) bool {
+	return authData[sha256.Size]&flagUserVerified != 0
+}
+
+func (a *Authenticator) clientData(ceremony, challenge string) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+}
+
+// publicKey - the public key in COSE_Key format
+func (c *credential) publicKey() []byte {
+	if c.algorithm == AlgorithmEdDSA {
+		return encodeCBOR(cborMap{
+			{1, 1},
+			{3, AlgorithmEdDSA},
+			{-1, 6},
+			{-2, []byte(c.edKey.Public().(ed25519.PublicKey))},
+		})
+	}
+
+	x, y := make([]byte, 32), make([]byte, 32)
+	c.ecKey.X.FillBytes(x)
+	c.ecKey.Y.FillBytes(y)
+
+	return encodeCBOR(cborMap{
+		{1, 2},
+		{3, AlgorithmES256},
+		{-1, 1},
+		{-2, x},
+		{-3, y},
+	})
+}
+
+func (c *credential) sign(data []byte) ([]byte, error) {
+	if c.algorithm == AlgorithmEdDSA {
+		return ed25519.Sign(c.edKey, data), nil
+	}
+
+	digest := sha256.Sum256(data)
+
+	return ecdsa.SignASN1(rand.Reader, c.ecKey, digest[:])
+}
+
+// prf - the browser hashes the salt with a context string and passes it to hmac-secret extension
+// of the authenticator, see WebAuthn Level 3, 10.1.4
+func (c *credential) prf(salt string, userVerified bool) (map[string]string, error) {
+	input, err := decode(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	hashedSalt := sha256.Sum256(append([]byte("WebAuthn PRF\x00"), input...))
+	secret := c.secretWithoutUV
+	if userVerified {
+		secret = c.secretWithUV
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(hashedSalt[:])
+
+	return map[string]string{"first": encode(mac.Sum(nil))}, nil
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+func randomBytes(n int) []byte {
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		panic(err)
+	}
+
+	return data
+}
@@ -0,0 +1,68 @@
+package webauthntest
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// cborMap - CBOR map which keeps the order of keys
+type cborMap []cborPair
+
+type cborPair struct {
+	key   any
+	value any
+}
+
+// encodeCBOR - encodes integers, byte and text strings and maps, which is enough for
+// attestation objects and COSE keys
+func encodeCBOR(value any) []byte {
+	var buf bytes.Buffer
+	writeCBOR(&buf, value)
+
+	return buf.Bytes()
+}
+
+func writeCBOR(buf *bytes.Buffer, value any) {
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			writeCBORHead(buf, 1, uint64(-1-v))
+		} else {
+			writeCBORHead(buf, 0, uint64(v))
+		}
+	case []byte:
+		writeCBORHead(buf, 2, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		writeCBORHead(buf, 3, uint64(len(v)))
+		buf.WriteString(v)
+	case cborMap:
+		writeCBORHead(buf, 5, uint64(len(v)))
+		for _, pair := range v {
+			writeCBOR(buf, pair.key)
+			writeCBOR(buf, pair.value)
+		}
+	default:
+		panic("unsupported CBOR type")
+	}
+}
+
+func writeCBORHead(buf *bytes.Buffer, major byte, value uint64) {
+	major <<= 5
+
+	switch {
+	case value < 24:
+		buf.WriteByte(major | byte(value))
+	case value <= 0xff:
+		buf.Write([]byte{major | 24, byte(value)})
+	case value <= 0xffff:
+		buf.WriteByte(major | 25)
+		_ = binary.Write(buf, binary.BigEndian, uint16(value))
+	case value <= 0xffffffff:
+		buf.WriteByte(major | 26)
+		_ = binary.Write(buf, binary.BigEndian, uint32(value))
+	default:
+		buf.WriteByte(major | 27)
+		_ = binary.Write(buf, binary.BigEndian, value)
+	}
+}
@@ -0,0 +1,47 @@
+// Package wordlist contains word lists which are embedded into the application binary
+package wordlist
+
+import (
+	"bufio"
+	_ "embed" // required for go:embed directive
+	"strings"
+	"sync"
+)
+
+// effLargeWordlist is EFF's large wordlist for passphrases, https://www.eff.org/dice
+// The list is distributed under Creative Commons Attribution 3.0 License.
+// Every line contains five dice rolls and a word separated by a tab.
+//
+//go:embed eff_large_wordlist.txt
+var effLargeWordlist string
+
+var (
+	diceware     []string
+	dicewareOnce sync.Once
+)
+
+// Diceware - returns 7776 words of EFF's large wordlist. The returned slice must not be modified.
+func Diceware() []string {
+	dicewareOnce.Do(func() {
+		diceware = parse(effLargeWordlist)
+	})
+
+	return diceware
+}
+
+// parse - returns the last tab-separated column of every non-empty line
+func parse(list string) []string {
+	words := make([]string, 0)
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		words = append(words, fields[len(fields)-1])
+	}
+
+	return words
+}
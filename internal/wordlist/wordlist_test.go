@@ -0,0 +1,20 @@
+package wordlist
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiceware(t *testing.T) {
+	words := Diceware()
+	require.Len(t, words, 7776)
+	require.Equal(t, "abacus", words[0])
+	require.Equal(t, "zoom", words[len(words)-1])
+
+	unique := make(map[string]struct{}, len(words))
+	for _, word := range words {
+		unique[word] = struct{}{}
+	}
+	require.Len(t, unique, len(words))
+}